@@ -1,10 +1,13 @@
 package client
 
 import (
+	"fmt"
+
 	"github.com/oiweiwei/gokrb5.fork/v9/crypto"
 	"github.com/oiweiwei/gokrb5.fork/v9/crypto/etype"
 	"github.com/oiweiwei/gokrb5.fork/v9/iana/errorcode"
 	"github.com/oiweiwei/gokrb5.fork/v9/iana/keyusage"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/nametype"
 	"github.com/oiweiwei/gokrb5.fork/v9/iana/patype"
 	"github.com/oiweiwei/gokrb5.fork/v9/krberror"
 	"github.com/oiweiwei/gokrb5.fork/v9/messages"
@@ -16,6 +19,9 @@ func (cl *Client) ASExchange(realm string, ASReq messages.ASReq, referral int) (
 	if ok, err := cl.IsConfigured(); !ok {
 		return messages.ASRep{}, krberror.Errorf(err, krberror.ConfigError, "AS Exchange cannot be performed")
 	}
+	if cl.settings.FASTArmor() != nil {
+		return cl.armoredASExchange(realm, ASReq, referral)
+	}
 
 	// Set PAData if required
 	err := setPAData(cl, nil, &ASReq)
@@ -29,7 +35,7 @@ func (cl *Client) ASExchange(realm string, ASReq messages.ASReq, referral int) (
 	}
 	var ASRep messages.ASRep
 
-	rb, err := cl.sendToKDC(b, realm)
+	rb, err := cl.sendASReq(b, realm, nil)
 	if err != nil {
 		if e, ok := err.(messages.KRBError); ok {
 			switch e.ErrorCode {
@@ -44,7 +50,7 @@ func (cl *Client) ASExchange(realm string, ASReq messages.ASReq, referral int) (
 				if err != nil {
 					return messages.ASRep{}, krberror.Errorf(err, krberror.EncodingError, "AS Exchange Error: failed marshaling AS_REQ with PAData")
 				}
-				rb, err = cl.sendToKDC(b, realm)
+				rb, err = cl.sendASReq(b, realm, nil)
 				if err != nil {
 					if _, ok := err.(messages.KRBError); ok {
 						return messages.ASRep{}, krberror.Errorf(err, krberror.KDCError, "AS Exchange Error: kerberos error response from KDC")
@@ -57,6 +63,10 @@ func (cl *Client) ASExchange(realm string, ASReq messages.ASReq, referral int) (
 					return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "maximum number of client referrals exceeded")
 				}
 				referral++
+				ASReq, err = referralASReq(ASReq, realm, e.CRealm)
+				if err != nil {
+					return messages.ASRep{}, err
+				}
 				return cl.ASExchange(e.CRealm, ASReq, referral)
 			default:
 				return messages.ASRep{}, krberror.Errorf(err, krberror.KDCError, "AS Exchange Error: kerberos error response from KDC")
@@ -75,51 +85,203 @@ func (cl *Client) ASExchange(realm string, ASReq messages.ASReq, referral int) (
 	return ASRep, nil
 }
 
-// setPAData adds pre-authentication data to the AS_REQ.
-func setPAData(cl *Client, krberr *messages.KRBError, ASReq *messages.ASReq) error {
-	if !cl.settings.DisablePAFXFAST() {
-		pa := types.PAData{PADataType: patype.PA_REQ_ENC_PA_REP}
-		ASReq.PAData = append(ASReq.PAData, pa)
+// armoredASExchange performs an AS exchange protected with FAST (RFC 6113) using the TGT of the armor client in the
+// settings. Pre-authentication is by one-time password, SPAKE or encrypted challenge as offered by the KDC.
+func (cl *Client) armoredASExchange(realm string, ASReq messages.ASReq, referral int) (messages.ASRep, error) {
+	armor, err := cl.fastArmor(realm)
+	if err != nil {
+		return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: could not create FAST armor")
 	}
+	var key types.EncryptionKey
+	var pas types.PADataSequence
 	if cl.settings.AssumePreAuthentication() {
-		// Identify the etype to use to encrypt the PA Data
-		var et etype.EType
-		var err error
-		var key types.EncryptionKey
-		var kvno int
-		if krberr == nil {
-			// This is not in response to an error from the KDC. It is preemptive or renewal
-			// There is no KRB Error that tells us the etype to use
-			etn := cl.settings.preAuthEType // Use the etype that may have previously been negotiated
-			if etn == 0 {
-				etn = int32(cl.Config.LibDefaults.PreferredPreauthTypes[0]) // Resort to config
-			}
-			et, err = crypto.GetEtype(etn)
+		key, pas, err = encryptedChallenge(cl, armor, nil, &ASReq)
+		if err != nil {
+			return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: issue with setting PAData on AS_REQ")
+		}
+	}
+	kdcChallenge := len(pas) > 0
+	armored, rb, err := cl.sendArmoredASReq(armor, ASReq, pas, realm)
+	if err != nil {
+		e, ok := err.(messages.KRBError)
+		if !ok {
+			return messages.ASRep{}, err
+		}
+		switch e.ErrorCode {
+		case errorcode.KDC_ERR_PREAUTH_REQUIRED, errorcode.KDC_ERR_PREAUTH_FAILED:
+			// From now on assume this client will need to do this pre-auth and set the PAData
+			cl.settings.assumePreAuthentication = true
+			armored, rb, key, kdcChallenge, err = cl.armoredPreAuth(armor, &e, ASReq, realm)
 			if err != nil {
-				return krberror.Errorf(err, krberror.EncryptingError, "error getting etype for pre-auth encryption")
+				return messages.ASRep{}, err
 			}
-			key, kvno, err = cl.Key(et, 0, nil)
-			if err != nil {
-				return krberror.Errorf(err, krberror.EncryptingError, "error getting key from credentials")
+		case errorcode.KDC_ERR_WRONG_REALM:
+			// Client referral https://tools.ietf.org/html/rfc6806.html#section-7
+			if referral > 5 {
+				return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "maximum number of client referrals exceeded")
 			}
-		} else {
-			// Get the etype to use from the PA data in the KRBError e-data
-			et, err = preAuthEType(krberr)
+			referral++
+			ASReq, err = referralASReq(ASReq, realm, e.CRealm)
 			if err != nil {
-				return krberror.Errorf(err, krberror.EncryptingError, "error getting etype for pre-auth encryption")
+				return messages.ASRep{}, err
 			}
-			cl.settings.preAuthEType = et.GetETypeID() // Set the etype that has been defined for potential future use
-			key, kvno, err = cl.Key(et, 0, krberr)
-			if err != nil {
-				return krberror.Errorf(err, krberror.EncryptingError, "error getting key from credentials")
+			return cl.ASExchange(e.CRealm, ASReq, referral)
+		default:
+			return messages.ASRep{}, krberror.Errorf(err, krberror.KDCError, "AS Exchange Error: kerberos error response from KDC")
+		}
+	}
+	var ASRep messages.ASRep
+	err = ASRep.Unmarshal(rb)
+	if err != nil {
+		return messages.ASRep{}, krberror.Errorf(err, krberror.EncodingError, "AS Exchange Error: failed to process the AS_REP")
+	}
+	if key.KeyType == 0 {
+		// The KDC did not require pre-authentication so the reply key is the client's key of the etype in the reply
+		et, err := cl.Config.EtypeRegistry().GetEtype(ASRep.EncPart.EType)
+		if err != nil {
+			return messages.ASRep{}, krberror.Errorf(err, krberror.DecryptingError, "AS Exchange Error: AS_REP encrypted part etype not supported")
+		}
+		key, _, err = cl.Key(et, 0, nil)
+		if err != nil {
+			return messages.ASRep{}, krberror.Errorf(err, krberror.DecryptingError, "AS Exchange Error: error getting key from credentials")
+		}
+	}
+	if ok, err := ASRep.VerifyArmored(cl.Config, armor, key, armored); !ok {
+		return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: AS_REP is not valid or client password/keytab incorrect")
+	}
+	if kdcChallenge {
+		if err := armor.VerifyKDCChallenge(ASRep.PAData, key, cl.Config.LibDefaults.Clockskew); err != nil {
+			return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: KDC challenge is not valid")
+		}
+	}
+	return ASRep, nil
+}
+
+// armoredPreAuth answers the KDC's request for pre-authentication in an armored AS exchange. A one-time password
+// (RFC 6560) is used if the KDC asks for one and the settings have a prompter, otherwise SPAKE if offered by the KDC,
+// otherwise encrypted challenge.
+// The armored AS_REQ sent, the KDC's reply, the reply key and whether the reply must carry a KDC challenge are returned.
+func (cl *Client) armoredPreAuth(armor messages.FASTArmor, krberr *messages.KRBError, ASReq messages.ASReq, realm string) (messages.ASReq, []byte, types.EncryptionKey, bool, error) {
+	var md types.PADataSequence
+	if err := md.Unmarshal(krberr.EData); err != nil {
+		return ASReq, nil, types.EncryptionKey{}, false, krberror.Errorf(err, krberror.EncodingError, "AS Exchange Error: error unmashalling KRBError data")
+	}
+	p := cl.settings.PreAuthPrompter()
+	switch {
+	case p != nil && md.Contains(patype.PA_OTP_CHALLENGE):
+		pas, err := otpRequest(armor, md, p)
+		if err != nil {
+			return ASReq, nil, types.EncryptionKey{}, false, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: failed setting AS_REQ PAData for one-time password")
+		}
+		armored, rb, err := cl.sendArmoredASReq(armor, ASReq, pas, realm)
+		// The reply key of OTP pre-authentication is the armor key
+		return armored, rb, armor.Key, false, err
+	case md.Contains(patype.PA_SPAKE):
+		armored, rb, key, err := cl.spakePreAuth(armor, krberr, md, ASReq, realm)
+		return armored, rb, key, false, err
+	}
+	key, pas, err := encryptedChallenge(cl, armor, krberr, &ASReq)
+	if err != nil {
+		return ASReq, nil, key, false, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: failed setting AS_REQ PAData for pre-authentication required")
+	}
+	armored, rb, err := cl.sendArmoredASReq(armor, ASReq, pas, realm)
+	return armored, rb, key, true, err
+}
+
+// fastArmor creates FAST armor for a request to the KDC of the realm from the armor client's TGT for the realm.
+func (cl *Client) fastArmor(realm string) (messages.FASTArmor, error) {
+	armor := cl.settings.FASTArmor()
+	tgt, sessionKey, err := armor.sessionTGT(realm)
+	if err != nil {
+		return messages.FASTArmor{}, fmt.Errorf("could not get armor TGT for realm %s: %v", realm, err)
+	}
+	return messages.NewFASTArmor(cl.Config.EtypeRegistry(), tgt, sessionKey, armor.Credentials.CName(), armor.cRealm())
+}
+
+// sendArmoredASReq armors the AS_REQ with the pre-authentication data provided and sends it to the KDC of the realm.
+// The armored AS_REQ is returned with the KDC's reply.
+// A KRBError returned by the KDC is the error carried in the FAST response.
+func (cl *Client) sendArmoredASReq(armor messages.FASTArmor, ASReq messages.ASReq, pas types.PADataSequence, realm string) (messages.ASReq, []byte, error) {
+	if err := armor.ArmorASReq(&ASReq, pas); err != nil {
+		return ASReq, nil, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: failed armoring AS_REQ")
+	}
+	b, err := ASReq.Marshal()
+	if err != nil {
+		return ASReq, nil, krberror.Errorf(err, krberror.EncodingError, "AS Exchange Error: failed marshaling AS_REQ")
+	}
+	rb, err := cl.sendASReq(b, realm, armor.Error)
+	if err != nil {
+		if e, ok := err.(messages.KRBError); ok {
+			fe, ferr := armor.Error(e)
+			if ferr != nil {
+				return ASReq, nil, krberror.Errorf(err, krberror.KDCError, "AS Exchange Error: kerberos error response from KDC not protected by FAST: %v", ferr)
 			}
+			return ASReq, nil, fe
+		}
+		return ASReq, nil, krberror.Errorf(err, krberror.NetworkingError, "AS Exchange Error: failed sending AS_REQ to KDC")
+	}
+	return ASReq, rb, nil
+}
+
+// encryptedChallenge returns the pre-authentication data to send in the armored AS_REQ: the PA-ENCRYPTED-CHALLENGE
+// and any PA-FX-COOKIE from the KDC's error. The reply key the challenge is made with is also returned.
+func encryptedChallenge(cl *Client, armor messages.FASTArmor, krberr *messages.KRBError, ASReq *messages.ASReq) (types.EncryptionKey, types.PADataSequence, error) {
+	var pas types.PADataSequence
+	if krberr != nil {
+		var md types.PADataSequence
+		if err := md.Unmarshal(krberr.EData); err != nil {
+			return types.EncryptionKey{}, pas, krberror.Errorf(err, krberror.EncodingError, "error unmashalling KRBError data")
+		}
+		if !md.Contains(patype.PA_ENCRYPTED_CHALLENGE) {
+			return types.EncryptionKey{}, pas, krberror.New(krberror.KRBMsgError, "KDC does not offer encrypted challenge pre-authentication")
+		}
+		pas = fxCookie(md)
+	}
+	key, _, err := preAuthKey(cl, krberr, ASReq)
+	if err != nil {
+		return key, pas, err
+	}
+	pa, err := armor.EncryptedChallenge(key)
+	if err != nil {
+		return key, pas, err
+	}
+	return key, append(pas, pa), nil
+}
+
+// referralASReq returns the AS_REQ to send to the realm the client has been referred to by the KDC of the realm
+// (RFC 6806 section 7). A TGT is requested from the referred realm and pre-authentication data is regenerated.
+func referralASReq(ASReq messages.ASReq, realm, referredRealm string) (messages.ASReq, error) {
+	if referredRealm == "" || referredRealm == realm {
+		return ASReq, krberror.NewErrorf(krberror.KRBMsgError, "AS Exchange Error: KDC of realm %s returned an invalid client referral to %q", realm, referredRealm)
+	}
+	ASReq.ReqBody.Realm = referredRealm
+	if len(ASReq.ReqBody.SName.NameString) > 0 && ASReq.ReqBody.SName.NameString[0] == "krbtgt" {
+		ASReq.ReqBody.SName = types.PrincipalName{
+			NameType:   nametype.KRB_NT_SRV_INST,
+			NameString: []string{"krbtgt", referredRealm},
+		}
+	}
+	ASReq.PAData = types.PADataSequence{}
+	return ASReq, nil
+}
+
+// setPAData adds pre-authentication data to the AS_REQ.
+func setPAData(cl *Client, krberr *messages.KRBError, ASReq *messages.ASReq) error {
+	if !cl.settings.DisablePAFXFAST() {
+		pa := types.PAData{PADataType: patype.PA_REQ_ENC_PA_REP}
+		ASReq.PAData = append(ASReq.PAData, pa)
+	}
+	if cl.settings.AssumePreAuthentication() {
+		key, kvno, err := preAuthKey(cl, krberr, ASReq)
+		if err != nil {
+			return err
 		}
 		// Generate the PA data
 		paTSb, err := types.GetPAEncTSEncAsnMarshalled()
 		if err != nil {
 			return krberror.Errorf(err, krberror.KRBMsgError, "error creating PAEncTSEnc for Pre-Authentication")
 		}
-		paEncTS, err := crypto.GetEncryptedData(paTSb, key, keyusage.AS_REQ_PA_ENC_TIMESTAMP, kvno)
+		paEncTS, err := cl.Config.EtypeRegistry().GetEncryptedData(paTSb, key, keyusage.AS_REQ_PA_ENC_TIMESTAMP, kvno)
 		if err != nil {
 			return krberror.Errorf(err, krberror.EncryptingError, "error encrypting pre-authentication timestamp")
 		}
@@ -143,8 +305,50 @@ func setPAData(cl *Client, krberr *messages.KRBError, ASReq *messages.ASReq) err
 	return nil
 }
 
+// preAuthKey returns the client's key, and its version number, with which pre-authentication data is encrypted.
+// The etype is that negotiated with the KDC in the KRBError, if provided, otherwise that previously used or configured.
+func preAuthKey(cl *Client, krberr *messages.KRBError, ASReq *messages.ASReq) (types.EncryptionKey, int, error) {
+	// Identify the etype to use to encrypt the PA Data
+	var et etype.EType
+	var err error
+	var key types.EncryptionKey
+	var kvno int
+	if krberr == nil {
+		// This is not in response to an error from the KDC. It is preemptive or renewal
+		// There is no KRB Error that tells us the etype to use
+		etn := cl.settings.preAuthEType // Use the etype that may have previously been negotiated
+		if etn == 0 {
+			etn = int32(cl.Config.LibDefaults.PreferredPreauthTypes[0]) // Resort to config
+		}
+		et, err = cl.Config.EtypeRegistry().GetEtype(etn)
+		if err != nil {
+			return key, kvno, krberror.Errorf(err, krberror.EncryptingError, "error getting etype for pre-auth encryption")
+		}
+		key, kvno, err = cl.Key(et, 0, nil)
+		if err != nil {
+			return key, kvno, krberror.Errorf(err, krberror.EncryptingError, "error getting key from credentials")
+		}
+	} else {
+		// Get the etype to use from the PA data in the KRBError e-data
+		et, err = preAuthEType(cl.Config.EtypeRegistry(), krberr)
+		if err != nil {
+			return key, kvno, krberror.Errorf(err, krberror.EncryptingError, "error getting etype for pre-auth encryption")
+		}
+		cl.settings.preAuthEType = et.GetETypeID() // Set the etype that has been defined for potential future use
+		key, kvno, err = cl.Key(et, 0, krberr)
+		if err != nil {
+			return key, kvno, krberror.Errorf(err, krberror.EncryptingError, "error getting key from credentials")
+		}
+	}
+	if !cl.Config.EtypePermitted(et.GetETypeID()) {
+		return key, kvno, messages.NewKRBError(ASReq.ReqBody.SName, ASReq.ReqBody.Realm, errorcode.KDC_ERR_ETYPE_NOSUPP, fmt.Sprintf("pre-authentication etype %d is not permitted", et.GetETypeID()))
+	}
+	return key, kvno, nil
+}
+
 // preAuthEType establishes what encryption type to use for pre-authentication from the KRBError returned from the KDC.
-func preAuthEType(krberr *messages.KRBError) (etype etype.EType, err error) {
+// The encryption type is looked up in the registry provided.
+func preAuthEType(r *crypto.Registry, krberr *messages.KRBError) (etype etype.EType, err error) {
 	//RFC 4120 5.2.7.5 covers the preference order of ETYPE-INFO2 and ETYPE-INFO.
 	var etypeID int32
 	var pas types.PADataSequence
@@ -173,7 +377,7 @@ Loop:
 			etypeID = info[0].EType
 		}
 	}
-	etype, e = crypto.GetEtype(etypeID)
+	etype, e = r.GetEtype(etypeID)
 	if e != nil {
 		err = krberror.Errorf(e, krberror.EncryptingError, "error creating etype")
 		return
@@ -0,0 +1,36 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/oiweiwei/gokrb5.fork/v9/config"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/patype"
+	"github.com/oiweiwei/gokrb5.fork/v9/messages"
+	"github.com/oiweiwei/gokrb5.fork/v9/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReferralASReq(t *testing.T) {
+	t.Parallel()
+	cname := types.NewEnterprisePrincipalName("testuser1@upn.test.gokrb5")
+	ASReq, err := messages.NewASReqForTGT("TEST.GOKRB5", config.New(), cname)
+	if err != nil {
+		t.Fatalf("error creating AS_REQ: %v", err)
+	}
+	ASReq.PAData = types.PADataSequence{{PADataType: patype.PA_ENC_TIMESTAMP, PADataValue: []byte("timestamp")}}
+
+	r, err := referralASReq(ASReq, "TEST.GOKRB5", "USER.GOKRB5")
+	if err != nil {
+		t.Fatalf("error creating referral AS_REQ: %v", err)
+	}
+	assert.Equal(t, "USER.GOKRB5", r.ReqBody.Realm, "realm not updated")
+	assert.Equal(t, []string{"krbtgt", "USER.GOKRB5"}, r.ReqBody.SName.NameString, "TGT should be requested from the referred realm")
+	assert.Equal(t, cname, r.ReqBody.CName, "client name should not change")
+	assert.Empty(t, r.PAData, "pre-authentication data should be regenerated for the referred realm")
+	assert.Equal(t, "TEST.GOKRB5", ASReq.ReqBody.Realm, "original AS_REQ should not be modified")
+
+	_, err = referralASReq(ASReq, "TEST.GOKRB5", "TEST.GOKRB5")
+	assert.Error(t, err, "referral to the same realm should fail")
+	_, err = referralASReq(ASReq, "TEST.GOKRB5", "")
+	assert.Error(t, err, "referral without a realm should fail")
+}
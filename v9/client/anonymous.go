@@ -0,0 +1,115 @@
+package client
+
+import (
+	"crypto/x509"
+
+	"github.com/oiweiwei/gokrb5.fork/v9/config"
+	"github.com/oiweiwei/gokrb5.fork/v9/credentials"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/flags"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/patype"
+	"github.com/oiweiwei/gokrb5.fork/v9/krberror"
+	"github.com/oiweiwei/gokrb5.fork/v9/messages"
+	"github.com/oiweiwei/gokrb5.fork/v9/pkinit"
+	"github.com/oiweiwei/gokrb5.fork/v9/types"
+)
+
+// NewAnonymous creates a new client that logs in to the realm as the anonymous principal
+// WELLKNOWN/ANONYMOUS@WELLKNOWN:ANONYMOUS using anonymous PKINIT (RFC 8062).
+// Set the realm to empty string to use the default realm from config.
+//
+// The KDC's certificate must chain to one of the trust anchors provided, have the id-pkinit-KPKdc extended key usage
+// and name the realm's TGS principal. The AS exchange is performed before the client is returned.
+//
+// The anonymous TGT obtained is suitable for armoring FAST requests on hosts that do not have a keytab.
+func NewAnonymous(realm string, anchors *x509.CertPool, krb5conf *config.Config, settings ...func(*Settings)) (*Client, error) {
+	if realm == "" {
+		realm = krb5conf.LibDefaults.DefaultRealm
+	}
+	cname := types.NewAnonymousPrincipalName()
+	creds := credentials.New(cname.PrincipalNameString(), realm)
+	creds.SetCName(cname)
+	creds.SetHuman(false)
+	cl := &Client{
+		Credentials: creds,
+		Config:      krb5conf,
+		settings:    NewSettings(settings...),
+		sessions: &sessions{
+			Entries: make(map[string]*session),
+		},
+		cache:         NewCache(),
+		pkinitAnchors: anchors,
+	}
+	if err := cl.Login(); err != nil {
+		return nil, err
+	}
+	return cl, nil
+}
+
+// anonymous indicates if the client logs in with anonymous PKINIT.
+func (cl *Client) anonymous() bool {
+	return cl.pkinitAnchors != nil
+}
+
+// anonymousLogin performs an anonymous PKINIT AS exchange with the KDC and establishes a session with the TGT.
+func (cl *Client) anonymousLogin() error {
+	realm := cl.Credentials.Domain()
+	pk, err := pkinit.NewAnonymousClient(realm, cl.pkinitAnchors)
+	if err != nil {
+		return krberror.Errorf(err, krberror.KRBMsgError, "error initialising anonymous PKINIT")
+	}
+	ASReq, err := messages.NewASReqForTGT(realm, cl.Config, types.NewAnonymousPrincipalName())
+	if err != nil {
+		return krberror.Errorf(err, krberror.KRBMsgError, "error generating new AS_REQ")
+	}
+	types.SetFlag(&ASReq.ReqBody.KDCOptions, flags.KDCOptionAnonymous)
+	bb, err := ASReq.ReqBody.Marshal()
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error marshaling AS_REQ body")
+	}
+	pa, err := pk.PAData(bb)
+	if err != nil {
+		return krberror.Errorf(err, krberror.KRBMsgError, "error generating PA-PK-AS-REQ")
+	}
+	ASReq.PAData = append(ASReq.PAData, pa)
+	if !cl.settings.DisablePAFXFAST() {
+		ASReq.PAData = append(ASReq.PAData, types.PAData{PADataType: patype.PA_REQ_ENC_PA_REP})
+	}
+	b, err := ASReq.Marshal()
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "AS Exchange Error: failed marshaling AS_REQ")
+	}
+	rb, err := cl.sendToKDC(b, realm)
+	if err != nil {
+		if _, ok := err.(messages.KRBError); ok {
+			return krberror.Errorf(err, krberror.KDCError, "AS Exchange Error: kerberos error response from KDC")
+		}
+		return krberror.Errorf(err, krberror.NetworkingError, "AS Exchange Error: failed sending AS_REQ to KDC")
+	}
+	var ASRep messages.ASRep
+	err = ASRep.Unmarshal(rb)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "AS Exchange Error: failed to process the AS_REP")
+	}
+	key, err := pk.ReplyKey(ASRep.PAData, ASRep.EncPart.EType)
+	if err != nil {
+		return krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: PKINIT reply not valid")
+	}
+	if ok, err := ASRep.VerifyAnonymous(cl.Config, key, ASReq); !ok {
+		return krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: AS_REP is not valid")
+	}
+	if err := pkinit.VerifyKeyExchange(ASRep.PAData, key, ASRep.DecryptedEncPart.Key); err != nil {
+		return krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: AS_REP is not valid")
+	}
+	// The KDC may place the anonymous principal in the anonymous realm rather than the requested one.
+	cl.pkinitCRealm = ASRep.CRealm
+	cl.addSession(ASRep.Ticket, ASRep.DecryptedEncPart)
+	return nil
+}
+
+// cRealm returns the realm of the client principal to which the client's tickets are issued.
+func (cl *Client) cRealm() string {
+	if cl.anonymous() && cl.pkinitCRealm != "" {
+		return cl.pkinitCRealm
+	}
+	return cl.Credentials.Domain()
+}
@@ -2,6 +2,7 @@
 package client
 
 import (
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,7 +12,6 @@ import (
 
 	"github.com/oiweiwei/gokrb5.fork/v9/config"
 	"github.com/oiweiwei/gokrb5.fork/v9/credentials"
-	"github.com/oiweiwei/gokrb5.fork/v9/crypto"
 	"github.com/oiweiwei/gokrb5.fork/v9/crypto/etype"
 	"github.com/oiweiwei/gokrb5.fork/v9/iana/errorcode"
 	"github.com/oiweiwei/gokrb5.fork/v9/iana/nametype"
@@ -23,21 +23,24 @@ import (
 
 // Client side configuration and state.
 type Client struct {
-	Credentials *credentials.Credentials
-	Config      *config.Config
-	settings    *Settings
-	sessions    *sessions
-	cache       *Cache
+	Credentials   *credentials.Credentials
+	Config        *config.Config
+	settings      *Settings
+	sessions      *sessions
+	cache         *Cache
+	pkinitAnchors *x509.CertPool
+	pkinitCRealm  string
 }
 
 // NewWithPassword creates a new client from a password credential.
 // Set the realm to empty string to use the default realm from config.
 func NewWithPassword(username, realm, password string, krb5conf *config.Config, settings ...func(*Settings)) *Client {
-	creds := credentials.New(username, realm)
+	s := NewSettings(settings...)
+	creds := newCredentials(username, realm, s)
 	return &Client{
 		Credentials: creds.WithPassword(password),
 		Config:      krb5conf,
-		settings:    NewSettings(settings...),
+		settings:    s,
 		sessions: &sessions{
 			Entries: make(map[string]*session),
 		},
@@ -47,11 +50,12 @@ func NewWithPassword(username, realm, password string, krb5conf *config.Config,
 
 // NewWithKeytab creates a new client from a keytab credential.
 func NewWithKeytab(username, realm string, kt *keytab.Keytab, krb5conf *config.Config, settings ...func(*Settings)) *Client {
-	creds := credentials.New(username, realm)
+	s := NewSettings(settings...)
+	creds := newCredentials(username, realm, s)
 	return &Client{
 		Credentials: creds.WithKeytab(kt),
 		Config:      krb5conf,
-		settings:    NewSettings(settings...),
+		settings:    s,
 		sessions: &sessions{
 			Entries: make(map[string]*session),
 		},
@@ -61,11 +65,12 @@ func NewWithKeytab(username, realm string, kt *keytab.Keytab, krb5conf *config.C
 
 // NewWithEncryptionKey creates a new client from an encryption key credential.
 func NewWithEncryptionKey(username, realm string, key types.EncryptionKey, krb5conf *config.Config, settings ...func(*Settings)) *Client {
-	creds := credentials.New(username, realm)
+	s := NewSettings(settings...)
+	creds := newCredentials(username, realm, s)
 	return &Client{
 		Credentials: creds.WithEncryptionKey(key),
 		Config:      krb5conf,
-		settings:    NewSettings(settings...),
+		settings:    s,
 		sessions: &sessions{
 			Entries: make(map[string]*session),
 		},
@@ -73,6 +78,15 @@ func NewWithEncryptionKey(username, realm string, key types.EncryptionKey, krb5c
 	}
 }
 
+// newCredentials creates the credentials for the username, which is an enterprise principal name if the settings say
+// so.
+func newCredentials(username, realm string, s *Settings) *credentials.Credentials {
+	if s.EnterprisePrincipal() {
+		return credentials.NewEnterprise(username, realm)
+	}
+	return credentials.New(username, realm)
+}
+
 // NewFromCCache create a client from a populated client cache.
 //
 // WARNING: A client created from CCache does not automatically renew TGTs and a failure will occur after the TGT expires.
@@ -93,6 +107,7 @@ func NewFromCCache(c *credentials.CCache, krb5conf *config.Config, settings ...f
 // NewFromCCacheOptionalTGT create a client from a populated client cache.
 //
 // It will not require TGT to be present in the cache in order to create the client.
+// Cache entries with session keys of encryption types not permitted by the configuration are ignored.
 //
 // WARNING: A client created from CCache does not automatically renew TGTs and a failure will occur after the TGT expires.
 func NewFromCCacheOptionalTGT(c *credentials.CCache, krb5conf *config.Config, settings ...func(*Settings)) (*Client, error) {
@@ -114,6 +129,10 @@ func NewFromCCacheOptionalTGT(c *credentials.CCache, krb5conf *config.Config, se
 		if err := tkt.Unmarshal(cred.Ticket); err != nil {
 			return cl, fmt.Errorf("cache entry ticket bytes are not valid: %v", err)
 		}
+		if !krb5conf.EtypePermitted(cred.Key.KeyType) {
+			// Tickets with session keys of etypes not permitted by the configuration are not used
+			continue
+		}
 		if cred.Server.PrincipalName.Equal(tgtSPN) {
 			cl.sessions.Entries[c.DefaultPrincipal.Realm] = &session{
 				realm:      c.DefaultPrincipal.Realm,
@@ -151,10 +170,10 @@ func (cl *Client) Key(etype etype.EType, kvno int, krberr *messages.KRBError) (t
 			if err != nil {
 				return types.EncryptionKey{}, 0, fmt.Errorf("could not get PAData from KRBError to generate key from password: %v", err)
 			}
-			key, _, err := crypto.GetKeyFromPassword(cl.Credentials.Password(), krberr.CName, krberr.CRealm, etype.GetETypeID(), pas)
+			key, _, err := cl.Config.EtypeRegistry().GetKeyFromPassword(cl.Credentials.Password(), krberr.CName, krberr.CRealm, etype.GetETypeID(), pas)
 			return key, 0, err
 		}
-		key, _, err := crypto.GetKeyFromPassword(cl.Credentials.Password(), cl.Credentials.CName(), cl.Credentials.Domain(), etype.GetETypeID(), types.PADataSequence{})
+		key, _, err := cl.Config.EtypeRegistry().GetKeyFromPassword(cl.Credentials.Password(), cl.Credentials.CName(), cl.Credentials.Domain(), etype.GetETypeID(), types.PADataSequence{})
 		return key, 0, err
 	}
 	return types.EncryptionKey{}, 0, errors.New("credential has neither keytab or password to generate key")
@@ -168,8 +187,9 @@ func (cl *Client) IsConfigured() (bool, error) {
 	if cl.Credentials.Domain() == "" {
 		return false, errors.New("client does not have a define realm")
 	}
-	// Client needs to have either a password, keytab or a session already (later when loading from CCache)
-	if !cl.Credentials.HasPassword() && !cl.Credentials.HasKeyProvider() {
+	// Client needs to have either a password, keytab, anonymous PKINIT trust anchors or a session already (later when
+	// loading from CCache)
+	if !cl.Credentials.HasPassword() && !cl.Credentials.HasKeyProvider() && !cl.anonymous() {
 		authTime, _, _, _, err := cl.sessionTimes(cl.Credentials.Domain())
 		if err != nil || authTime.IsZero() {
 			return false, errors.New("client has neither a keytab nor a password set and no session")
@@ -193,6 +213,9 @@ func (cl *Client) Login() error {
 	if ok, err := cl.IsConfigured(); !ok {
 		return err
 	}
+	if cl.anonymous() {
+		return cl.anonymousLogin()
+	}
 	if !cl.Credentials.HasPassword() && !cl.Credentials.HasKeyProvider() {
 		_, endTime, _, _, err := cl.sessionTimes(cl.Credentials.Domain())
 		if err != nil {
@@ -212,6 +235,25 @@ func (cl *Client) Login() error {
 	if err != nil {
 		return err
 	}
+	if ASRep.Canonicalized(ASReq) {
+		// The KDC returned the canonical name and realm of the client, such as for an enterprise principal name or
+		// after a client referral. Subsequent requests are made as the canonical client, provided the name is
+		// authenticated by the reply as otherwise it could have been rewritten in transit.
+		if ASRep.ClientAuthenticated() {
+			cl.Credentials.SetCName(ASRep.CName)
+			cl.Credentials.SetRealm(ASRep.CRealm)
+			cl.Log("client name canonicalized to %s@%s", ASRep.CName.PrincipalNameString(), ASRep.CRealm)
+		} else {
+			cl.Log("client name canonicalized to %s@%s in an unprotected reply is not adopted", ASRep.CName.PrincipalNameString(), ASRep.CRealm)
+		}
+	}
+	if realm := ASRep.DecryptedEncPart.SRealm; realm != cl.Credentials.Domain() {
+		// The client followed a client referral (RFC 6806 section 7) and the TGT is from the realm it was referred
+		// to. The realm is that the client sent the AS_REQ to, checked against the encrypted part of the reply, so
+		// the client adopts it whether or not the reply is protected so that its session is found under the realm.
+		cl.Credentials.SetRealm(realm)
+		cl.Log("client realm changed to %s following a client referral", realm)
+	}
 	cl.addSession(ASRep.Ticket, ASRep.DecryptedEncPart)
 	return nil
 }
@@ -229,6 +271,9 @@ func (cl *Client) AffirmLogin() error {
 }
 
 // realmLogin obtains or renews a TGT and establishes a session for the realm specified.
+// TGTs for realms other than the client's realm are obtained by walking the authentication path to the realm, taken
+// from the [capaths] section of the configuration or the realm hierarchy. From each realm reached a TGT is requested
+// for the realm furthest along the path, falling back to closer realms on the path if the KDC cannot issue it.
 func (cl *Client) realmLogin(realm string) error {
 	if realm == cl.Credentials.Domain() {
 		return cl.Login()
@@ -245,17 +290,29 @@ func (cl *Client) realmLogin(realm string) error {
 		return err
 	}
 
-	spn := types.PrincipalName{
-		NameType:   nametype.KRB_NT_SRV_INST,
-		NameString: []string{"krbtgt", realm},
-	}
-
-	_, tgsRep, err := cl.TGSREQGenerateAndExchange(spn, cl.Credentials.Domain(), tgt, skey, false)
-	if err != nil {
-		return err
+	path := append([]string{cl.Credentials.Domain()}, cl.Config.RealmPath(cl.Credentials.Domain(), realm)...)
+	path = append(path, realm)
+	for i := 0; i < len(path)-1; {
+		var tgsRep messages.TGSRep
+		j := len(path) - 1
+		for ; j > i; j-- {
+			spn := types.PrincipalName{
+				NameType:   nametype.KRB_NT_SRV_INST,
+				NameString: []string{"krbtgt", path[j]},
+			}
+			_, tgsRep, err = cl.TGSREQGenerateAndExchange(spn, path[i], tgt, skey, false)
+			if err == nil {
+				break
+			}
+			cl.Log("could not get TGT for %s from %s: %v", path[j], path[i], err)
+		}
+		if err != nil {
+			return krberror.Errorf(err, krberror.KRBMsgError, "could not get TGT for %s along the authentication path %v", realm, path)
+		}
+		cl.addSession(tgsRep.Ticket, tgsRep.DecryptedEncPart)
+		tgt, skey = tgsRep.Ticket, tgsRep.DecryptedEncPart.Key
+		i = j
 	}
-	cl.addSession(tgsRep.Ticket, tgsRep.DecryptedEncPart)
-
 	return nil
 }
 
@@ -272,6 +329,13 @@ func (cl *Client) Destroy() {
 func (cl *Client) Diagnostics(w io.Writer) error {
 	cl.Print(w)
 	var errs []string
+	if err := cl.Config.Validate(); err != nil {
+		if v, ok := err.(config.ValidationError); ok {
+			for _, p := range v.Problems {
+				errs = append(errs, fmt.Sprintf("krb5 config problem: %v", p))
+			}
+		}
+	}
 	if cl.Credentials.HasKeyProvider() {
 		var loginRealmEncTypes []int32
 		if cl.Credentials.HasKeytab() {
@@ -311,6 +375,14 @@ func (cl *Client) Diagnostics(w io.Writer) error {
 			}
 		}
 	}
+	if n, proxies, err := cl.Config.GetKDCProxies(cl.Credentials.Realm()); err == nil && n > 0 {
+		b, _ := json.MarshalIndent(&proxies, "", "  ")
+		fmt.Fprintf(w, "KDC proxies: %s\n", string(b))
+		if errs == nil || len(errs) < 1 {
+			return nil
+		}
+		return fmt.Errorf(strings.Join(errs, "\n"))
+	}
 	udpCnt, udpKDC, err := cl.Config.GetKDCs(cl.Credentials.Realm(), false)
 	if err != nil {
 		errs = append(errs, fmt.Sprintf("error when resolving KDCs for UDP communication: %v", err))
@@ -331,6 +403,10 @@ func (cl *Client) Diagnostics(w io.Writer) error {
 		b, _ := json.MarshalIndent(&tcpKDC, "", "  ")
 		fmt.Fprintf(w, "TCP KDCs: %s\n", string(b))
 	}
+	if st := cl.KDCStatus(); len(st) > 0 {
+		b, _ := json.MarshalIndent(&st, "", "  ")
+		fmt.Fprintf(w, "KDC status: %s\n", string(b))
+	}
 
 	if errs == nil || len(errs) < 1 {
 		return nil
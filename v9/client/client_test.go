@@ -1,10 +1,20 @@
 package client
 
 import (
+	"context"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/jcmturner/gofork/encoding/asn1"
 	"github.com/oiweiwei/gokrb5.fork/v9/config"
+	"github.com/oiweiwei/gokrb5.fork/v9/crypto"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/errorcode"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/etypeID"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/keyusage"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/msgtype"
 	"github.com/oiweiwei/gokrb5.fork/v9/iana/nametype"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/patype"
 	"github.com/oiweiwei/gokrb5.fork/v9/keytab"
 	"github.com/oiweiwei/gokrb5.fork/v9/messages"
 	"github.com/oiweiwei/gokrb5.fork/v9/types"
@@ -65,3 +75,173 @@ func TestAnyServiceClassSPN(t *testing.T) {
 		})
 	}
 }
+
+func TestLogin_DisabledEtype(t *testing.T) {
+	t.Parallel()
+	// The KDC requires pre-authentication with aes256-cts-hmac-sha1-96
+	info, err := asn1.Marshal(types.ETypeInfo2{{EType: etypeID.AES256_CTS_HMAC_SHA1_96, Salt: "TEST.GOKRB5testuser1"}})
+	if err != nil {
+		t.Fatalf("error marshaling ETYPE-INFO2: %v", err)
+	}
+	edata, err := asn1.Marshal(types.PADataSequence{{PADataType: patype.PA_ETYPE_INFO2, PADataValue: info}})
+	if err != nil {
+		t.Fatalf("error marshaling PAData: %v", err)
+	}
+	krberr := messages.NewKRBError(types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/TEST.GOKRB5"), "TEST.GOKRB5", errorcode.KDC_ERR_PREAUTH_REQUIRED, "")
+	krberr.CName = types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1")
+	krberr.CRealm = "TEST.GOKRB5"
+	krberr.EData = edata
+	rb, err := krberr.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling KRBError: %v", err)
+	}
+
+	login := func(r *crypto.Registry) (*testTransport, error) {
+		c, err := config.NewFromString(`[libdefaults]
+ default_tkt_enctypes = aes256-cts-hmac-sha1-96 aes128-cts-hmac-sha1-96
+ permitted_enctypes = aes256-cts-hmac-sha1-96 aes128-cts-hmac-sha1-96
+`)
+		if err != nil {
+			t.Fatalf("error loading config: %v", err)
+		}
+		if r != nil {
+			c.SetEtypeRegistry(r)
+		}
+		tt := &testTransport{kdc: rb}
+		cl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", c, Transport(tt))
+		return tt, cl.Login()
+	}
+
+	// With the default registry the client pre-authenticates with the etype the KDC asks for
+	tt, err := login(nil)
+	assert.Error(t, err)
+	assert.Len(t, tt.requests, 2, "the client should have sent the pre-authenticated AS_REQ")
+
+	// With aes256-cts-hmac-sha1-96 disabled in the configuration's registry it is neither requested nor used
+	r := crypto.DefaultRegistry().Clone()
+	r.Disable(etypeID.AES256_CTS_HMAC_SHA1_96)
+	tt, err = login(r)
+	if assert.Error(t, err, "login should fail as the KDC requires a disabled etype") {
+		assert.Contains(t, err.Error(), "disabled")
+	}
+	if assert.Len(t, tt.requests, 1, "the client should not pre-authenticate with a disabled etype") {
+		var asReq messages.ASReq
+		if err := asReq.Unmarshal([]byte(strings.TrimPrefix(tt.requests[0], "TEST.GOKRB5 "))); err != nil {
+			t.Fatalf("error unmarshaling AS_REQ: %v", err)
+		}
+		assert.Equal(t, []int32{etypeID.AES128_CTS_HMAC_SHA1_96}, asReq.ReqBody.EType, "the AS_REQ should not request a disabled etype")
+	}
+}
+
+// referralKDC refers AS_REQs for other realms to USER.GOKRB5, where it issues the client a TGT and service tickets.
+type referralKDC struct {
+	t          *testing.T
+	key        types.EncryptionKey
+	sessionKey types.EncryptionKey
+	requests   []string
+}
+
+func (k *referralKDC) RoundTrip(ctx context.Context, realm string, req []byte) ([]byte, error) {
+	var asReq messages.ASReq
+	if err := asReq.Unmarshal(req); err == nil {
+		k.requests = append(k.requests, "AS_REQ "+realm)
+		if realm != "USER.GOKRB5" {
+			e := messages.NewKRBError(asReq.ReqBody.SName, realm, errorcode.KDC_ERR_WRONG_REALM, "")
+			e.CName = asReq.ReqBody.CName
+			e.CRealm = "USER.GOKRB5"
+			b, err := e.Marshal()
+			if err != nil {
+				k.t.Fatalf("error marshaling KRBError: %v", err)
+			}
+			return checkForKRBError(b)
+		}
+		var ASRep messages.ASRep
+		ASRep.KDCRepFields, k.sessionKey = k.reply(msgtype.KRB_AS_REP, asReq.ReqBody, k.key, keyusage.AS_REP_ENCPART)
+		return ASRep.Marshal()
+	}
+	var tgsReq messages.TGSReq
+	if err := tgsReq.Unmarshal(req); err != nil {
+		k.t.Fatalf("KDC request is neither an AS_REQ nor a TGS_REQ: %v", err)
+	}
+	k.requests = append(k.requests, "TGS_REQ "+realm)
+	var tgsRep messages.TGSRep
+	tgsRep.KDCRepFields, _ = k.reply(msgtype.KRB_TGS_REP, tgsReq.ReqBody, k.sessionKey, keyusage.TGS_REP_ENCPART_SESSION_KEY)
+	return tgsRep.Marshal()
+}
+
+// reply returns the fields of a reply to the request with the encrypted part encrypted in the key and the session key.
+func (k *referralKDC) reply(msgType int, body messages.KDCReqBody, key types.EncryptionKey, usage uint32) (messages.KDCRepFields, types.EncryptionKey) {
+	et, _ := crypto.GetEtype(etypeID.AES256_CTS_HMAC_SHA1_96)
+	sessionKey, _ := types.GenerateEncryptionKey(et)
+	now := time.Now().UTC()
+	encPart := messages.EncKDCRepPart{
+		Key:       sessionKey,
+		Nonce:     body.Nonce,
+		Flags:     types.NewKrbFlags(),
+		AuthTime:  now,
+		StartTime: now,
+		EndTime:   now.Add(time.Hour),
+		SRealm:    body.Realm,
+		SName:     body.SName,
+	}
+	b, err := encPart.Marshal()
+	if err != nil {
+		k.t.Fatalf("error marshaling encrypted part: %v", err)
+	}
+	ed, err := crypto.GetEncryptedData(b, key, usage, 1)
+	if err != nil {
+		k.t.Fatalf("error encrypting encrypted part: %v", err)
+	}
+	return messages.KDCRepFields{
+		PVNO:    5,
+		MsgType: msgType,
+		CRealm:  "USER.GOKRB5",
+		CName:   body.CName,
+		Ticket: messages.Ticket{
+			TktVNO:  5,
+			Realm:   body.Realm,
+			SName:   body.SName,
+			EncPart: types.EncryptedData{EType: etypeID.AES256_CTS_HMAC_SHA1_96, KVNO: 1, Cipher: []byte("ticket")},
+		},
+		EncPart: ed,
+	}, sessionKey
+}
+
+func TestClient_ServiceTicketAfterReferral(t *testing.T) {
+	t.Parallel()
+	cname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1")
+	key, _, err := crypto.GetKeyFromPassword("passwordvalue", cname, "USER.GOKRB5", etypeID.AES256_CTS_HMAC_SHA1_96, types.PADataSequence{})
+	if err != nil {
+		t.Fatalf("error getting key from password: %v", err)
+	}
+	c := config.New()
+	c.Realms = []config.Realm{
+		{Realm: "TEST.GOKRB5", KDC: []string{"kdc.test.gokrb5"}},
+		{Realm: "USER.GOKRB5", KDC: []string{"kdc.user.gokrb5"}},
+	}
+	kdc := &referralKDC{t: t, key: key}
+	cl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", c, Transport(kdc))
+	defer cl.Destroy()
+	if err := cl.Login(); err != nil {
+		t.Fatalf("error logging in: %v", err)
+	}
+	// The reply is not protected by PA-REQ-ENC-PA-REP but the client followed the referral itself
+	assert.Equal(t, "USER.GOKRB5", cl.Credentials.Domain(), "client realm should be the realm it was referred to")
+
+	tkt, _, err := cl.GetServiceTicket("HTTP/host.example.com")
+	if err != nil {
+		t.Fatalf("error getting service ticket after a client referral: %v", err)
+	}
+	assert.Equal(t, "USER.GOKRB5", tkt.Realm)
+	assert.Equal(t, []string{"AS_REQ TEST.GOKRB5", "AS_REQ USER.GOKRB5", "TGS_REQ USER.GOKRB5"}, kdc.requests,
+		"the TGT from the referred realm should be used for the service ticket")
+}
+
+func TestEnterprisePrincipal(t *testing.T) {
+	t.Parallel()
+	cl := NewWithPassword("testuser1@upn.test.gokrb5", "TEST.GOKRB5", "passwordvalue", config.New())
+	assert.False(t, cl.Credentials.CName().IsEnterprise(), "enterprise principal names should be opt-in")
+	cl = NewWithPassword("testuser1@upn.test.gokrb5", "TEST.GOKRB5", "passwordvalue", config.New(), EnterprisePrincipal(true))
+	assert.True(t, cl.Credentials.CName().IsEnterprise(), "username should be an enterprise principal name")
+	assert.Equal(t, "testuser1@upn.test.gokrb5", cl.Credentials.CName().PrincipalNameString())
+}
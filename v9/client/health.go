@@ -0,0 +1,130 @@
+package client
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// KDCStatus describes the health of a KDC as tracked by the NetworkTransport.
+type KDCStatus struct {
+	// Address is the host:port of the KDC.
+	Address string
+	// Failures is the number of consecutive failed exchanges with the KDC.
+	Failures int
+	// LastFailure is the time of the last failed exchange with the KDC.
+	LastFailure time.Time
+	// BackoffUntil is the time until which the KDC is tried after the other KDCs of the realm.
+	BackoffUntil time.Time
+	// Latency is the smoothed round trip time of the successful exchanges with the KDC.
+	Latency time.Duration
+}
+
+// kdcHealth tracks the health and latency of the KDCs exchanged with so that KDCs failing to respond are tried after
+// those that are responding for a backoff period.
+type kdcHealth struct {
+	mu     sync.Mutex
+	status map[string]*KDCStatus
+}
+
+func newKDCHealth() *kdcHealth {
+	return &kdcHealth{status: make(map[string]*KDCStatus)}
+}
+
+// get returns the status of the KDC, creating it if it is not yet tracked. The lock must be held.
+func (h *kdcHealth) get(kdc string) *KDCStatus {
+	s, ok := h.status[kdc]
+	if !ok {
+		s = &KDCStatus{Address: kdc}
+		h.status[kdc] = s
+	}
+	return s
+}
+
+// success records a successful exchange with the KDC taking the round trip time provided.
+func (h *kdcHealth) success(kdc string, rtt time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.get(kdc)
+	s.Failures = 0
+	s.BackoffUntil = time.Time{}
+	if s.Latency == 0 {
+		s.Latency = rtt
+	} else {
+		// Exponentially weighted moving average as used for TCP round trip times (RFC 6298)
+		s.Latency = (7*s.Latency + rtt) / 8
+	}
+}
+
+// failure records a failed exchange with the KDC, which is then backed off for the period provided.
+func (h *kdcHealth) failure(kdc string, backoff time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.get(kdc)
+	s.Failures++
+	s.LastFailure = time.Now()
+	s.BackoffUntil = s.LastFailure.Add(backoff)
+}
+
+// order returns the KDCs keyed on preference order as a list. The KDCs that are not being backed off come first, those
+// with a smoothed latency ordered by it ahead of those not yet exchanged with, and the KDCs being backed off are moved
+// after them in the order their backoff periods end. KDCs that compare equal keep their preference order.
+func (h *kdcHealth) order(kdcs map[int]string) []string {
+	l := make([]string, 0, len(kdcs))
+	for i := 1; i <= len(kdcs); i++ {
+		l = append(l, kdcs[i])
+	}
+	now := time.Now()
+	until := make(map[string]time.Time)
+	latency := make(map[string]time.Duration)
+	h.mu.Lock()
+	for _, k := range l {
+		s, ok := h.status[k]
+		if !ok {
+			continue
+		}
+		if s.BackoffUntil.After(now) {
+			until[k] = s.BackoffUntil
+		} else {
+			latency[k] = s.Latency
+		}
+	}
+	h.mu.Unlock()
+	sort.SliceStable(l, func(i, j int) bool {
+		ui, uj := until[l[i]], until[l[j]]
+		if !ui.Equal(uj) {
+			return ui.Before(uj)
+		}
+		li, lj := latency[l[i]], latency[l[j]]
+		if li == 0 || lj == 0 {
+			return li != 0 && lj == 0
+		}
+		return li < lj
+	})
+	return l
+}
+
+// snapshot returns the status of the KDCs tracked ordered by address.
+func (h *kdcHealth) snapshot() []KDCStatus {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ss := make([]KDCStatus, 0, len(h.status))
+	for _, s := range h.status {
+		ss = append(ss, *s)
+	}
+	sort.Slice(ss, func(i, j int) bool { return ss[i].Address < ss[j].Address })
+	return ss
+}
+
+// KDCStatus returns the health of the KDCs the transport has exchanged with.
+func (t *NetworkTransport) KDCStatus() []KDCStatus {
+	return t.health.snapshot()
+}
+
+// KDCStatus returns the health of the KDCs the client has exchanged with using the default NetworkTransport.
+func (cl *Client) KDCStatus() []KDCStatus {
+	return cl.settings.kdcHealth.snapshot()
+}
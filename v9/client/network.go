@@ -1,23 +1,154 @@
 package client
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
 	"io"
 	"net"
+	"net/http"
 	"strings"
 	"time"
 
+	"github.com/oiweiwei/gokrb5.fork/v9/config"
 	"github.com/oiweiwei/gokrb5.fork/v9/iana/errorcode"
+	"github.com/oiweiwei/gokrb5.fork/v9/kkdcp"
 	"github.com/oiweiwei/gokrb5.fork/v9/messages"
 )
 
+// KDCTransport sends requests to the KDCs of a realm and returns their replies. A KRBError replied by a KDC is
+// returned as the error, as a messages.KRBError, so that the client can act on it. A request to be sent to the master
+// KDC of the realm is indicated by its context, as reported by IsMasterKDC.
+//
+// The client uses a NetworkTransport unless another transport is configured with the Transport setting.
+type KDCTransport interface {
+	RoundTrip(ctx context.Context, realm string, req []byte) ([]byte, error)
+}
+
+type masterKDCKey struct{}
+
+// WithMasterKDC returns a copy of the context indicating that the request is to be sent to the master KDC of the
+// realm.
+func WithMasterKDC(ctx context.Context) context.Context {
+	return context.WithValue(ctx, masterKDCKey{}, true)
+}
+
+// IsMasterKDC returns true if the context indicates that the request is to be sent to the master KDC of the realm.
+func IsMasterKDC(ctx context.Context) bool {
+	m, _ := ctx.Value(masterKDCKey{}).(bool)
+	return m
+}
+
+// NetworkTransport is the default KDCTransport. Requests are sent to the KDCs of the realm located by the
+// configuration over UDP or TCP, with UDP tried first for requests no larger than the libdefaults
+// udp_preference_limit, or to a KDC proxy (MS-KKDCP) over HTTPS if the realm's KDCs are configured as KDC proxies.
+//
+// Requests are hedged: if no reply is received from a KDC within the hedge delay the request is also sent to the next
+// KDC without abandoning the first. The health of the KDCs is tracked so that KDCs failing to respond are tried after
+// the others for a backoff period.
+type NetworkTransport struct {
+	config      *config.Config
+	dialer      KDCDialer
+	proxyClient *http.Client
+	timeout     time.Duration
+	hedgeDelay  time.Duration
+	backoff     time.Duration
+	health      *kdcHealth
+}
+
+// NewNetworkTransport creates a new NetworkTransport sending requests to the KDCs located by the configuration.
+// The dialer, KDC proxy HTTP client, KDC timeout, hedge delay and backoff of the settings provided are used.
+//
+// t := NewNetworkTransport(cfg, Dialer(d), KDCTimeout(10*time.Second))
+func NewNetworkTransport(c *config.Config, settings ...func(*Settings)) *NetworkTransport {
+	return newNetworkTransport(c, NewSettings(settings...))
+}
+
+func newNetworkTransport(c *config.Config, s *Settings) *NetworkTransport {
+	h := s.kdcHealth
+	if h == nil {
+		h = newKDCHealth()
+	}
+	return &NetworkTransport{
+		config:      c,
+		dialer:      s.Dialer(),
+		proxyClient: s.KDCProxyClient(),
+		timeout:     s.KDCTimeout(),
+		hedgeDelay:  s.KDCHedgeDelay(),
+		backoff:     s.KDCBackoff(),
+		health:      h,
+	}
+}
+
+// transport returns the KDC transport of the client.
+func (cl *Client) transport() KDCTransport {
+	if t := cl.settings.Transport(); t != nil {
+		return t
+	}
+	return newNetworkTransport(cl.Config, cl.settings)
+}
+
 // SendToKDC performs network actions to send data to the KDC.
 func (cl *Client) sendToKDC(b []byte, realm string) ([]byte, error) {
+	return cl.transport().RoundTrip(context.Background(), realm, b)
+}
+
+// sendToMasterKDC performs network actions to send data to the master KDC of the realm.
+func (cl *Client) sendToMasterKDC(b []byte, realm string) ([]byte, error) {
+	return cl.transport().RoundTrip(WithMasterKDC(context.Background()), realm, b)
+}
+
+// sendASReq sends the AS_REQ to a KDC of the realm. As MIT krb5 does, if the KDC returns KDC_ERR_PREAUTH_FAILED or
+// KDC_ERR_KEY_EXPIRED the AS_REQ is sent again to the master KDC of the realm, if there is one, as a change to the
+// client's password may not yet have been replicated to the KDC. If the master KDC cannot be reached the error from
+// the KDC is returned. The unwrap function, if not nil, returns the error to check from the KRBError returned by the
+// KDC, such as the error protected by FAST.
+func (cl *Client) sendASReq(b []byte, realm string, unwrap func(messages.KRBError) (messages.KRBError, error)) ([]byte, error) {
+	rb, err := cl.sendToKDC(b, realm)
+	e, ok := err.(messages.KRBError)
+	if !ok {
+		return rb, err
+	}
+	if unwrap != nil {
+		var uerr error
+		if e, uerr = unwrap(e); uerr != nil {
+			return rb, err
+		}
+	}
+	if e.ErrorCode != errorcode.KDC_ERR_PREAUTH_FAILED && e.ErrorCode != errorcode.KDC_ERR_KEY_EXPIRED {
+		return rb, err
+	}
+	if n, _, merr := cl.Config.GetMasterKDCs(realm, false); merr != nil || n < 1 {
+		return rb, err
+	}
+	cl.Log("retrying AS_REQ with the master KDC of realm %s after error from KDC: %v", realm, e)
+	mrb, merr := cl.sendToMasterKDC(b, realm)
+	if _, ok := merr.(messages.KRBError); merr != nil && !ok {
+		cl.Log("error sending AS_REQ to the master KDC of realm %s: %v", realm, merr)
+		return rb, err
+	}
+	return mrb, merr
+}
+
+// RoundTrip sends the request to a KDC of the realm and returns its reply, implementing the KDCTransport interface.
+func (t *NetworkTransport) RoundTrip(ctx context.Context, realm string, b []byte) ([]byte, error) {
+	master := IsMasterKDC(ctx)
+	if !master {
+		if n, proxies, err := t.config.GetKDCProxies(realm); err == nil && n > 0 {
+			rb, err := t.sendKDCProxy(ctx, proxies, realm, b)
+			if err != nil {
+				if e, ok := err.(messages.KRBError); ok {
+					return rb, e
+				}
+				return rb, fmt.Errorf("communication error with KDC via KDC proxy: %v", err)
+			}
+			return rb, nil
+		}
+	}
 	var rb []byte
-	if cl.Config.LibDefaults.UDPPreferenceLimit == 1 {
+	if t.config.LibDefaults.UDPPreferenceLimit == 1 {
 		//1 means we should always use TCP
-		rb, errtcp := cl.sendKDCTCP(realm, b)
+		rb, errtcp := t.sendKDCTCP(ctx, realm, b, master)
 		if errtcp != nil {
 			if e, ok := errtcp.(messages.KRBError); ok {
 				return rb, e
@@ -26,9 +157,9 @@ func (cl *Client) sendToKDC(b []byte, realm string) ([]byte, error) {
 		}
 		return rb, nil
 	}
-	if len(b) <= cl.Config.LibDefaults.UDPPreferenceLimit {
+	if len(b) <= t.config.LibDefaults.UDPPreferenceLimit {
 		//Try UDP first, TCP second
-		rb, errudp := cl.sendKDCUDP(realm, b)
+		rb, errudp := t.sendKDCUDP(ctx, realm, b, master)
 		if errudp != nil {
 			if e, ok := errudp.(messages.KRBError); ok && e.ErrorCode != errorcode.KRB_ERR_RESPONSE_TOO_BIG {
 				// Got a KRBError from KDC
@@ -36,7 +167,7 @@ func (cl *Client) sendToKDC(b []byte, realm string) ([]byte, error) {
 				return rb, e
 			}
 			// Try TCP
-			r, errtcp := cl.sendKDCTCP(realm, b)
+			r, errtcp := t.sendKDCTCP(ctx, realm, b, master)
 			if errtcp != nil {
 				if e, ok := errtcp.(messages.KRBError); ok {
 					// Got a KRBError
@@ -49,62 +180,164 @@ func (cl *Client) sendToKDC(b []byte, realm string) ([]byte, error) {
 		return rb, nil
 	}
 	//Try TCP first, UDP second
-	rb, errtcp := cl.sendKDCTCP(realm, b)
+	rb, errtcp := t.sendKDCTCP(ctx, realm, b, master)
 	if errtcp != nil {
 		if e, ok := errtcp.(messages.KRBError); ok {
 			// Got a KRBError from KDC so returning and not trying UDP.
 			return rb, e
 		}
-		rb, errudp := cl.sendKDCUDP(realm, b)
+		r, errudp := t.sendKDCUDP(ctx, realm, b, master)
 		if errudp != nil {
 			if e, ok := errudp.(messages.KRBError); ok {
 				// Got a KRBError
-				return rb, e
+				return r, e
 			}
-			return rb, fmt.Errorf("failed to communicate with KDC. Attempts made with TCP (%v) and then UDP (%v)", errtcp, errudp)
+			return r, fmt.Errorf("failed to communicate with KDC. Attempts made with TCP (%v) and then UDP (%v)", errtcp, errudp)
 		}
+		rb = r
 	}
 	return rb, nil
 }
 
 // sendKDCUDP sends bytes to the KDC via UDP.
-func (cl *Client) sendKDCUDP(realm string, b []byte) ([]byte, error) {
+func (t *NetworkTransport) sendKDCUDP(ctx context.Context, realm string, b []byte, master bool) ([]byte, error) {
 	var r []byte
-	_, kdcs, err := cl.Config.GetKDCs(realm, false)
+	kdcs, err := t.kdcs(realm, false, master)
 	if err != nil {
 		return r, err
 	}
-	r, err = cl.dialSendUDP(kdcs, b)
+	r, err = t.dialSendUDP(ctx, kdcs, b)
 	if err != nil {
 		return r, err
 	}
 	return checkForKRBError(r)
 }
 
-// dialSendUDP establishes a UDP connection to a KDC.
-func (cl *Client) dialSendUDP(kdcs map[int]string, b []byte) ([]byte, error) {
+// kdcs returns the KDCs, or master KDCs, of the realm keyed on preference order.
+func (t *NetworkTransport) kdcs(realm string, tcp, master bool) (map[int]string, error) {
+	if master {
+		_, kdcs, err := t.config.GetMasterKDCs(realm, tcp)
+		return kdcs, err
+	}
+	_, kdcs, err := t.config.GetKDCs(realm, tcp)
+	return kdcs, err
+}
+
+// dial establishes a connection to the KDC with the transport's dialer, using the context if the dialer supports it.
+func (t *NetworkTransport) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	if d, ok := t.dialer.(interface {
+		DialContext(ctx context.Context, network, address string) (net.Conn, error)
+	}); ok {
+		return d.DialContext(ctx, network, address)
+	}
+	return t.dialer.Dial(network, address)
+}
+
+// deadline returns the deadline for an exchange with a KDC: the transport's timeout from now, or the deadline of the
+// context if that is sooner.
+func (t *NetworkTransport) deadline(ctx context.Context) time.Time {
+	d := time.Now().Add(t.timeout)
+	if cd, ok := ctx.Deadline(); ok && cd.Before(d) {
+		return cd
+	}
+	return d
+}
+
+// dialSendUDP sends bytes to the KDCs provided via UDP, hedging the request as described for NetworkTransport.
+func (t *NetworkTransport) dialSendUDP(ctx context.Context, kdcs map[int]string, b []byte) ([]byte, error) {
+	return t.exchange(ctx, "udp", kdcs, b)
+}
+
+// exchange sends bytes to the KDCs provided in order of preference, with those being backed off last, and returns the
+// first reply received. If the hedge delay passes without a reply the bytes are also sent to the next KDC, and a KDC
+// that fails is moved on from immediately. Exchanges outstanding when a reply is received are abandoned.
+func (t *NetworkTransport) exchange(ctx context.Context, network string, kdcs map[int]string, b []byte) ([]byte, error) {
+	l := t.health.order(kdcs)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type reply struct {
+		rb  []byte
+		err error
+	}
+	replies := make(chan reply, len(l))
+	var next, pending int
 	var errs []string
-	for i := 1; i <= len(kdcs); i++ {
-		conn, err := cl.settings.Dialer().Dial("udp", kdcs[i])
-		if err != nil {
-			errs = append(errs, fmt.Sprintf("error establishing connection to %s: %v", kdcs[i], err))
-			continue
+	send := func() {
+		if next >= len(l) {
+			return
 		}
-		if err := conn.SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
-			errs = append(errs, fmt.Sprintf("error setting deadline on connection to %s: %v", kdcs[i], err))
-			continue
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err.Error())
+			next = len(l)
+			return
 		}
-		// conn is guaranteed to be a UDPConn
-		rb, err := sendUDP(conn, b)
-		if err != nil {
-			errs = append(errs, fmt.Sprintf("error sending to %s: %v", kdcs[i], err))
-			continue
+		kdc := l[next]
+		next++
+		pending++
+		go func() {
+			start := time.Now()
+			rb, err := t.send(ctx, network, kdc, b)
+			if err == nil {
+				t.health.success(kdc, time.Since(start))
+			} else if ctx.Err() == nil {
+				t.health.failure(kdc, t.backoff)
+			}
+			replies <- reply{rb, err}
+		}()
+	}
+	send()
+	for pending > 0 {
+		var timer *time.Timer
+		var hedge <-chan time.Time
+		if t.hedgeDelay > 0 && next < len(l) {
+			timer = time.NewTimer(t.hedgeDelay)
+			hedge = timer.C
+		}
+		select {
+		case r := <-replies:
+			pending--
+			if r.err == nil {
+				return r.rb, nil
+			}
+			errs = append(errs, r.err.Error())
+			send()
+		case <-hedge:
+			send()
+		}
+		if timer != nil {
+			timer.Stop()
 		}
-		return rb, nil
 	}
 	return nil, fmt.Errorf("error sending to a KDC: %s", strings.Join(errs, "; "))
 }
 
+// send sends bytes to the KDC over the network provided and returns its reply.
+func (t *NetworkTransport) send(ctx context.Context, network, kdc string, b []byte) ([]byte, error) {
+	conn, err := t.dial(ctx, network, kdc)
+	if err != nil {
+		return nil, fmt.Errorf("error establishing connection to %s: %v", kdc, err)
+	}
+	// Abandon the exchange if the context is cancelled, such as when another KDC has replied
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	if err := conn.SetDeadline(t.deadline(ctx)); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error setting deadline on connection to %s: %v", kdc, err)
+	}
+	var rb []byte
+	if network == "udp" {
+		// conn is guaranteed to be a UDPConn
+		rb, err = sendUDP(conn, b)
+	} else {
+		// conn is guaranteed to be a TCPConn
+		rb, err = sendTCP(conn, b)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error sending to %s: %v", kdc, err)
+	}
+	return rb, nil
+}
+
 // sendUDP sends bytes to connection over UDP.
 func sendUDP(conn net.Conn, b []byte) ([]byte, error) {
 	var r []byte
@@ -130,41 +363,22 @@ func sendUDP(conn net.Conn, b []byte) ([]byte, error) {
 }
 
 // sendKDCTCP sends bytes to the KDC via TCP.
-func (cl *Client) sendKDCTCP(realm string, b []byte) ([]byte, error) {
+func (t *NetworkTransport) sendKDCTCP(ctx context.Context, realm string, b []byte, master bool) ([]byte, error) {
 	var r []byte
-	_, kdcs, err := cl.Config.GetKDCs(realm, true)
+	kdcs, err := t.kdcs(realm, true, master)
 	if err != nil {
 		return r, err
 	}
-	r, err = cl.dialSendTCP(kdcs, b)
+	r, err = t.dialSendTCP(ctx, kdcs, b)
 	if err != nil {
 		return r, err
 	}
 	return checkForKRBError(r)
 }
 
-// dialKDCTCP establishes a TCP connection to a KDC.
-func (cl *Client) dialSendTCP(kdcs map[int]string, b []byte) ([]byte, error) {
-	var errs []string
-	for i := 1; i <= len(kdcs); i++ {
-		conn, err := cl.settings.Dialer().Dial("tcp", kdcs[i])
-		if err != nil {
-			errs = append(errs, fmt.Sprintf("error establishing connection to %s: %v", kdcs[i], err))
-			continue
-		}
-		if err := conn.SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
-			errs = append(errs, fmt.Sprintf("error setting deadline on connection to %s: %v", kdcs[i], err))
-			continue
-		}
-		// conn is guaranteed to be a TCPConn
-		rb, err := sendTCP(conn, b)
-		if err != nil {
-			errs = append(errs, fmt.Sprintf("error sending to %s: %v", kdcs[i], err))
-			continue
-		}
-		return rb, nil
-	}
-	return nil, fmt.Errorf("error sending to a KDC: %s", strings.Join(errs, "; "))
+// dialSendTCP sends bytes to the KDCs provided via TCP, hedging the request as described for NetworkTransport.
+func (t *NetworkTransport) dialSendTCP(ctx context.Context, kdcs map[int]string, b []byte) ([]byte, error) {
+	return t.exchange(ctx, "tcp", kdcs, b)
 }
 
 // sendTCP sends bytes to connection over TCP.
@@ -199,6 +413,20 @@ func sendTCP(conn net.Conn, b []byte) ([]byte, error) {
 	return rb, nil
 }
 
+// sendKDCProxy sends bytes to the KDC through the KDC proxies (MS-KKDCP) provided, trying each in order of preference.
+func (t *NetworkTransport) sendKDCProxy(ctx context.Context, proxies map[int]string, realm string, b []byte) ([]byte, error) {
+	var errs []string
+	for i := 1; i <= len(proxies); i++ {
+		rb, err := kkdcp.Post(ctx, t.proxyClient, proxies[i], realm, b)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		return checkForKRBError(rb)
+	}
+	return nil, fmt.Errorf("error sending to a KDC proxy: %s", strings.Join(errs, "; "))
+}
+
 // checkForKRBError checks if the response bytes from the KDC are a KRBError.
 func checkForKRBError(b []byte) ([]byte, error) {
 	var KRBErr messages.KRBError
@@ -0,0 +1,275 @@
+package client
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oiweiwei/gokrb5.fork/v9/config"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/errorcode"
+	"github.com/oiweiwei/gokrb5.fork/v9/keytab"
+	"github.com/oiweiwei/gokrb5.fork/v9/kkdcp"
+	"github.com/oiweiwei/gokrb5.fork/v9/messages"
+	"github.com/oiweiwei/gokrb5.fork/v9/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// testKDCDialer answers requests over TCP with the response configured for the address dialed.
+type testKDCDialer struct {
+	mu        sync.Mutex
+	responses map[string][]byte
+	delays    map[string]time.Duration
+	dialed    []string
+}
+
+func (d *testKDCDialer) Dial(network, address string) (net.Conn, error) {
+	d.mu.Lock()
+	d.dialed = append(d.dialed, address)
+	rb, ok := d.responses[address]
+	delay := d.delays[address]
+	d.mu.Unlock()
+	if !ok {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: io.ErrClosedPipe}
+	}
+	c, s := net.Pipe()
+	go func() {
+		defer s.Close()
+		h := make([]byte, 4)
+		if _, err := io.ReadFull(s, h); err != nil {
+			return
+		}
+		if _, err := io.ReadFull(s, make([]byte, binary.BigEndian.Uint32(h))); err != nil {
+			return
+		}
+		time.Sleep(delay)
+		binary.BigEndian.PutUint32(h, uint32(len(rb)))
+		s.Write(append(h, rb...))
+	}()
+	return c, nil
+}
+
+func testKRBError(t *testing.T, code int32) []byte {
+	e := messages.NewKRBError(types.NewPrincipalName(1, "krbtgt/TEST.GOKRB5"), "TEST.GOKRB5", code, "")
+	b, err := e.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling KRBError: %v", err)
+	}
+	return b
+}
+
+func TestSendASReq_MasterKDC(t *testing.T) {
+	t.Parallel()
+	c := config.New()
+	c.LibDefaults.UDPPreferenceLimit = 1
+	c.Realms = []config.Realm{{
+		Realm:     "TEST.GOKRB5",
+		KDC:       []string{"replica.test.gokrb5"},
+		MasterKDC: []string{"master.test.gokrb5"},
+	}}
+	d := &testKDCDialer{responses: map[string][]byte{
+		"replica.test.gokrb5:88": testKRBError(t, errorcode.KDC_ERR_PREAUTH_FAILED),
+		"master.test.gokrb5:88":  []byte("reply from master"),
+	}}
+	cl := NewWithKeytab("testuser1", "TEST.GOKRB5", &keytab.Keytab{}, c, Dialer(d))
+	rb, err := cl.sendASReq([]byte("AS_REQ"), "TEST.GOKRB5", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("reply from master"), rb)
+	assert.Equal(t, []string{"replica.test.gokrb5:88", "master.test.gokrb5:88"}, d.dialed)
+
+	// Other errors are not retried
+	d = &testKDCDialer{responses: map[string][]byte{
+		"replica.test.gokrb5:88": testKRBError(t, errorcode.KDC_ERR_C_PRINCIPAL_UNKNOWN),
+		"master.test.gokrb5:88":  []byte("reply from master"),
+	}}
+	cl = NewWithKeytab("testuser1", "TEST.GOKRB5", &keytab.Keytab{}, c, Dialer(d))
+	_, err = cl.sendASReq([]byte("AS_REQ"), "TEST.GOKRB5", nil)
+	if e, ok := err.(messages.KRBError); assert.True(t, ok, "KRBError expected: %v", err) {
+		assert.Equal(t, errorcode.KDC_ERR_C_PRINCIPAL_UNKNOWN, e.ErrorCode)
+	}
+	assert.Equal(t, []string{"replica.test.gokrb5:88"}, d.dialed)
+
+	// The KDC's error is returned if the master KDC cannot be reached
+	d = &testKDCDialer{responses: map[string][]byte{
+		"replica.test.gokrb5:88": testKRBError(t, errorcode.KDC_ERR_KEY_EXPIRED),
+	}}
+	cl = NewWithKeytab("testuser1", "TEST.GOKRB5", &keytab.Keytab{}, c, Dialer(d))
+	_, err = cl.sendASReq([]byte("AS_REQ"), "TEST.GOKRB5", nil)
+	if e, ok := err.(messages.KRBError); assert.True(t, ok, "KRBError expected: %v", err) {
+		assert.Equal(t, errorcode.KDC_ERR_KEY_EXPIRED, e.ErrorCode)
+	}
+	assert.Equal(t, []string{"replica.test.gokrb5:88", "master.test.gokrb5:88"}, d.dialed)
+}
+
+func TestSendToKDC_KDCProxy(t *testing.T) {
+	t.Parallel()
+	// A minimal message with the application tag of an AS_REQ as the proxy only forwards KDC requests
+	asReq := []byte{0x6a, 0x02, 0x30, 0x00}
+	pc := config.New()
+	pc.Realms = []config.Realm{{Realm: "TEST.GOKRB5", KDC: []string{"kdc.test.gokrb5"}}}
+	d := &testKDCDialer{responses: map[string][]byte{"kdc.test.gokrb5:88": []byte("reply from KDC")}}
+	s := httptest.NewTLSServer(kkdcp.NewProxy(pc, kkdcp.Dialer(d)))
+	defer s.Close()
+
+	c := config.New()
+	c.Realms = []config.Realm{{Realm: "TEST.GOKRB5", KDC: []string{s.URL + "/KdcProxy"}}}
+	cl := NewWithKeytab("testuser1", "TEST.GOKRB5", &keytab.Keytab{}, c, KDCProxyClient(s.Client()))
+	rb, err := cl.sendToKDC(asReq, "TEST.GOKRB5")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("reply from KDC"), rb)
+	assert.Equal(t, []string{"kdc.test.gokrb5:88"}, d.dialed)
+
+	// KRBErrors from the KDC are returned through the proxy
+	d.responses["kdc.test.gokrb5:88"] = testKRBError(t, errorcode.KDC_ERR_C_PRINCIPAL_UNKNOWN)
+	_, err = cl.sendToKDC(asReq, "TEST.GOKRB5")
+	if e, ok := err.(messages.KRBError); assert.True(t, ok, "KRBError expected: %v", err) {
+		assert.Equal(t, errorcode.KDC_ERR_C_PRINCIPAL_UNKNOWN, e.ErrorCode)
+	}
+}
+
+// testTransport records the requests sent and replies with the responses configured for the KDCs, or master KDCs.
+type testTransport struct {
+	requests []string
+	kdc      []byte
+	master   []byte
+}
+
+func (tt *testTransport) RoundTrip(ctx context.Context, realm string, req []byte) ([]byte, error) {
+	rb := tt.kdc
+	if IsMasterKDC(ctx) {
+		rb = tt.master
+		realm = "master/" + realm
+	}
+	tt.requests = append(tt.requests, realm+" "+string(req))
+	return checkForKRBError(rb)
+}
+
+func TestTransport(t *testing.T) {
+	t.Parallel()
+	c := config.New()
+	c.Realms = []config.Realm{{Realm: "TEST.GOKRB5", MasterKDC: []string{"master.test.gokrb5"}}}
+	tt := &testTransport{
+		kdc:    testKRBError(t, errorcode.KDC_ERR_KEY_EXPIRED),
+		master: []byte("reply from master"),
+	}
+	cl := NewWithKeytab("testuser1", "TEST.GOKRB5", &keytab.Keytab{}, c, Transport(tt))
+	rb, err := cl.sendASReq([]byte("AS_REQ"), "TEST.GOKRB5", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("reply from master"), rb)
+	assert.Equal(t, []string{"TEST.GOKRB5 AS_REQ", "master/TEST.GOKRB5 AS_REQ"}, tt.requests)
+}
+
+func TestNetworkTransport(t *testing.T) {
+	t.Parallel()
+	c := config.New()
+	c.LibDefaults.UDPPreferenceLimit = 1
+	c.Realms = []config.Realm{{Realm: "TEST.GOKRB5", KDC: []string{"kdc1.test.gokrb5", "kdc2.test.gokrb5"}}}
+	d := &testKDCDialer{responses: map[string][]byte{
+		"kdc1.test.gokrb5:88": []byte("reply from KDC"),
+		"kdc2.test.gokrb5:88": []byte("reply from KDC"),
+	}}
+	tr := NewNetworkTransport(c, Dialer(d), KDCTimeout(time.Second))
+	rb, err := tr.RoundTrip(context.Background(), "TEST.GOKRB5", []byte("TGS_REQ"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("reply from KDC"), rb)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = tr.RoundTrip(ctx, "TEST.GOKRB5", []byte("TGS_REQ"))
+	assert.Error(t, err, "cancelled context should stop the request")
+	assert.Len(t, d.dialed, 1, "no KDCs should be dialed once the context is cancelled")
+}
+
+func TestNetworkTransport_Hedging(t *testing.T) {
+	t.Parallel()
+	d := &testKDCDialer{
+		responses: map[string][]byte{
+			"kdc1.test.gokrb5:88": []byte("reply from kdc1"),
+			"kdc2.test.gokrb5:88": []byte("reply from kdc2"),
+		},
+		delays: map[string]time.Duration{"kdc1.test.gokrb5:88": 2 * time.Second},
+	}
+	tr := NewNetworkTransport(config.New(), Dialer(d), KDCHedgeDelay(50*time.Millisecond))
+	kdcs := map[int]string{1: "kdc1.test.gokrb5:88", 2: "kdc2.test.gokrb5:88"}
+	start := time.Now()
+	rb, err := tr.exchange(context.Background(), "tcp", kdcs, []byte("AS_REQ"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("reply from kdc2"), rb, "reply from the hedged request expected")
+	assert.Less(t, int64(time.Since(start)), int64(time.Second), "slow KDC should not delay the reply")
+	d.mu.Lock()
+	assert.Equal(t, []string{"kdc1.test.gokrb5:88", "kdc2.test.gokrb5:88"}, d.dialed)
+	d.mu.Unlock()
+	for _, s := range tr.KDCStatus() {
+		assert.Zero(t, s.Failures, "abandoned exchanges should not be failures: %s", s.Address)
+	}
+}
+
+func TestNetworkTransport_Health(t *testing.T) {
+	t.Parallel()
+	d := &testKDCDialer{responses: map[string][]byte{
+		"kdc2.test.gokrb5:88": []byte("reply from kdc2"),
+	}}
+	cl := NewWithKeytab("testuser1", "TEST.GOKRB5", &keytab.Keytab{}, config.New(), Dialer(d), KDCHedgeDelay(0), KDCBackoff(time.Hour))
+	tr := newNetworkTransport(cl.Config, cl.settings)
+	kdcs := map[int]string{1: "kdc1.test.gokrb5:88", 2: "kdc2.test.gokrb5:88"}
+	rb, err := tr.exchange(context.Background(), "tcp", kdcs, []byte("AS_REQ"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("reply from kdc2"), rb)
+
+	st := cl.KDCStatus()
+	if assert.Len(t, st, 2) {
+		assert.Equal(t, "kdc1.test.gokrb5:88", st[0].Address)
+		assert.Equal(t, 1, st[0].Failures)
+		assert.True(t, st[0].BackoffUntil.After(time.Now().Add(59*time.Minute)), "failed KDC should be backed off")
+		assert.Zero(t, st[1].Failures)
+		assert.NotZero(t, st[1].Latency, "latency of the KDC should be tracked")
+	}
+
+	// The failed KDC is tried after the others by transports of the client for the backoff period
+	d.mu.Lock()
+	d.dialed = nil
+	d.mu.Unlock()
+	tr = newNetworkTransport(cl.Config, cl.settings)
+	_, err = tr.exchange(context.Background(), "tcp", kdcs, []byte("AS_REQ"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"kdc2.test.gokrb5:88"}, d.dialed)
+}
+
+func TestKDCHealth_Order(t *testing.T) {
+	t.Parallel()
+	h := newKDCHealth()
+	kdcs := map[int]string{1: "a:88", 2: "b:88", 3: "c:88", 4: "d:88"}
+	h.failure("b:88", time.Hour)
+	h.failure("a:88", 2*time.Hour)
+	h.failure("c:88", -time.Second)
+	assert.Equal(t, []string{"c:88", "d:88", "b:88", "a:88"}, h.order(kdcs), "backed off KDCs should be last in order of their backoff ending")
+	h.success("a:88", time.Millisecond)
+	assert.Equal(t, []string{"a:88", "c:88", "d:88", "b:88"}, h.order(kdcs))
+	h.success("d:88", time.Microsecond)
+	assert.Equal(t, []string{"d:88", "a:88", "c:88", "b:88"}, h.order(kdcs), "KDCs should be ordered by latency")
+}
+
+func TestClient_FailedKDCNotRetriedFirst(t *testing.T) {
+	t.Parallel()
+	c := config.New()
+	c.LibDefaults.UDPPreferenceLimit = 1
+	c.Realms = []config.Realm{{Realm: "TEST.GOKRB5", KDC: []string{"kdc1.test.gokrb5", "kdc2.test.gokrb5", "kdc3.test.gokrb5"}}}
+	d := &testKDCDialer{responses: map[string][]byte{
+		"kdc2.test.gokrb5:88": []byte("reply from kdc2"),
+		"kdc3.test.gokrb5:88": []byte("reply from kdc3"),
+	}}
+	cl := NewWithKeytab("testuser1", "TEST.GOKRB5", &keytab.Keytab{}, c, Dialer(d), KDCHedgeDelay(0), KDCBackoff(time.Hour))
+	for i := 0; i < 3; i++ {
+		rb, err := cl.sendToKDC([]byte("TGS_REQ"), "TEST.GOKRB5")
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("reply from kdc2"), rb)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	assert.Equal(t, []string{"kdc1.test.gokrb5:88", "kdc2.test.gokrb5:88", "kdc2.test.gokrb5:88", "kdc2.test.gokrb5:88"}, d.dialed,
+		"failed KDC should not be tried first by later requests of the client")
+}
@@ -1,10 +1,12 @@
 package client
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/oiweiwei/gokrb5.fork/v9/kadmin"
 	"github.com/oiweiwei/gokrb5.fork/v9/messages"
+	"github.com/oiweiwei/gokrb5.fork/v9/types"
 )
 
 // Kpasswd server response codes.
@@ -34,6 +36,29 @@ func (cl *Client) ChangePasswd(newPasswd string) (bool, error) {
 	if err != nil {
 		return false, err
 	}
+	if ok, err := cl.exchangeKPasswd(msg, key); !ok {
+		return false, err
+	}
+	cl.Credentials.WithPassword(newPasswd)
+	return true, nil
+}
+
+// SetPasswd sets the password of the target principal to the value provided using the set password protocol (RFC 3244).
+// The client's principal must be permitted by the KDC to reset the password of the target, for example an
+// administrator of an Active Directory domain.
+func (cl *Client) SetPasswd(targName types.PrincipalName, targRealm, newPasswd string) (bool, error) {
+	tkt, sessionKey, err := cl.GetServiceTicket("kadmin/changepw")
+	if err != nil {
+		return false, err
+	}
+	msg, key, err := kadmin.SetPasswdMsg(cl.Credentials.CName(), cl.Credentials.Domain(), targName, targRealm, newPasswd, tkt, sessionKey)
+	if err != nil {
+		return false, err
+	}
+	return cl.exchangeKPasswd(msg, key)
+}
+
+func (cl *Client) exchangeKPasswd(msg kadmin.Request, key types.EncryptionKey) (bool, error) {
 	r, err := cl.sendToKPasswd(msg)
 	if err != nil {
 		return false, err
@@ -45,7 +70,6 @@ func (cl *Client) ChangePasswd(newPasswd string) (bool, error) {
 	if r.ResultCode != KRB5_KPASSWD_SUCCESS {
 		return false, fmt.Errorf("error response from kadmin: code: %d; result: %s; krberror: %v", r.ResultCode, r.Result, r.KRBError)
 	}
-	cl.Credentials.WithPassword(newPasswd)
 	return true, nil
 }
 
@@ -59,13 +83,14 @@ func (cl *Client) sendToKPasswd(msg kadmin.Request) (r kadmin.Reply, err error)
 		return
 	}
 	var rb []byte
+	t := newNetworkTransport(cl.Config, cl.settings)
 	if len(b) <= cl.Config.LibDefaults.UDPPreferenceLimit {
-		rb, err = cl.dialSendUDP(kps, b)
+		rb, err = t.dialSendUDP(context.Background(), kps, b)
 		if err != nil {
 			return
 		}
 	} else {
-		rb, err = cl.dialSendTCP(kps, b)
+		rb, err = t.dialSendTCP(context.Background(), kps, b)
 		if err != nil {
 			return
 		}
@@ -0,0 +1,142 @@
+package client
+
+import (
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/errorcode"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/patype"
+	"github.com/oiweiwei/gokrb5.fork/v9/krberror"
+	"github.com/oiweiwei/gokrb5.fork/v9/messages"
+	"github.com/oiweiwei/gokrb5.fork/v9/spake"
+	"github.com/oiweiwei/gokrb5.fork/v9/types"
+)
+
+// PreAuthChallenge is a request from the KDC for a value from the user, such as a one-time password, during
+// pre-authentication.
+type PreAuthChallenge struct {
+	// PAType is the pre-authentication mechanism: patype.PA_OTP_CHALLENGE or patype.PA_SPAKE.
+	PAType int32
+	// Service is the name of the OTP service, if provided by the KDC.
+	Service string
+	// Token describes the OTP token a value is required from.
+	Token messages.OTPTokenInfo
+	// Factor is the SPAKE second factor offered by the KDC.
+	Factor spake.SPAKESecondFactor
+}
+
+// PreAuthResponse is the user's response to a PreAuthChallenge.
+type PreAuthResponse struct {
+	// Value is the one-time password or the SPAKE second factor data.
+	Value []byte
+	// PIN is the PIN of the OTP token, if one is to be sent.
+	PIN string
+}
+
+// Prompter supplies the user's response to a pre-authentication challenge from the KDC during Login.
+type Prompter func(challenge PreAuthChallenge) (PreAuthResponse, error)
+
+// otpRequest prompts for a one-time password for the first token in the KDC's PA-OTP-CHALLENGE and returns the
+// pre-authentication data to send in the armored AS_REQ: the PA-OTP-REQUEST and any PA-FX-COOKIE.
+func otpRequest(armor messages.FASTArmor, md types.PADataSequence, p Prompter) (types.PADataSequence, error) {
+	var ch messages.PAOTPChallenge
+	for _, pa := range md {
+		if pa.PADataType == patype.PA_OTP_CHALLENGE {
+			if err := ch.Unmarshal(pa.PADataValue); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	if len(ch.TokenInfo) == 0 {
+		return nil, krberror.New(krberror.KRBMsgError, "PA-OTP-CHALLENGE does not describe any tokens")
+	}
+	token := ch.TokenInfo[0]
+	r, err := p(PreAuthChallenge{
+		PAType:  patype.PA_OTP_CHALLENGE,
+		Service: ch.Service,
+		Token:   token,
+	})
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.KRBMsgError, "error getting one-time password")
+	}
+	pa, err := armor.OTPRequest(ch, token, r.Value, r.PIN)
+	if err != nil {
+		return nil, err
+	}
+	return append(fxCookie(md), pa), nil
+}
+
+// spakePreAuth performs SPAKE pre-authentication in the armored AS exchange. If the KDC indicated support for SPAKE
+// without a challenge the client's supported groups are sent to obtain one. The response to the challenge is then
+// sent, with the second factor provided by the prompter if SF-NONE is not offered.
+// The armored AS_REQ sent, the KDC's reply and the reply key are returned.
+func (cl *Client) spakePreAuth(armor messages.FASTArmor, krberr *messages.KRBError, md types.PADataSequence, ASReq messages.ASReq, realm string) (messages.ASReq, []byte, types.EncryptionKey, error) {
+	key, _, err := preAuthKey(cl, krberr, &ASReq)
+	if err != nil {
+		return ASReq, nil, types.EncryptionKey{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: failed getting SPAKE pre-authentication key")
+	}
+	sc := spake.NewClient(cl.Config.EtypeRegistry(), key)
+	pa := findPAData(md, patype.PA_SPAKE)
+	if len(pa.PADataValue) == 0 {
+		support, err := sc.Support()
+		if err != nil {
+			return ASReq, nil, types.EncryptionKey{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: failed creating SPAKE support message")
+		}
+		_, _, err = cl.sendArmoredASReq(armor, ASReq, append(fxCookie(md), support), realm)
+		if err == nil {
+			return ASReq, nil, types.EncryptionKey{}, krberror.New(krberror.KRBMsgError, "AS Exchange Error: KDC did not return a SPAKE challenge")
+		}
+		e, ok := err.(messages.KRBError)
+		if !ok || e.ErrorCode != errorcode.KDC_ERR_MORE_PREAUTH_DATA_REQUIRED {
+			return ASReq, nil, types.EncryptionKey{}, krberror.Errorf(err, krberror.KDCError, "AS Exchange Error: KDC did not return a SPAKE challenge")
+		}
+		md = types.PADataSequence{}
+		if err := md.Unmarshal(e.EData); err != nil {
+			return ASReq, nil, types.EncryptionKey{}, krberror.Errorf(err, krberror.EncodingError, "AS Exchange Error: error unmashalling KRBError data")
+		}
+		pa = findPAData(md, patype.PA_SPAKE)
+	}
+	bb, err := ASReq.ReqBody.Marshal()
+	if err != nil {
+		return ASReq, nil, types.EncryptionKey{}, krberror.Errorf(err, krberror.EncodingError, "AS Exchange Error: failed marshaling AS_REQ body")
+	}
+	resp, replyKey, err := sc.Response(pa, bb, spakeSecondFactor(cl.settings.PreAuthPrompter()))
+	if err != nil {
+		return ASReq, nil, types.EncryptionKey{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: failed creating SPAKE response")
+	}
+	armored, rb, err := cl.sendArmoredASReq(armor, ASReq, append(fxCookie(md), resp), realm)
+	return armored, rb, replyKey, err
+}
+
+// spakeSecondFactor returns the SPAKE second factor callback using the prompter, or nil if there is no prompter.
+func spakeSecondFactor(p Prompter) spake.SecondFactor {
+	if p == nil {
+		return nil
+	}
+	return func(f spake.SPAKESecondFactor) ([]byte, error) {
+		r, err := p(PreAuthChallenge{
+			PAType: patype.PA_SPAKE,
+			Factor: f,
+		})
+		return r.Value, err
+	}
+}
+
+// fxCookie returns the PA-FX-COOKIE in the KDC's pre-authentication data, if any, to be returned to the KDC.
+func fxCookie(md types.PADataSequence) types.PADataSequence {
+	var pas types.PADataSequence
+	for _, pa := range md {
+		if pa.PADataType == patype.PA_FX_COOKIE {
+			pas = append(pas, pa)
+		}
+	}
+	return pas
+}
+
+// findPAData returns the first pre-authentication data of the type provided.
+func findPAData(md types.PADataSequence, paType int32) types.PAData {
+	for _, pa := range md {
+		if pa.PADataType == paType {
+			return pa
+		}
+	}
+	return types.PAData{}
+}
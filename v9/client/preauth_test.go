@@ -0,0 +1,91 @@
+package client
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/oiweiwei/gokrb5.fork/v9/crypto"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/etypeID"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/nametype"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/patype"
+	"github.com/oiweiwei/gokrb5.fork/v9/messages"
+	"github.com/oiweiwei/gokrb5.fork/v9/spake"
+	"github.com/oiweiwei/gokrb5.fork/v9/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func testFASTArmor(t *testing.T) messages.FASTArmor {
+	et, _ := crypto.GetEtype(etypeID.AES256_CTS_HMAC_SHA1_96)
+	sessionKey, _ := types.GenerateEncryptionKey(et)
+	tgt := messages.Ticket{
+		TktVNO:  5,
+		Realm:   "TEST.GOKRB5",
+		SName:   types.PrincipalName{NameType: nametype.KRB_NT_SRV_INST, NameString: []string{"krbtgt", "TEST.GOKRB5"}},
+		EncPart: types.EncryptedData{EType: etypeID.AES256_CTS_HMAC_SHA1_96, KVNO: 1, Cipher: []byte("armor ticket")},
+	}
+	armor, err := messages.NewFASTArmor(crypto.DefaultRegistry(), tgt, sessionKey, types.NewAnonymousPrincipalName(), types.AnonymousRealm)
+	if err != nil {
+		t.Fatalf("error creating FAST armor: %v", err)
+	}
+	return armor
+}
+
+func TestOTPRequest(t *testing.T) {
+	t.Parallel()
+	armor := testFASTArmor(t)
+	ch := messages.PAOTPChallenge{
+		Nonce:     []byte("kdc nonce"),
+		Service:   "Example OTP Service",
+		TokenInfo: []messages.OTPTokenInfo{{Flags: types.NewKrbFlags(), Vendor: "Example Vendor"}},
+	}
+	cb, _ := ch.Marshal()
+	md := types.PADataSequence{
+		{PADataType: patype.PA_FX_COOKIE, PADataValue: []byte("cookie")},
+		{PADataType: patype.PA_OTP_CHALLENGE, PADataValue: cb},
+	}
+	var got PreAuthChallenge
+	pas, err := otpRequest(armor, md, func(c PreAuthChallenge) (PreAuthResponse, error) {
+		got = c
+		return PreAuthResponse{Value: []byte("123456")}, nil
+	})
+	if err != nil {
+		t.Fatalf("error creating OTP request: %v", err)
+	}
+	assert.Equal(t, patype.PA_OTP_CHALLENGE, got.PAType)
+	assert.Equal(t, "Example OTP Service", got.Service)
+	assert.Equal(t, "Example Vendor", got.Token.Vendor)
+	if assert.Len(t, pas, 2) {
+		assert.Equal(t, md[0], pas[0], "cookie should be returned to the KDC")
+		assert.Equal(t, patype.PA_OTP_REQUEST, pas[1].PADataType)
+		var req messages.PAOTPRequest
+		if assert.NoError(t, req.Unmarshal(pas[1].PADataValue)) {
+			assert.Equal(t, []byte("123456"), req.Value)
+		}
+	}
+
+	_, err = otpRequest(armor, md, func(c PreAuthChallenge) (PreAuthResponse, error) {
+		return PreAuthResponse{}, errors.New("cancelled")
+	})
+	assert.Error(t, err, "prompter error should be returned")
+}
+
+func TestSPAKESecondFactor(t *testing.T) {
+	t.Parallel()
+	assert.Nil(t, spakeSecondFactor(nil), "no callback expected without a prompter")
+	sf := spakeSecondFactor(func(c PreAuthChallenge) (PreAuthResponse, error) {
+		assert.Equal(t, patype.PA_SPAKE, c.PAType)
+		return PreAuthResponse{Value: c.Factor.Data}, nil
+	})
+	b, err := sf(spake.SPAKESecondFactor{Type: 2, Data: []byte("data")})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("data"), b)
+
+	// A KDC indicating SPAKE support without a challenge sends an empty PA-SPAKE
+	md := types.PADataSequence{{PADataType: patype.PA_SPAKE}}
+	mb, _ := asn1.Marshal(md)
+	var u types.PADataSequence
+	assert.NoError(t, u.Unmarshal(mb))
+	assert.Empty(t, findPAData(u, patype.PA_SPAKE).PADataValue)
+	assert.True(t, u.Contains(patype.PA_SPAKE))
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"net/http"
 	"time"
 )
 
@@ -19,7 +20,16 @@ type Settings struct {
 	preAuthEType            int32
 	logger                  *log.Logger
 	dialer                  KDCDialer
+	kdcProxyClient          *http.Client
+	kdcTimeout              time.Duration
+	kdcHedgeDelay           time.Duration
+	kdcBackoff              time.Duration
+	kdcHealth               *kdcHealth
+	transport               KDCTransport
 	anyServiceClassSPN      bool
+	enterprisePrincipal     bool
+	fastArmor               *Client
+	prompter                Prompter
 }
 
 // jsonSettings is used when marshaling the Settings details to JSON format.
@@ -30,7 +40,7 @@ type jsonSettings struct {
 
 // NewSettings creates a new client settings struct.
 func NewSettings(settings ...func(*Settings)) *Settings {
-	s := new(Settings)
+	s := &Settings{kdcHealth: newKDCHealth()}
 	for _, set := range settings {
 		set(s)
 	}
@@ -60,6 +70,37 @@ func AssumePreAuthentication(b bool) func(*Settings) {
 	}
 }
 
+// FASTArmor used to configure the client to protect its AS exchanges with FAST (RFC 6113) using the TGT of the armor
+// client provided, such as an anonymous PKINIT client or one with a host keytab. Armored AS exchanges use the one-time
+// password, SPAKE or encrypted challenge pre-authentication mechanisms.
+//
+// s := NewSettings(FASTArmor(armorClient))
+func FASTArmor(armor *Client) func(*Settings) {
+	return func(s *Settings) {
+		s.fastArmor = armor
+	}
+}
+
+// FASTArmor returns the client whose TGT is used to armor AS exchanges, or nil if AS exchanges are not armored.
+func (s *Settings) FASTArmor() *Client {
+	return s.fastArmor
+}
+
+// PreAuthPrompter used to configure the client with a prompter that supplies one-time passwords and second factors
+// requested by the KDC during Login. OTP (RFC 6560) and SPAKE second factor pre-authentication require FAST armor.
+//
+// s := NewSettings(FASTArmor(armorClient), PreAuthPrompter(p))
+func PreAuthPrompter(p Prompter) func(*Settings) {
+	return func(s *Settings) {
+		s.prompter = p
+	}
+}
+
+// PreAuthPrompter returns the prompter for pre-authentication challenges, or nil if none is configured.
+func (s *Settings) PreAuthPrompter() Prompter {
+	return s.prompter
+}
+
 // AnyServiceClassSPN used to configure the client to allow using tickets
 // matching target SPN that does not match the service class of the target service.
 // Microsoft Services do not require the service class to match the target SPN.
@@ -71,6 +112,22 @@ func AnyServiceClassSPN(b bool) func(*Settings) {
 	}
 }
 
+// EnterprisePrincipal used to configure the client to use the username as an enterprise principal name
+// (KRB_NT_ENTERPRISE, RFC 6806), such as the Active Directory user principal name user@suffix, which the KDC is asked
+// to canonicalize. See credentials.NewEnterprise.
+//
+// s := NewSettings(EnterprisePrincipal(true))
+func EnterprisePrincipal(b bool) func(*Settings) {
+	return func(s *Settings) {
+		s.enterprisePrincipal = b
+	}
+}
+
+// EnterprisePrincipal indicates if the client's username is used as an enterprise principal name.
+func (s *Settings) EnterprisePrincipal() bool {
+	return s.enterprisePrincipal
+}
+
 // AssumePreAuthentication indicates if the client should proactively assume using pre-authentication.
 func (s *Settings) AssumePreAuthentication() bool {
 	return s.assumePreAuthentication
@@ -107,6 +164,100 @@ func (s *Settings) Dialer() KDCDialer {
 	return &net.Dialer{Timeout: 5 * time.Minute}
 }
 
+// KDCProxyClient used to configure the client with the HTTP client used to send messages to KDC proxies (MS-KKDCP),
+// such as one with the TLS configuration to trust the proxies' certificates.
+//
+// s := NewSettings(KDCProxyClient(&http.Client{Timeout: 30 * time.Second}))
+func KDCProxyClient(c *http.Client) func(*Settings) {
+	return func(s *Settings) {
+		s.kdcProxyClient = c
+	}
+}
+
+// KDCProxyClient returns the HTTP client used to send messages to KDC proxies.
+func (s *Settings) KDCProxyClient() *http.Client {
+	if s.kdcProxyClient != nil {
+		return s.kdcProxyClient
+	}
+	return &http.Client{Timeout: 30 * time.Second}
+}
+
+// KDCTimeout used to configure the time allowed for each exchange with a KDC over UDP or TCP. The default is 5
+// seconds.
+//
+// s := NewSettings(KDCTimeout(10 * time.Second))
+func KDCTimeout(d time.Duration) func(*Settings) {
+	return func(s *Settings) {
+		s.kdcTimeout = d
+	}
+}
+
+// KDCTimeout returns the time allowed for each exchange with a KDC.
+func (s *Settings) KDCTimeout() time.Duration {
+	if s.kdcTimeout > 0 {
+		return s.kdcTimeout
+	}
+	return 5 * time.Second
+}
+
+// KDCHedgeDelay used to configure how long to wait for a reply from a KDC before also sending the request to the next
+// KDC of the realm, without abandoning the first. The first reply received is used. A KDC that cannot be reached is
+// moved on from immediately. The default is 1 second, as used by MIT krb5. A delay of zero or less disables hedging so
+// that each KDC is only tried once the previous one has failed or timed out.
+//
+// s := NewSettings(KDCHedgeDelay(500 * time.Millisecond))
+func KDCHedgeDelay(d time.Duration) func(*Settings) {
+	return func(s *Settings) {
+		if d <= 0 {
+			d = -1
+		}
+		s.kdcHedgeDelay = d
+	}
+}
+
+// KDCHedgeDelay returns how long to wait for a reply from a KDC before also trying the next. Zero or less indicates
+// that requests are not hedged.
+func (s *Settings) KDCHedgeDelay() time.Duration {
+	if s.kdcHedgeDelay == 0 {
+		return time.Second
+	}
+	return s.kdcHedgeDelay
+}
+
+// KDCBackoff used to configure how long a KDC that failed to respond is tried after the other KDCs of the realm.
+// The default is 1 minute.
+//
+// s := NewSettings(KDCBackoff(5 * time.Minute))
+func KDCBackoff(d time.Duration) func(*Settings) {
+	return func(s *Settings) {
+		s.kdcBackoff = d
+	}
+}
+
+// KDCBackoff returns how long a KDC that failed to respond is tried after the other KDCs of the realm.
+func (s *Settings) KDCBackoff() time.Duration {
+	if s.kdcBackoff > 0 {
+		return s.kdcBackoff
+	}
+	return time.Minute
+}
+
+// Transport used to configure the client with the transport used to send requests to KDCs in place of the default
+// NetworkTransport, such as one recording requests or using a shared connection pool. The Dialer, KDCProxyClient,
+// KDCTimeout, KDCHedgeDelay and KDCBackoff settings only apply to the default transport.
+//
+// s := NewSettings(Transport(t))
+func Transport(t KDCTransport) func(*Settings) {
+	return func(s *Settings) {
+		s.transport = t
+	}
+}
+
+// Transport returns the transport used to send requests to KDCs, or nil if the default NetworkTransport is used.
+func (s *Settings) Transport() KDCTransport {
+	return s.transport
+}
+
 // Log will write to the service's logger if it is configured.
 func (cl *Client) Log(format string, v ...interface{}) {
 	if cl.settings.Logger() != nil {
@@ -0,0 +1,477 @@
+package config
+
+import (
+	"bufio"
+	"context"
+	crand "crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Resolver looks up the DNS records used to locate the KDCs of realms and the realms of hosts.
+// The resolver of a configuration can be replaced with SetResolver, such as to fake the DNS in tests.
+type Resolver interface {
+	// LookupSRV looks up the SRV records of the service, as net.Resolver does.
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	// LookupTXT looks up the TXT records of the name, as net.Resolver does.
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+	// LookupURI looks up the URI records (RFC 7553) of the name.
+	LookupURI(ctx context.Context, name string) ([]*URI, error)
+}
+
+// URI is a DNS URI record as described in RFC 7553.
+type URI struct {
+	Priority uint16
+	Weight   uint16
+	Target   string
+}
+
+// KDCURI is the location of a KDC published in a _kerberos URI record of a realm, which has a target of the form
+// krb5srv:flags:transport:residual as described in the MIT krb5 documentation.
+type KDCURI struct {
+	// Master is true if the KDC is a master KDC of the realm, indicated by the m flag.
+	Master bool
+	// Transport is the transport of the KDC: udp, tcp or kkdcp for a KDC proxy (MS-KKDCP).
+	Transport string
+	// Address is the host:port of the KDC, or the URL of a KDC proxy.
+	Address string
+}
+
+// uriCacheLifetime is how long the _kerberos URI records of a realm looked up are used for, so that the KDCs and KDC
+// proxies of a realm located for a request are resolved from a single lookup.
+const uriCacheLifetime = 30 * time.Second
+
+// uriCache holds the results of the recent _kerberos URI record lookups of realms.
+type uriCache struct {
+	mu      sync.Mutex
+	entries map[string]uriCacheEntry
+}
+
+type uriCacheEntry struct {
+	uris    []*URI
+	err     error
+	expires time.Time
+}
+
+func newURICache() *uriCache {
+	return &uriCache{entries: make(map[string]uriCacheEntry)}
+}
+
+// SetResolver sets the resolver used to look up DNS records with this configuration in place of the default
+// resolver, which uses net.DefaultResolver and queries the system's name servers for URI records.
+func (c *Config) SetResolver(r Resolver) {
+	c.resolver = r
+	c.uris = newURICache()
+}
+
+// Resolver returns the resolver used to look up DNS records with this configuration.
+func (c *Config) Resolver() Resolver {
+	if c.resolver != nil {
+		return c.resolver
+	}
+	return defaultResolver{}
+}
+
+// ParseKDCURI parses the target of a _kerberos URI record of a realm.
+func ParseKDCURI(target string) (KDCURI, error) {
+	var k KDCURI
+	p := strings.SplitN(target, ":", 4)
+	if len(p) != 4 || !strings.EqualFold(p[0], "krb5srv") {
+		return k, fmt.Errorf("URI record target %s is not a krb5srv URI", target)
+	}
+	k.Master = strings.ContainsAny(p[1], "mM")
+	k.Transport = strings.ToLower(p[2])
+	switch k.Transport {
+	case "udp", "tcp":
+		k.Address = hostPort(p[3], "88")
+	case "kkdcp":
+		k.Address = p[3]
+	default:
+		return k, fmt.Errorf("URI record target %s has unsupported transport %s", target, p[2])
+	}
+	return k, nil
+}
+
+// LookupKDCURIs returns the KDCs of the realm published in its _kerberos URI records, keyed on preference order.
+// Records that are not valid krb5srv URIs are skipped. The records of a realm are looked up once and reused for a
+// short time.
+func (c *Config) LookupKDCURIs(realm string) (int, map[int]KDCURI, error) {
+	uris, err := c.lookupURI(realm)
+	ks := make(map[int]KDCURI)
+	if err != nil {
+		return 0, ks, err
+	}
+	var rs []dnsRecord
+	parsed := make(map[string]KDCURI)
+	for _, u := range uris {
+		k, err := ParseKDCURI(u.Target)
+		if err != nil {
+			continue
+		}
+		parsed[u.Target] = k
+		rs = append(rs, dnsRecord{priority: u.Priority, weight: u.Weight, target: u.Target})
+	}
+	for i, t := range orderRecords(rs) {
+		ks[i] = parsed[t]
+	}
+	return len(ks), ks, nil
+}
+
+// lookupURI returns the _kerberos URI records of the realm, from the cache if they were looked up recently.
+func (c *Config) lookupURI(realm string) ([]*URI, error) {
+	if c.uris == nil {
+		return c.Resolver().LookupURI(context.Background(), "_kerberos."+realm)
+	}
+	c.uris.mu.Lock()
+	defer c.uris.mu.Unlock()
+	now := time.Now()
+	if e, ok := c.uris.entries[realm]; ok && now.Before(e.expires) {
+		return e.uris, e.err
+	}
+	for r, e := range c.uris.entries {
+		if !now.Before(e.expires) {
+			delete(c.uris.entries, r)
+		}
+	}
+	uris, err := c.Resolver().LookupURI(context.Background(), "_kerberos."+realm)
+	c.uris.entries[realm] = uriCacheEntry{uris: uris, err: err, expires: now.Add(uriCacheLifetime)}
+	return uris, err
+}
+
+// lookupKDCs resolves the KDCs, or the master KDCs, of the realm for the protocol from the realm's _kerberos URI
+// records, if dns_uri_lookup is enabled, or, if there are none for the protocol, from its SRV records.
+func (c *Config) lookupKDCs(realm string, tcp, master bool) (int, map[int]string, error) {
+	proto := "udp"
+	if tcp {
+		proto = "tcp"
+	}
+	if !c.LibDefaults.DNSURILookup {
+		return c.lookupSRV(kdcService(master), proto, realm)
+	}
+	if _, uris, err := c.LookupKDCURIs(realm); err == nil {
+		kdcs := make(map[int]string)
+		for i := 1; i <= len(uris); i++ {
+			if uris[i].Transport == proto && (uris[i].Master || !master) {
+				kdcs[len(kdcs)+1] = uris[i].Address
+			}
+		}
+		if len(kdcs) > 0 {
+			return len(kdcs), kdcs, nil
+		}
+	}
+	return c.lookupSRV(kdcService(master), proto, realm)
+}
+
+// kdcService returns the service name of the SRV records of the KDCs, or the master KDCs, of a realm.
+func kdcService(master bool) string {
+	if master {
+		return "kerberos-master"
+	}
+	return "kerberos"
+}
+
+// lookupSRV returns the count of the targets of the SRV records of the service and a map of their host:port keyed
+// on preference order.
+func (c *Config) lookupSRV(service, proto, name string) (int, map[int]string, error) {
+	_, addrs, err := c.Resolver().LookupSRV(context.Background(), service, proto, name)
+	if err != nil {
+		return 0, make(map[int]string), err
+	}
+	rs := make([]dnsRecord, len(addrs))
+	for i, a := range addrs {
+		rs[i] = dnsRecord{
+			priority: a.Priority,
+			weight:   a.Weight,
+			target:   net.JoinHostPort(strings.TrimRight(a.Target, "."), strconv.Itoa(int(a.Port))),
+		}
+	}
+	o := orderRecords(rs)
+	return len(o), o, nil
+}
+
+// lookupRealm returns the realm of the host from the _kerberos TXT record of the host or, if it has none, the
+// record of the closest of its parent domains that has one.
+func (c *Config) lookupRealm(host string) string {
+	labels := strings.Split(host, ".")
+	for i := range labels {
+		txt, err := c.Resolver().LookupTXT(context.Background(), "_kerberos."+strings.Join(labels[i:], "."))
+		if err != nil {
+			continue
+		}
+		for _, r := range txt {
+			if r = strings.TrimSpace(r); r != "" {
+				return r
+			}
+		}
+	}
+	return ""
+}
+
+// dnsRecord is a DNS record that is ordered by priority and weight as described in RFC 2782.
+type dnsRecord struct {
+	priority uint16
+	weight   uint16
+	target   string
+}
+
+// orderRecords returns the targets of the records keyed on the order they should be used. Records of a lower
+// priority are used first, and those of the same priority in a random order weighted by their relative weights.
+func orderRecords(rs []dnsRecord) map[int]string {
+	rs = append([]dnsRecord(nil), rs...)
+	sort.SliceStable(rs, func(i, j int) bool { return rs[i].priority < rs[j].priority })
+	o := make(map[int]string)
+	for len(rs) > 0 {
+		// The records of the lowest priority remaining
+		n := 1
+		for n < len(rs) && rs[n].priority == rs[0].priority {
+			n++
+		}
+		var tw int
+		for _, r := range rs[:n] {
+			tw += int(r.weight)
+		}
+		var i int
+		if tw > 0 {
+			w := rand.Intn(tw)
+			for i = 0; i < n-1 && w >= int(rs[i].weight); i++ {
+				w -= int(rs[i].weight)
+			}
+		} else {
+			i = rand.Intn(n)
+		}
+		o[len(o)+1] = rs[i].target
+		rs = append(rs[:i], rs[i+1:]...)
+	}
+	return o
+}
+
+// defaultResolver looks up SRV and TXT records with net.DefaultResolver and URI records by querying the system's
+// name servers, which are those of /etc/resolv.conf or, on Windows, those of the network adapters.
+type defaultResolver struct{}
+
+func (defaultResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	return net.DefaultResolver.LookupSRV(ctx, service, proto, name)
+}
+
+func (defaultResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	return net.DefaultResolver.LookupTXT(ctx, name)
+}
+
+// typeURI is the DNS resource record type of URI records.
+const typeURI dnsmessage.Type = 256
+
+// LookupURI queries the system's name servers for the URI records of the name. The name is fully qualified so the
+// search domains of the system are not applied. Each name server is tried in turn, starting from a random one if the
+// rotate option is set, for the number of attempts and with the timeout of the system's resolver configuration.
+func (defaultResolver) LookupURI(ctx context.Context, name string) ([]*URI, error) {
+	n, err := dnsmessage.NewName(strings.TrimSuffix(name, ".") + ".")
+	if err != nil {
+		return nil, err
+	}
+	q := dnsmessage.Question{Name: n, Type: typeURI, Class: dnsmessage.ClassINET}
+	conf := systemDNSConfig()
+	servers := conf.servers
+	if conf.rotate && len(servers) > 1 {
+		i := rand.Intn(len(servers))
+		servers = append(servers[i:len(servers):len(servers)], servers[:i]...)
+	}
+	var errs []string
+	for a := 0; a < conf.attempts; a++ {
+		for _, ns := range servers {
+			uris, err := queryURI(ctx, ns, q, conf.timeout)
+			if err == nil {
+				return uris, nil
+			}
+			errs = append(errs, err.Error())
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+		}
+	}
+	return nil, fmt.Errorf("error looking up URI records of %s: %s", name, strings.Join(errs, "; "))
+}
+
+// queryURI sends the query for URI records to the name server, over TCP if the response over UDP is truncated, and
+// returns the URI records of the response.
+func queryURI(ctx context.Context, ns string, q dnsmessage.Question, timeout time.Duration) ([]*URI, error) {
+	idb := make([]byte, 2)
+	if _, err := crand.Read(idb); err != nil {
+		return nil, err
+	}
+	id := binary.BigEndian.Uint16(idb)
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true})
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(q); err != nil {
+		return nil, err
+	}
+	msg, err := b.Finish()
+	if err != nil {
+		return nil, err
+	}
+	rb, err := exchangeDNS(ctx, "udp", ns, msg, timeout)
+	if err == nil && len(rb) > 2 && rb[2]&0x02 != 0 {
+		// The response is truncated so repeat the query over TCP
+		rb, err = exchangeDNS(ctx, "tcp", ns, msg, timeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseURIResponse(rb, id, q)
+}
+
+// dnsConfig is the configuration of the system's resolver used to query for URI records.
+type dnsConfig struct {
+	servers  []string
+	timeout  time.Duration
+	attempts int
+	rotate   bool
+}
+
+// parseResolvConf parses the name servers and the timeout, attempts and rotate options of a resolv.conf file.
+// Defaults are those of the system resolver: the local name server, a timeout of 5 seconds and 2 attempts.
+func parseResolvConf(r io.Reader) dnsConfig {
+	conf := dnsConfig{
+		timeout:  5 * time.Second,
+		attempts: 2,
+	}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fs := strings.Fields(scanner.Text())
+		if len(fs) < 2 {
+			continue
+		}
+		switch fs[0] {
+		case "nameserver":
+			if ip := net.ParseIP(strings.SplitN(fs[1], "%", 2)[0]); ip != nil {
+				conf.servers = append(conf.servers, net.JoinHostPort(fs[1], "53"))
+			}
+		case "options":
+			for _, o := range fs[1:] {
+				switch {
+				case strings.HasPrefix(o, "timeout:"):
+					if n, err := strconv.Atoi(strings.TrimPrefix(o, "timeout:")); err == nil && n > 0 {
+						conf.timeout = time.Duration(n) * time.Second
+					}
+				case strings.HasPrefix(o, "attempts:"):
+					if n, err := strconv.Atoi(strings.TrimPrefix(o, "attempts:")); err == nil && n > 0 {
+						conf.attempts = n
+					}
+				case o == "rotate":
+					conf.rotate = true
+				}
+			}
+		}
+	}
+	if len(conf.servers) < 1 {
+		conf.servers = localNameServers()
+	}
+	return conf
+}
+
+// localNameServers returns the addresses of a name server on the local host.
+func localNameServers() []string {
+	return []string{"127.0.0.1:53", "[::1]:53"}
+}
+
+// exchangeDNS sends the DNS query to the name server and returns its response.
+func exchangeDNS(ctx context.Context, network, ns string, msg []byte, timeout time.Duration) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, ns)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if dl, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(dl)
+	}
+	if network == "tcp" {
+		l := make([]byte, 2)
+		binary.BigEndian.PutUint16(l, uint16(len(msg)))
+		msg = append(l, msg...)
+	}
+	if _, err := conn.Write(msg); err != nil {
+		return nil, err
+	}
+	if network == "tcp" {
+		l := make([]byte, 2)
+		if _, err := io.ReadFull(conn, l); err != nil {
+			return nil, err
+		}
+		rb := make([]byte, binary.BigEndian.Uint16(l))
+		_, err := io.ReadFull(conn, rb)
+		return rb, err
+	}
+	rb := make([]byte, 65535)
+	n, err := conn.Read(rb)
+	return rb[:n], err
+}
+
+// parseURIResponse returns the URI records in the answers of the DNS response to the query with the ID and question
+// provided.
+func parseURIResponse(rb []byte, id uint16, q dnsmessage.Question) ([]*URI, error) {
+	var p dnsmessage.Parser
+	h, err := p.Start(rb)
+	if err != nil {
+		return nil, err
+	}
+	if h.ID != id || !h.Response {
+		return nil, errors.New("DNS response does not match the query")
+	}
+	qs, err := p.AllQuestions()
+	if err != nil {
+		return nil, err
+	}
+	if len(qs) != 1 || qs[0].Type != q.Type || qs[0].Class != q.Class || !strings.EqualFold(qs[0].Name.String(), q.Name.String()) {
+		return nil, errors.New("DNS response question does not match the query")
+	}
+	if h.RCode == dnsmessage.RCodeNameError {
+		return nil, nil
+	}
+	if h.RCode != dnsmessage.RCodeSuccess {
+		return nil, fmt.Errorf("DNS query failed: %v", h.RCode)
+	}
+	var uris []*URI
+	for {
+		ah, err := p.AnswerHeader()
+		if err == dnsmessage.ErrSectionDone {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if ah.Type != typeURI {
+			if err := p.SkipAnswer(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		r, err := p.UnknownResource()
+		if err != nil {
+			return nil, err
+		}
+		if len(r.Data) < 4 {
+			return nil, errors.New("invalid URI record in DNS response")
+		}
+		uris = append(uris, &URI{
+			Priority: binary.BigEndian.Uint16(r.Data[0:2]),
+			Weight:   binary.BigEndian.Uint16(r.Data[2:4]),
+			Target:   string(r.Data[4:]),
+		})
+	}
+	return uris, nil
+}
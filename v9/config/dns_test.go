@@ -0,0 +1,195 @@
+package config
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// testResolver answers DNS lookups from the records it holds and counts the lookups of URI records.
+type testResolver struct {
+	srv        map[string][]*net.SRV
+	txt        map[string][]string
+	uri        map[string][]*URI
+	uriLookups *int
+}
+
+func (r testResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	n := "_" + service + "._" + proto + "." + name
+	if s, ok := r.srv[n]; ok {
+		return n, s, nil
+	}
+	return n, nil, errors.New("no such host")
+}
+
+func (r testResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if t, ok := r.txt[name]; ok {
+		return t, nil
+	}
+	return nil, errors.New("no such host")
+}
+
+func (r testResolver) LookupURI(ctx context.Context, name string) ([]*URI, error) {
+	if r.uriLookups != nil {
+		*r.uriLookups++
+	}
+	return r.uri[name], nil
+}
+
+func TestParseKDCURI(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		target string
+		want   KDCURI
+	}{
+		{"krb5srv:m:udp:kdc1.test.gokrb5", KDCURI{Master: true, Transport: "udp", Address: "kdc1.test.gokrb5:88"}},
+		{"krb5srv::tcp:kdc2.test.gokrb5:750", KDCURI{Transport: "tcp", Address: "kdc2.test.gokrb5:750"}},
+		{"KRB5SRV::TCP:[2001:db8::1]", KDCURI{Transport: "tcp", Address: "[2001:db8::1]:88"}},
+		{"krb5srv:m:kkdcp:https://proxy.test.gokrb5/KdcProxy", KDCURI{Master: true, Transport: "kkdcp", Address: "https://proxy.test.gokrb5/KdcProxy"}},
+	}
+	for _, test := range tests {
+		k, err := ParseKDCURI(test.target)
+		if assert.NoError(t, err, test.target) {
+			assert.Equal(t, test.want, k, test.target)
+		}
+	}
+	for _, target := range []string{"krb5srv:m:sctp:kdc.test.gokrb5", "https://kdc.test.gokrb5", "krb5srv:m:udp"} {
+		_, err := ParseKDCURI(target)
+		assert.Error(t, err, target)
+	}
+}
+
+func TestConfig_GetKDCsDNS(t *testing.T) {
+	t.Parallel()
+	c := New()
+	c.LibDefaults.DNSLookupKDC = true
+	var lookups int
+	r := testResolver{
+		uriLookups: &lookups,
+		uri: map[string][]*URI{
+			"_kerberos.TEST.GOKRB5": {
+				{Priority: 20, Weight: 1, Target: "krb5srv::udp:kdc2.test.gokrb5"},
+				{Priority: 10, Weight: 1, Target: "krb5srv:m:udp:kdc1.test.gokrb5:88"},
+				{Priority: 10, Weight: 1, Target: "krb5srv:m:kkdcp:https://proxy.test.gokrb5/KdcProxy"},
+				{Priority: 10, Weight: 1, Target: "not a kerberos URI"},
+			},
+		},
+		srv: map[string][]*net.SRV{
+			"_kerberos._tcp.TEST.GOKRB5":         {{Target: "kdc3.test.gokrb5.", Port: 88, Priority: 20}, {Target: "kdc4.test.gokrb5.", Port: 750, Priority: 10}},
+			"_kerberos-master._udp.OTHER.GOKRB5": {{Target: "master.other.gokrb5.", Port: 88}},
+		},
+	}
+	c.SetResolver(r)
+
+	count, kdcs, err := c.GetKDCs("TEST.GOKRB5", false)
+	if assert.NoError(t, err) && assert.Equal(t, 2, count) {
+		assert.Equal(t, map[int]string{1: "kdc1.test.gokrb5:88", 2: "kdc2.test.gokrb5:88"}, kdcs, "URI records should be used in priority order")
+	}
+	count, kdcs, err = c.GetKDCs("TEST.GOKRB5", true)
+	if assert.NoError(t, err) && assert.Equal(t, 2, count) {
+		assert.Equal(t, map[int]string{1: "kdc4.test.gokrb5:750", 2: "kdc3.test.gokrb5:88"}, kdcs, "SRV records should be used without URI records for TCP")
+	}
+	count, kdcs, err = c.GetMasterKDCs("TEST.GOKRB5", false)
+	if assert.NoError(t, err) && assert.Equal(t, 1, count) {
+		assert.Equal(t, "kdc1.test.gokrb5:88", kdcs[1])
+	}
+	count, kdcs, err = c.GetMasterKDCs("OTHER.GOKRB5", false)
+	if assert.NoError(t, err) && assert.Equal(t, 1, count) {
+		assert.Equal(t, "master.other.gokrb5:88", kdcs[1])
+	}
+	count, proxies, err := c.GetKDCProxies("TEST.GOKRB5")
+	if assert.NoError(t, err) && assert.Equal(t, 1, count) {
+		assert.Equal(t, "https://proxy.test.gokrb5/KdcProxy", proxies[1])
+	}
+	_, _, err = c.GetKDCProxies("OTHER.GOKRB5")
+	assert.Error(t, err)
+	assert.Equal(t, 2, lookups, "URI records of a realm should be looked up once")
+
+	c.LibDefaults.DNSURILookup = false
+	count, kdcs, err = c.GetKDCs("TEST.GOKRB5", true)
+	if assert.NoError(t, err) && assert.Equal(t, 2, count) {
+		assert.Equal(t, "kdc4.test.gokrb5:750", kdcs[1])
+	}
+	_, _, err = c.GetKDCs("TEST.GOKRB5", false)
+	assert.Error(t, err, "URI records should not be used when dns_uri_lookup is false")
+	_, _, err = c.GetKDCProxies("TEST.GOKRB5")
+	assert.Error(t, err, "URI records should not be used when dns_uri_lookup is false")
+	assert.Equal(t, 2, lookups, "URI records should not be looked up when dns_uri_lookup is false")
+
+	c.LibDefaults.DNSLookupKDC = false
+	_, _, err = c.GetKDCs("TEST.GOKRB5", false)
+	assert.Error(t, err, "DNS should not be used when dns_lookup_kdc is false")
+}
+
+func TestResolveRealm_TXT(t *testing.T) {
+	t.Parallel()
+	c := New()
+	c.DomainRealm.addMapping(".mapped.gokrb5", "MAPPED.GOKRB5")
+	c.SetResolver(testResolver{txt: map[string][]string{
+		"_kerberos.test.gokrb5":        {"TEST.GOKRB5"},
+		"_kerberos.host.mapped.gokrb5": {"DNS.GOKRB5"},
+	}})
+	assert.Equal(t, "", c.ResolveRealm("host.sub.test.gokrb5"), "TXT records should not be used when dns_lookup_realm is false")
+	c.LibDefaults.DNSLookupRealm = true
+	assert.Equal(t, "TEST.GOKRB5", c.ResolveRealm("host.sub.test.gokrb5"))
+	assert.Equal(t, "MAPPED.GOKRB5", c.ResolveRealm("host.mapped.gokrb5"), "domain_realm mapping should take precedence")
+	assert.Equal(t, "", c.ResolveRealm("host.unknown.gokrb5"))
+}
+
+func TestParseURIResponse(t *testing.T) {
+	t.Parallel()
+	name := dnsmessage.MustNewName("_kerberos.TEST.GOKRB5.")
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: 42, Response: true})
+	assert.NoError(t, b.StartQuestions())
+	assert.NoError(t, b.Question(dnsmessage.Question{Name: name, Type: typeURI, Class: dnsmessage.ClassINET}))
+	assert.NoError(t, b.StartAnswers())
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint16(data[0:2], 10)
+	binary.BigEndian.PutUint16(data[2:4], 5)
+	data = append(data, "krb5srv:m:tcp:kdc1.test.gokrb5"...)
+	assert.NoError(t, b.UnknownResource(dnsmessage.ResourceHeader{Name: name, Type: typeURI, Class: dnsmessage.ClassINET}, dnsmessage.UnknownResource{Type: typeURI, Data: data}))
+	assert.NoError(t, b.TXTResource(dnsmessage.ResourceHeader{Name: name, Class: dnsmessage.ClassINET}, dnsmessage.TXTResource{TXT: []string{"TEST.GOKRB5"}}))
+	msg, err := b.Finish()
+	if err != nil {
+		t.Fatalf("error building DNS response: %v", err)
+	}
+	q := dnsmessage.Question{Name: dnsmessage.MustNewName("_kerberos.test.gokrb5."), Type: typeURI, Class: dnsmessage.ClassINET}
+	uris, err := parseURIResponse(msg, 42, q)
+	if assert.NoError(t, err) && assert.Len(t, uris, 1) {
+		assert.Equal(t, URI{Priority: 10, Weight: 5, Target: "krb5srv:m:tcp:kdc1.test.gokrb5"}, *uris[0])
+	}
+	_, err = parseURIResponse(msg, 43, q)
+	assert.Error(t, err, "response to another query should not be accepted")
+	_, err = parseURIResponse(msg, 42, dnsmessage.Question{Name: dnsmessage.MustNewName("_kerberos.OTHER.GOKRB5."), Type: typeURI, Class: dnsmessage.ClassINET})
+	assert.Error(t, err, "response to a question for another name should not be accepted")
+	_, err = parseURIResponse(msg, 42, dnsmessage.Question{Name: q.Name, Type: dnsmessage.TypeTXT, Class: dnsmessage.ClassINET})
+	assert.Error(t, err, "response to a question for another type should not be accepted")
+}
+
+func TestParseResolvConf(t *testing.T) {
+	t.Parallel()
+	conf := parseResolvConf(strings.NewReader(`# comment
+search test.gokrb5
+nameserver 10.80.88.1
+nameserver fe80::1%eth0
+nameserver notanaddress
+options ndots:2 timeout:3 attempts:4 rotate
+`))
+	assert.Equal(t, []string{"10.80.88.1:53", "[fe80::1%eth0]:53"}, conf.servers)
+	assert.Equal(t, 3*time.Second, conf.timeout)
+	assert.Equal(t, 4, conf.attempts)
+	assert.True(t, conf.rotate)
+
+	conf = parseResolvConf(strings.NewReader(""))
+	assert.Equal(t, localNameServers(), conf.servers)
+	assert.Equal(t, 5*time.Second, conf.timeout)
+	assert.Equal(t, 2, conf.attempts)
+	assert.False(t, conf.rotate)
+}
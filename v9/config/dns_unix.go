@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package config
+
+import (
+	"os"
+	"strings"
+)
+
+// systemDNSConfig returns the name servers and resolver options configured in /etc/resolv.conf.
+func systemDNSConfig() dnsConfig {
+	f, err := os.Open("/etc/resolv.conf")
+	if err != nil {
+		return parseResolvConf(strings.NewReader(""))
+	}
+	defer f.Close()
+	return parseResolvConf(f)
+}
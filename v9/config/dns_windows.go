@@ -0,0 +1,71 @@
+//go:build windows
+// +build windows
+
+package config
+
+import (
+	"net"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// systemDNSConfig returns the name servers of the network adapters that are up, with the default resolver options.
+func systemDNSConfig() dnsConfig {
+	conf := parseResolvConf(strings.NewReader(""))
+	if ns := adapterNameServers(); len(ns) > 0 {
+		conf.servers = ns
+	}
+	return conf
+}
+
+// adapterNameServers returns the addresses of the DNS servers of the network adapters that are up.
+func adapterNameServers() []string {
+	l := uint32(15000) // recommended initial size
+	var b []byte
+	for {
+		b = make([]byte, l)
+		err := windows.GetAdaptersAddresses(syscall.AF_UNSPEC, windows.GAA_FLAG_INCLUDE_PREFIX, 0, (*windows.IpAdapterAddresses)(unsafe.Pointer(&b[0])), &l)
+		if err == nil {
+			if l == 0 {
+				return nil
+			}
+			break
+		}
+		if err.(syscall.Errno) != syscall.ERROR_BUFFER_OVERFLOW {
+			return nil
+		}
+		if l <= uint32(len(b)) {
+			return nil
+		}
+	}
+	var ns []string
+	for aa := (*windows.IpAdapterAddresses)(unsafe.Pointer(&b[0])); aa != nil; aa = aa.Next {
+		if aa.OperStatus != windows.IfOperStatusUp {
+			continue
+		}
+		for dns := aa.FirstDnsServerAddress; dns != nil; dns = dns.Next {
+			sa, err := dns.Address.Sockaddr.Sockaddr()
+			if err != nil {
+				continue
+			}
+			var ip net.IP
+			switch sa := sa.(type) {
+			case *syscall.SockaddrInet4:
+				ip = net.IP(sa.Addr[:])
+			case *syscall.SockaddrInet6:
+				ip = net.IP(sa.Addr[:])
+				if ip[0] == 0xfe && ip[1] == 0xc0 {
+					// Ignore the deprecated site-local addresses Windows lists as default DNS servers
+					continue
+				}
+			default:
+				continue
+			}
+			ns = append(ns, net.JoinHostPort(ip.String(), "53"))
+		}
+	}
+	return ns
+}
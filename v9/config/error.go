@@ -1,6 +1,9 @@
 package config
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 // UnsupportedDirective error.
 type UnsupportedDirective struct {
@@ -28,3 +31,47 @@ func InvalidErrorf(format string, a ...interface{}) Invalid {
 		text: fmt.Sprintf("invalid krb5 config "+format, a...),
 	}
 }
+
+// Problem is an issue found in a line of the configuration when it is parsed.
+type Problem struct {
+	// File is the path of the configuration file, or empty if the configuration was not loaded from a file.
+	File string
+	// Line is the number of the line in the file, starting at 1.
+	Line int
+	// Section is the section of the configuration the line is in.
+	Section string
+	// Text describes the problem.
+	Text string
+}
+
+// Error implements the error interface for a configuration problem.
+func (p Problem) Error() string {
+	if p.File != "" {
+		return fmt.Sprintf("%s:%d: %s", p.File, p.Line, p.Text)
+	}
+	return fmt.Sprintf("line %d: %s", p.Line, p.Text)
+}
+
+// ValidationError holds all of the problems found in the configuration, such as unknown sections and relations,
+// invalid values and unsupported directives.
+type ValidationError struct {
+	Problems []Problem
+}
+
+// Error implements the error interface for the problems found in the configuration.
+func (e ValidationError) Error() string {
+	s := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		s[i] = p.Error()
+	}
+	return fmt.Sprintf("invalid krb5 config: %d problem(s) found:\n%s", len(e.Problems), strings.Join(s, "\n"))
+}
+
+// Unwrap returns the problems found in the configuration as errors.
+func (e ValidationError) Unwrap() []error {
+	errs := make([]error, len(e.Problems))
+	for i, p := range e.Problems {
+		errs[i] = p
+	}
+	return errs
+}
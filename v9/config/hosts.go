@@ -2,12 +2,8 @@ package config
 
 import (
 	"fmt"
-	"math/rand"
 	"net"
-	"strconv"
 	"strings"
-
-	"github.com/jcmturner/dnsutils/v2"
 )
 
 // GetKDCs returns the count of KDCs available and a map of KDC host names keyed on preference order.
@@ -20,41 +16,128 @@ func (c *Config) GetKDCs(realm string, tcp bool) (int, map[int]string, error) {
 
 	// Get the KDCs from the krb5.conf.
 	var ks []string
+	var proxied bool // the realm's KDCs are configured as KDC proxies
 	for _, r := range c.Realms {
 		if r.Realm != realm {
 			continue
 		}
-		ks = r.KDC
+		ks = kdcAddresses(r.KDC)
+		proxied = len(r.KDC) > len(ks)
 	}
 	count = len(ks)
 
 	if count > 0 {
-		// Order the kdcs randomly for preference.
-		kdcs = randServOrder(ks)
+		// The kdcs are preferred in the order they are configured.
+		kdcs = servOrder(ks)
 		return count, kdcs, nil
 	}
 
-	if !c.LibDefaults.DNSLookupKDC {
+	if proxied || !c.LibDefaults.DNSLookupKDC {
 		return count, kdcs, fmt.Errorf("no KDCs defined in configuration for realm %s", realm)
 	}
 
-	// Use DNS to resolve kerberos SRV records.
-	proto := "udp"
-	if tcp {
-		proto = "tcp"
+	// Use DNS to resolve the KDCs from the URI or SRV records of the realm.
+	return c.lookupKDCs(realm, tcp, false)
+}
+
+// GetMasterKDCs returns the count of master KDCs of the realm available and a map of their host names keyed on
+// preference order. The master KDCs are those configured by the master_kdc relation of the realm or, if there are
+// none and DNS lookups of KDCs are enabled, found from the _kerberos-master SRV records of the realm.
+func (c *Config) GetMasterKDCs(realm string, tcp bool) (int, map[int]string, error) {
+	if realm == "" {
+		realm = c.LibDefaults.DefaultRealm
+	}
+	kdcs := make(map[int]string)
+	var ks []string
+	for _, r := range c.Realms {
+		if r.Realm == realm {
+			ks = kdcAddresses(r.MasterKDC)
+			break
+		}
+	}
+	if len(ks) > 0 {
+		return len(ks), servOrder(ks), nil
+	}
+	if !c.LibDefaults.DNSLookupKDC {
+		return 0, kdcs, fmt.Errorf("no master KDCs defined in configuration for realm %s", realm)
+	}
+	return c.lookupKDCs(realm, tcp, true)
+}
+
+// GetKDCProxies returns the count of the KDC proxies (MS-KKDCP) of the realm and a map of their URLs keyed on
+// preference order. KDC proxies are configured by kdc relations of the realm with https URLs, such as
+// kdc = https://kdc.example.com/KdcProxy. If the realm has no KDCs configured and DNS lookups of KDCs and URI
+// records are enabled KDC proxies are found from the kkdcp _kerberos URI records of the realm.
+func (c *Config) GetKDCProxies(realm string) (int, map[int]string, error) {
+	if realm == "" {
+		realm = c.LibDefaults.DefaultRealm
+	}
+	proxies := make(map[int]string)
+	var ks, ps []string
+	for _, r := range c.Realms {
+		if r.Realm == realm {
+			ks = r.KDC
+			break
+		}
 	}
-	index, addrs, err := dnsutils.OrderedSRV("kerberos", proto, realm)
+	for _, k := range ks {
+		if IsKDCProxy(k) {
+			ps = append(ps, strings.TrimSpace(k))
+		}
+	}
+	if len(ps) > 0 {
+		return len(ps), servOrder(ps), nil
+	}
+	if len(ks) > 0 || !c.LibDefaults.DNSLookupKDC || !c.LibDefaults.DNSURILookup {
+		return 0, proxies, fmt.Errorf("no KDC proxies defined in configuration for realm %s", realm)
+	}
+	_, uris, err := c.LookupKDCURIs(realm)
 	if err != nil {
-		return count, kdcs, err
+		return 0, proxies, err
 	}
-	if len(addrs) < 1 {
-		return count, kdcs, fmt.Errorf("no KDC SRV records found for realm %s", realm)
+	for i := 1; i <= len(uris); i++ {
+		if uris[i].Transport == "kkdcp" {
+			proxies[len(proxies)+1] = uris[i].Address
+		}
 	}
-	count = index
-	for k, v := range addrs {
-		kdcs[k] = strings.TrimRight(v.Target, ".") + ":" + strconv.Itoa(int(v.Port))
+	if len(proxies) < 1 {
+		return 0, proxies, fmt.Errorf("no KDC proxy URI records found for realm %s", realm)
 	}
-	return count, kdcs, nil
+	return len(proxies), proxies, nil
+}
+
+// kdcAddresses returns the addresses of the KDCs configured as host:port, adding the default port 88 to any address
+// without one. KDC proxy URLs are omitted.
+func kdcAddresses(ks []string) []string {
+	var a []string
+	for _, k := range ks {
+		if !IsKDCProxy(k) {
+			a = append(a, hostPort(k, "88"))
+		}
+	}
+	return a
+}
+
+// IsKDCProxy returns true if the KDC address configured is the https URL of a KDC proxy (MS-KKDCP).
+func IsKDCProxy(kdc string) bool {
+	return len(kdc) > 8 && strings.EqualFold(kdc[:8], "https://")
+}
+
+// hostPort returns the address of a server as host:port, adding the port provided if the address does not specify
+// one. IPv6 literals may be given with or without square brackets, such as [::1]:88, [::1] or ::1, and are returned
+// in brackets.
+func hostPort(s, port string) string {
+	s = strings.TrimSpace(s)
+	if IsKDCProxy(s) {
+		return s
+	}
+	if h, p, err := net.SplitHostPort(s); err == nil {
+		if p == "" {
+			p = port
+		}
+		return net.JoinHostPort(h, p)
+	}
+	return net.JoinHostPort(strings.TrimSuffix(strings.TrimPrefix(s, "["), "]"), port)
 }
 
 // GetKpasswdServers returns the count of kpasswd servers available and a map of kpasswd host names keyed on preference order.
@@ -69,12 +152,12 @@ func (c *Config) GetKpasswdServers(realm string, tcp bool) (int, map[int]string,
 		if tcp {
 			proto = "tcp"
 		}
-		c, addrs, err := dnsutils.OrderedSRV("kpasswd", proto, realm)
+		n, addrs, err := c.lookupSRV("kpasswd", proto, realm)
 		if err != nil {
 			return count, kdcs, err
 		}
-		if c < 1 {
-			c, addrs, err = dnsutils.OrderedSRV("kerberos-adm", proto, realm)
+		if n < 1 {
+			n, addrs, err = c.lookupSRV("kerberos-adm", proto, realm)
 			if err != nil {
 				return count, kdcs, err
 			}
@@ -82,12 +165,10 @@ func (c *Config) GetKpasswdServers(realm string, tcp bool) (int, map[int]string,
 		if len(addrs) < 1 {
 			return count, kdcs, fmt.Errorf("no kpasswd or kadmin SRV records found for realm %s", realm)
 		}
-		count = c
-		for k, v := range addrs {
-			kdcs[k] = strings.TrimRight(v.Target, ".") + ":" + strconv.Itoa(int(v.Port))
-		}
+		count = n
+		kdcs = addrs
 	} else {
-		// Get the KDCs from the krb5.conf an order them randomly for preference.
+		// Get the kpasswd servers from the krb5.conf in the order they are configured.
 		var ks []string
 		var ka []string
 		for _, r := range c.Realms {
@@ -110,32 +191,17 @@ func (c *Config) GetKpasswdServers(realm string, tcp bool) (int, map[int]string,
 		if count < 1 {
 			return count, kdcs, fmt.Errorf("no kpasswd or kadmin defined in configuration for realm %s", realm)
 		}
-		kdcs = randServOrder(ks)
+		kdcs = servOrder(ks)
 	}
 	return count, kdcs, nil
 }
 
-func randServOrder(ks []string) map[int]string {
+// servOrder returns the servers keyed on preference order, which is the order they are configured in as it is for
+// MIT krb5. The order is stable so that clients tracking the health of servers try them consistently.
+func servOrder(ks []string) map[int]string {
 	kdcs := make(map[int]string)
-	count := len(ks)
-	i := 1
-	if count > 1 {
-		l := len(ks)
-		for l > 0 {
-			ri := rand.Intn(l)
-			kdcs[i] = ks[ri]
-			if l > 1 {
-				// Remove the entry from the source slice by swapping with the last entry and truncating
-				ks[len(ks)-1], ks[ri] = ks[ri], ks[len(ks)-1]
-				ks = ks[:len(ks)-1]
-				l = len(ks)
-			} else {
-				l = 0
-			}
-			i++
-		}
-	} else {
-		kdcs[i] = ks[0]
+	for i, k := range ks {
+		kdcs[i+1] = k
 	}
 	return kdcs
 }
@@ -101,3 +101,61 @@ func TestResolveKDCNoDNS(t *testing.T) {
 		assert.True(t, found, "Record %s not found in results", s)
 	}
 }
+
+func TestConfig_GetKDCsAddresses(t *testing.T) {
+	t.Parallel()
+	c, err := NewFromString(`
+[realms]
+ TEST.GOKRB5 = {
+  kdc = [2001:db8::1]:750
+  kdc = [2001:db8::2]
+  kdc = 2001:db8::3
+ }
+`)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	assert.Equal(t, []string{"[2001:db8::1]:750", "[2001:db8::2]:88", "[2001:db8::3]:88"}, c.Realms[0].KDC)
+
+	c.Realms = append(c.Realms, Realm{
+		Realm:     "OTHER.GOKRB5",
+		KDC:       []string{"kdc.other.gokrb5"},
+		MasterKDC: []string{"master.other.gokrb5", "[2001:db8::4]:8888"},
+	})
+	count, kdcs, err := c.GetKDCs("OTHER.GOKRB5", false)
+	if assert.NoError(t, err) && assert.Equal(t, 1, count) {
+		assert.Equal(t, "kdc.other.gokrb5:88", kdcs[1])
+	}
+	assert.Equal(t, []string{"kdc.other.gokrb5"}, c.Realms[1].KDC, "configured KDCs should not be modified")
+
+	count, kdcs, err = c.GetMasterKDCs("OTHER.GOKRB5", true)
+	if assert.NoError(t, err) && assert.Equal(t, 2, count) {
+		assert.ElementsMatch(t, []string{"master.other.gokrb5:88", "[2001:db8::4]:8888"}, []string{kdcs[1], kdcs[2]})
+	}
+	_, _, err = c.GetMasterKDCs("TEST.GOKRB5", false)
+	assert.Error(t, err, "no master KDCs are configured")
+}
+
+func TestConfig_GetKDCProxies(t *testing.T) {
+	t.Parallel()
+	c, err := NewFromString(`
+[libdefaults]
+ dns_lookup_kdc = true
+
+[realms]
+ TEST.GOKRB5 = {
+  kdc = https://kdc.test.gokrb5:8443/KdcProxy
+ }
+`)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	assert.Equal(t, []string{"https://kdc.test.gokrb5:8443/KdcProxy"}, c.Realms[0].KDC, "KDC proxy URL should not be modified")
+	count, proxies, err := c.GetKDCProxies("TEST.GOKRB5")
+	if assert.NoError(t, err) && assert.Equal(t, 1, count) {
+		assert.Equal(t, "https://kdc.test.gokrb5:8443/KdcProxy", proxies[1])
+	}
+	_, _, err = c.GetKDCs("TEST.GOKRB5", true)
+	assert.Error(t, err, "KDC proxies should not be returned as KDCs or DNS used")
+	assert.NoError(t, c.Validate())
+}
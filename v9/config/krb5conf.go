@@ -11,12 +11,14 @@ import (
 	"net"
 	"os"
 	"os/user"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/oiweiwei/gokrb5.fork/v9/crypto"
 	"github.com/oiweiwei/gokrb5.fork/v9/iana/etypeID"
 )
 
@@ -25,9 +27,16 @@ type Config struct {
 	LibDefaults LibDefaults
 	Realms      []Realm
 	DomainRealm DomainRealm
-	//CaPaths
+	CaPaths     CaPaths `json:",omitempty"`
 	//AppDefaults
 	//Plugins
+	registry *crypto.Registry
+	// capathsFinal holds the [capaths] client realm subsections and paths marked final, keyed on the client realm
+	// and on the client and server realms separated by a space respectively, so that they are kept when marshalled.
+	capathsFinal map[string]bool
+	resolver     Resolver
+	uris         *uriCache
+	problems     []Problem // problems found when parsing the configuration
 }
 
 // WeakETypeList is a list of encryption types that have been deemed weak.
@@ -36,10 +45,13 @@ const WeakETypeList = "des-cbc-crc des-cbc-md4 des-cbc-md5 des-cbc-raw des3-cbc-
 // New creates a new config struct instance.
 func New() *Config {
 	d := make(DomainRealm)
-	return &Config{
-		LibDefaults: newLibDefaults(),
+	c := &Config{
 		DomainRealm: d,
+		CaPaths:     make(CaPaths),
+		uris:        newURICache(),
 	}
+	c.LibDefaults = newLibDefaults(c.EtypeRegistry())
+	return c
 }
 
 // LibDefaults represents the [libdefaults] section of the configuration.
@@ -60,10 +72,11 @@ type LibDefaults struct {
 	DNSCanonicalizeHostname bool     //default true
 	DNSLookupKDC            bool     //default false
 	DNSLookupRealm          bool
+	DNSURILookup            bool           //default true
 	ExtraAddresses          []net.IP       //Not implementing yet
 	Forwardable             bool           //default false
 	IgnoreAcceptorHostname  bool           //default false
-	K5LoginAuthoritative    bool           //default false
+	K5LoginAuthoritative    bool           //default true
 	K5LoginDirectory        string         //default user's home directory. Must be owned by the user or root
 	KDCDefaultOptions       asn1.BitString //default 0x00000010 (KDC_OPT_RENEWABLE_OK)
 	KDCTimeSync             int            //default 1
@@ -81,10 +94,13 @@ type LibDefaults struct {
 	TicketLifetime        time.Duration //default 1 day
 	UDPPreferenceLimit    int           // 1 means to always use tcp. MIT krb5 has a default value of 1465, and it prevents user setting more than 32700.
 	VerifyAPReqNofail     bool          //default false
+
+	k5LoginDirectorySet     bool // k5login_directory is configured rather than defaulted
+	k5LoginAuthoritativeSet bool // k5login_authoritative is configured rather than defaulted
 }
 
-// Create a new LibDefaults struct.
-func newLibDefaults() LibDefaults {
+// Create a new LibDefaults struct resolving the default encryption types against the registry.
+func newLibDefaults(r *crypto.Registry) LibDefaults {
 	uid := "0"
 	var hdir string
 	usr, _ := user.Current()
@@ -103,6 +119,7 @@ func newLibDefaults() LibDefaults {
 		DefaultTGSEnctypes:      []string{"aes256-cts-hmac-sha1-96", "aes128-cts-hmac-sha1-96", "des3-cbc-sha1", "arcfour-hmac-md5", "camellia256-cts-cmac", "camellia128-cts-cmac", "des-cbc-crc", "des-cbc-md5", "des-cbc-md4"},
 		DefaultTktEnctypes:      []string{"aes256-cts-hmac-sha1-96", "aes128-cts-hmac-sha1-96", "des3-cbc-sha1", "arcfour-hmac-md5", "camellia256-cts-cmac", "camellia128-cts-cmac", "des-cbc-crc", "des-cbc-md5", "des-cbc-md4"},
 		DNSCanonicalizeHostname: true,
+		DNSURILookup:            true,
 		K5LoginDirectory:        hdir,
 		KDCDefaultOptions:       opts,
 		KDCTimeSync:             1,
@@ -115,202 +132,236 @@ func newLibDefaults() LibDefaults {
 		UDPPreferenceLimit:      1465,
 		PreferredPreauthTypes:   []int{17, 16, 15, 14},
 	}
-	l.DefaultTGSEnctypeIDs = parseETypes(l.DefaultTGSEnctypes, l.AllowWeakCrypto)
-	l.DefaultTktEnctypeIDs = parseETypes(l.DefaultTktEnctypes, l.AllowWeakCrypto)
-	l.PermittedEnctypeIDs = parseETypes(l.PermittedEnctypes, l.AllowWeakCrypto)
+	l.DefaultTGSEnctypeIDs = parseETypes(l.DefaultTGSEnctypes, l.AllowWeakCrypto, r)
+	l.DefaultTktEnctypeIDs = parseETypes(l.DefaultTktEnctypes, l.AllowWeakCrypto, r)
+	l.PermittedEnctypeIDs = parseETypes(l.PermittedEnctypes, l.AllowWeakCrypto, r)
 	return l
 }
 
-// Parse the lines of the [libdefaults] section of the configuration into the LibDefaults struct.
-func (l *LibDefaults) parseLines(lines []string) error {
-	for _, line := range lines {
-		//Remove comments after the values
-		if idx := strings.IndexAny(line, "#;"); idx != -1 {
-			line = line[:idx]
+// Parse the lines of the [libdefaults] section of the configuration into the LibDefaults struct. The problems found,
+// such as unknown relations and invalid values, are passed to the problem function with the index of their line and
+// the lines that follow an invalid line are still parsed. The first invalid line found is returned as an error.
+// The encryption types configured are resolved against the registry.
+func (l *LibDefaults) parseLines(lines []string, r *crypto.Registry, problem func(i int, err error)) error {
+	var err error
+	for i, line := range lines {
+		e := l.parseLine(line, r, func(e error) { problem(i, e) })
+		if e != nil {
+			problem(i, e)
+			if err == nil {
+				err = e
+			}
 		}
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
+	}
+	l.DefaultTGSEnctypeIDs = parseETypes(l.DefaultTGSEnctypes, l.AllowWeakCrypto, r)
+	l.DefaultTktEnctypeIDs = parseETypes(l.DefaultTktEnctypes, l.AllowWeakCrypto, r)
+	l.PermittedEnctypeIDs = parseETypes(l.PermittedEnctypes, l.AllowWeakCrypto, r)
+	return err
+}
+
+// parseLine parses a line of the [libdefaults] section into the LibDefaults struct, returning an error if it is
+// invalid. Unknown relations and values that are not supported but do not prevent the line being parsed are passed to
+// the problem function.
+func (l *LibDefaults) parseLine(line string, r *crypto.Registry, problem func(err error)) error {
+	//Remove comments after the values
+	if idx := strings.IndexAny(line, "#;"); idx != -1 {
+		line = line[:idx]
+	}
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil
+	}
+	if !strings.Contains(line, "=") {
+		return InvalidErrorf("libdefaults section line (%s)", line)
+	}
+
+	p := strings.Split(line, "=")
+	key := strings.TrimSpace(strings.ToLower(p[0]))
+	switch key {
+	case "allow_weak_crypto":
+		v, err := parseBoolean(p[1])
+		if err != nil {
+			return InvalidErrorf("libdefaults section line (%s): %v", line, err)
 		}
-		if !strings.Contains(line, "=") {
+		l.AllowWeakCrypto = v
+	case "canonicalize":
+		v, err := parseBoolean(p[1])
+		if err != nil {
+			return InvalidErrorf("libdefaults section line (%s): %v", line, err)
+		}
+		l.Canonicalize = v
+	case "ccache_type":
+		p[1] = strings.TrimSpace(p[1])
+		v, err := strconv.ParseUint(p[1], 10, 32)
+		if err != nil || v < 0 || v > 4 {
 			return InvalidErrorf("libdefaults section line (%s)", line)
 		}
-
-		p := strings.Split(line, "=")
-		key := strings.TrimSpace(strings.ToLower(p[0]))
-		switch key {
-		case "allow_weak_crypto":
-			v, err := parseBoolean(p[1])
-			if err != nil {
-				return InvalidErrorf("libdefaults section line (%s): %v", line, err)
-			}
-			l.AllowWeakCrypto = v
-		case "canonicalize":
-			v, err := parseBoolean(p[1])
-			if err != nil {
-				return InvalidErrorf("libdefaults section line (%s): %v", line, err)
-			}
-			l.Canonicalize = v
-		case "ccache_type":
-			p[1] = strings.TrimSpace(p[1])
-			v, err := strconv.ParseUint(p[1], 10, 32)
-			if err != nil || v < 0 || v > 4 {
-				return InvalidErrorf("libdefaults section line (%s)", line)
-			}
-			l.CCacheType = int(v)
-		case "clockskew":
-			d, err := parseDuration(p[1])
-			if err != nil {
-				return InvalidErrorf("libdefaults section line (%s): %v", line, err)
-			}
-			l.Clockskew = d
-		case "default_client_keytab_name":
-			l.DefaultClientKeytabName = strings.TrimSpace(p[1])
-		case "default_keytab_name":
-			l.DefaultKeytabName = strings.TrimSpace(p[1])
-		case "default_realm":
-			l.DefaultRealm = strings.TrimSpace(p[1])
-		case "default_tgs_enctypes":
-			l.DefaultTGSEnctypes = strings.Fields(p[1])
-		case "default_tkt_enctypes":
-			l.DefaultTktEnctypes = strings.Fields(p[1])
-		case "dns_canonicalize_hostname":
-			v, err := parseBoolean(p[1])
-			if err != nil {
-				return InvalidErrorf("libdefaults section line (%s): %v", line, err)
-			}
-			l.DNSCanonicalizeHostname = v
-		case "dns_lookup_kdc":
-			v, err := parseBoolean(p[1])
-			if err != nil {
-				return InvalidErrorf("libdefaults section line (%s): %v", line, err)
-			}
-			l.DNSLookupKDC = v
-		case "dns_lookup_realm":
-			v, err := parseBoolean(p[1])
-			if err != nil {
-				return InvalidErrorf("libdefaults section line (%s): %v", line, err)
-			}
-			l.DNSLookupRealm = v
-		case "extra_addresses":
-			ipStr := strings.TrimSpace(p[1])
-			for _, ip := range strings.Split(ipStr, ",") {
-				if eip := net.ParseIP(ip); eip != nil {
-					l.ExtraAddresses = append(l.ExtraAddresses, eip)
-				}
-			}
-		case "forwardable":
-			v, err := parseBoolean(p[1])
-			if err != nil {
-				return InvalidErrorf("libdefaults section line (%s): %v", line, err)
-			}
-			l.Forwardable = v
-		case "ignore_acceptor_hostname":
-			v, err := parseBoolean(p[1])
-			if err != nil {
-				return InvalidErrorf("libdefaults section line (%s): %v", line, err)
-			}
-			l.IgnoreAcceptorHostname = v
-		case "k5login_authoritative":
-			v, err := parseBoolean(p[1])
-			if err != nil {
-				return InvalidErrorf("libdefaults section line (%s): %v", line, err)
-			}
-			l.K5LoginAuthoritative = v
-		case "k5login_directory":
-			l.K5LoginDirectory = strings.TrimSpace(p[1])
-		case "kdc_default_options":
-			v := strings.TrimSpace(p[1])
-			v = strings.Replace(v, "0x", "", -1)
-			b, err := hex.DecodeString(v)
-			if err != nil {
-				return InvalidErrorf("libdefaults section line (%s): %v", line, err)
-			}
-			l.KDCDefaultOptions.Bytes = b
-			l.KDCDefaultOptions.BitLength = len(b) * 8
-		case "kdc_timesync":
-			p[1] = strings.TrimSpace(p[1])
-			v, err := strconv.ParseInt(p[1], 10, 32)
-			if err != nil || v < 0 {
-				return InvalidErrorf("libdefaults section line (%s)", line)
-			}
-			l.KDCTimeSync = int(v)
-		case "noaddresses":
-			v, err := parseBoolean(p[1])
-			if err != nil {
-				return InvalidErrorf("libdefaults section line (%s): %v", line, err)
-			}
-			l.NoAddresses = v
-		case "permitted_enctypes":
-			l.PermittedEnctypes = strings.Fields(p[1])
-		case "preferred_preauth_types":
-			p[1] = strings.TrimSpace(p[1])
-			t := strings.Split(p[1], ",")
-			var v []int
-			for _, s := range t {
-				i, err := strconv.ParseInt(s, 10, 32)
-				if err != nil {
-					return InvalidErrorf("libdefaults section line (%s): %v", line, err)
-				}
-				v = append(v, int(i))
-			}
-			l.PreferredPreauthTypes = v
-		case "proxiable":
-			v, err := parseBoolean(p[1])
-			if err != nil {
-				return InvalidErrorf("libdefaults section line (%s): %v", line, err)
-			}
-			l.Proxiable = v
-		case "rdns":
-			v, err := parseBoolean(p[1])
-			if err != nil {
-				return InvalidErrorf("libdefaults section line (%s): %v", line, err)
-			}
-			l.RDNS = v
-		case "realm_try_domains":
-			p[1] = strings.TrimSpace(p[1])
-			v, err := strconv.ParseInt(p[1], 10, 32)
-			if err != nil || v < -1 {
-				return InvalidErrorf("libdefaults section line (%s)", line)
-			}
-			l.RealmTryDomains = int(v)
-		case "renew_lifetime":
-			d, err := parseDuration(p[1])
-			if err != nil {
-				return InvalidErrorf("libdefaults section line (%s): %v", line, err)
-			}
-			l.RenewLifetime = d
-		case "safe_checksum_type":
-			p[1] = strings.TrimSpace(p[1])
-			v, err := strconv.ParseInt(p[1], 10, 32)
-			if err != nil || v < 0 {
-				return InvalidErrorf("libdefaults section line (%s)", line)
-			}
-			l.SafeChecksumType = int(v)
-		case "ticket_lifetime":
-			d, err := parseDuration(p[1])
-			if err != nil {
-				return InvalidErrorf("libdefaults section line (%s): %v", line, err)
-			}
-			l.TicketLifetime = d
-		case "udp_preference_limit":
-			p[1] = strings.TrimSpace(p[1])
-			v, err := strconv.ParseUint(p[1], 10, 32)
-			if err != nil || v > 32700 {
-				return InvalidErrorf("libdefaults section line (%s)", line)
+		l.CCacheType = int(v)
+	case "clockskew":
+		d, err := parseDuration(p[1])
+		if err != nil {
+			return InvalidErrorf("libdefaults section line (%s): %v", line, err)
+		}
+		l.Clockskew = d
+	case "default_client_keytab_name":
+		l.DefaultClientKeytabName = strings.TrimSpace(p[1])
+	case "default_keytab_name":
+		l.DefaultKeytabName = strings.TrimSpace(p[1])
+	case "default_realm":
+		l.DefaultRealm = strings.TrimSpace(p[1])
+	case "default_tgs_enctypes":
+		l.DefaultTGSEnctypes = strings.Fields(p[1])
+		checkETypes(key, l.DefaultTGSEnctypes, r, problem)
+	case "default_tkt_enctypes":
+		l.DefaultTktEnctypes = strings.Fields(p[1])
+		checkETypes(key, l.DefaultTktEnctypes, r, problem)
+	case "dns_canonicalize_hostname":
+		v, err := parseBoolean(p[1])
+		if err != nil {
+			return InvalidErrorf("libdefaults section line (%s): %v", line, err)
+		}
+		l.DNSCanonicalizeHostname = v
+	case "dns_lookup_kdc":
+		v, err := parseBoolean(p[1])
+		if err != nil {
+			return InvalidErrorf("libdefaults section line (%s): %v", line, err)
+		}
+		l.DNSLookupKDC = v
+	case "dns_uri_lookup":
+		v, err := parseBoolean(p[1])
+		if err != nil {
+			return InvalidErrorf("libdefaults section line (%s): %v", line, err)
+		}
+		l.DNSURILookup = v
+	case "dns_lookup_realm":
+		v, err := parseBoolean(p[1])
+		if err != nil {
+			return InvalidErrorf("libdefaults section line (%s): %v", line, err)
+		}
+		l.DNSLookupRealm = v
+	case "extra_addresses":
+		ipStr := strings.TrimSpace(p[1])
+		for _, ip := range strings.Split(ipStr, ",") {
+			ip = strings.TrimSpace(ip)
+			if eip := net.ParseIP(ip); eip != nil {
+				l.ExtraAddresses = append(l.ExtraAddresses, eip)
+			} else {
+				problem(fmt.Errorf("invalid IP address %s in extra_addresses", ip))
 			}
-			l.UDPPreferenceLimit = int(v)
-		case "verify_ap_req_nofail":
-			v, err := parseBoolean(p[1])
+		}
+	case "forwardable":
+		v, err := parseBoolean(p[1])
+		if err != nil {
+			return InvalidErrorf("libdefaults section line (%s): %v", line, err)
+		}
+		l.Forwardable = v
+	case "ignore_acceptor_hostname":
+		v, err := parseBoolean(p[1])
+		if err != nil {
+			return InvalidErrorf("libdefaults section line (%s): %v", line, err)
+		}
+		l.IgnoreAcceptorHostname = v
+	case "k5login_authoritative":
+		v, err := parseBoolean(p[1])
+		if err != nil {
+			return InvalidErrorf("libdefaults section line (%s): %v", line, err)
+		}
+		l.K5LoginAuthoritative = v
+		l.k5LoginAuthoritativeSet = true
+	case "k5login_directory":
+		l.K5LoginDirectory = strings.TrimSpace(p[1])
+		l.k5LoginDirectorySet = true
+	case "kdc_default_options":
+		v := strings.TrimSpace(p[1])
+		v = strings.Replace(v, "0x", "", -1)
+		b, err := hex.DecodeString(v)
+		if err != nil {
+			return InvalidErrorf("libdefaults section line (%s): %v", line, err)
+		}
+		l.KDCDefaultOptions.Bytes = b
+		l.KDCDefaultOptions.BitLength = len(b) * 8
+	case "kdc_timesync":
+		p[1] = strings.TrimSpace(p[1])
+		v, err := strconv.ParseInt(p[1], 10, 32)
+		if err != nil || v < 0 {
+			return InvalidErrorf("libdefaults section line (%s)", line)
+		}
+		l.KDCTimeSync = int(v)
+	case "noaddresses":
+		v, err := parseBoolean(p[1])
+		if err != nil {
+			return InvalidErrorf("libdefaults section line (%s): %v", line, err)
+		}
+		l.NoAddresses = v
+	case "permitted_enctypes":
+		l.PermittedEnctypes = strings.Fields(p[1])
+		checkETypes(key, l.PermittedEnctypes, r, problem)
+	case "preferred_preauth_types":
+		p[1] = strings.TrimSpace(p[1])
+		t := strings.Split(p[1], ",")
+		var v []int
+		for _, s := range t {
+			i, err := strconv.ParseInt(s, 10, 32)
 			if err != nil {
 				return InvalidErrorf("libdefaults section line (%s): %v", line, err)
 			}
-			l.VerifyAPReqNofail = v
+			v = append(v, int(i))
+		}
+		l.PreferredPreauthTypes = v
+	case "proxiable":
+		v, err := parseBoolean(p[1])
+		if err != nil {
+			return InvalidErrorf("libdefaults section line (%s): %v", line, err)
 		}
+		l.Proxiable = v
+	case "rdns":
+		v, err := parseBoolean(p[1])
+		if err != nil {
+			return InvalidErrorf("libdefaults section line (%s): %v", line, err)
+		}
+		l.RDNS = v
+	case "realm_try_domains":
+		p[1] = strings.TrimSpace(p[1])
+		v, err := strconv.ParseInt(p[1], 10, 32)
+		if err != nil || v < -1 {
+			return InvalidErrorf("libdefaults section line (%s)", line)
+		}
+		l.RealmTryDomains = int(v)
+	case "renew_lifetime":
+		d, err := parseDuration(p[1])
+		if err != nil {
+			return InvalidErrorf("libdefaults section line (%s): %v", line, err)
+		}
+		l.RenewLifetime = d
+	case "safe_checksum_type":
+		p[1] = strings.TrimSpace(p[1])
+		v, err := strconv.ParseInt(p[1], 10, 32)
+		if err != nil || v < 0 {
+			return InvalidErrorf("libdefaults section line (%s)", line)
+		}
+		l.SafeChecksumType = int(v)
+	case "ticket_lifetime":
+		d, err := parseDuration(p[1])
+		if err != nil {
+			return InvalidErrorf("libdefaults section line (%s): %v", line, err)
+		}
+		l.TicketLifetime = d
+	case "udp_preference_limit":
+		p[1] = strings.TrimSpace(p[1])
+		v, err := strconv.ParseUint(p[1], 10, 32)
+		if err != nil || v > 32700 {
+			return InvalidErrorf("libdefaults section line (%s)", line)
+		}
+		l.UDPPreferenceLimit = int(v)
+	case "verify_ap_req_nofail":
+		v, err := parseBoolean(p[1])
+		if err != nil {
+			return InvalidErrorf("libdefaults section line (%s): %v", line, err)
+		}
+		l.VerifyAPReqNofail = v
+	default:
+		problem(fmt.Errorf("unknown or unsupported libdefaults relation %s", key))
 	}
-	l.DefaultTGSEnctypeIDs = parseETypes(l.DefaultTGSEnctypes, l.AllowWeakCrypto)
-	l.DefaultTktEnctypeIDs = parseETypes(l.DefaultTktEnctypes, l.AllowWeakCrypto)
-	l.PermittedEnctypeIDs = parseETypes(l.PermittedEnctypes, l.AllowWeakCrypto)
 	return nil
 }
 
@@ -318,24 +369,33 @@ func (l *LibDefaults) parseLines(lines []string) error {
 type Realm struct {
 	Realm       string
 	AdminServer []string
-	//auth_to_local //Not implementing for now
-	//auth_to_local_names //Not implementing for now
-	DefaultDomain string
-	KDC           []string
-	KPasswdServer []string //default admin_server:464
-	MasterKDC     []string
+	// AuthToLocal holds the rules mapping principal names to local user names, in the order applied.
+	// Only the rules of the default realm are used.
+	AuthToLocal []string `json:",omitempty"`
+	// AuthToLocalNames maps principal names of the realm, without the realm, to local user names.
+	// Only the mappings of the default realm are used.
+	AuthToLocalNames map[string]string `json:",omitempty"`
+	DefaultDomain    string
+	KDC              []string
+	KPasswdServer    []string //default admin_server:464
+	MasterKDC        []string
+
+	// Final markers of the realm's subsection and relations, which are kept when the realm is merged from another file
+	final              bool
+	adminServerFinal   bool
+	kdcFinal           bool
+	kpasswdServerFinal bool
+	masterKDCFinal     bool
 }
 
-// Parse the lines of a [realms] entry into the Realm struct.
-func (r *Realm) parseLines(name string, lines []string) (err error) {
+// Parse the lines of a [realms] entry into the Realm struct. Unknown relations and v4 configurations, which are
+// ignored, are passed to the problem function with the index of their line.
+func (r *Realm) parseLines(name string, lines []string, problem func(i int, err error)) (err error) {
 	r.Realm = name
-	var adminServerFinal bool
-	var KDCFinal bool
-	var kpasswdServerFinal bool
-	var masterKDCFinal bool
 	var ignore bool
-	var c int // counts the depth of blocks within brackets { }
-	for _, line := range lines {
+	var names bool // within the auth_to_local_names subsection
+	var c int      // counts the depth of blocks within brackets { }
+	for i, line := range lines {
 		if ignore && c > 0 && !strings.Contains(line, "{") && !strings.Contains(line, "}") {
 			continue
 		}
@@ -347,14 +407,49 @@ func (r *Realm) parseLines(name string, lines []string) (err error) {
 		if line == "" {
 			continue
 		}
+		if names {
+			if strings.Contains(line, "}") {
+				names = false
+				c--
+				continue
+			}
+			p := strings.SplitN(line, "=", 2)
+			if len(p) != 2 {
+				return InvalidErrorf("auth_to_local_names line (%s)", line)
+			}
+			if _, ok := r.AuthToLocalNames[strings.TrimSpace(p[0])]; !ok {
+				r.AuthToLocalNames[strings.TrimSpace(p[0])] = strings.TrimSpace(p[1])
+			}
+			continue
+		}
+		if strings.Contains(line, "{") && strings.TrimSpace(strings.ToLower(strings.Split(line, "=")[0])) == "auth_to_local_names" {
+			names = true
+			c++
+			if r.AuthToLocalNames == nil {
+				r.AuthToLocalNames = make(map[string]string)
+			}
+			continue
+		}
 		if !strings.Contains(line, "=") && !strings.Contains(line, "}") {
 			return InvalidErrorf("realms section line (%s)", line)
 		}
+		key := strings.TrimSpace(strings.ToLower(strings.Split(line, "=")[0]))
 		if strings.Contains(line, "v4_") {
-			ignore = true
 			err = UnsupportedDirective{"v4 configurations are not supported"}
+			if !ignore {
+				problem(i, fmt.Errorf("v4 configurations are not supported: %s in realm %s", key, name))
+			}
+			if !strings.Contains(line, "{") {
+				continue
+			}
+			ignore = true
 		}
 		if strings.Contains(line, "{") {
+			if !ignore {
+				// Subsections other than auth_to_local_names are not supported so are ignored
+				problem(i, fmt.Errorf("unknown or unsupported relation %s in realm %s", key, name))
+				ignore = true
+			}
 			c++
 			if ignore {
 				continue
@@ -374,30 +469,36 @@ func (r *Realm) parseLines(name string, lines []string) (err error) {
 			}
 		}
 
-		p := strings.Split(line, "=")
-		key := strings.TrimSpace(strings.ToLower(p[0]))
-		v := strings.TrimSpace(p[1])
+		v := strings.TrimSpace(strings.Split(line, "=")[1])
 		switch key {
 		case "admin_server":
-			appendUntilFinal(&r.AdminServer, v, &adminServerFinal)
+			appendUntilFinal(&r.AdminServer, v, &r.adminServerFinal)
+		case "auth_to_local":
+			// Rules may contain the = character
+			r.AuthToLocal = append(r.AuthToLocal, strings.TrimSpace(strings.SplitN(line, "=", 2)[1]))
 		case "default_domain":
 			r.DefaultDomain = v
 		case "kdc":
-			if !strings.Contains(v, ":") {
-				// No port number specified default to 88
-				if strings.HasSuffix(v, `*`) {
-					v = strings.TrimSpace(strings.TrimSuffix(v, `*`)) + ":88*"
-				} else {
-					v = strings.TrimSpace(v) + ":88"
-				}
+			// No port number specified default to 88
+			if strings.HasSuffix(v, `*`) {
+				v = hostPort(strings.TrimSuffix(v, `*`), "88") + "*"
+			} else {
+				v = hostPort(v, "88")
 			}
-			appendUntilFinal(&r.KDC, v, &KDCFinal)
+			appendUntilFinal(&r.KDC, v, &r.kdcFinal)
 		case "kpasswd_server":
-			appendUntilFinal(&r.KPasswdServer, v, &kpasswdServerFinal)
+			appendUntilFinal(&r.KPasswdServer, v, &r.kpasswdServerFinal)
 		case "master_kdc":
-			appendUntilFinal(&r.MasterKDC, v, &masterKDCFinal)
+			appendUntilFinal(&r.MasterKDC, v, &r.masterKDCFinal)
+		default:
+			problem(i, fmt.Errorf("unknown or unsupported relation %s in realm %s", key, name))
 		}
 	}
+	return
+}
+
+// Set the defaults of the Realm for relations not configured.
+func (r *Realm) setDefaults() {
 	//default for Kpasswd_server = admin_server:464
 	if len(r.KPasswdServer) < 1 {
 		for _, a := range r.AdminServer {
@@ -405,14 +506,16 @@ func (r *Realm) parseLines(name string, lines []string) (err error) {
 			r.KPasswdServer = append(r.KPasswdServer, s[0]+":464")
 		}
 	}
-	return
 }
 
-// Parse the lines of the [realms] section of the configuration into an slice of Realm structs.
-func parseRealms(lines []string) (realms []Realm, err error) {
+// Parse the lines of the [realms] section of the configuration into the Realms of the configuration.
+// Relations of a realm already configured are added to it unless the realm's subsection has been marked final by
+// following its closing bracket with an asterisk. The problems found are passed to the problem function with the index
+// of their line.
+func (c *Config) parseRealms(lines []string, problem func(i int, err error)) (err error) {
 	var name string
 	var start int
-	var c int
+	var n int
 	for i, l := range lines {
 		//Remove comments after the values
 		if idx := strings.IndexAny(l, "#;"); idx != -1 {
@@ -426,25 +529,29 @@ func parseRealms(lines []string) (realms []Realm, err error) {
 		//	return nil, errors.New("v4 configurations are not supported in Realms section")
 		//}
 		if strings.Contains(l, "{") {
-			c++
+			n++
 			if !strings.Contains(l, "=") {
-				return nil, fmt.Errorf("realm configuration line invalid: %s", l)
+				return fmt.Errorf("realm configuration line invalid: %s", l)
 			}
-			if c == 1 {
+			if n == 1 {
 				start = i
 				p := strings.Split(l, "=")
 				name = strings.TrimSpace(p[0])
 			}
 		}
 		if strings.Contains(l, "}") {
-			if c < 1 {
+			if n < 1 {
 				// but not started a block!!!
-				return nil, errors.New("invalid Realms section in configuration")
+				return errors.New("invalid Realms section in configuration")
 			}
-			c--
-			if c == 0 {
-				var r Realm
-				e := r.parseLines(name, lines[start+1:i])
+			n--
+			if n == 0 {
+				r := c.realm(name)
+				if r.final {
+					continue
+				}
+				offset := start + 1
+				e := r.parseLines(name, lines[offset:i], func(j int, err error) { problem(offset+j, err) })
 				if e != nil {
 					if _, ok := e.(UnsupportedDirective); !ok {
 						err = e
@@ -452,13 +559,24 @@ func parseRealms(lines []string) (realms []Realm, err error) {
 					}
 					err = e
 				}
-				realms = append(realms, r)
+				r.final = strings.HasSuffix(l, "*")
 			}
 		}
 	}
 	return
 }
 
+// realm returns the configured Realm of the name provided, adding a new Realm to the configuration if there is none.
+func (c *Config) realm(name string) *Realm {
+	for i := range c.Realms {
+		if c.Realms[i].Realm == name {
+			return &c.Realms[i]
+		}
+	}
+	c.Realms = append(c.Realms, Realm{Realm: name})
+	return &c.Realms[len(c.Realms)-1]
+}
+
 // DomainRealm maps the domains to realms representing the [domain_realm] section of the configuration.
 type DomainRealm map[string]string
 
@@ -494,7 +612,8 @@ func (d *DomainRealm) deleteMapping(domain, realm string) {
 }
 
 // ResolveRealm resolves the kerberos realm for the specified domain name from the domain to realm mapping.
-// The most specific mapping is returned.
+// The most specific mapping is returned. If there is no mapping and dns_lookup_realm is enabled the realm is looked up
+// in the _kerberos TXT records of the host and its parent domains.
 func (c *Config) ResolveRealm(domainName string) string {
 	domainName = strings.TrimSuffix(domainName, ".")
 
@@ -511,18 +630,201 @@ func (c *Config) ResolveRealm(domainName string) string {
 			return r
 		}
 	}
+
+	// Look up the realm in the _kerberos TXT records of the host and its domains
+	if c.LibDefaults.DNSLookupRealm {
+		return c.lookupRealm(domainName)
+	}
 	return ""
 }
 
+// CaPaths holds the explicit cross-realm authentication paths of the [capaths] section of the configuration.
+// It is keyed on the client realm and then the server realm, and holds the intermediate realms in the order they are
+// traversed. A value of "." indicates the client realm shares a key with the server realm directly.
+type CaPaths map[string]map[string][]string
+
+// Parse the lines of the [capaths] section of the configuration and add to the paths. As for the relations of the
+// realms, a path configured by an earlier [capaths] section, such as that of an earlier file, takes precedence and is
+// not added to, and a path marked final by following its last realm with an asterisk is not added to. Client realm
+// subsections marked final by following their closing bracket with an asterisk are recorded in the final map provided,
+// keyed on the section and client realm, and are not added to by later sections. The client realm subsections and
+// paths marked final are also recorded in the marked map, keyed on the client realm and on the client and server realms
+// separated by a space respectively.
+func (p *CaPaths) parseLines(lines []string, final, marked map[string]bool) error {
+	var client string
+	var c int
+	set := make(map[string]bool) // paths set by this section, which may be added to
+	var finals []string          // client realm subsections marked final by this section
+	for _, line := range lines {
+		//Remove comments after the values
+		if idx := strings.IndexAny(line, "#;"); idx != -1 {
+			line = line[:idx]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.Contains(line, "{") {
+			if c > 0 || !strings.Contains(line, "=") {
+				return InvalidErrorf("capaths section line (%s)", line)
+			}
+			c++
+			client = strings.TrimSpace(strings.Split(line, "=")[0])
+			if _, ok := (*p)[client]; !ok {
+				(*p)[client] = make(map[string][]string)
+			}
+			continue
+		}
+		if strings.Contains(line, "}") {
+			if c < 1 {
+				return InvalidErrorf("unpaired curly brackets")
+			}
+			c--
+			if strings.HasSuffix(line, "*") {
+				finals = append(finals, client)
+			}
+			continue
+		}
+		if c < 1 || !strings.Contains(line, "=") {
+			return InvalidErrorf("capaths section line (%s)", line)
+		}
+		kv := strings.SplitN(line, "=", 2)
+		server := strings.TrimSpace(kv[0])
+		key := client + " " + server
+		if final["capaths."+client] || marked[key] {
+			continue
+		}
+		if _, ok := (*p)[client][server]; ok && !set[key] {
+			// The path was configured by an earlier section
+			continue
+		}
+		set[key] = true
+		realms := strings.Fields(kv[1])
+		if last := len(realms) - 1; last >= 0 && strings.HasSuffix(realms[last], "*") {
+			marked[key] = true
+			realms[last] = strings.TrimSuffix(realms[last], "*")
+			if realms[last] == "" {
+				realms = realms[:last]
+			}
+		}
+		(*p)[client][server] = append((*p)[client][server], realms...)
+	}
+	if c != 0 {
+		return InvalidErrorf("unpaired curly brackets")
+	}
+	for _, client := range finals {
+		final["capaths."+client] = true
+		marked[client] = true
+	}
+	return nil
+}
+
+// RealmPath returns the intermediate realms through which the client realm authenticates to the server realm, in the
+// order they are traversed. The path is taken from the [capaths] section of the configuration if it has an entry for
+// the realms, otherwise the hierarchical path is used. An empty path indicates the realms trust each other directly.
+func (c *Config) RealmPath(clientRealm, serverRealm string) []string {
+	if clientRealm == serverRealm {
+		return nil
+	}
+	if paths, ok := c.CaPaths[clientRealm][serverRealm]; ok {
+		var path []string
+		for _, r := range paths {
+			if r != "." {
+				path = append(path, r)
+			}
+		}
+		return path
+	}
+	return HierarchicalRealmPath(clientRealm, serverRealm)
+}
+
+// HierarchicalRealmPath returns the intermediate realms through which the client realm authenticates to the server
+// realm when the realms follow the hierarchical organization of RFC 4120 section 1.2: up from the client realm to the
+// realm the two realms have in common and down from there to the server realm.
+func HierarchicalRealmPath(clientRealm, serverRealm string) []string {
+	cc := strings.Split(clientRealm, ".")
+	sc := strings.Split(serverRealm, ".")
+	// n is the number of trailing components the realms have in common
+	var n int
+	for n < len(cc) && n < len(sc) && cc[len(cc)-1-n] == sc[len(sc)-1-n] {
+		n++
+	}
+	var path []string
+	for i := 1; i < len(cc)-n; i++ {
+		path = append(path, strings.Join(cc[i:], "."))
+	}
+	if n > 0 && n < len(cc) && n < len(sc) {
+		path = append(path, strings.Join(cc[len(cc)-n:], "."))
+	}
+	for i := len(sc) - n - 1; i > 0; i-- {
+		path = append(path, strings.Join(sc[i:], "."))
+	}
+	return path
+}
+
+// TransitedPermitted indicates if the realms transited in authenticating a client of the client realm to the server
+// realm are all on the configured path between the realms.
+func (c *Config) TransitedPermitted(clientRealm, serverRealm string, transited []string) bool {
+	path := c.RealmPath(clientRealm, serverRealm)
+	for _, t := range transited {
+		if t == clientRealm || t == serverRealm {
+			continue
+		}
+		var ok bool
+		for _, r := range path {
+			if r == t {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
 // Load the KRB5 configuration from the specified file path.
+// A list of file paths separated by the OS path list separator, such as the value of the KRB5_CONFIG environment
+// variable, is loaded as a single configuration as described for LoadFiles.
 func Load(cfgPath string) (*Config, error) {
-	fh, err := os.Open(cfgPath)
-	if err != nil {
-		return nil, errors.New("configuration file could not be opened: " + cfgPath + " " + err.Error())
+	return LoadFiles(filepath.SplitList(cfgPath)...)
+}
+
+// LoadFiles loads the KRB5 configuration from the files specified, merging them as the MIT profile library does.
+// Sections appearing in more than one file are merged, with the value of a relation in an earlier file taking
+// precedence over the value in a later one and lists of values, such as a realm's KDCs, being concatenated.
+// A section, realm subsection or list marked final with an asterisk is not added to by later files.
+// Files that do not exist are skipped provided at least one of the files can be loaded.
+func LoadFiles(cfgPaths ...string) (*Config, error) {
+	return newProfile().load(cfgPaths)
+}
+
+// LoadStrict loads the KRB5 configuration from the specified file path, as Load does, in strict mode.
+// Rather than stopping at the first invalid line, or ignoring unknown sections and relations and unsupported values,
+// all of the problems found are returned as a ValidationError along with the configuration parsed.
+// Files that cannot be opened or read are returned as other errors, without a configuration.
+func LoadStrict(cfgPath string) (*Config, error) {
+	p := newProfile()
+	p.strict = true
+	return p.load(filepath.SplitList(cfgPath))
+}
+
+// load the configuration files into the profile.
+func (p *profile) load(cfgPaths []string) (*Config, error) {
+	for _, cfgPath := range cfgPaths {
+		if _, err := os.Stat(cfgPath); err != nil && len(cfgPaths) > 1 {
+			continue
+		}
+		if err := p.include(cfgPath); err != nil {
+			return nil, err
+		}
+		p.loaded = true
 	}
-	defer fh.Close()
-	scanner := bufio.NewScanner(fh)
-	return NewFromScanner(scanner)
+	if !p.loaded {
+		return nil, errors.New("configuration file could not be opened: " + strings.Join(cfgPaths, string(filepath.ListSeparator)))
+	}
+	return p.config()
 }
 
 // NewFromString creates a new Config struct from a string.
@@ -538,79 +840,251 @@ func NewFromReader(r io.Reader) (*Config, error) {
 }
 
 // NewFromScanner creates a new Config struct from a bufio.Scanner.
+// Files referenced by include and includedir directives are loaded and merged into the configuration.
 func NewFromScanner(scanner *bufio.Scanner) (*Config, error) {
-	c := New()
-	var e error
-	sections := make(map[int]string)
-	var sectionLineNum []int
+	p := newProfile()
+	if err := p.parse(scanner); err != nil {
+		return nil, err
+	}
+	return p.config()
+}
+
+// NewFromStringStrict creates a new Config struct from a string in strict mode, returning all of the problems found
+// in the configuration as a ValidationError as described for LoadStrict.
+func NewFromStringStrict(s string) (*Config, error) {
+	return NewFromScannerStrict(bufio.NewScanner(strings.NewReader(s)))
+}
+
+// NewFromScannerStrict creates a new Config struct from a bufio.Scanner in strict mode, returning all of the problems
+// found in the configuration as a ValidationError as described for LoadStrict.
+func NewFromScannerStrict(scanner *bufio.Scanner) (*Config, error) {
+	p := newProfile()
+	p.strict = true
+	if err := p.parse(scanner); err != nil {
+		return nil, err
+	}
+	return p.config()
+}
+
+var (
+	sectionRegexp    = regexp.MustCompile(`^\s*\[(.*)\]\s*(\*?)`)
+	includeRegexp    = regexp.MustCompile(`^(include|includedir)\s+(.+?)\s*$`)
+	includeDirRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+// profile holds the state of parsing one or more configuration files into a Config.
+type profile struct {
+	c      *Config
+	files  []string        // files being parsed, used to detect include loops
+	set    map[string]bool // relations already set, as the first value set takes precedence
+	final  map[string]bool // sections marked final
+	loaded bool
+	err    error // unsupported directive error returned with the configuration
+	strict bool  // all problems found are returned rather than the first invalid line or last unsupported directive
+}
+
+func newProfile() *profile {
+	return &profile{
+		c:     New(),
+		set:   make(map[string]bool),
+		final: make(map[string]bool),
+	}
+}
+
+// config returns the configuration parsed, with defaults set for the realms.
+func (p *profile) config() (*Config, error) {
+	for i := range p.c.Realms {
+		p.c.Realms[i].setDefaults()
+	}
+	if p.strict {
+		return p.c, p.c.Validate()
+	}
+	return p.c, p.err
+}
+
+// include parses the configuration file at the path provided.
+func (p *profile) include(cfgPath string) error {
+	abs, err := filepath.Abs(cfgPath)
+	if err != nil {
+		abs = cfgPath
+	}
+	for _, f := range p.files {
+		if f == abs {
+			return InvalidErrorf("configuration file %s includes itself", cfgPath)
+		}
+	}
+	fh, err := os.Open(cfgPath)
+	if err != nil {
+		return errors.New("configuration file could not be opened: " + cfgPath + " " + err.Error())
+	}
+	defer fh.Close()
+	p.files = append(p.files, abs)
+	defer func() { p.files = p.files[:len(p.files)-1] }()
+	return p.parse(bufio.NewScanner(fh))
+}
+
+// includeDir parses the configuration files in the directory provided in lexical order. As with the MIT profile
+// library only files with names consisting of alphanumeric characters, dashes and underscores, or ending in .conf,
+// are included.
+func (p *profile) includeDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return errors.New("configuration directory could not be read: " + dir + " " + err.Error())
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || strings.HasPrefix(name, ".") || !(includeDirRegexp.MatchString(name) || strings.HasSuffix(name, ".conf")) {
+			continue
+		}
+		if err := p.include(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parse the configuration lines from the scanner into the configuration. Includes are parsed as they are found so
+// that their values take precedence over those that follow them.
+func (p *profile) parse(scanner *bufio.Scanner) error {
+	var file string
+	if len(p.files) > 0 {
+		file = p.files[len(p.files)-1]
+	}
+	var section string
+	var ignore bool
 	var lines []string
+	var nums []int // line numbers of the lines
+	var n int      // current line number
+	var c int      // counts the depth of blocks within brackets { }
+	flush := func() error {
+		defer func() { lines, nums = nil, nil }()
+		if ignore || len(lines) < 1 {
+			return nil
+		}
+		found := len(p.c.problems)
+		p.check(file, section, lines, nums)
+		err := p.parseSection(section, lines, func(i int, err error) {
+			p.c.problems = append(p.c.problems, Problem{File: file, Line: nums[i], Section: section, Text: err.Error()})
+		})
+		if err != nil && p.strict {
+			// Record the error unless the lines causing it have already been identified
+			if len(p.c.problems) == found {
+				p.c.problems = append(p.c.problems, Problem{File: file, Line: nums[0], Section: section, Text: err.Error()})
+			}
+			return nil
+		}
+		return err
+	}
 	for scanner.Scan() {
+		n++
 		// Skip comments and blank lines
 		if matched, _ := regexp.MatchString(`^\s*(#|;|\n)`, scanner.Text()); matched {
 			continue
 		}
-		if matched, _ := regexp.MatchString(`^\s*\[libdefaults\]\s*`, scanner.Text()); matched {
-			sections[len(lines)] = "libdefaults"
-			sectionLineNum = append(sectionLineNum, len(lines))
-			continue
-		}
-		if matched, _ := regexp.MatchString(`^\s*\[realms\]\s*`, scanner.Text()); matched {
-			sections[len(lines)] = "realms"
-			sectionLineNum = append(sectionLineNum, len(lines))
-			continue
+		if c == 0 {
+			if m := includeRegexp.FindStringSubmatch(scanner.Text()); m != nil {
+				if err := flush(); err != nil {
+					return err
+				}
+				var err error
+				if m[1] == "include" {
+					err = p.include(m[2])
+				} else {
+					err = p.includeDir(m[2])
+				}
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			if m := sectionRegexp.FindStringSubmatch(scanner.Text()); m != nil {
+				if err := flush(); err != nil {
+					return err
+				}
+				section = strings.TrimSpace(m[1])
+				ignore = p.final[section]
+				if m[2] == "*" {
+					p.final[section] = true
+				}
+				if !knownSections[section] {
+					p.c.problems = append(p.c.problems, Problem{File: file, Line: n, Section: section, Text: fmt.Sprintf("unknown section [%s]", section)})
+				}
+				continue
+			}
 		}
-		if matched, _ := regexp.MatchString(`^\s*\[domain_realm\]\s*`, scanner.Text()); matched {
-			sections[len(lines)] = "domain_realm"
-			sectionLineNum = append(sectionLineNum, len(lines))
-			continue
+		line := scanner.Text()
+		if idx := strings.IndexAny(line, "#;"); idx != -1 {
+			line = line[:idx]
 		}
-		if matched, _ := regexp.MatchString(`^\s*\[.*\]\s*`, scanner.Text()); matched {
-			sections[len(lines)] = "unknown_section"
-			sectionLineNum = append(sectionLineNum, len(lines))
-			continue
+		if c += strings.Count(line, "{") - strings.Count(line, "}"); c < 0 {
+			c = 0
 		}
 		lines = append(lines, scanner.Text())
+		nums = append(nums, n)
 	}
-	for i, start := range sectionLineNum {
-		var end int
-		if i+1 >= len(sectionLineNum) {
-			end = len(lines)
-		} else {
-			end = sectionLineNum[i+1]
+	return flush()
+}
+
+// parseSection parses the lines of a section of the configuration into the configuration, passing the problems found
+// by the parsers to the problem function with the index of their line.
+func (p *profile) parseSection(section string, lines []string, problem func(i int, err error)) error {
+	switch section {
+	case "libdefaults":
+		err := p.c.LibDefaults.parseLines(p.unset(section, lines), p.c.EtypeRegistry(), problem)
+		if err != nil {
+			if _, ok := err.(UnsupportedDirective); !ok {
+				return fmt.Errorf("error processing libdefaults section: %v", err)
+			}
+			p.err = err
 		}
-		switch section := sections[start]; section {
-		case "libdefaults":
-			err := c.LibDefaults.parseLines(lines[start:end])
-			if err != nil {
-				if _, ok := err.(UnsupportedDirective); !ok {
-					return nil, fmt.Errorf("error processing libdefaults section: %v", err)
-				}
-				e = err
+	case "realms":
+		err := p.c.parseRealms(lines, problem)
+		if err != nil {
+			if _, ok := err.(UnsupportedDirective); !ok {
+				return fmt.Errorf("error processing realms section: %v", err)
 			}
-		case "realms":
-			realms, err := parseRealms(lines[start:end])
-			if err != nil {
-				if _, ok := err.(UnsupportedDirective); !ok {
-					return nil, fmt.Errorf("error processing realms section: %v", err)
-				}
-				e = err
+			p.err = err
+		}
+	case "domain_realm":
+		err := p.c.DomainRealm.parseLines(p.unset(section, lines))
+		if err != nil {
+			if _, ok := err.(UnsupportedDirective); !ok {
+				return fmt.Errorf("error processing domaain_realm section: %v", err)
 			}
-			c.Realms = realms
-		case "domain_realm":
-			err := c.DomainRealm.parseLines(lines[start:end])
-			if err != nil {
-				if _, ok := err.(UnsupportedDirective); !ok {
-					return nil, fmt.Errorf("error processing domaain_realm section: %v", err)
-				}
-				e = err
+			p.err = err
+		}
+	case "capaths":
+		if p.c.capathsFinal == nil {
+			p.c.capathsFinal = make(map[string]bool)
+		}
+		err := p.c.CaPaths.parseLines(lines, p.final, p.c.capathsFinal)
+		if err != nil {
+			return fmt.Errorf("error processing capaths section: %v", err)
+		}
+	}
+	return nil
+}
+
+// unset returns the lines of a section of single valued relations with those for relations already set blanked, so
+// that the lines keep their index.
+func (p *profile) unset(section string, lines []string) []string {
+	u := make([]string, len(lines))
+	for j, line := range lines {
+		if i := strings.Index(line, "="); i != -1 {
+			key := section + "." + strings.TrimSpace(strings.ToLower(line[:i]))
+			if p.set[key] {
+				continue
 			}
+			p.set[key] = true
 		}
+		u[j] = line
 	}
-	return c, e
+	return u
 }
 
 // Parse a space delimited list of ETypes into a list of EType numbers optionally filtering out weak ETypes.
-func parseETypes(s []string, w bool) []int32 {
+// ETypes not enabled in the registry are left out.
+func parseETypes(s []string, w bool, r *crypto.Registry) []int32 {
 	var eti []int32
 	for _, et := range s {
 		if !w {
@@ -625,7 +1099,7 @@ func parseETypes(s []string, w bool) []int32 {
 				continue
 			}
 		}
-		i := etypeID.EtypeSupported(et)
+		i := r.EtypeID(et)
 		if i != 0 {
 			eti = append(eti, i)
 		}
@@ -722,6 +1196,55 @@ func appendUntilFinal(s *[]string, value string, final *bool) {
 	*s = append(*s, value)
 }
 
+// SetEtypeRegistry sets the registry of encryption and checksum types to use with this configuration in place of
+// the default registry of the crypto package. The encryption type IDs of the default_tgs_enctypes,
+// default_tkt_enctypes and permitted_enctypes settings are resolved again against the registry so that encryption
+// types it does not enable are neither requested nor permitted.
+func (c *Config) SetEtypeRegistry(r *crypto.Registry) {
+	c.registry = r
+	l := &c.LibDefaults
+	l.DefaultTGSEnctypeIDs = parseETypes(l.DefaultTGSEnctypes, l.AllowWeakCrypto, r)
+	l.DefaultTktEnctypeIDs = parseETypes(l.DefaultTktEnctypes, l.AllowWeakCrypto, r)
+	l.PermittedEnctypeIDs = parseETypes(l.PermittedEnctypes, l.AllowWeakCrypto, r)
+}
+
+// EtypeRegistry returns the registry of encryption and checksum types for this configuration. This is the registry
+// set with SetEtypeRegistry, otherwise, or if the configuration is nil, the default registry of the crypto package.
+// Whether the configuration permits use of an encryption type is given by EtypePermitted.
+func (c *Config) EtypeRegistry() *crypto.Registry {
+	if c == nil || c.registry == nil {
+		return crypto.DefaultRegistry()
+	}
+	return c.registry
+}
+
+// EtypePermitted returns true if use of the encryption type is permitted by the configuration.
+// The encryption type must be listed in the permitted_enctypes setting, must not be a weak encryption type unless
+// allow_weak_crypto is set and must be enabled in the configuration's etype registry.
+func (c *Config) EtypePermitted(id int32) bool {
+	if !c.LibDefaults.AllowWeakCrypto && IsWeakEtype(id) {
+		return false
+	}
+	var permitted bool
+	for _, p := range c.LibDefaults.PermittedEnctypeIDs {
+		if p == id {
+			permitted = true
+			break
+		}
+	}
+	return permitted && c.EtypeRegistry().Enabled(id)
+}
+
+// IsWeakEtype returns true if the encryption type is one of those deemed weak in WeakETypeList.
+func IsWeakEtype(id int32) bool {
+	for _, name := range strings.Fields(WeakETypeList) {
+		if etypeID.ETypesByName[name] == id {
+			return true
+		}
+	}
+	return false
+}
+
 // JSON return details of the config in a JSON format.
 func (c *Config) JSON() (string, error) {
 	b, err := json.MarshalIndent(c, "", "  ")
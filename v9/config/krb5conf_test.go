@@ -2,9 +2,12 @@ package config
 
 import (
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/oiweiwei/gokrb5.fork/v9/crypto"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -105,7 +108,9 @@ const (
     "DefaultTGSEnctypeIDs": [
       18,
       17,
-      23
+      23,
+      26,
+      25
     ],
     "DefaultTktEnctypeIDs": [
       18,
@@ -114,6 +119,7 @@ const (
     "DNSCanonicalizeHostname": true,
     "DNSLookupKDC": false,
     "DNSLookupRealm": false,
+    "DNSURILookup": true,
     "ExtraAddresses": null,
     "Forwardable": true,
     "IgnoreAcceptorHostname": false,
@@ -139,7 +145,9 @@ const (
     "PermittedEnctypeIDs": [
       18,
       17,
-      23
+      23,
+      26,
+      25
     ],
     "PreferredPreauthTypes": [
       17,
@@ -179,6 +187,9 @@ const (
       "AdminServer": [
         "kerberos.example.com"
       ],
+      "AuthToLocal": [
+        "RULE:[1:$1@$0](.*@EXAMPLE.COM)s/.*//"
+      ],
       "DefaultDomain": "",
       "KDC": [
         "kerberos.example.com:88",
@@ -663,6 +674,52 @@ func TestResolveRealm(t *testing.T) {
 	}
 }
 
+func TestEtypeRegistry(t *testing.T) {
+	t.Parallel()
+	c, err := NewFromString(`[libdefaults]
+ permitted_enctypes = aes256-cts-hmac-sha1-96 aes128-cts-hmac-sha1-96
+`)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	assert.Same(t, crypto.DefaultRegistry(), c.EtypeRegistry(), "the default registry should be used if none is set")
+	assert.Equal(t, []int32{18, 17}, c.LibDefaults.PermittedEnctypeIDs)
+
+	custom := crypto.NewRegistry()
+	custom.RegisterEtype(crypto.Aes256CtsHmacSha96{}, "aes256-cts-hmac-sha1-96")
+	c.SetEtypeRegistry(custom)
+	assert.Same(t, custom, c.EtypeRegistry())
+	assert.Equal(t, []int32{18}, c.LibDefaults.PermittedEnctypeIDs, "etypes not in the registry should not be permitted")
+	assert.True(t, c.EtypePermitted(18))
+	assert.False(t, c.EtypePermitted(17), "aes128-cts-hmac-sha1-96 is not in the registry")
+}
+
+func TestEtypePermitted(t *testing.T) {
+	t.Parallel()
+	c := New()
+	assert.True(t, c.EtypePermitted(18), "aes256-cts-hmac-sha1-96 should be permitted by default")
+	assert.True(t, c.EtypePermitted(23), "rc4-hmac should be permitted by default")
+	assert.False(t, c.EtypePermitted(3), "des-cbc-md5 should not be permitted without allow_weak_crypto")
+	assert.False(t, c.EtypePermitted(1), "des-cbc-crc should not be permitted without allow_weak_crypto")
+
+	c, err := NewFromString(`[libdefaults]
+ allow_weak_crypto = true
+ permitted_enctypes = aes256-cts-hmac-sha1-96 des-cbc-md5
+`)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	assert.True(t, c.EtypePermitted(18))
+	assert.True(t, c.EtypePermitted(3), "des-cbc-md5 should be permitted with allow_weak_crypto")
+	assert.False(t, c.EtypePermitted(23), "rc4-hmac is not in permitted_enctypes")
+	assert.False(t, c.EtypePermitted(1), "des-cbc-crc is not in permitted_enctypes")
+
+	r := crypto.DefaultRegistry().Clone()
+	r.Disable(3)
+	c.SetEtypeRegistry(r)
+	assert.False(t, c.EtypePermitted(3), "des-cbc-md5 is disabled in the registry")
+}
+
 func TestJSON(t *testing.T) {
 	t.Parallel()
 	c, err := NewFromString(krb5Conf)
@@ -678,3 +735,219 @@ func TestJSON(t *testing.T) {
 
 	t.Log(j)
 }
+
+func TestCaPaths(t *testing.T) {
+	t.Parallel()
+	c, err := NewFromString(`[libdefaults]
+ default_realm = ANL.GOV
+
+[capaths]
+ ANL.GOV = {
+  TEST.ANL.GOV = .
+  PNL.GOV = ES.NET
+  NIST.GOV = ES.NET
+  NIST.GOV = G.NIST.GOV ; comment to be ignored
+ }
+ PNL.GOV = {
+  ANL.GOV = ES.NET
+ }
+`)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	assert.Equal(t, []string{"."}, c.CaPaths["ANL.GOV"]["TEST.ANL.GOV"], "[capaths] direct path not as expected")
+	assert.Equal(t, []string{"ES.NET", "G.NIST.GOV"}, c.CaPaths["ANL.GOV"]["NIST.GOV"], "[capaths] path not as expected")
+	assert.Equal(t, []string{"ES.NET"}, c.CaPaths["PNL.GOV"]["ANL.GOV"], "[capaths] path not as expected")
+
+	assert.Empty(t, c.RealmPath("ANL.GOV", "TEST.ANL.GOV"), "direct path should have no intermediate realms")
+	assert.Equal(t, []string{"ES.NET", "G.NIST.GOV"}, c.RealmPath("ANL.GOV", "NIST.GOV"), "capaths realm path not as expected")
+	assert.Equal(t, []string{"GOV"}, c.RealmPath("ANL.GOV", "OTHER.GOV"), "hierarchical realm path not as expected")
+
+	assert.True(t, c.TransitedPermitted("ANL.GOV", "NIST.GOV", []string{"ES.NET", "G.NIST.GOV"}), "transited realms on the path should be permitted")
+	assert.True(t, c.TransitedPermitted("ANL.GOV", "NIST.GOV", []string{"ANL.GOV", "ES.NET"}), "client realm should be permitted")
+	assert.False(t, c.TransitedPermitted("ANL.GOV", "NIST.GOV", []string{"ES.NET", "EVIL.GOV"}), "transited realm off the path should not be permitted")
+
+	_, err = NewFromString(`[capaths]
+ ANL.GOV = {
+  PNL.GOV = ES.NET
+`)
+	assert.Error(t, err, "unterminated capaths entry should not parse")
+}
+
+func TestLoadFiles_CaPaths(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.conf")
+	inc := filepath.Join(dir, "include.conf")
+	second := filepath.Join(dir, "second.conf")
+	if err := os.WriteFile(first, []byte(`[capaths]
+ ANL.GOV = {
+  NIST.GOV = ES.NET
+  NIST.GOV = G.NIST.GOV
+  PNL.GOV = ES.NET*
+  PNL.GOV = OTHER.NET
+ }
+ PNL.GOV = {
+  ANL.GOV = ES.NET
+ }*
+include `+inc+`
+`), 0644); err != nil {
+		t.Fatalf("error writing %s: %v", first, err)
+	}
+	if err := os.WriteFile(inc, []byte(`[capaths]
+ ANL.GOV = {
+  NIST.GOV = OTHER.NET
+  TEST.ANL.GOV = .
+ }
+`), 0644); err != nil {
+		t.Fatalf("error writing %s: %v", inc, err)
+	}
+	if err := os.WriteFile(second, []byte(`[capaths]
+ ANL.GOV = {
+  PNL.GOV = OTHER.NET
+  TEST.ANL.GOV = OTHER.NET
+  ORNL.GOV = ES.NET
+ }
+ PNL.GOV = {
+  ANL.GOV = OTHER.NET
+  NIST.GOV = ES.NET
+ }
+`), 0644); err != nil {
+		t.Fatalf("error writing %s: %v", second, err)
+	}
+	c, err := LoadFiles(first, second)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	assert.Equal(t, []string{"ES.NET", "G.NIST.GOV"}, c.CaPaths["ANL.GOV"]["NIST.GOV"], "path of the first file should not be added to by includes")
+	assert.Equal(t, []string{"ES.NET"}, c.CaPaths["ANL.GOV"]["PNL.GOV"], "final path should not be added to")
+	assert.Equal(t, []string{"."}, c.CaPaths["ANL.GOV"]["TEST.ANL.GOV"], "path of an include should take precedence over later files")
+	assert.Equal(t, []string{"ES.NET"}, c.CaPaths["ANL.GOV"]["ORNL.GOV"], "paths of later files should be added")
+	assert.Equal(t, map[string][]string{"ANL.GOV": {"ES.NET"}}, c.CaPaths["PNL.GOV"], "final client realm should not be added to")
+}
+
+func TestHierarchicalRealmPath(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		client string
+		server string
+		path   []string
+	}{
+		{"A.EXAMPLE.COM", "B.EXAMPLE.COM", []string{"EXAMPLE.COM"}},
+		{"EXAMPLE.COM", "B.EXAMPLE.COM", nil},
+		{"A.B.EXAMPLE.COM", "EXAMPLE.COM", []string{"B.EXAMPLE.COM"}},
+		{"A.B.EXAMPLE.COM", "C.D.EXAMPLE.COM", []string{"B.EXAMPLE.COM", "EXAMPLE.COM", "D.EXAMPLE.COM"}},
+		{"A.EXAMPLE.COM", "EXAMPLE.ORG", []string{"EXAMPLE.COM", "COM", "ORG"}},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.path, HierarchicalRealmPath(test.client, test.server), "path from %s to %s not as expected", test.client, test.server)
+	}
+}
+
+func TestLoadInclude(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	confd := filepath.Join(dir, "krb5.conf.d")
+	if err := os.Mkdir(confd, 0755); err != nil {
+		t.Fatalf("error creating include directory: %v", err)
+	}
+	files := map[string]string{
+		filepath.Join(confd, "crypto-policies"): `[libdefaults]
+ permitted_enctypes = aes256-cts-hmac-sha1-96
+`,
+		filepath.Join(confd, "realms.conf"): `[realms]
+ TEST.GOKRB5 = {
+  kdc = kdc1.test.gokrb5
+ }
+`,
+		filepath.Join(confd, "ignored.rpmsave"): `[libdefaults]
+ default_realm = IGNORED.GOKRB5
+`,
+		filepath.Join(dir, "extra.conf"): `[domain_realm]
+ .test.gokrb5 = TEST.GOKRB5
+`,
+		filepath.Join(dir, "krb5.conf"): `includedir ` + confd + `
+include ` + filepath.Join(dir, "extra.conf") + `
+
+[libdefaults]
+ default_realm = TEST.GOKRB5
+ permitted_enctypes = aes128-cts-hmac-sha1-96
+
+[realms]
+ TEST.GOKRB5 = {
+  kdc = kdc2.test.gokrb5
+ }
+`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatalf("error writing %s: %v", name, err)
+		}
+	}
+	c, err := Load(filepath.Join(dir, "krb5.conf"))
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	assert.Equal(t, "TEST.GOKRB5", c.LibDefaults.DefaultRealm, "[libdefaults] default_realm not as expected")
+	assert.Equal(t, []string{"aes256-cts-hmac-sha1-96"}, c.LibDefaults.PermittedEnctypes, "included value should take precedence")
+	if assert.Len(t, c.Realms, 1, "realms should be merged") {
+		assert.Equal(t, []string{"kdc1.test.gokrb5:88", "kdc2.test.gokrb5:88"}, c.Realms[0].KDC, "[realm] Kdc not as expected")
+	}
+	assert.Equal(t, "TEST.GOKRB5", c.DomainRealm[".test.gokrb5"], "Domain to realm mapping not as expected")
+
+	loop := filepath.Join(dir, "loop.conf")
+	if err := os.WriteFile(loop, []byte("include "+loop+"\n"), 0644); err != nil {
+		t.Fatalf("error writing %s: %v", loop, err)
+	}
+	_, err = Load(loop)
+	assert.Error(t, err, "include loop should not load")
+}
+
+func TestLoadFiles(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.conf")
+	second := filepath.Join(dir, "second.conf")
+	if err := os.WriteFile(first, []byte(`[libdefaults]*
+ default_realm = TEST.GOKRB5
+
+[realms]
+ TEST.GOKRB5 = {
+  kdc = kdc1.test.gokrb5
+ }
+ EXAMPLE.COM = {
+  kdc = kdc1.example.com
+ }*
+`), 0644); err != nil {
+		t.Fatalf("error writing %s: %v", first, err)
+	}
+	if err := os.WriteFile(second, []byte(`[libdefaults]
+ dns_lookup_kdc = true
+
+[realms]
+ TEST.GOKRB5 = {
+  kdc = kdc2.test.gokrb5*
+  kdc = kdc3.test.gokrb5
+  admin_server = kdc2.test.gokrb5
+ }
+ EXAMPLE.COM = {
+  kdc = kdc2.example.com
+ }
+`), 0644); err != nil {
+		t.Fatalf("error writing %s: %v", second, err)
+	}
+	c, err := Load(strings.Join([]string{first, filepath.Join(dir, "missing.conf"), second}, string(filepath.ListSeparator)))
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	assert.Equal(t, "TEST.GOKRB5", c.LibDefaults.DefaultRealm, "[libdefaults] default_realm not as expected")
+	assert.False(t, c.LibDefaults.DNSLookupKDC, "final [libdefaults] section should not be added to")
+	if assert.Len(t, c.Realms, 2, "realms should be merged") {
+		assert.Equal(t, []string{"kdc1.test.gokrb5:88", "kdc2.test.gokrb5:88"}, c.Realms[0].KDC, "[realm] Kdc not as expected")
+		assert.Equal(t, []string{"kdc2.test.gokrb5:464"}, c.Realms[0].KPasswdServer, "[realm] Kpasswd_server not as expected")
+		assert.Equal(t, []string{"kdc1.example.com:88"}, c.Realms[1].KDC, "final realm should not be added to")
+	}
+
+	_, err = LoadFiles(filepath.Join(dir, "missing.conf"), filepath.Join(dir, "missing2.conf"))
+	assert.Error(t, err, "configuration should not load without any files")
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+)
+
+// UserOK indicates if the principal, of the form primary/instance@REALM, is authorized to log in as the local user,
+// as the MIT krb5_kuserok function does. If the principal name has no realm the default realm is assumed.
+//
+// If the local user has a .k5login file the principal is authorized if it is listed in the file. The file is named
+// after the local user in the k5login_directory if one is configured, otherwise it is the .k5login file of the local
+// user's home directory. The file must be a regular file owned by the local user or root that is not writable by other
+// users. If the principal is not listed and k5login_authoritative is true, as it is if not configured, the principal
+// is not authorized.
+// Otherwise the principal is authorized if it maps to the local user's name with the auth_to_local rules of the
+// default realm (see LocalName).
+func (c *Config) UserOK(principal, luser string) (bool, error) {
+	u, err := user.Lookup(luser)
+	if err != nil {
+		return false, fmt.Errorf("could not find local user %s: %v", luser, err)
+	}
+	principal = c.qualifyPrincipal(principal)
+	k5login := filepath.Join(u.HomeDir, ".k5login")
+	if c.LibDefaults.k5LoginDirectorySet {
+		k5login = filepath.Join(c.LibDefaults.K5LoginDirectory, luser)
+	}
+	// The file is opened before its status is checked, so that the file checked is the file read.
+	fh, err := os.OpenFile(k5login, k5LoginOpenFlags, 0)
+	switch {
+	case err == nil:
+		ok, err := c.k5LoginListed(fh, u, principal)
+		fh.Close()
+		if ok || err != nil || c.LibDefaults.K5LoginAuthoritative || !c.LibDefaults.k5LoginAuthoritativeSet {
+			return ok, err
+		}
+	case !os.IsNotExist(err):
+		return false, fmt.Errorf("could not open k5login file %s: %v", k5login, err)
+	}
+	l, err := c.LocalName(principal)
+	return err == nil && l == luser, nil
+}
+
+// k5LoginListed indicates if the principal is listed in the open k5login file of the local user.
+func (c *Config) k5LoginListed(fh *os.File, u *user.User, principal string) (bool, error) {
+	k5login := fh.Name()
+	fi, err := fh.Stat()
+	if err != nil {
+		return false, fmt.Errorf("could not access k5login file %s: %v", k5login, err)
+	}
+	if !fi.Mode().IsRegular() {
+		return false, fmt.Errorf("k5login file %s is not a regular file", k5login)
+	}
+	if err := checkK5LoginOwner(fi, u); err != nil {
+		return false, fmt.Errorf("k5login file %s is not secure: %v", k5login, err)
+	}
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && c.qualifyPrincipal(line) == principal {
+			return true, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("could not read k5login file %s: %v", k5login, err)
+	}
+	return false, nil
+}
+
+// qualifyPrincipal adds the default realm to a principal name without a realm.
+func (c *Config) qualifyPrincipal(principal string) string {
+	if !strings.Contains(principal, "@") {
+		return principal + "@" + c.LibDefaults.DefaultRealm
+	}
+	return principal
+}
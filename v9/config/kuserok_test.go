@@ -0,0 +1,79 @@
+package config
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserOK(t *testing.T) {
+	t.Parallel()
+	u, err := user.Current()
+	if err != nil {
+		t.Skipf("current user not available: %v", err)
+	}
+	dir := t.TempDir()
+	load := func(authoritative string) *Config {
+		conf := `[libdefaults]
+ default_realm = TEST.GOKRB5
+ k5login_directory = ` + dir + "\n"
+		if authoritative != "" {
+			conf += " k5login_authoritative = " + authoritative + "\n"
+		}
+		c, err := NewFromString(conf)
+		if err != nil {
+			t.Fatalf("Error loading config: %v", err)
+		}
+		return c
+	}
+	c := load("false")
+
+	// Without a k5login file the principal must map to the local user
+	ok, err := c.UserOK(u.Username+"@TEST.GOKRB5", u.Username)
+	assert.NoError(t, err)
+	assert.True(t, ok, "principal mapping to the local user should be authorized")
+	ok, _ = c.UserOK("someoneelse@TEST.GOKRB5", u.Username)
+	assert.False(t, ok, "principal not mapping to the local user should not be authorized")
+
+	k5login := filepath.Join(dir, u.Username)
+	if err := os.WriteFile(k5login, []byte("testuser1@TEST.GOKRB5\nHTTP/host.test.gokrb5\n"), 0600); err != nil {
+		t.Fatalf("error writing k5login file: %v", err)
+	}
+	ok, err = c.UserOK("testuser1@TEST.GOKRB5", u.Username)
+	assert.NoError(t, err)
+	assert.True(t, ok, "principal listed in the k5login file should be authorized")
+	ok, _ = c.UserOK("HTTP/host.test.gokrb5@TEST.GOKRB5", u.Username)
+	assert.True(t, ok, "principal listed without a realm should be authorized")
+	ok, _ = c.UserOK(u.Username+"@TEST.GOKRB5", u.Username)
+	assert.True(t, ok, "principal mapping to the local user should be authorized if k5login is not authoritative")
+	ok, _ = load("true").UserOK(u.Username+"@TEST.GOKRB5", u.Username)
+	assert.False(t, ok, "principal not listed should not be authorized if k5login is authoritative")
+	ok, _ = load("").UserOK(u.Username+"@TEST.GOKRB5", u.Username)
+	assert.False(t, ok, "principal not listed should not be authorized as k5login is authoritative by default")
+	ok, _ = load("").UserOK("testuser1@TEST.GOKRB5", u.Username)
+	assert.True(t, ok, "principal listed in the k5login file should be authorized")
+
+	if runtime.GOOS != "windows" {
+		if err := os.Chmod(k5login, 0666); err != nil {
+			t.Fatalf("error changing k5login file mode: %v", err)
+		}
+		ok, err = c.UserOK("testuser1@TEST.GOKRB5", u.Username)
+		assert.False(t, ok, "k5login file writable by others should not be trusted")
+		assert.Error(t, err)
+	}
+
+	// Only a regular file is read as the k5login file
+	if err := os.Remove(k5login); err != nil {
+		t.Fatalf("error removing k5login file: %v", err)
+	}
+	if err := os.Mkdir(k5login, 0700); err != nil {
+		t.Fatalf("error creating k5login directory: %v", err)
+	}
+	ok, err = c.UserOK(u.Username+"@TEST.GOKRB5", u.Username)
+	assert.False(t, ok, "k5login that is not a regular file should not be trusted")
+	assert.Error(t, err)
+}
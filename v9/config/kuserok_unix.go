@@ -0,0 +1,31 @@
+//go:build !windows
+// +build !windows
+
+package config
+
+import (
+	"errors"
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// k5LoginOpenFlags are the flags the k5login file is opened with. The file is opened non-blocking so that opening a
+// FIFO, which is then rejected as not a regular file, does not wait for a writer.
+const k5LoginOpenFlags = os.O_RDONLY | syscall.O_NONBLOCK
+
+// checkK5LoginOwner checks the k5login file is owned by the local user or root and is not writable by other users.
+func checkK5LoginOwner(fi os.FileInfo, u *user.User) error {
+	if fi.Mode().Perm()&0022 != 0 {
+		return errors.New("file is writable by other users")
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return errors.New("file ownership could not be determined")
+	}
+	if uid := strconv.FormatUint(uint64(st.Uid), 10); uid != u.Uid && st.Uid != 0 {
+		return errors.New("file is not owned by the local user or root")
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// LocalName maps the principal name, of the form primary/instance@REALM, to a local user name as the MIT
+// krb5_aname_to_localname function does. If the principal name has no realm the default realm is assumed.
+//
+// The mapping is configured in the default realm's subsection of the [realms] section, whatever the principal's realm.
+// For principals of the default realm the auth_to_local_names subsection is checked for the principal name without the
+// realm first. Otherwise the auth_to_local rules are applied in order until one produces a local name. The rules are:
+//
+// DEFAULT: the principal's single component if the principal is in the default realm.
+//
+// RULE:[n:fmt](regex)s/pattern/replacement/g: for principals with n components a selection string is formed from fmt,
+// in which $0 is replaced with the realm and $1 to $n with the components. If the whole selection string matches the
+// regular expression the sed style substitutions are applied to it to form the local name. The regular expression and
+// substitutions are optional, as is the selection, without which the full principal name is used.
+//
+// If the default realm has no auth_to_local rules the DEFAULT rule is applied.
+func (c *Config) LocalName(principal string) (string, error) {
+	name, realm := principal, c.LibDefaults.DefaultRealm
+	if i := strings.LastIndex(principal, "@"); i != -1 {
+		name, realm = principal[:i], principal[i+1:]
+	}
+	components := strings.Split(name, "/")
+	var rules []string
+	for _, r := range c.Realms {
+		if r.Realm != c.LibDefaults.DefaultRealm {
+			continue
+		}
+		if l, ok := r.AuthToLocalNames[name]; ok && realm == r.Realm {
+			return l, nil
+		}
+		rules = r.AuthToLocal
+		break
+	}
+	if len(rules) < 1 {
+		rules = []string{"DEFAULT"}
+	}
+	for _, rule := range rules {
+		switch {
+		case rule == "DEFAULT":
+			if len(components) == 1 && realm == c.LibDefaults.DefaultRealm {
+				return components[0], nil
+			}
+		case strings.HasPrefix(rule, "RULE:"):
+			l, ok, err := applyLocalNameRule(strings.TrimPrefix(rule, "RULE:"), name+"@"+realm, components, realm)
+			if err != nil {
+				return "", err
+			}
+			if ok {
+				return l, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no local name mapping for principal %s@%s", name, realm)
+}
+
+// applyLocalNameRule applies an auth_to_local rule, without the RULE: prefix, to the principal.
+// The boolean indicates if the rule applies to the principal.
+func applyLocalNameRule(rule, principal string, components []string, realm string) (string, bool, error) {
+	s := principal
+	if strings.HasPrefix(rule, "[") {
+		end := strings.Index(rule, "]")
+		if end == -1 {
+			return "", false, InvalidErrorf("auth_to_local rule (%s) selection not terminated", rule)
+		}
+		sel := strings.SplitN(rule[1:end], ":", 2)
+		n, err := strconv.Atoi(sel[0])
+		if err != nil || len(sel) != 2 {
+			return "", false, InvalidErrorf("auth_to_local rule (%s) selection invalid", rule)
+		}
+		rule = rule[end+1:]
+		if n != len(components) {
+			return "", false, nil
+		}
+		s, err = localNameSelection(sel[1], components, realm)
+		if err != nil {
+			return "", false, err
+		}
+	}
+	if strings.HasPrefix(rule, "(") {
+		// Find the closing parenthesis of the regular expression allowing for nested groups
+		var depth, end int
+		for i := 0; i < len(rule) && end == 0; i++ {
+			switch rule[i] {
+			case '\\':
+				i++
+			case '(':
+				depth++
+			case ')':
+				if depth--; depth == 0 {
+					end = i
+				}
+			}
+		}
+		if end == 0 {
+			return "", false, InvalidErrorf("auth_to_local rule (%s) regular expression not terminated", rule)
+		}
+		re, err := regexp.Compile(`^(?:` + rule[1:end] + `)$`)
+		if err != nil {
+			return "", false, InvalidErrorf("auth_to_local rule (%s) regular expression invalid: %v", rule, err)
+		}
+		rule = rule[end+1:]
+		if !re.MatchString(s) {
+			return "", false, nil
+		}
+	}
+	for rule = strings.TrimSpace(rule); rule != ""; rule = strings.TrimSpace(rule) {
+		p := strings.SplitN(rule, "/", 4)
+		if len(p) < 4 || p[0] != "s" {
+			return "", false, InvalidErrorf("auth_to_local rule substitution (%s) invalid", rule)
+		}
+		re, err := regexp.Compile(p[1])
+		if err != nil {
+			return "", false, InvalidErrorf("auth_to_local rule substitution (%s) regular expression invalid: %v", rule, err)
+		}
+		rule = p[3]
+		if strings.HasPrefix(rule, "g") {
+			s = re.ReplaceAllLiteralString(s, p[2])
+			rule = rule[1:]
+		} else if loc := re.FindStringIndex(s); loc != nil {
+			s = s[:loc[0]] + p[2] + s[loc[1]:]
+		}
+	}
+	return s, true, nil
+}
+
+// localNameSelection forms the selection string of an auth_to_local rule from the format provided.
+func localNameSelection(format string, components []string, realm string) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '$' {
+			sb.WriteByte(format[i])
+			continue
+		}
+		j := i + 1
+		for j < len(format) && format[j] >= '0' && format[j] <= '9' {
+			j++
+		}
+		n, err := strconv.Atoi(format[i+1 : j])
+		if err != nil || n > len(components) {
+			return "", InvalidErrorf("auth_to_local rule selection format (%s) invalid", format)
+		}
+		if n == 0 {
+			sb.WriteString(realm)
+		} else {
+			sb.WriteString(components[n-1])
+		}
+		i = j - 1
+	}
+	return sb.String(), nil
+}
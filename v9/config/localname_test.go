@@ -0,0 +1,63 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalName(t *testing.T) {
+	t.Parallel()
+	c, err := NewFromString(`[libdefaults]
+ default_realm = TEST.GOKRB5
+
+[realms]
+ TEST.GOKRB5 = {
+  kdc = 10.80.88.88
+  auth_to_local_names = {
+   testuser2 = localuser2
+  }
+  auth_to_local = RULE:[2:$1@$0](nn@TEST\.GOKRB5)s/@.*//
+  auth_to_local = RULE:[2:$1,$2](HTTP,.*)s/^HTTP,/web-/
+  auth_to_local = RULE:[1:$1@$0](.*@EXAMPLE\.COM)s/@EXAMPLE\.COM$//s/\./_/g
+  auth_to_local = DEFAULT
+ }
+ EXAMPLE.COM = {
+  auth_to_local_names = {
+   testuser3 = localuser3
+  }
+  auth_to_local = RULE:[2:$1](.*)
+  auth_to_local = DEFAULT
+ }
+`)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	var tests = []struct {
+		principal string
+		local     string
+	}{
+		{"testuser1@TEST.GOKRB5", "testuser1"},
+		{"testuser1", "testuser1"},
+		{"testuser2@TEST.GOKRB5", "localuser2"},
+		{"nn/host.test.gokrb5@TEST.GOKRB5", "nn"},
+		{"HTTP/host.test.gokrb5@TEST.GOKRB5", "web-host.test.gokrb5"},
+		{"first.last@EXAMPLE.COM", "first_last"},
+		// The auth_to_local_names of the default realm apply only to its principals and those of other realms are not used
+		{"testuser2@EXAMPLE.COM", "testuser2"},
+		{"testuser3@EXAMPLE.COM", "testuser3"},
+	}
+	for _, test := range tests {
+		l, err := c.LocalName(test.principal)
+		if err != nil {
+			t.Errorf("error mapping %s to a local name: %v", test.principal, err)
+			continue
+		}
+		assert.Equal(t, test.local, l, "local name of %s not as expected", test.principal)
+	}
+	// The auth_to_local rules of realms other than the default realm are not used
+	for _, principal := range []string{"dn/host.test.gokrb5@TEST.GOKRB5", "user/admin@EXAMPLE.COM", "user@OTHER.GOKRB5"} {
+		_, err := c.LocalName(principal)
+		assert.Error(t, err, "%s should not map to a local name", principal)
+	}
+}
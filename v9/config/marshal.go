@@ -0,0 +1,205 @@
+package config
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oiweiwei/gokrb5.fork/v9/crypto"
+)
+
+// Marshal the configuration to krb5.conf text. Parsing the text with NewFromString gives an equivalent configuration.
+func (c *Config) Marshal() ([]byte, error) {
+	var b bytes.Buffer
+	if _, err := c.WriteTo(&b); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// WriteTo writes the configuration to the io.Writer as krb5.conf text with [libdefaults], [realms], [domain_realm] and
+// [capaths] sections. Only the libdefaults relations that differ from their defaults are written.
+func (c *Config) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	b.WriteString("[libdefaults]\n")
+	for _, line := range c.LibDefaults.marshalLines(c.EtypeRegistry()) {
+		b.WriteString(" " + line + "\n")
+	}
+	if len(c.Realms) > 0 {
+		b.WriteString("\n[realms]\n")
+		for _, r := range c.Realms {
+			b.WriteString(" " + r.Realm + " = {\n")
+			for _, line := range r.marshalLines() {
+				b.WriteString("  " + line + "\n")
+			}
+			if r.final {
+				b.WriteString(" }*\n")
+			} else {
+				b.WriteString(" }\n")
+			}
+		}
+	}
+	if len(c.DomainRealm) > 0 {
+		b.WriteString("\n[domain_realm]\n")
+		for _, domain := range sortedKeys(c.DomainRealm) {
+			b.WriteString(" " + domain + " = " + c.DomainRealm[domain] + "\n")
+		}
+	}
+	if len(c.CaPaths) > 0 {
+		b.WriteString("\n[capaths]\n")
+		clients := make([]string, 0, len(c.CaPaths))
+		for client := range c.CaPaths {
+			clients = append(clients, client)
+		}
+		sort.Strings(clients)
+		for _, client := range clients {
+			b.WriteString(" " + client + " = {\n")
+			servers := make([]string, 0, len(c.CaPaths[client]))
+			for server := range c.CaPaths[client] {
+				servers = append(servers, server)
+			}
+			sort.Strings(servers)
+			for _, server := range servers {
+				realms := c.CaPaths[client][server]
+				final := c.capathsFinal[client+" "+server]
+				if final && len(realms) == 0 {
+					b.WriteString("  " + server + " = *\n")
+				}
+				for i, r := range realms {
+					if final && i == len(realms)-1 {
+						r += "*"
+					}
+					b.WriteString("  " + server + " = " + r + "\n")
+				}
+			}
+			if c.capathsFinal[client] {
+				b.WriteString(" }*\n")
+			} else {
+				b.WriteString(" }\n")
+			}
+		}
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// Marshal the LibDefaults to the lines of the [libdefaults] section, omitting relations with their default value.
+func (l *LibDefaults) marshalLines(r *crypto.Registry) []string {
+	d := newLibDefaults(r)
+	var lines []string
+	add := func(key string, v, def interface{}, s string) {
+		if !reflect.DeepEqual(v, def) {
+			lines = append(lines, key+" = "+s)
+		}
+	}
+	add("allow_weak_crypto", l.AllowWeakCrypto, d.AllowWeakCrypto, strconv.FormatBool(l.AllowWeakCrypto))
+	add("canonicalize", l.Canonicalize, d.Canonicalize, strconv.FormatBool(l.Canonicalize))
+	add("ccache_type", l.CCacheType, d.CCacheType, strconv.Itoa(l.CCacheType))
+	add("clockskew", l.Clockskew, d.Clockskew, formatDuration(l.Clockskew))
+	add("default_client_keytab_name", l.DefaultClientKeytabName, d.DefaultClientKeytabName, l.DefaultClientKeytabName)
+	add("default_keytab_name", l.DefaultKeytabName, d.DefaultKeytabName, l.DefaultKeytabName)
+	add("default_realm", l.DefaultRealm, d.DefaultRealm, l.DefaultRealm)
+	tgs := enctypeNames(l.DefaultTGSEnctypes, l.DefaultTGSEnctypeIDs, r)
+	add("default_tgs_enctypes", tgs, d.DefaultTGSEnctypes, strings.Join(tgs, " "))
+	tkt := enctypeNames(l.DefaultTktEnctypes, l.DefaultTktEnctypeIDs, r)
+	add("default_tkt_enctypes", tkt, d.DefaultTktEnctypes, strings.Join(tkt, " "))
+	add("dns_canonicalize_hostname", l.DNSCanonicalizeHostname, d.DNSCanonicalizeHostname, strconv.FormatBool(l.DNSCanonicalizeHostname))
+	add("dns_lookup_kdc", l.DNSLookupKDC, d.DNSLookupKDC, strconv.FormatBool(l.DNSLookupKDC))
+	add("dns_lookup_realm", l.DNSLookupRealm, d.DNSLookupRealm, strconv.FormatBool(l.DNSLookupRealm))
+	add("dns_uri_lookup", l.DNSURILookup, d.DNSURILookup, strconv.FormatBool(l.DNSURILookup))
+	var ips []string
+	for _, ip := range l.ExtraAddresses {
+		ips = append(ips, ip.String())
+	}
+	add("extra_addresses", l.ExtraAddresses, d.ExtraAddresses, strings.Join(ips, ","))
+	add("forwardable", l.Forwardable, d.Forwardable, strconv.FormatBool(l.Forwardable))
+	add("ignore_acceptor_hostname", l.IgnoreAcceptorHostname, d.IgnoreAcceptorHostname, strconv.FormatBool(l.IgnoreAcceptorHostname))
+	if l.k5LoginAuthoritativeSet || l.K5LoginAuthoritative != d.K5LoginAuthoritative {
+		lines = append(lines, "k5login_authoritative = "+strconv.FormatBool(l.K5LoginAuthoritative))
+	}
+	if l.k5LoginDirectorySet || l.K5LoginDirectory != d.K5LoginDirectory {
+		lines = append(lines, "k5login_directory = "+l.K5LoginDirectory)
+	}
+	add("kdc_default_options", l.KDCDefaultOptions.Bytes, d.KDCDefaultOptions.Bytes, "0x"+hex.EncodeToString(l.KDCDefaultOptions.Bytes))
+	add("kdc_timesync", l.KDCTimeSync, d.KDCTimeSync, strconv.Itoa(l.KDCTimeSync))
+	add("noaddresses", l.NoAddresses, d.NoAddresses, strconv.FormatBool(l.NoAddresses))
+	permitted := enctypeNames(l.PermittedEnctypes, l.PermittedEnctypeIDs, r)
+	add("permitted_enctypes", permitted, d.PermittedEnctypes, strings.Join(permitted, " "))
+	var pts []string
+	for _, pt := range l.PreferredPreauthTypes {
+		pts = append(pts, strconv.Itoa(pt))
+	}
+	add("preferred_preauth_types", l.PreferredPreauthTypes, d.PreferredPreauthTypes, strings.Join(pts, ","))
+	add("proxiable", l.Proxiable, d.Proxiable, strconv.FormatBool(l.Proxiable))
+	add("rdns", l.RDNS, d.RDNS, strconv.FormatBool(l.RDNS))
+	add("realm_try_domains", l.RealmTryDomains, d.RealmTryDomains, strconv.Itoa(l.RealmTryDomains))
+	add("renew_lifetime", l.RenewLifetime, d.RenewLifetime, formatDuration(l.RenewLifetime))
+	add("safe_checksum_type", l.SafeChecksumType, d.SafeChecksumType, strconv.Itoa(l.SafeChecksumType))
+	add("ticket_lifetime", l.TicketLifetime, d.TicketLifetime, formatDuration(l.TicketLifetime))
+	add("udp_preference_limit", l.UDPPreferenceLimit, d.UDPPreferenceLimit, strconv.Itoa(l.UDPPreferenceLimit))
+	add("verify_ap_req_nofail", l.VerifyAPReqNofail, d.VerifyAPReqNofail, strconv.FormatBool(l.VerifyAPReqNofail))
+	return lines
+}
+
+// Marshal the Realm to the lines of its subsection of the [realms] section.
+func (r *Realm) marshalLines() []string {
+	var lines []string
+	list := func(key string, values []string, final bool) {
+		for i, v := range values {
+			if final && i == len(values)-1 {
+				v += "*"
+			}
+			lines = append(lines, key+" = "+v)
+		}
+	}
+	list("admin_server", r.AdminServer, r.adminServerFinal)
+	list("auth_to_local", r.AuthToLocal, false)
+	if len(r.AuthToLocalNames) > 0 {
+		lines = append(lines, "auth_to_local_names = {")
+		for _, name := range sortedKeys(r.AuthToLocalNames) {
+			lines = append(lines, " "+name+" = "+r.AuthToLocalNames[name])
+		}
+		lines = append(lines, "}")
+	}
+	if r.DefaultDomain != "" {
+		lines = append(lines, "default_domain = "+r.DefaultDomain)
+	}
+	list("kdc", r.KDC, r.kdcFinal)
+	list("kpasswd_server", r.KPasswdServer, r.kpasswdServerFinal)
+	list("master_kdc", r.MasterKDC, r.masterKDCFinal)
+	return lines
+}
+
+// enctypeNames returns the names of an enctype list. If the list of names is empty, as it is if only the IDs were set,
+// the names are those of the IDs in the etype registry.
+func enctypeNames(names []string, ids []int32, r *crypto.Registry) []string {
+	if len(names) > 0 || len(ids) == 0 {
+		return names
+	}
+	for _, id := range ids {
+		if name := r.EtypeName(id); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// formatDuration formats a duration as a number of seconds.
+func formatDuration(d time.Duration) string {
+	return strconv.FormatInt(int64(d/time.Second), 10)
+}
+
+// sortedKeys returns the keys of the map in order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
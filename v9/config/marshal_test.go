@@ -0,0 +1,133 @@
+package config
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/etypeID"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig_Marshal(t *testing.T) {
+	t.Parallel()
+	for _, conf := range []string{krb5Conf, krb5Conf2, `[libdefaults]
+ default_realm = ANL.GOV
+ ticket_lifetime = 10h
+ kdc_default_options = 0x40000010
+ preferred_preauth_types = 17,16
+ extra_addresses = 10.0.0.1,10.0.0.2
+ k5login_directory = /etc/k5login.d
+
+[realms]
+ ANL.GOV = {
+  kdc = kdc1.anl.gov
+  kdc = kdc2.anl.gov:750*
+  auth_to_local_names = {
+   admin = root
+  }
+  auth_to_local = RULE:[2:$1@$0](.*@ANL\.GOV)s/@.*//
+  auth_to_local = DEFAULT
+ }*
+
+[capaths]
+ ANL.GOV = {
+  NIST.GOV = ES.NET
+  NIST.GOV = G.NIST.GOV
+  TEST.ANL.GOV = .
+ }
+`} {
+		c, err := NewFromString(conf)
+		if _, ok := err.(UnsupportedDirective); err != nil && !ok {
+			t.Fatalf("Error loading config: %v", err)
+		}
+		b, err := c.Marshal()
+		if err != nil {
+			t.Fatalf("Error marshaling config: %v", err)
+		}
+		u, err := NewFromString(string(b))
+		if err != nil {
+			t.Fatalf("Error loading marshaled config: %v\n%s", err, b)
+		}
+		assert.Equal(t, c, u, "marshaled config not equivalent:\n%s", b)
+
+		var w bytes.Buffer
+		n, err := c.WriteTo(&w)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len(b)), n, "bytes written not as expected")
+		assert.Equal(t, b, w.Bytes(), "config written not as marshaled")
+	}
+}
+
+func TestConfig_Marshal_EnctypeIDs(t *testing.T) {
+	t.Parallel()
+	c, err := NewFromString("[libdefaults]\n default_realm = TEST.GOKRB5\n")
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	// Only the IDs are set, as a configuration built in code may do
+	ids := []int32{etypeID.AES256_CTS_HMAC_SHA384_192, etypeID.AES256_CTS_HMAC_SHA1_96}
+	c.LibDefaults.DefaultTGSEnctypes = nil
+	c.LibDefaults.DefaultTGSEnctypeIDs = ids
+	c.LibDefaults.DefaultTktEnctypes = nil
+	c.LibDefaults.DefaultTktEnctypeIDs = ids
+	c.LibDefaults.PermittedEnctypes = nil
+	c.LibDefaults.PermittedEnctypeIDs = ids
+	b, err := c.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshaling config: %v", err)
+	}
+	u, err := NewFromString(string(b))
+	if err != nil {
+		t.Fatalf("Error loading marshaled config: %v\n%s", err, b)
+	}
+	names := []string{"aes256-cts-hmac-sha384-192", "aes256-cts-hmac-sha1-96"}
+	assert.Equal(t, names, u.LibDefaults.DefaultTGSEnctypes, "default_tgs_enctypes not as expected:\n%s", b)
+	assert.Equal(t, ids, u.LibDefaults.DefaultTGSEnctypeIDs)
+	assert.Equal(t, names, u.LibDefaults.DefaultTktEnctypes, "default_tkt_enctypes not as expected:\n%s", b)
+	assert.Equal(t, ids, u.LibDefaults.DefaultTktEnctypeIDs)
+	assert.Equal(t, names, u.LibDefaults.PermittedEnctypes, "permitted_enctypes not as expected:\n%s", b)
+	assert.Equal(t, ids, u.LibDefaults.PermittedEnctypeIDs)
+}
+
+func TestConfig_Marshal_CaPathsFinal(t *testing.T) {
+	t.Parallel()
+	c, err := NewFromString(`[libdefaults]
+ default_realm = ANL.GOV
+
+[capaths]
+ ANL.GOV = {
+  NIST.GOV = ES.NET
+  NIST.GOV = G.NIST.GOV*
+  TEST.ANL.GOV = .
+ }
+ ES.NET = {
+  NIST.GOV = G.NIST.GOV
+ }*
+`)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	b, err := c.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshaling config: %v", err)
+	}
+	// A later file cannot add to the paths marked final in the marshaled config
+	u, err := NewFromString(string(b) + `
+[capaths]
+ ANL.GOV = {
+  NIST.GOV = OTHER.NET
+  TEST.ANL.GOV = OTHER.NET
+ }
+ ES.NET = {
+  TEST.ANL.GOV = .
+ }
+`)
+	if err != nil {
+		t.Fatalf("Error loading marshaled config: %v\n%s", err, b)
+	}
+	assert.Equal(t, []string{"ES.NET", "G.NIST.GOV"}, u.CaPaths["ANL.GOV"]["NIST.GOV"], "final path added to:\n%s", b)
+	assert.Equal(t, []string{"."}, u.CaPaths["ANL.GOV"]["TEST.ANL.GOV"], "path from an earlier file added to:\n%s", b)
+	assert.Equal(t, map[string][]string{"NIST.GOV": {"G.NIST.GOV"}}, u.CaPaths["ES.NET"], "final client realm added to:\n%s", b)
+	assert.True(t, u.capathsFinal["ANL.GOV NIST.GOV"])
+	assert.True(t, u.capathsFinal["ES.NET"])
+}
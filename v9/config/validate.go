@@ -0,0 +1,115 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/oiweiwei/gokrb5.fork/v9/crypto"
+)
+
+// knownSections are the sections of the configuration that are parsed, along with the sections of the MIT
+// krb5.conf that do not apply to clients and services and so are ignored.
+var knownSections = map[string]bool{
+	"libdefaults":  true,
+	"realms":       true,
+	"domain_realm": true,
+	"capaths":      true,
+	"appdefaults":  true,
+	"plugins":      true,
+	"logging":      true,
+	"kdcdefaults":  true,
+	"dbdefaults":   true,
+	"dbmodules":    true,
+	"otp":          true,
+}
+
+// Validate returns the problems found in the configuration when it was parsed as a ValidationError, or nil if no
+// problems were found. Problems are found for unknown sections and relations, values that are invalid or not
+// supported, such as unknown encryption type names, and unsupported directives.
+func (c *Config) Validate() error {
+	if len(c.problems) < 1 {
+		return nil
+	}
+	return ValidationError{Problems: append([]Problem(nil), c.problems...)}
+}
+
+// check the structure of the lines of a section of the configuration, recording the problems found with the line
+// numbers provided. Unknown relations and invalid values are found by the parsers of the sections.
+func (p *profile) check(file, section string, lines []string, nums []int) {
+	add := func(i int, format string, a ...interface{}) {
+		p.c.problems = append(p.c.problems, Problem{
+			File:    file,
+			Line:    nums[i],
+			Section: section,
+			Text:    fmt.Sprintf(format, a...),
+		})
+	}
+	var depth int // depth of blocks within brackets { } in the [realms] section
+	var realm string
+	for i, line := range lines {
+		//Remove comments after the values
+		if idx := strings.IndexAny(line, "#;"); idx != -1 {
+			line = line[:idx]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		switch section {
+		case "":
+			add(i, "line (%s) is not within a section", line)
+		case "realms":
+			opens, closes := strings.Contains(line, "{"), strings.Contains(line, "}")
+			switch depth {
+			case 0:
+				if opens && strings.Contains(line, "=") {
+					realm = strings.TrimSpace(strings.Split(line, "=")[0])
+					depth++
+					continue
+				}
+				if closes {
+					add(i, "unpaired curly brackets")
+					continue
+				}
+				add(i, "realms line (%s) is not a realm subsection", line)
+			case 1:
+				if closes && !opens {
+					depth--
+					continue
+				}
+				if !strings.Contains(line, "=") {
+					add(i, "realm %s line (%s) is not a relation", realm, line)
+					continue
+				}
+				if opens {
+					depth++
+				}
+			default:
+				// Relations within blocks nested in a realm's subsection
+				if opens {
+					depth++
+				}
+				if closes {
+					depth--
+				}
+			}
+		case "domain_realm":
+			if !strings.Contains(line, "=") {
+				add(i, "domain_realm line (%s) is not a relation", line)
+			}
+		}
+	}
+	if section == "realms" && depth > 0 {
+		add(len(lines)-1, "realm %s subsection is not closed", realm)
+	}
+}
+
+// checkETypes passes the names of the encryption types of the relation that are unknown or not enabled in the
+// registry to the problem function.
+func checkETypes(key string, names []string, r *crypto.Registry, problem func(err error)) {
+	for _, et := range names {
+		if r.EtypeID(et) == 0 {
+			problem(fmt.Errorf("unknown or unsupported encryption type %s in %s", et, key))
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const krb5ConfProblems = `[libdefaults]
+ default_realm = TEST.GOKRB5
+ forwardable = maybe
+ default_tkt_enctyps = aes256-cts-hmac-sha1-96
+ permitted_enctypes = aes256-cts-hmac-sha1-96 aes512-cts
+
+[realms]
+ TEST.GOKRB5 = {
+  kdc = 10.80.88.88:88
+  kdcs = 10.80.88.89:88
+  v4_realm = TEST
+ }
+
+[domain_ralm]
+ .test.gokrb5 = TEST.GOKRB5
+`
+
+func TestNewFromStringStrict(t *testing.T) {
+	t.Parallel()
+	c, err := NewFromStringStrict(krb5ConfProblems)
+	if err == nil {
+		t.Fatal("strict mode should return the problems found")
+	}
+	var v ValidationError
+	if !errors.As(err, &v) {
+		t.Fatalf("error should be a ValidationError: %v", err)
+	}
+	var lines []int
+	for _, p := range v.Problems {
+		lines = append(lines, p.Line)
+	}
+	assert.Equal(t, []int{3, 4, 5, 10, 11, 14}, lines, "problems not found on the lines expected: %v", err)
+	assert.Contains(t, v.Problems[1].Text, "default_tkt_enctyps")
+	assert.Contains(t, v.Problems[2].Text, "aes512-cts")
+	assert.Equal(t, "realms", v.Problems[3].Section)
+	assert.Contains(t, v.Problems[5].Text, "unknown section [domain_ralm]")
+	var p Problem
+	assert.True(t, errors.As(err, &p), "problems should be unwrapped from the error")
+
+	// The configuration is still parsed
+	assert.Equal(t, "TEST.GOKRB5", c.LibDefaults.DefaultRealm)
+	assert.Equal(t, []string{"10.80.88.88:88"}, c.Realms[0].KDC)
+	assert.Equal(t, err, c.Validate())
+
+	// Without strict mode parsing stops at the first invalid line
+	_, err = NewFromString(krb5ConfProblems)
+	assert.Error(t, err)
+	assert.False(t, errors.As(err, &v), "error should not be a ValidationError outside strict mode")
+	assert.Contains(t, err.Error(), "forwardable")
+
+	// Problems are recorded without strict mode and returned by Validate
+	c, err = NewFromString(krb5Conf)
+	if err != nil {
+		t.Fatalf("error parsing configuration: %v", err)
+	}
+	assert.NoError(t, c.Validate())
+}
+
+func TestNewFromStringStrict_Realms(t *testing.T) {
+	t.Parallel()
+	c, err := NewFromStringStrict(`[libdefaults]
+ default_realm = TEST.GOKRB5
+ dns_lookup_kdc = sometimes
+ extra_addresses = 10.80.88.88, 10.80.88.999
+
+[realms]
+ TEST.GOKRB5 = {
+  kdc = 10.80.88.88:88
+  plugins = {
+   kdc = 10.80.88.89:88
+  }
+  admin_server = 10.80.88.88:749
+ }
+`)
+	var v ValidationError
+	if !errors.As(err, &v) {
+		t.Fatalf("error should be a ValidationError: %v", err)
+	}
+	var lines []int
+	for _, p := range v.Problems {
+		lines = append(lines, p.Line)
+	}
+	assert.Equal(t, []int{3, 4, 9}, lines, "problems not found on the lines expected: %v", err)
+	assert.Contains(t, v.Problems[1].Text, "10.80.88.999")
+	assert.Contains(t, v.Problems[2].Text, "plugins")
+
+	// Relations following invalid lines and unknown subsections are parsed
+	assert.Equal(t, []string{"10.80.88.88:88"}, c.Realms[0].KDC, "relations of unknown subsections should be ignored")
+	assert.Equal(t, []string{"10.80.88.88:749"}, c.Realms[0].AdminServer)
+	assert.Len(t, c.LibDefaults.ExtraAddresses, 1)
+}
+
+func TestLoadStrict(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	inc := filepath.Join(dir, "include.conf")
+	assert.NoError(t, os.WriteFile(inc, []byte("[libdefaults]\n ticket_lifetime = 10h\n\n udp_preference_limt = 1\n"), 0644))
+	cfg := filepath.Join(dir, "krb5.conf")
+	assert.NoError(t, os.WriteFile(cfg, []byte("include "+inc+"\n[libdefaults]\n default_realm = TEST.GOKRB5\n"), 0644))
+
+	c, err := LoadStrict(cfg)
+	if err == nil {
+		t.Fatal("strict mode should return the problems found")
+	}
+	var v ValidationError
+	if assert.True(t, errors.As(err, &v)) && assert.Len(t, v.Problems, 1) {
+		assert.Equal(t, inc, v.Problems[0].File)
+		assert.Equal(t, 4, v.Problems[0].Line)
+		assert.Equal(t, inc+":4: unknown or unsupported libdefaults relation udp_preference_limt", v.Problems[0].Error())
+	}
+	assert.Equal(t, "TEST.GOKRB5", c.LibDefaults.DefaultRealm)
+
+	c, err = Load(cfg)
+	assert.NoError(t, err, "unknown relations should be ignored outside strict mode")
+	assert.Error(t, c.Validate())
+
+	_, err = LoadStrict(filepath.Join(dir, "missing.conf"))
+	assert.Error(t, err)
+	assert.False(t, errors.As(err, &v), "files that cannot be opened should not be returned as a ValidationError")
+}
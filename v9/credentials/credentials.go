@@ -16,6 +16,8 @@ import (
 const (
 	// AttributeKeyADCredentials assigned number for AD credentials.
 	AttributeKeyADCredentials = "gokrb5AttributeKeyADCredentials"
+	// AttributeKeyLocalName assigned number for the local user name.
+	AttributeKeyLocalName = "gokrb5AttributeKeyLocalName"
 )
 
 // Credentials struct for a user.
@@ -90,6 +92,16 @@ func New(username string, realm string) *Credentials {
 	}
 }
 
+// NewEnterprise creates a new Credentials instance for an enterprise principal name (KRB_NT_ENTERPRISE, RFC 6806),
+// such as the Active Directory user principal name user@suffix. The username is a single name component which may
+// contain "@". The AS_REQ for an enterprise name asks the KDC to canonicalize it, and the client adopts the canonical
+// name and realm returned only if the AS_REP authenticates them.
+func NewEnterprise(username string, realm string) *Credentials {
+	c := New(username, realm)
+	c.cname = types.NewEnterprisePrincipalName(username)
+	return c
+}
+
 type clearFlag uint8
 
 // NewFromPrincipalName creates a new Credentials instance with the user details provides as a PrincipalName type.
@@ -201,6 +213,20 @@ func (c *Credentials) GetADCredentials() ADCredentials {
 	return ADCredentials{}
 }
 
+// SetLocalName sets the local user name the credential's principal maps to.
+func (c *Credentials) SetLocalName(s string) {
+	c.SetAttribute(AttributeKeyLocalName, s)
+}
+
+// LocalName returns the local user name the credential's principal maps to, or an empty string if it has not been
+// mapped.
+func (c *Credentials) LocalName() string {
+	if s, ok := c.attributes[AttributeKeyLocalName].(string); ok {
+		return s
+	}
+	return ""
+}
+
 // Methods to implement goidentity.Identity interface
 
 // UserName returns the credential's username.
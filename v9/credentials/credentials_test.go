@@ -26,3 +26,14 @@ func TestCredentials_Marshal(t *testing.T) {
 		t.Fatalf("could not unmarshal credetials: %v", err)
 	}
 }
+
+func TestNewEnterprise(t *testing.T) {
+	t.Parallel()
+	cred := NewEnterprise("user@upn.example.com", "TEST.GOKRB5")
+	assert.True(t, cred.CName().IsEnterprise(), "username should be an enterprise principal name")
+	assert.Equal(t, "user@upn.example.com", cred.CName().PrincipalNameString())
+	assert.Equal(t, "user@upn.example.com", cred.UserName())
+	cred = New("user@upn.example.com", "TEST.GOKRB5")
+	assert.False(t, cred.CName().IsEnterprise(), "New should not create an enterprise principal name")
+	assert.Equal(t, []string{"user@upn.example.com"}, cred.CName().NameString)
+}
@@ -100,8 +100,16 @@ func (e Aes256CtsHmacSha96) DecryptMessage(key, ciphertext []byte, usage uint32)
 }
 
 // DeriveKey derives a key from the protocol key based on the usage value.
+// Keys derived for key usage numbers are cached and must not be modified.
 func (e Aes256CtsHmacSha96) DeriveKey(protocolKey, usage []byte) ([]byte, error) {
-	return rfc3961.DeriveKey(protocolKey, usage, e)
+	return common.CachedDeriveKey(e.GetETypeID(), protocolKey, usage, func() ([]byte, error) {
+		return rfc3961.DeriveKey(protocolKey, usage, e)
+	})
+}
+
+// PRF returns the output of the etype's pseudo-random function for the protocol key and input.
+func (e Aes256CtsHmacSha96) PRF(protocolKey, b []byte) ([]byte, error) {
+	return rfc3962.PseudoRandom(protocolKey, b, e)
 }
 
 // DeriveRandom generates data needed for key generation.
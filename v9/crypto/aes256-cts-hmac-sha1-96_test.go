@@ -5,7 +5,9 @@ import (
 	"testing"
 
 	"github.com/oiweiwei/gokrb5.fork/v9/crypto/common"
+	"github.com/oiweiwei/gokrb5.fork/v9/crypto/etype"
 	"github.com/oiweiwei/gokrb5.fork/v9/crypto/rfc3962"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/keyusage"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -43,3 +45,44 @@ func TestAes256CtsHmacSha196_StringToKey(t *testing.T) {
 
 	}
 }
+
+func benchmarkEncryptDecrypt(b *testing.B, e etype.EType, keyLen int) {
+	key := make([]byte, keyLen)
+	msg := make([]byte, 1024)
+	_, ct, err := e.EncryptMessage(key, msg, keyusage.AP_REQ_AUTHENTICATOR)
+	if err != nil {
+		b.Fatalf("error encrypting: %v", err)
+	}
+	for _, cached := range []bool{true, false} {
+		name := "Cached"
+		if !cached {
+			name = "Uncached"
+		}
+		b.Run(name+"/EncryptMessage", func(b *testing.B) {
+			if cached {
+				common.EnableKeyCache(common.DefaultKeyCacheSize, common.DefaultKeyCacheLifetime)
+				defer common.DisableKeyCache()
+			}
+			b.ReportAllocs()
+			b.SetBytes(int64(len(msg)))
+			for i := 0; i < b.N; i++ {
+				e.EncryptMessage(key, msg, keyusage.AP_REQ_AUTHENTICATOR)
+			}
+		})
+		b.Run(name+"/DecryptMessage", func(b *testing.B) {
+			if cached {
+				common.EnableKeyCache(common.DefaultKeyCacheSize, common.DefaultKeyCacheLifetime)
+				defer common.DisableKeyCache()
+			}
+			b.ReportAllocs()
+			b.SetBytes(int64(len(msg)))
+			for i := 0; i < b.N; i++ {
+				e.DecryptMessage(key, ct, keyusage.AP_REQ_AUTHENTICATOR)
+			}
+		})
+	}
+}
+
+func BenchmarkAes256CtsHmacSha96(b *testing.B) {
+	benchmarkEncryptDecrypt(b, Aes256CtsHmacSha96{}, 32)
+}
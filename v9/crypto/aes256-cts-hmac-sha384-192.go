@@ -100,8 +100,16 @@ func (e Aes256CtsHmacSha384192) DecryptMessage(key, ciphertext []byte, usage uin
 }
 
 // DeriveKey derives a key from the protocol key based on the usage value.
+// Keys derived for key usage numbers are cached and must not be modified.
 func (e Aes256CtsHmacSha384192) DeriveKey(protocolKey, usage []byte) ([]byte, error) {
-	return rfc8009.DeriveKey(protocolKey, usage, e), nil
+	return common.CachedDeriveKey(e.GetETypeID(), protocolKey, usage, func() ([]byte, error) {
+		return rfc8009.DeriveKey(protocolKey, usage, e), nil
+	})
+}
+
+// PRF returns the output of the etype's pseudo-random function for the protocol key and input.
+func (e Aes256CtsHmacSha384192) PRF(protocolKey, b []byte) ([]byte, error) {
+	return rfc8009.PseudoRandom(protocolKey, b, e)
 }
 
 // DeriveRandom generates data needed for key generation.
@@ -145,3 +145,7 @@ func TestAes256CtsHmacSha384192_VerifyIntegrity(t *testing.T) {
 		assert.Equal(t, test.chksum, hex.EncodeToString(b), "Checksum not as expected")
 	}
 }
+
+func BenchmarkAes256CtsHmacSha384192(b *testing.B) {
+	benchmarkEncryptDecrypt(b, Aes256CtsHmacSha384192{}, 32)
+}
@@ -0,0 +1,231 @@
+// Package camellia implements the Camellia block cipher as defined in RFC 3713.
+//
+// The S-boxes are implemented with lookup tables indexed by key and data dependent values, so the cipher is not
+// constant time and its timing, through the CPU cache, may leak information about the key to an attacker able to
+// observe it. Prefer the AES encryption types where this is a concern.
+package camellia
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"strconv"
+)
+
+// BlockSize is the Camellia block size in bytes.
+const BlockSize = 16
+
+// KeySizeError is returned for invalid key lengths.
+type KeySizeError int
+
+func (k KeySizeError) Error() string {
+	return "camellia: invalid key size " + strconv.Itoa(int(k))
+}
+
+const (
+	sigma1 uint64 = 0xA09E667F3BCC908B
+	sigma2 uint64 = 0xB67AE8584CAA73B2
+	sigma3 uint64 = 0xC6EF372FE94F82BE
+	sigma4 uint64 = 0x54FF53A5F1D36F1C
+	sigma5 uint64 = 0x10E527FADE682D1D
+	sigma6 uint64 = 0xB05688C2B3E6C1FD
+)
+
+type camelliaCipher struct {
+	// kw holds the whitening keys kw1 to kw4.
+	kw [4]uint64
+	// k holds the round keys, 18 for 128-bit keys and 24 for 192 and 256-bit keys.
+	k []uint64
+	// ke holds the FL/FL^-1 layer keys, 4 for 128-bit keys and 6 for 192 and 256-bit keys.
+	ke []uint64
+}
+
+// NewCipher creates and returns a new cipher.Block. The key argument should be 16, 24 or 32 bytes.
+func NewCipher(key []byte) (cipher.Block, error) {
+	var klh, kll, krh, krl uint64
+	switch len(key) {
+	case 16:
+		klh = binary.BigEndian.Uint64(key[0:8])
+		kll = binary.BigEndian.Uint64(key[8:16])
+	case 24:
+		klh = binary.BigEndian.Uint64(key[0:8])
+		kll = binary.BigEndian.Uint64(key[8:16])
+		krh = binary.BigEndian.Uint64(key[16:24])
+		krl = ^krh
+	case 32:
+		klh = binary.BigEndian.Uint64(key[0:8])
+		kll = binary.BigEndian.Uint64(key[8:16])
+		krh = binary.BigEndian.Uint64(key[16:24])
+		krl = binary.BigEndian.Uint64(key[24:32])
+	default:
+		return nil, KeySizeError(len(key))
+	}
+
+	d1 := klh ^ krh
+	d2 := kll ^ krl
+	d2 ^= f(d1, sigma1)
+	d1 ^= f(d2, sigma2)
+	d1 ^= klh
+	d2 ^= kll
+	d2 ^= f(d1, sigma3)
+	d1 ^= f(d2, sigma4)
+	kah, kal := d1, d2
+
+	c := new(camelliaCipher)
+	if len(key) == 16 {
+		c.kw[0], c.kw[1] = rotl128(klh, kll, 0)
+		c.kw[2], c.kw[3] = rotl128(kah, kal, 111)
+		c.k = make([]uint64, 18)
+		c.ke = make([]uint64, 4)
+		c.k[0], c.k[1] = rotl128(kah, kal, 0)
+		c.k[2], c.k[3] = rotl128(klh, kll, 15)
+		c.k[4], c.k[5] = rotl128(kah, kal, 15)
+		c.ke[0], c.ke[1] = rotl128(kah, kal, 30)
+		c.k[6], c.k[7] = rotl128(klh, kll, 45)
+		c.k[8], _ = rotl128(kah, kal, 45)
+		_, c.k[9] = rotl128(klh, kll, 60)
+		c.k[10], c.k[11] = rotl128(kah, kal, 60)
+		c.ke[2], c.ke[3] = rotl128(klh, kll, 77)
+		c.k[12], c.k[13] = rotl128(klh, kll, 94)
+		c.k[14], c.k[15] = rotl128(kah, kal, 94)
+		c.k[16], c.k[17] = rotl128(klh, kll, 111)
+		return c, nil
+	}
+
+	d1 = kah ^ krh
+	d2 = kal ^ krl
+	d2 ^= f(d1, sigma5)
+	d1 ^= f(d2, sigma6)
+	kbh, kbl := d1, d2
+
+	c.kw[0], c.kw[1] = rotl128(klh, kll, 0)
+	c.kw[2], c.kw[3] = rotl128(kbh, kbl, 111)
+	c.k = make([]uint64, 24)
+	c.ke = make([]uint64, 6)
+	c.k[0], c.k[1] = rotl128(kbh, kbl, 0)
+	c.k[2], c.k[3] = rotl128(krh, krl, 15)
+	c.k[4], c.k[5] = rotl128(kah, kal, 15)
+	c.ke[0], c.ke[1] = rotl128(krh, krl, 30)
+	c.k[6], c.k[7] = rotl128(kbh, kbl, 30)
+	c.k[8], c.k[9] = rotl128(klh, kll, 45)
+	c.k[10], c.k[11] = rotl128(kah, kal, 45)
+	c.ke[2], c.ke[3] = rotl128(klh, kll, 60)
+	c.k[12], c.k[13] = rotl128(krh, krl, 60)
+	c.k[14], c.k[15] = rotl128(kbh, kbl, 60)
+	c.k[16], c.k[17] = rotl128(klh, kll, 77)
+	c.ke[4], c.ke[5] = rotl128(kah, kal, 77)
+	c.k[18], c.k[19] = rotl128(krh, krl, 94)
+	c.k[20], c.k[21] = rotl128(kah, kal, 94)
+	c.k[22], c.k[23] = rotl128(klh, kll, 111)
+	return c, nil
+}
+
+// BlockSize returns the Camellia block size.
+func (c *camelliaCipher) BlockSize() int {
+	return BlockSize
+}
+
+// Encrypt encrypts the first block in src into dst.
+func (c *camelliaCipher) Encrypt(dst, src []byte) {
+	if len(src) < BlockSize || len(dst) < BlockSize {
+		panic("camellia: input not full block")
+	}
+	d1 := binary.BigEndian.Uint64(src[0:8]) ^ c.kw[0]
+	d2 := binary.BigEndian.Uint64(src[8:16]) ^ c.kw[1]
+	for i := 0; i < len(c.k); i += 6 {
+		if i > 0 {
+			d1 = fl(d1, c.ke[i/3-2])
+			d2 = flinv(d2, c.ke[i/3-1])
+		}
+		d2 ^= f(d1, c.k[i])
+		d1 ^= f(d2, c.k[i+1])
+		d2 ^= f(d1, c.k[i+2])
+		d1 ^= f(d2, c.k[i+3])
+		d2 ^= f(d1, c.k[i+4])
+		d1 ^= f(d2, c.k[i+5])
+	}
+	d2 ^= c.kw[2]
+	d1 ^= c.kw[3]
+	binary.BigEndian.PutUint64(dst[0:8], d2)
+	binary.BigEndian.PutUint64(dst[8:16], d1)
+}
+
+// Decrypt decrypts the first block in src into dst.
+func (c *camelliaCipher) Decrypt(dst, src []byte) {
+	if len(src) < BlockSize || len(dst) < BlockSize {
+		panic("camellia: input not full block")
+	}
+	n := len(c.k)
+	d1 := binary.BigEndian.Uint64(src[0:8]) ^ c.kw[2]
+	d2 := binary.BigEndian.Uint64(src[8:16]) ^ c.kw[3]
+	for i := n - 1; i >= 0; i -= 6 {
+		if i < n-1 {
+			j := (i+1)/3 - 1
+			d1 = fl(d1, c.ke[j])
+			d2 = flinv(d2, c.ke[j-1])
+		}
+		d2 ^= f(d1, c.k[i])
+		d1 ^= f(d2, c.k[i-1])
+		d2 ^= f(d1, c.k[i-2])
+		d1 ^= f(d2, c.k[i-3])
+		d2 ^= f(d1, c.k[i-4])
+		d1 ^= f(d2, c.k[i-5])
+	}
+	d2 ^= c.kw[0]
+	d1 ^= c.kw[1]
+	binary.BigEndian.PutUint64(dst[0:8], d2)
+	binary.BigEndian.PutUint64(dst[8:16], d1)
+}
+
+// rotl128 rotates the 128-bit value held in hi and lo left by n bits and returns the result as hi and lo.
+func rotl128(hi, lo uint64, n uint) (uint64, uint64) {
+	if n >= 64 {
+		hi, lo = lo, hi
+		n -= 64
+	}
+	if n == 0 {
+		return hi, lo
+	}
+	return hi<<n | lo>>(64-n), lo<<n | hi>>(64-n)
+}
+
+func rotl32(x uint32, n uint) uint32 {
+	return x<<n | x>>(32-n)
+}
+
+func f(in, ke uint64) uint64 {
+	x := in ^ ke
+	t1 := sbox1[byte(x>>56)]
+	t2 := sbox2[byte(x>>48)]
+	t3 := sbox3[byte(x>>40)]
+	t4 := sbox4[byte(x>>32)]
+	t5 := sbox2[byte(x>>24)]
+	t6 := sbox3[byte(x>>16)]
+	t7 := sbox4[byte(x>>8)]
+	t8 := sbox1[byte(x)]
+	y1 := t1 ^ t3 ^ t4 ^ t6 ^ t7 ^ t8
+	y2 := t1 ^ t2 ^ t4 ^ t5 ^ t7 ^ t8
+	y3 := t1 ^ t2 ^ t3 ^ t5 ^ t6 ^ t8
+	y4 := t2 ^ t3 ^ t4 ^ t5 ^ t6 ^ t7
+	y5 := t1 ^ t2 ^ t6 ^ t7 ^ t8
+	y6 := t2 ^ t3 ^ t5 ^ t7 ^ t8
+	y7 := t3 ^ t4 ^ t5 ^ t6 ^ t8
+	y8 := t1 ^ t4 ^ t5 ^ t6 ^ t7
+	return uint64(y1)<<56 | uint64(y2)<<48 | uint64(y3)<<40 | uint64(y4)<<32 |
+		uint64(y5)<<24 | uint64(y6)<<16 | uint64(y7)<<8 | uint64(y8)
+}
+
+func fl(in, ke uint64) uint64 {
+	x1, x2 := uint32(in>>32), uint32(in)
+	k1, k2 := uint32(ke>>32), uint32(ke)
+	x2 ^= rotl32(x1&k1, 1)
+	x1 ^= x2 | k2
+	return uint64(x1)<<32 | uint64(x2)
+}
+
+func flinv(in, ke uint64) uint64 {
+	y1, y2 := uint32(in>>32), uint32(in)
+	k1, k2 := uint32(ke>>32), uint32(ke)
+	y1 ^= y2 | k2
+	y2 ^= rotl32(y1&k1, 1)
+	return uint64(y1)<<32 | uint64(y2)
+}
@@ -0,0 +1,38 @@
+package camellia
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCamellia(t *testing.T) {
+	t.Parallel()
+	// Test vectors from RFC 3713 Appendix A
+	var tests = []struct {
+		key    string
+		plain  string
+		cipher string
+	}{
+		{"0123456789abcdeffedcba9876543210", "0123456789abcdeffedcba9876543210", "67673138549669730857065648eabe43"},
+		{"0123456789abcdeffedcba98765432100011223344556677", "0123456789abcdeffedcba9876543210", "b4993401b3e996f84ee5cee7d79b09b9"},
+		{"0123456789abcdeffedcba987654321000112233445566778899aabbccddeeff", "0123456789abcdeffedcba9876543210", "9acc237dff16d76c20ef7c919e3a7509"},
+	}
+	for i, test := range tests {
+		k, _ := hex.DecodeString(test.key)
+		p, _ := hex.DecodeString(test.plain)
+		c, err := NewCipher(k)
+		if err != nil {
+			t.Fatalf("error creating cipher for test %d: %v", i, err)
+		}
+		b := make([]byte, BlockSize)
+		c.Encrypt(b, p)
+		assert.Equal(t, test.cipher, hex.EncodeToString(b), "ciphertext not as expected for test %d", i)
+		c.Decrypt(b, b)
+		assert.Equal(t, test.plain, hex.EncodeToString(b), "plaintext not as expected for test %d", i)
+	}
+	if _, err := NewCipher(make([]byte, 10)); err == nil {
+		t.Error("should have errored for invalid key size")
+	}
+}
@@ -0,0 +1,115 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/oiweiwei/gokrb5.fork/v9/crypto/common"
+	"github.com/oiweiwei/gokrb5.fork/v9/crypto/rfc6803"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCamellia128CtsCmac_StringToKey(t *testing.T) {
+	t.Parallel()
+	// Test vectors from RFC 6803 section 10
+	var tests = []struct {
+		iterations uint32
+		phrase     string
+		salt       string
+		key        string
+	}{
+		{1, "password", "ATHENA.MIT.EDUraeburn", "57d0297298ffd9d35de5a47fb4bde24b"},
+		{2, "password", "ATHENA.MIT.EDUraeburn", "73f1b53aa0f310f93b1de8ccaa0cb152"},
+		{1200, "password", "ATHENA.MIT.EDUraeburn", "8e571145452855575fd916e7b04487aa"},
+	}
+	var e Camellia128CtsCmac
+	for i, test := range tests {
+		k, err := e.StringToKey(test.phrase, test.salt, common.IterationsToS2Kparams(test.iterations))
+		if err != nil {
+			t.Errorf("error in processing string to key for test %d: %v", i, err)
+		}
+		assert.Equal(t, test.key, hex.EncodeToString(k), "String to Key not as expected for test %d", i)
+	}
+}
+
+func TestCamellia128CtsCmac_DeriveKey(t *testing.T) {
+	t.Parallel()
+	// Test vectors from RFC 6803 section 10
+	protocolBaseKey, _ := hex.DecodeString("57d0297298ffd9d35de5a47fb4bde24b")
+	testUsage := uint32(2)
+	var e Camellia128CtsCmac
+	k, err := e.DeriveKey(protocolBaseKey, common.GetUsageKc(testUsage))
+	if err != nil {
+		t.Fatalf("Error deriving checksum key: %v", err)
+	}
+	assert.Equal(t, "d155775a209d05f02b38d42a389e5a56", hex.EncodeToString(k), "Checksum derived key not as epxected")
+	k, err = e.DeriveKey(protocolBaseKey, common.GetUsageKe(testUsage))
+	if err != nil {
+		t.Fatalf("Error deriving encryption key: %v", err)
+	}
+	assert.Equal(t, "64df83f85a532f17577d8c37035796ab", hex.EncodeToString(k), "Encryption derived key not as epxected")
+	k, err = e.DeriveKey(protocolBaseKey, common.GetUsageKi(testUsage))
+	if err != nil {
+		t.Fatalf("Error deriving integrity key: %v", err)
+	}
+	assert.Equal(t, "3e4fbdf30fb8259c425cb6c96f1f4635", hex.EncodeToString(k), "Integrity derived key not as epxected")
+}
+
+func TestCamellia128CtsCmac_Cypto(t *testing.T) {
+	t.Parallel()
+	// Test vectors from RFC 6803 section 10
+	var tests = []struct {
+		plain      string
+		confounder string
+		key        string
+		usage      uint32
+		cipher     string
+	}{
+		{"", "b69822a19a6b09c0ebc8557d1f1b6c0a", "1dc46a8d763f4f93742bcba3387576c3", 0, "c466f1871069921edb7c6fde244a52db0ba10edc197bdb8006658ca3ccce6eb8"},
+		{"1", "6f2fc3c2a166fd8898967a83de9596d9", "5027bc231d0f3a9d23333f1ca6fdbe7c", 1, "842d21fd950311c0dd464a3f4be8d6da88a56d559c9b47d3f9a85067af661559b8"},
+		{"9 bytesss", "a5b4a71e077aeef93c8763c18fdb1f10", "a1bb61e805f9ba6dde8fdbddc05cdea0", 2, "619ff072e36286ff0a28deb3a352ec0d0edf5c5160d663c901758ccf9d1ed33d71db8f23aabf8348a0"},
+		{"13 bytes byte", "19fee40d810c524b5b22f01874c693da", "2ca27a5faf5532244506434e1cef6676", 3, "b8eca3167ae6315512e59f98a7c500205e5f63ff3bb389af1c41a21d640d8615c9ed3fbeb05ab6acb67689b5ea"},
+		{"30 bytes bytes bytes bytes byt", "ca7a7ab4be192dabd603506db19c39e2", "7824f8c16f83ff354c6bf7515b973f43", 4, "a26a3905a4ffd5816b7b1e27380d08090c8ec1f304496e1abdcd2bdcd1dffc660989e117a713ddbb57a4146c1587cba4356665591d2240282f5842b105a5"},
+	}
+	var e Camellia128CtsCmac
+	for i, test := range tests {
+		m := []byte(test.plain)
+		b, _ := hex.DecodeString(test.confounder)
+		k, _ := hex.DecodeString(test.key)
+		_, c, err := rfc6803.EncryptMessageWithConfounder(k, m, b, test.usage, e)
+		if err != nil {
+			t.Errorf("encryption failed for test %v: %v", i+1, err)
+		}
+		assert.Equal(t, test.cipher, hex.EncodeToString(c), "Encrypted result not as expected - test %v", i)
+		p, err := e.DecryptMessage(k, c, test.usage)
+		if err != nil {
+			t.Errorf("decryption failed for test %v: %v", i+1, err)
+		}
+		assert.Equal(t, m, p, "Decrypted result not as expected - test %v", i)
+	}
+}
+
+func TestCamellia128CtsCmac_VerifyChecksum(t *testing.T) {
+	t.Parallel()
+	// Test vectors from RFC 6803 section 10
+	var tests = []struct {
+		plain  string
+		key    string
+		usage  uint32
+		chksum string
+	}{
+		{"abcdefghijk", "1dc46a8d763f4f93742bcba3387576c3", 7, "1178e6c5c47a8c1ae0c4b9c7d4eb7b6b"},
+		{"ABCDEFGHIJKLMNOPQRSTUVWXYZ", "5027bc231d0f3a9d23333f1ca6fdbe7c", 8, "d1b34f7004a731f23a0c00bf6c3f753a"},
+	}
+	var e Camellia128CtsCmac
+	for i, test := range tests {
+		k, _ := hex.DecodeString(test.key)
+		c, err := e.GetChecksumHash(k, []byte(test.plain), test.usage)
+		if err != nil {
+			t.Errorf("checksum failed for test %v: %v", i+1, err)
+		}
+		assert.Equal(t, test.chksum, hex.EncodeToString(c), "Checksum not as expected - test %v", i)
+		cb, _ := hex.DecodeString(test.chksum)
+		assert.True(t, e.VerifyChecksum(k, []byte(test.plain), cb, test.usage), "Checksum verification failed - test %v", i)
+	}
+}
@@ -0,0 +1,115 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/oiweiwei/gokrb5.fork/v9/crypto/common"
+	"github.com/oiweiwei/gokrb5.fork/v9/crypto/rfc6803"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCamellia256CtsCmac_StringToKey(t *testing.T) {
+	t.Parallel()
+	// Test vectors from RFC 6803 section 10
+	var tests = []struct {
+		iterations uint32
+		phrase     string
+		salt       string
+		key        string
+	}{
+		{1, "password", "ATHENA.MIT.EDUraeburn", "b9d6828b2056b7be656d88a123b1fac68214ac2b727ecf5f69afe0c4df2a6d2c"},
+		{2, "password", "ATHENA.MIT.EDUraeburn", "83fc5866e5f8f4c6f38663c65c87549f342bc47ed394dc9d3cd4d163ade375e3"},
+		{1200, "password", "ATHENA.MIT.EDUraeburn", "77f421a6f25e138395e837e5d85d385b4c1bfd772e112cd9208ce72a530b15e6"},
+	}
+	var e Camellia256CtsCmac
+	for i, test := range tests {
+		k, err := e.StringToKey(test.phrase, test.salt, common.IterationsToS2Kparams(test.iterations))
+		if err != nil {
+			t.Errorf("error in processing string to key for test %d: %v", i, err)
+		}
+		assert.Equal(t, test.key, hex.EncodeToString(k), "String to Key not as expected for test %d", i)
+	}
+}
+
+func TestCamellia256CtsCmac_DeriveKey(t *testing.T) {
+	t.Parallel()
+	// Test vectors from RFC 6803 section 10
+	protocolBaseKey, _ := hex.DecodeString("b9d6828b2056b7be656d88a123b1fac68214ac2b727ecf5f69afe0c4df2a6d2c")
+	testUsage := uint32(2)
+	var e Camellia256CtsCmac
+	k, err := e.DeriveKey(protocolBaseKey, common.GetUsageKc(testUsage))
+	if err != nil {
+		t.Fatalf("Error deriving checksum key: %v", err)
+	}
+	assert.Equal(t, "e467f9a9552bc7d3155a6220af9c19220eeed4ff78b0d1e6a1544991461a9e50", hex.EncodeToString(k), "Checksum derived key not as epxected")
+	k, err = e.DeriveKey(protocolBaseKey, common.GetUsageKe(testUsage))
+	if err != nil {
+		t.Fatalf("Error deriving encryption key: %v", err)
+	}
+	assert.Equal(t, "412aefc362a7285fc3966c6a5181e7605ae675235b6d549fbfc9ab6630a4c604", hex.EncodeToString(k), "Encryption derived key not as epxected")
+	k, err = e.DeriveKey(protocolBaseKey, common.GetUsageKi(testUsage))
+	if err != nil {
+		t.Fatalf("Error deriving integrity key: %v", err)
+	}
+	assert.Equal(t, "fa624fa0e523993fa388aefdc67e67ebcd8c08e8a0246b1d73b0d1dd9fc582b0", hex.EncodeToString(k), "Integrity derived key not as epxected")
+}
+
+func TestCamellia256CtsCmac_Cypto(t *testing.T) {
+	t.Parallel()
+	// Test vectors from RFC 6803 section 10
+	var tests = []struct {
+		plain      string
+		confounder string
+		key        string
+		usage      uint32
+		cipher     string
+	}{
+		{"", "3cbbd2b45917941067f96599bb98926c", "b61c86cc4e5d2757545ad423399fb7031ecab913cbb900bd7a3c6dd8bf92015b", 0, "03886d03310b47a6d8f06d7b94d1dd837ecce315ef652aff620859d94a259266"},
+		{"1", "def487fcebe6de6346d4da4521bba2d2", "1b97fe0a190e2021eb30753e1b6e1e77b0754b1d684610355864104963463833", 1, "2c9c1570133c99bf6a34bc1b0212002fd194338749db4135497a347cfcd9d18a12"},
+		{"9 bytesss", "ad4ff904d34e555384b14100fc465f88", "32164c5b434d1d1538e4cfd9be8040fe8c4ac7acc4b93d3314d2133668147a05", 2, "9c6de75f812de7ed0d28b2963557a115640998275b0af5152709913ff52a2a9c8e63b872f92e64c839"},
+		{"13 bytes byte", "cf9bca6df1144e0c0af9b8f34c90d514", "b038b132cd8e06612267fab7170066d88aeccba0b744bfc60dc89bca182d0715", 3, "eeec85a9813cdc536772ab9b42defc5706f726e975dde05a87eb5406ea324ca185c9986b42aabe794b84821bee"},
+		{"30 bytes bytes bytes bytes byt", "644def38da35007275878d216855e228", "ccfcd349bf4c6677e86e4b02b8eab924a546ac731cf9bf6989b996e7d6bfbba7", 4, "0e44680985855f2d1f1812529ca83bfd8e349de6fd9ada0baaa048d68e265febf34ad1255a344999ad37146887a6c6845731ac7f46376a0504cd06571474"},
+	}
+	var e Camellia256CtsCmac
+	for i, test := range tests {
+		m := []byte(test.plain)
+		b, _ := hex.DecodeString(test.confounder)
+		k, _ := hex.DecodeString(test.key)
+		_, c, err := rfc6803.EncryptMessageWithConfounder(k, m, b, test.usage, e)
+		if err != nil {
+			t.Errorf("encryption failed for test %v: %v", i+1, err)
+		}
+		assert.Equal(t, test.cipher, hex.EncodeToString(c), "Encrypted result not as expected - test %v", i)
+		p, err := e.DecryptMessage(k, c, test.usage)
+		if err != nil {
+			t.Errorf("decryption failed for test %v: %v", i+1, err)
+		}
+		assert.Equal(t, m, p, "Decrypted result not as expected - test %v", i)
+	}
+}
+
+func TestCamellia256CtsCmac_VerifyChecksum(t *testing.T) {
+	t.Parallel()
+	// Test vectors from RFC 6803 section 10
+	var tests = []struct {
+		plain  string
+		key    string
+		usage  uint32
+		chksum string
+	}{
+		{"123456789", "b61c86cc4e5d2757545ad423399fb7031ecab913cbb900bd7a3c6dd8bf92015b", 9, "87a12cfd2b96214810f01c826e7744b1"},
+		{"!@#$%^&*()!@#$%^&*()!@#$%^&*()", "32164c5b434d1d1538e4cfd9be8040fe8c4ac7acc4b93d3314d2133668147a05", 10, "3fa0b42355e52b189187294aa252ab64"},
+	}
+	var e Camellia256CtsCmac
+	for i, test := range tests {
+		k, _ := hex.DecodeString(test.key)
+		c, err := e.GetChecksumHash(k, []byte(test.plain), test.usage)
+		if err != nil {
+			t.Errorf("checksum failed for test %v: %v", i+1, err)
+		}
+		assert.Equal(t, test.chksum, hex.EncodeToString(c), "Checksum not as expected - test %v", i)
+		cb, _ := hex.DecodeString(test.chksum)
+		assert.True(t, e.VerifyChecksum(k, []byte(test.plain), cb, test.usage), "Checksum verification failed - test %v", i)
+	}
+}
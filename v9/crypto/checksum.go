@@ -0,0 +1,68 @@
+package crypto
+
+import (
+	"crypto/hmac"
+
+	"github.com/oiweiwei/gokrb5.fork/v9/crypto/chksum"
+	"github.com/oiweiwei/gokrb5.fork/v9/crypto/etype"
+	"github.com/oiweiwei/gokrb5.fork/v9/types"
+)
+
+// GetChksumType returns an instance of the required checksum type for the checksum type ID from the default registry.
+//
+// Unlike GetChksumEtype the checksum types returned are independent of encryption types so unkeyed and legacy keyed
+// checksums, such as RSA-MD5 and DES-MAC, are also supported.
+func GetChksumType(id int32) (chksum.ChksumType, error) {
+	return defaultRegistry.GetChksumType(id)
+}
+
+// GetChecksum calculates the checksum of the data using the checksum type ID provided.
+func GetChecksum(data []byte, key types.EncryptionKey, usage uint32, id int32) (types.Checksum, error) {
+	return GetChecksumWithKey(data, NewKey(key), usage, id)
+}
+
+// VerifyChecksum verifies the checksum of the data using the checksum type of the checksum provided.
+// If keyed is true unkeyed checksum types are rejected.
+func VerifyChecksum(c types.Checksum, data []byte, key types.EncryptionKey, usage uint32, keyed bool) (bool, error) {
+	return VerifyChecksumWithKey(c, data, NewKey(key), usage, keyed)
+}
+
+// ETypeChksum is the keyed checksum type associated with an encryption type, as for the simplified profile
+// checksums of RFC 3961 section 5.4.
+type ETypeChksum struct {
+	EType etype.EType
+}
+
+// GetChksumTypeID returns the checksum type ID number.
+func (c ETypeChksum) GetChksumTypeID() int32 {
+	return c.EType.GetHashID()
+}
+
+// GetChecksumByteSize returns the byte size of the checksum.
+func (c ETypeChksum) GetChecksumByteSize() int {
+	return c.EType.GetHMACBitLength() / 8
+}
+
+// IsKeyed returns true as the checksums are keyed.
+func (c ETypeChksum) IsKeyed() bool {
+	return true
+}
+
+// GetChecksum returns a keyed checksum of the data provided.
+func (c ETypeChksum) GetChecksum(key, data []byte, usage uint32) ([]byte, error) {
+	return c.EType.GetChecksumHash(key, data, usage)
+}
+
+// VerifyChecksum compares the checksum of the data is the same as the checksum provided.
+func (c ETypeChksum) VerifyChecksum(key, data, chksum []byte, usage uint32) bool {
+	return c.EType.VerifyChecksum(key, data, chksum, usage)
+}
+
+// verifyUnkeyed compares the unkeyed checksum of the data is the same as the checksum provided.
+func verifyUnkeyed(ct chksum.ChksumType, data, chksum []byte) bool {
+	c, err := ct.GetChecksum(nil, data, 0)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(c, chksum)
+}
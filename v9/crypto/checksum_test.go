@@ -0,0 +1,136 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/chksumtype"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/etypeID"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/keyusage"
+	"github.com/oiweiwei/gokrb5.fork/v9/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetChksumType_Unkeyed(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		id     int32
+		data   string
+		chksum string
+	}{
+		// RFC 3961 Appendix A.5
+		{chksumtype.CRC32, "foo", "33bc3273"},
+		{chksumtype.CRC32, "test0123456789", "d6883eb8"},
+		{chksumtype.CRC32, "MASSACHVSETTS INSTITVTE OF TECHNOLOGY", "f78041e3"},
+		// RFC 1320 and RFC 1321 test suites
+		{chksumtype.RSA_MD4, "abc", "a448017aaf21d8525fc10ae87aa6729d"},
+		{chksumtype.RSA_MD5, "abc", "900150983cd24fb0d6963f7d28e17f72"},
+	}
+	for i, test := range tests {
+		ct, err := GetChksumType(test.id)
+		if err != nil {
+			t.Fatalf("error getting checksum type for test %d: %v", i, err)
+		}
+		assert.False(t, ct.IsKeyed(), "checksum type should not be keyed for test %d", i)
+		assert.Equal(t, test.id, ct.GetChksumTypeID(), "checksum type ID not as expected for test %d", i)
+		c, err := ct.GetChecksum(nil, []byte(test.data), 0)
+		if err != nil {
+			t.Fatalf("error calculating checksum for test %d: %v", i, err)
+		}
+		assert.Equal(t, test.chksum, hex.EncodeToString(c), "checksum not as expected for test %d", i)
+		assert.Equal(t, ct.GetChecksumByteSize(), len(c), "checksum size not as expected for test %d", i)
+		assert.True(t, ct.VerifyChecksum(nil, []byte(test.data), c, 0), "checksum verification failed for test %d", i)
+	}
+}
+
+func TestGetChksumType_Keyed(t *testing.T) {
+	t.Parallel()
+	desKey, _ := hex.DecodeString("cbc22fae235298e3")
+	aesKey, _ := hex.DecodeString("fe697b52bc0d3ce14432ba036a92e65bbb52280990a2fa27883998d72af30161")
+	rc4Key, _ := hex.DecodeString("68f263db3fce15d031c9eab02d67107a")
+	var tests = []struct {
+		id  int32
+		key []byte
+	}{
+		{chksumtype.RSA_MD4_DES, desKey},
+		{chksumtype.RSA_MD5_DES, desKey},
+		{chksumtype.DES_MAC, desKey},
+		{chksumtype.HMAC_SHA1_96_AES256, aesKey},
+		{chksumtype.KERB_CHECKSUM_HMAC_MD5, rc4Key},
+	}
+	data := []byte("this is the data to be checksummed")
+	for i, test := range tests {
+		ct, err := GetChksumType(test.id)
+		if err != nil {
+			t.Fatalf("error getting checksum type for test %d: %v", i, err)
+		}
+		assert.True(t, ct.IsKeyed(), "checksum type should be keyed for test %d", i)
+		c, err := ct.GetChecksum(test.key, data, keyusage.KRB_SAFE_CHKSUM)
+		if err != nil {
+			t.Fatalf("error calculating checksum for test %d: %v", i, err)
+		}
+		assert.Equal(t, ct.GetChecksumByteSize(), len(c), "checksum size not as expected for test %d", i)
+		assert.True(t, ct.VerifyChecksum(test.key, data, c, keyusage.KRB_SAFE_CHKSUM), "checksum verification failed for test %d", i)
+		assert.False(t, ct.VerifyChecksum(test.key, []byte("other data"), c, keyusage.KRB_SAFE_CHKSUM), "checksum verification should fail for other data for test %d", i)
+		otherKey := make([]byte, len(test.key))
+		copy(otherKey, test.key)
+		otherKey[0] ^= 0x02
+		assert.False(t, ct.VerifyChecksum(otherKey, data, c, keyusage.KRB_SAFE_CHKSUM), "checksum verification should fail for other key for test %d", i)
+	}
+}
+
+func TestHmacMd5_MatchesRC4HMAC(t *testing.T) {
+	t.Parallel()
+	key, _ := hex.DecodeString("68f263db3fce15d031c9eab02d67107a")
+	data := []byte("PAC data")
+	c, err := HmacMd5{}.GetChecksum(key, data, keyusage.KERB_NON_KERB_CKSUM_SALT)
+	if err != nil {
+		t.Fatalf("error calculating checksum: %v", err)
+	}
+	e, _ := RC4HMAC{}.GetChecksumHash(key, data, keyusage.KERB_NON_KERB_CKSUM_SALT)
+	assert.Equal(t, e, c, "HMAC-MD5 checksum not as expected")
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	t.Parallel()
+	key := types.EncryptionKey{KeyType: etypeID.DES_CBC_MD5}
+	key.KeyValue, _ = hex.DecodeString("cbc22fae235298e3")
+	data := []byte("krb5data")
+	c, err := GetChecksum(data, key, keyusage.KRB_SAFE_CHKSUM, chksumtype.RSA_MD5_DES)
+	if err != nil {
+		t.Fatalf("error calculating checksum: %v", err)
+	}
+	assert.Equal(t, chksumtype.RSA_MD5_DES, c.CksumType, "checksum type not as expected")
+	ok, err := VerifyChecksum(c, data, key, keyusage.KRB_SAFE_CHKSUM, true)
+	if err != nil || !ok {
+		t.Errorf("checksum verification failed: %v", err)
+	}
+
+	c, _ = GetChecksum(data, key, keyusage.KRB_SAFE_CHKSUM, chksumtype.RSA_MD5)
+	if _, err := VerifyChecksum(c, data, key, keyusage.KRB_SAFE_CHKSUM, true); err == nil {
+		t.Error("should have errored verifying an unkeyed checksum where a keyed checksum is required")
+	}
+	if _, err := GetChksumType(chksumtype.SHA1_ID10); err == nil {
+		t.Error("should have errored for an unsupported checksum type")
+	}
+}
+
+func TestVerifyChecksumWithKey_Registry(t *testing.T) {
+	t.Parallel()
+	key := types.EncryptionKey{KeyType: etypeID.DES_CBC_MD5}
+	key.KeyValue, _ = hex.DecodeString("cbc22fae235298e3")
+	data := []byte("krb5data")
+	c, err := GetChecksum(data, key, keyusage.KRB_SAFE_CHKSUM, chksumtype.RSA_MD5_DES)
+	if err != nil {
+		t.Fatalf("error calculating checksum: %v", err)
+	}
+	r := DefaultRegistry().Clone()
+	r.Disable(etypeID.DES_CBC_CRC, etypeID.DES_CBC_MD4, etypeID.DES_CBC_MD5)
+	k := r.NewKey(key)
+	assert.Same(t, r, KeyRegistry(k))
+	_, err = VerifyChecksumWithKey(c, data, k, keyusage.KRB_SAFE_CHKSUM, true)
+	assert.Error(t, err, "the DES checksum should be rejected by a registry with the DES etypes disabled")
+	ok, err := VerifyChecksumWithKey(c, data, NewKey(key), keyusage.KRB_SAFE_CHKSUM, true)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
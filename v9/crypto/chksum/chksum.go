@@ -0,0 +1,14 @@
+// Package chksum provides the Kerberos Checksum Type interface
+package chksum
+
+// ChksumType is the interface defining a Kerberos checksum type.
+//
+// Checksum types are independent of encryption types. Unkeyed checksum types ignore the key provided and must not be
+// used where RFC 4120 requires a keyed checksum, such as in KRB_SAFE messages.
+type ChksumType interface {
+	GetChksumTypeID() int32
+	GetChecksumByteSize() int
+	IsKeyed() bool
+	GetChecksum(key, data []byte, usage uint32) ([]byte, error)
+	VerifyChecksum(key, data, chksum []byte, usage uint32) bool
+}
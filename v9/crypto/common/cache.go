@@ -0,0 +1,189 @@
+package common
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+// DefaultKeyCacheSize is the suggested maximum number of entries held in each of the derived key and cipher caches.
+const DefaultKeyCacheSize = 4096
+
+// DefaultKeyCacheLifetime is the suggested time for which entries are held in the derived key and cipher caches.
+const DefaultKeyCacheLifetime = 5 * time.Minute
+
+const (
+	maxCachedKeyLen   = 32
+	maxCachedUsageLen = 5
+)
+
+// cacheSalt is the random value hashed with the keys cached so that the cache keys cannot be used to test guesses of
+// the keys.
+var cacheSalt = func() [sha256.Size]byte {
+	var b [sha256.Size]byte
+	rand.Read(b[:])
+	return b
+}()
+
+// cacheKey identifies a key, and the key usage it is derived for, by a salted hash so that the key itself is not held
+// as the key of the cache.
+type cacheKey [sha256.Size]byte
+
+func newCacheKey(etype int32, key, usage []byte) (cacheKey, bool) {
+	if len(key) > maxCachedKeyLen || (usage != nil && len(usage) != maxCachedUsageLen) {
+		return cacheKey{}, false
+	}
+	// A fixed size buffer is used so the lookup does not allocate
+	var b [sha256.Size + 4 + 1 + maxCachedKeyLen + maxCachedUsageLen]byte
+	n := copy(b[:], cacheSalt[:])
+	binary.BigEndian.PutUint32(b[n:], uint32(etype))
+	n += 4
+	b[n] = uint8(len(key))
+	n++
+	n += copy(b[n:], key)
+	n += copy(b[n:], usage)
+	return sha256.Sum256(b[:n]), true
+}
+
+type cacheEntry[V any] struct {
+	v       V
+	expires time.Time
+}
+
+// keyCache is a size bounded, concurrency safe cache of entries held for a limited lifetime. When full expired entries
+// are removed and, if it is still full, the entry closest to expiry is evicted. Caching is disabled while the maximum
+// size is zero.
+type keyCache[V any] struct {
+	mu       sync.RWMutex
+	m        map[cacheKey]cacheEntry[V]
+	max      int
+	lifetime time.Duration
+}
+
+func newKeyCache[V any](max int, lifetime time.Duration) *keyCache[V] {
+	return &keyCache[V]{m: make(map[cacheKey]cacheEntry[V]), max: max, lifetime: lifetime}
+}
+
+func (c *keyCache[V]) enabled() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.max > 0
+}
+
+func (c *keyCache[V]) get(k cacheKey) (V, bool) {
+	c.mu.RLock()
+	e, ok := c.m[k]
+	c.mu.RUnlock()
+	if !ok || !time.Now().Before(e.expires) {
+		var v V
+		return v, false
+	}
+	return e.v, true
+}
+
+func (c *keyCache[V]) put(k cacheKey, v V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.max <= 0 {
+		return
+	}
+	now := time.Now()
+	if len(c.m) >= c.max {
+		var oldest cacheKey
+		var oldestExpires time.Time
+		for ek, e := range c.m {
+			if !now.Before(e.expires) {
+				delete(c.m, ek)
+				continue
+			}
+			if oldestExpires.IsZero() || e.expires.Before(oldestExpires) {
+				oldest, oldestExpires = ek, e.expires
+			}
+		}
+		if len(c.m) >= c.max {
+			delete(c.m, oldest)
+		}
+	}
+	c.m[k] = cacheEntry[V]{v: v, expires: now.Add(c.lifetime)}
+}
+
+func (c *keyCache[V]) set(max int, lifetime time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.max = max
+	c.lifetime = lifetime
+	c.m = make(map[cacheKey]cacheEntry[V])
+}
+
+// The caches are disabled until EnableKeyCache is called.
+var (
+	derivedKeys = newKeyCache[[]byte](0, 0)
+	aesBlocks   = newKeyCache[cipher.Block](0, 0)
+)
+
+// EnableKeyCache enables the caching of the keys derived for the AES encryption types and of the AES ciphers of keys,
+// so that they are not recalculated for keys used repeatedly, such as the long-term keys of a busy service. Each cache
+// holds up to size entries for the lifetime provided, such as DefaultKeyCacheSize and DefaultKeyCacheLifetime.
+// The caches are emptied.
+//
+// The caches are shared by the process and hold key material in memory for the lifetime of the entries.
+func EnableKeyCache(size int, lifetime time.Duration) {
+	if size < 0 || lifetime <= 0 {
+		size = 0
+	}
+	derivedKeys.set(size, lifetime)
+	aesBlocks.set(size, lifetime)
+}
+
+// DisableKeyCache disables and empties the derived key and cipher caches.
+func DisableKeyCache() {
+	EnableKeyCache(0, 0)
+}
+
+// CachedDeriveKey returns the key derived from the protocol key and the key usage constant, calling derive only if
+// the key cache is enabled and the derived key is not already cached.
+// Only the 5 byte key usage constants of RFC 3961 section 5.3 are cached.
+// The derived key returned is shared and must not be modified.
+func CachedDeriveKey(etype int32, protocolKey, usage []byte, derive func() ([]byte, error)) ([]byte, error) {
+	if !derivedKeys.enabled() {
+		return derive()
+	}
+	ck, ok := newCacheKey(etype, protocolKey, usage)
+	if !ok {
+		return derive()
+	}
+	if k, ok := derivedKeys.get(ck); ok {
+		return k, nil
+	}
+	k, err := derive()
+	if err != nil {
+		return nil, err
+	}
+	derivedKeys.put(ck, k)
+	return k, nil
+}
+
+// AESBlock returns an AES cipher.Block for the key. If the key cache is enabled blocks are cached so the key schedule
+// is not recalculated for keys that are used repeatedly.
+func AESBlock(key []byte) (cipher.Block, error) {
+	if !aesBlocks.enabled() {
+		return aes.NewCipher(key)
+	}
+	ck, ok := newCacheKey(0, key, nil)
+	if !ok {
+		return aes.NewCipher(key)
+	}
+	if b, ok := aesBlocks.get(ck); ok {
+		return b, nil
+	}
+	b, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aesBlocks.put(ck, b)
+	return b, nil
+}
@@ -0,0 +1,108 @@
+package common
+
+import (
+	"crypto/subtle"
+	"errors"
+	"sync"
+)
+
+// maxBlockSize is the largest cipher block size supported by the CTS functions.
+const maxBlockSize = 16
+
+// CBCBlock is the subset of cipher.Block used by the CTS functions.
+type CBCBlock interface {
+	BlockSize() int
+	Encrypt(dst, src []byte)
+	Decrypt(dst, src []byte)
+}
+
+// CTSEncrypt encrypts the plaintext using CBC mode with ciphertext stealing as defined for Kerberos in RFC 3962.
+// For consistency ciphertext stealing is always used for the last two blocks, so if the plaintext is a multiple of
+// the block size this is CBC mode with the last two ciphertext blocks swapped. Plaintext no larger than one block is
+// zero padded to the block size.
+// Returns the next iv and the ciphertext.
+func CTSEncrypt(b CBCBlock, iv, plaintext []byte) ([]byte, []byte) {
+	bs := b.BlockSize()
+	l := len(plaintext)
+	n := ((l + bs - 1) / bs) * bs
+	if n == 0 {
+		n = bs
+	}
+	out := make([]byte, n)
+	copy(out, plaintext)
+	prev := iv
+	for i := 0; i < n; i += bs {
+		blk := out[i : i+bs]
+		subtle.XORBytes(blk, blk, prev)
+		b.Encrypt(blk, blk)
+		prev = blk
+	}
+	if n == bs {
+		return out, out
+	}
+	var tmp [maxBlockSize]byte
+	pb, lb := out[n-2*bs:n-bs], out[n-bs:]
+	copy(tmp[:bs], pb)
+	copy(pb, lb)
+	copy(lb, tmp[:bs])
+	return pb[:bs:bs], out[:l]
+}
+
+// CTSDecrypt decrypts ciphertext encrypted using CBC mode with ciphertext stealing as defined for Kerberos in RFC 3962.
+func CTSDecrypt(b CBCBlock, iv, ciphertext []byte) ([]byte, error) {
+	bs := b.BlockSize()
+	l := len(ciphertext)
+	if l < bs {
+		return nil, errors.New("ciphertext is not large enough. It is less that one block size")
+	}
+	n := ((l + bs - 1) / bs) * bs
+	out := make([]byte, n)
+	copy(out, ciphertext)
+	if n > bs {
+		// d is the number of bytes in the final, possibly partial, block
+		d := l - (n - bs)
+		// Decrypting the last full cipher block gives the final plaintext block XORed with the penultimate cipher
+		// block. The bytes of the penultimate cipher block that were stolen are recovered from this.
+		var dn, cn [maxBlockSize]byte
+		copy(cn[:bs], ciphertext[n-2*bs:n-bs])
+		b.Decrypt(dn[:bs], cn[:bs])
+		copy(out[n-2*bs:], ciphertext[n-bs:])
+		copy(out[n-2*bs+d:n-bs], dn[d:bs])
+		copy(out[n-bs:], cn[:bs])
+	}
+	// CBC decrypt in place working backwards so the preceding cipher block is still available
+	for i := n - bs; i >= 0; i -= bs {
+		blk := out[i : i+bs]
+		b.Decrypt(blk, blk)
+		if i == 0 {
+			subtle.XORBytes(blk, blk, iv)
+		} else {
+			subtle.XORBytes(blk, blk, out[i-bs:i])
+		}
+	}
+	return out[:l], nil
+}
+
+var bufPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 2048)
+		return &b
+	},
+}
+
+// GetBuffer returns a buffer of length n from a pool of buffers.
+// The buffer should be returned to the pool with PutBuffer once it is no longer referenced.
+func GetBuffer(n int) *[]byte {
+	bp := bufPool.Get().(*[]byte)
+	if cap(*bp) < n {
+		*bp = make([]byte, n)
+	}
+	*bp = (*bp)[:n]
+	return bp
+}
+
+// PutBuffer clears the buffer and returns it to the pool.
+func PutBuffer(bp *[]byte) {
+	clear(*bp)
+	bufPool.Put(bp)
+}
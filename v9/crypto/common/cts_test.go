@@ -0,0 +1,113 @@
+package common
+
+import (
+	"crypto/aes"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCTS(t *testing.T) {
+	t.Parallel()
+	// Test vectors from RFC 3962 Appendix B
+	key, _ := hex.DecodeString("636869636b656e207465726979616b69")
+	var tests = []struct {
+		plain  string
+		cipher string
+		nextIV string
+	}{
+		{"4920776f756c64206c696b652074686520", "c6353568f2bf8cb4d8a580362da7ff7f97", "c6353568f2bf8cb4d8a580362da7ff7f"},
+		{"4920776f756c64206c696b65207468652047656e6572616c20476175277320", "fc00783e0efdb2c1d445d4c8eff7ed2297687268d6ecccc0c07b25e25ecfe5", "fc00783e0efdb2c1d445d4c8eff7ed22"},
+		{"4920776f756c64206c696b65207468652047656e6572616c2047617527732043", "39312523a78662d5be7fcbcc98ebf5a897687268d6ecccc0c07b25e25ecfe584", "39312523a78662d5be7fcbcc98ebf5a8"},
+		{"4920776f756c64206c696b65207468652047656e6572616c20476175277320436869636b656e2c20706c656173652c", "97687268d6ecccc0c07b25e25ecfe584b3fffd940c16a18c1b5549d2f838029e39312523a78662d5be7fcbcc98ebf5", "b3fffd940c16a18c1b5549d2f838029e"},
+		{"4920776f756c64206c696b65207468652047656e6572616c20476175277320436869636b656e2c20706c656173652c20", "97687268d6ecccc0c07b25e25ecfe5849dad8bbb96c4cdc03bc103e1a194bbd839312523a78662d5be7fcbcc98ebf5a8", "9dad8bbb96c4cdc03bc103e1a194bbd8"},
+		{"4920776f756c64206c696b65207468652047656e6572616c20476175277320436869636b656e2c20706c656173652c20616e6420776f6e746f6e20736f75702e", "97687268d6ecccc0c07b25e25ecfe58439312523a78662d5be7fcbcc98ebf5a84807efe836ee89a526730dbc2f7bc8409dad8bbb96c4cdc03bc103e1a194bbd8", "4807efe836ee89a526730dbc2f7bc840"},
+	}
+	b, err := AESBlock(key)
+	if err != nil {
+		t.Fatalf("error creating cipher: %v", err)
+	}
+	ivz := make([]byte, aes.BlockSize)
+	for i, test := range tests {
+		p, _ := hex.DecodeString(test.plain)
+		iv, c := CTSEncrypt(b, ivz, p)
+		assert.Equal(t, test.cipher, hex.EncodeToString(c), "Encrypted result not as expected for test %d", i)
+		assert.Equal(t, test.nextIV, hex.EncodeToString(iv), "Next IV not as expected for test %d", i)
+		d, err := CTSDecrypt(b, ivz, c)
+		if err != nil {
+			t.Fatalf("error decrypting test %d: %v", i, err)
+		}
+		assert.Equal(t, test.plain, hex.EncodeToString(d), "Decrypted result not as expected for test %d", i)
+	}
+}
+
+func TestCachedDeriveKey(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	usage := GetUsageKe(2)
+	var calls int
+	derive := func() ([]byte, error) {
+		calls++
+		return []byte("derived"), nil
+	}
+	// Keys are not cached unless the cache is enabled
+	for i := 0; i < 2; i++ {
+		CachedDeriveKey(-1001, key, usage, derive)
+	}
+	assert.Equal(t, 2, calls, "derived key should not be cached by default")
+	calls = 0
+	EnableKeyCache(DefaultKeyCacheSize, DefaultKeyCacheLifetime)
+	defer DisableKeyCache()
+
+	// An etype ID not otherwise in use so the test does not interfere with cached keys of other tests
+	for i := 0; i < 3; i++ {
+		k, err := CachedDeriveKey(-1001, key, usage, derive)
+		if err != nil {
+			t.Fatalf("error deriving key: %v", err)
+		}
+		assert.Equal(t, []byte("derived"), k)
+	}
+	assert.Equal(t, 1, calls, "derived key should have been cached")
+
+	// Constants other than key usages are not cached
+	for i := 0; i < 2; i++ {
+		CachedDeriveKey(-1001, key, []byte("kerberos"), derive)
+	}
+	assert.Equal(t, 3, calls, "derived key should not have been cached")
+}
+
+func TestKeyCache(t *testing.T) {
+	t.Parallel()
+	c := newKeyCache[int](2, time.Hour)
+	k1, _ := newCacheKey(1, []byte("key1"), nil)
+	k2, _ := newCacheKey(1, []byte("key2"), nil)
+	k3, _ := newCacheKey(1, []byte("key3"), nil)
+	k, _ := newCacheKey(2, []byte("key1"), nil)
+	assert.NotEqual(t, k1, k, "cache keys of other etypes should differ")
+
+	c.put(k1, 1)
+	c.put(k2, 2)
+	c.m[k1] = cacheEntry[int]{v: 1, expires: time.Now().Add(time.Minute)}
+	c.put(k3, 3)
+	assert.Len(t, c.m, 2, "cache should be bounded")
+	_, ok := c.get(k1)
+	assert.False(t, ok, "entry closest to expiry should have been evicted")
+	v, ok := c.get(k3)
+	assert.True(t, ok)
+	assert.Equal(t, 3, v)
+
+	// Expired entries are not returned
+	c.m[k2] = cacheEntry[int]{v: 2, expires: time.Now().Add(-time.Second)}
+	_, ok = c.get(k2)
+	assert.False(t, ok, "expired entry should not be returned")
+	c.put(k1, 1)
+	assert.Len(t, c.m, 2, "expired entry should have been removed")
+	_, ok = c.get(k3)
+	assert.True(t, ok, "unexpired entry should be kept")
+
+	c.set(0, time.Hour)
+	c.put(k1, 1)
+	assert.False(t, c.enabled())
+	assert.Empty(t, c.m, "disabled cache should not hold entries")
+}
@@ -6,83 +6,29 @@ import (
 	"fmt"
 
 	"github.com/oiweiwei/gokrb5.fork/v9/crypto/etype"
-	"github.com/oiweiwei/gokrb5.fork/v9/iana/chksumtype"
-	"github.com/oiweiwei/gokrb5.fork/v9/iana/etypeID"
 	"github.com/oiweiwei/gokrb5.fork/v9/iana/patype"
 	"github.com/oiweiwei/gokrb5.fork/v9/types"
 )
 
-// GetEtype returns an instances of the required etype struct for the etype ID.
+// GetEtype returns an instances of the required etype struct for the etype ID from the default registry.
 func GetEtype(id int32) (etype.EType, error) {
-	switch id {
-	case etypeID.AES128_CTS_HMAC_SHA1_96:
-		var et Aes128CtsHmacSha96
-		return et, nil
-	case etypeID.AES256_CTS_HMAC_SHA1_96:
-		var et Aes256CtsHmacSha96
-		return et, nil
-	case etypeID.AES128_CTS_HMAC_SHA256_128:
-		var et Aes128CtsHmacSha256128
-		return et, nil
-	case etypeID.AES256_CTS_HMAC_SHA384_192:
-		var et Aes256CtsHmacSha384192
-		return et, nil
-	case etypeID.DES3_CBC_SHA1_KD:
-		var et Des3CbcSha1Kd
-		return et, nil
-	case etypeID.RC4_HMAC:
-		var et RC4HMAC
-		return et, nil
-	case etypeID.DES_CBC_MD5:
-		var et DesCbcMd5
-		return et, nil
-	case etypeID.DES_CBC_CRC:
-		var et DesCbcCrc
-		return et, nil
-	default:
-		return nil, fmt.Errorf("unknown or unsupported EType: %d", id)
-	}
+	return defaultRegistry.GetEtype(id)
 }
 
-// GetChksumEtype returns an instances of the required etype struct for the checksum ID.
+// GetChksumEtype returns an instances of the required etype struct for the checksum ID from the default registry.
 func GetChksumEtype(id int32) (etype.EType, error) {
-	switch id {
-	case chksumtype.HMAC_SHA1_96_AES128:
-		var et Aes128CtsHmacSha96
-		return et, nil
-	case chksumtype.HMAC_SHA1_96_AES256:
-		var et Aes256CtsHmacSha96
-		return et, nil
-	case chksumtype.HMAC_SHA256_128_AES128:
-		var et Aes128CtsHmacSha256128
-		return et, nil
-	case chksumtype.HMAC_SHA384_192_AES256:
-		var et Aes256CtsHmacSha384192
-		return et, nil
-	case chksumtype.HMAC_SHA1_DES3_KD:
-		var et Des3CbcSha1Kd
-		return et, nil
-	case chksumtype.KERB_CHECKSUM_HMAC_MD5:
-		var et RC4HMAC
-		return et, nil
-	case chksumtype.RSA_MD5_DES:
-		var et DesCbcMd5
-		return et, nil
-	case chksumtype.CRC32:
-		var et DesCbcCrc
-		return et, nil
-	//case chksumtype.KERB_CHECKSUM_HMAC_MD5_UNSIGNED:
-	//	var et RC4HMAC
-	//	return et, nil
-	default:
-		return nil, fmt.Errorf("unknown or unsupported checksum type: %d", id)
-	}
+	return defaultRegistry.GetChksumEtype(id)
 }
 
-// GetKeyFromPassword generates an encryption key from the principal's password.
+// GetKeyFromPassword generates an encryption key from the principal's password using the default registry.
 func GetKeyFromPassword(passwd string, cname types.PrincipalName, realm string, etypeID int32, pas types.PADataSequence) (types.EncryptionKey, etype.EType, error) {
+	return defaultRegistry.GetKeyFromPassword(passwd, cname, realm, etypeID, pas)
+}
+
+// GetKeyFromPassword generates an encryption key from the principal's password.
+func (r *Registry) GetKeyFromPassword(passwd string, cname types.PrincipalName, realm string, etypeID int32, pas types.PADataSequence) (types.EncryptionKey, etype.EType, error) {
 	var key types.EncryptionKey
-	et, err := GetEtype(etypeID)
+	et, err := r.GetEtype(etypeID)
 	if err != nil {
 		return key, et, fmt.Errorf("error getting encryption type: %v", err)
 	}
@@ -106,7 +52,7 @@ func GetKeyFromPassword(passwd string, cname types.PrincipalName, realm string,
 				return key, et, fmt.Errorf("error unmashaling PA Data to PA-ETYPE-INFO2: %v", err)
 			}
 			if etypeID != eti[0].EType {
-				et, err = GetEtype(eti[0].EType)
+				et, err = r.GetEtype(eti[0].EType)
 				if err != nil {
 					return key, et, fmt.Errorf("error getting encryption type: %v", err)
 				}
@@ -122,7 +68,7 @@ func GetKeyFromPassword(passwd string, cname types.PrincipalName, realm string,
 				return key, et, fmt.Errorf("error unmashalling PA Data to PA-ETYPE-INFO2: %v", err)
 			}
 			if etypeID != et2[0].EType {
-				et, err = GetEtype(et2[0].EType)
+				et, err = r.GetEtype(et2[0].EType)
 				if err != nil {
 					return key, et, fmt.Errorf("error getting encryption type: %v", err)
 				}
@@ -147,41 +93,34 @@ func GetKeyFromPassword(passwd string, cname types.PrincipalName, realm string,
 	return key, et, nil
 }
 
-// GetEncryptedData encrypts the data provided and returns and EncryptedData type.
+// GetEncryptedData encrypts the data provided and returns and EncryptedData type using the default registry.
 // Pass a usage value of zero to use the key provided directly rather than deriving one.
 func GetEncryptedData(plainBytes []byte, key types.EncryptionKey, usage uint32, kvno int) (types.EncryptedData, error) {
-	var ed types.EncryptedData
-	et, err := GetEtype(key.KeyType)
-	if err != nil {
-		return ed, fmt.Errorf("error getting etype: %v", err)
-	}
-	_, b, err := et.EncryptMessage(key.KeyValue, plainBytes, usage)
-	if err != nil {
-		return ed, err
-	}
+	return defaultRegistry.GetEncryptedData(plainBytes, key, usage, kvno)
+}
 
-	ed = types.EncryptedData{
-		EType:  key.KeyType,
-		Cipher: b,
-		KVNO:   kvno,
-	}
-	return ed, nil
+// DecryptEncPart decrypts the EncryptedData using the default registry.
+func DecryptEncPart(ed types.EncryptedData, key types.EncryptionKey, usage uint32) ([]byte, error) {
+	return defaultRegistry.DecryptEncPart(ed, key, usage)
+}
+
+// DecryptMessage decrypts the ciphertext and verifies the integrity using the default registry.
+func DecryptMessage(ciphertext []byte, key types.EncryptionKey, usage uint32) ([]byte, error) {
+	return defaultRegistry.DecryptMessage(ciphertext, key, usage)
+}
+
+// GetEncryptedData encrypts the data provided and returns and EncryptedData type.
+// Pass a usage value of zero to use the key provided directly rather than deriving one.
+func (r *Registry) GetEncryptedData(plainBytes []byte, key types.EncryptionKey, usage uint32, kvno int) (types.EncryptedData, error) {
+	return GetEncryptedDataWithKey(plainBytes, r.NewKey(key), usage, kvno)
 }
 
 // DecryptEncPart decrypts the EncryptedData.
-func DecryptEncPart(ed types.EncryptedData, key types.EncryptionKey, usage uint32) ([]byte, error) {
-	return DecryptMessage(ed.Cipher, key, usage)
+func (r *Registry) DecryptEncPart(ed types.EncryptedData, key types.EncryptionKey, usage uint32) ([]byte, error) {
+	return r.DecryptMessage(ed.Cipher, key, usage)
 }
 
 // DecryptMessage decrypts the ciphertext and verifies the integrity.
-func DecryptMessage(ciphertext []byte, key types.EncryptionKey, usage uint32) ([]byte, error) {
-	et, err := GetEtype(key.KeyType)
-	if err != nil {
-		return []byte{}, fmt.Errorf("error decrypting: %v", err)
-	}
-	b, err := et.DecryptMessage(key.KeyValue, ciphertext, usage)
-	if err != nil {
-		return nil, fmt.Errorf("error decrypting: %v", err)
-	}
-	return b, nil
+func (r *Registry) DecryptMessage(ciphertext []byte, key types.EncryptionKey, usage uint32) ([]byte, error) {
+	return DecryptMessageWithKey(ciphertext, r.NewKey(key), usage)
 }
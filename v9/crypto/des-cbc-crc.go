@@ -94,6 +94,11 @@ func (e DesCbcCrc) DeriveKey(protocolKey, usage []byte) ([]byte, error) {
 	return r, nil
 }
 
+// PRF returns the output of the etype's pseudo-random function for the protocol key and input.
+func (e DesCbcCrc) PRF(protocolKey, b []byte) ([]byte, error) {
+	return rfc3961.DESPseudoRandom(protocolKey, b, e)
+}
+
 // EncryptData encrypts the data provided.
 func (e DesCbcCrc) EncryptData(key, data []byte) ([]byte, []byte, error) {
 	iv := make([]byte, des.BlockSize)
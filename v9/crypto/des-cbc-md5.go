@@ -95,6 +95,11 @@ func (e DesCbcMd5) DeriveKey(protocolKey, usage []byte) ([]byte, error) {
 	return r, nil
 }
 
+// PRF returns the output of the etype's pseudo-random function for the protocol key and input.
+func (e DesCbcMd5) PRF(protocolKey, b []byte) ([]byte, error) {
+	return rfc3961.DESPseudoRandom(protocolKey, b, e)
+}
+
 // EncryptData encrypts the data provided.
 func (e DesCbcMd5) EncryptData(key, data []byte) ([]byte, []byte, error) {
 	ivz := make([]byte, des.BlockSize)
@@ -99,6 +99,11 @@ func (e Des3CbcSha1Kd) DeriveKey(protocolKey, usage []byte) ([]byte, error) {
 	return e.RandomToKey(r), nil
 }
 
+// PRF returns the output of the etype's pseudo-random function for the protocol key and input.
+func (e Des3CbcSha1Kd) PRF(protocolKey, b []byte) ([]byte, error) {
+	return rfc3961.PseudoRandom(protocolKey, b, e)
+}
+
 // EncryptData encrypts the data provided.
 func (e Des3CbcSha1Kd) EncryptData(key, data []byte) ([]byte, []byte, error) {
 	return rfc3961.DES3EncryptData(key, data, e)
@@ -0,0 +1,171 @@
+package crypto
+
+import (
+	"fmt"
+
+	"github.com/oiweiwei/gokrb5.fork/v9/types"
+)
+
+// Key is an opaque encryption key. The cryptographic operations using the key are delegated to the implementation
+// rather than performed on the key material. The only implementation provided is the in process one returned by
+// NewKey; an implementation keeping the key material out of the process must be supplied by the caller.
+type Key interface {
+	// KeyType returns the encryption type ID of the key.
+	KeyType() int32
+	// EncryptMessage encrypts the message and appends the integrity hash as for etype.EType.EncryptMessage.
+	EncryptMessage(message []byte, usage uint32) ([]byte, error)
+	// DecryptMessage decrypts the ciphertext and verifies its integrity as for etype.EType.DecryptMessage.
+	DecryptMessage(ciphertext []byte, usage uint32) ([]byte, error)
+	// DeriveKey derives a new key from this key and the usage constant as for etype.EType.DeriveKey.
+	DeriveKey(usage []byte) (Key, error)
+	// GetChecksum returns a keyed checksum of the data using the checksum type ID provided.
+	GetChecksum(cksumType int32, data []byte, usage uint32) ([]byte, error)
+	// VerifyChecksum verifies the keyed checksum of the data using the checksum type ID provided.
+	VerifyChecksum(cksumType int32, data, chksum []byte, usage uint32) bool
+}
+
+// softKey is a Key that performs the cryptographic operations in process using the key material of an EncryptionKey.
+type softKey struct {
+	key types.EncryptionKey
+	r   *Registry
+}
+
+// NewKey returns a Key that performs the cryptographic operations in process with the encryption key provided using
+// the encryption and checksum types of the default registry.
+func NewKey(key types.EncryptionKey) Key {
+	return defaultRegistry.NewKey(key)
+}
+
+// NewKey returns a Key that performs the cryptographic operations in process with the encryption key provided using
+// the encryption and checksum types of the registry.
+func (r *Registry) NewKey(key types.EncryptionKey) Key {
+	return softKey{key: key, r: r}
+}
+
+// KeyRegistry returns the registry of the encryption and checksum types used with the key. This is the registry the
+// key was created with by Registry.NewKey, or that returned by the key's Registry method if it has one, otherwise
+// the default registry.
+func KeyRegistry(key Key) *Registry {
+	if rk, ok := key.(interface{ Registry() *Registry }); ok {
+		if r := rk.Registry(); r != nil {
+			return r
+		}
+	}
+	return defaultRegistry
+}
+
+// Registry returns the registry of the encryption and checksum types used with the key.
+func (k softKey) Registry() *Registry {
+	return k.r
+}
+
+// KeyType returns the encryption type ID of the key.
+func (k softKey) KeyType() int32 {
+	return k.key.KeyType
+}
+
+// EncryptMessage encrypts the message and appends the integrity hash.
+func (k softKey) EncryptMessage(message []byte, usage uint32) ([]byte, error) {
+	et, err := k.r.GetEtype(k.key.KeyType)
+	if err != nil {
+		return nil, err
+	}
+	_, b, err := et.EncryptMessage(k.key.KeyValue, message, usage)
+	return b, err
+}
+
+// DecryptMessage decrypts the ciphertext and verifies its integrity.
+func (k softKey) DecryptMessage(ciphertext []byte, usage uint32) ([]byte, error) {
+	et, err := k.r.GetEtype(k.key.KeyType)
+	if err != nil {
+		return nil, err
+	}
+	return et.DecryptMessage(k.key.KeyValue, ciphertext, usage)
+}
+
+// DeriveKey derives a new key from this key and the usage constant.
+func (k softKey) DeriveKey(usage []byte) (Key, error) {
+	et, err := k.r.GetEtype(k.key.KeyType)
+	if err != nil {
+		return nil, err
+	}
+	b, err := et.DeriveKey(k.key.KeyValue, usage)
+	if err != nil {
+		return nil, err
+	}
+	return softKey{key: types.EncryptionKey{KeyType: k.key.KeyType, KeyValue: b}, r: k.r}, nil
+}
+
+// GetChecksum returns a keyed checksum of the data using the checksum type ID provided.
+func (k softKey) GetChecksum(cksumType int32, data []byte, usage uint32) ([]byte, error) {
+	ct, err := k.r.GetChksumType(cksumType)
+	if err != nil {
+		return nil, err
+	}
+	return ct.GetChecksum(k.key.KeyValue, data, usage)
+}
+
+// VerifyChecksum verifies the keyed checksum of the data using the checksum type ID provided.
+func (k softKey) VerifyChecksum(cksumType int32, data, chksum []byte, usage uint32) bool {
+	ct, err := k.r.GetChksumType(cksumType)
+	if err != nil {
+		return false
+	}
+	return ct.VerifyChecksum(k.key.KeyValue, data, chksum, usage)
+}
+
+// GetEncryptedDataWithKey encrypts the data provided with the opaque key and returns and EncryptedData type.
+func GetEncryptedDataWithKey(plainBytes []byte, key Key, usage uint32, kvno int) (types.EncryptedData, error) {
+	var ed types.EncryptedData
+	b, err := key.EncryptMessage(plainBytes, usage)
+	if err != nil {
+		return ed, err
+	}
+	ed = types.EncryptedData{
+		EType:  key.KeyType(),
+		Cipher: b,
+		KVNO:   kvno,
+	}
+	return ed, nil
+}
+
+// DecryptEncPartWithKey decrypts the EncryptedData with the opaque key.
+func DecryptEncPartWithKey(ed types.EncryptedData, key Key, usage uint32) ([]byte, error) {
+	return DecryptMessageWithKey(ed.Cipher, key, usage)
+}
+
+// DecryptMessageWithKey decrypts the ciphertext with the opaque key and verifies the integrity.
+func DecryptMessageWithKey(ciphertext []byte, key Key, usage uint32) ([]byte, error) {
+	b, err := key.DecryptMessage(ciphertext, usage)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting: %v", err)
+	}
+	return b, nil
+}
+
+// GetChecksumWithKey calculates the checksum of the data with the opaque key using the checksum type ID provided.
+func GetChecksumWithKey(data []byte, key Key, usage uint32, id int32) (types.Checksum, error) {
+	var c types.Checksum
+	b, err := key.GetChecksum(id, data, usage)
+	if err != nil {
+		return c, fmt.Errorf("error calculating checksum: %v", err)
+	}
+	c = types.Checksum{
+		CksumType: id,
+		Checksum:  b,
+	}
+	return c, nil
+}
+
+// VerifyChecksumWithKey verifies the checksum of the data with the opaque key using the checksum type of the
+// checksum provided from the key's registry. If keyed is true unkeyed checksum types are rejected.
+func VerifyChecksumWithKey(c types.Checksum, data []byte, key Key, usage uint32, keyed bool) (bool, error) {
+	ct, err := KeyRegistry(key).GetChksumType(c.CksumType)
+	if err != nil {
+		return false, err
+	}
+	if keyed && !ct.IsKeyed() {
+		return false, fmt.Errorf("checksum type %d is not a keyed checksum", c.CksumType)
+	}
+	return key.VerifyChecksum(c.CksumType, data, c.Checksum, usage), nil
+}
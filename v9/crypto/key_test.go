@@ -0,0 +1,136 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/chksumtype"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/etypeID"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/keyusage"
+	"github.com/oiweiwei/gokrb5.fork/v9/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// testDevice stands in for a key store outside the process. Keys are referenced by handle and the key material is never returned.
+type testDevice struct {
+	keys map[string]types.EncryptionKey
+	ops  int
+}
+
+type testDeviceKey struct {
+	d      *testDevice
+	handle string
+}
+
+func (k testDeviceKey) KeyType() int32 {
+	return k.d.keys[k.handle].KeyType
+}
+
+func (k testDeviceKey) EncryptMessage(message []byte, usage uint32) ([]byte, error) {
+	k.d.ops++
+	return NewKey(k.d.keys[k.handle]).EncryptMessage(message, usage)
+}
+
+func (k testDeviceKey) DecryptMessage(ciphertext []byte, usage uint32) ([]byte, error) {
+	k.d.ops++
+	return NewKey(k.d.keys[k.handle]).DecryptMessage(ciphertext, usage)
+}
+
+func (k testDeviceKey) DeriveKey(usage []byte) (Key, error) {
+	k.d.ops++
+	return NewKey(k.d.keys[k.handle]).DeriveKey(usage)
+}
+
+func (k testDeviceKey) GetChecksum(cksumType int32, data []byte, usage uint32) ([]byte, error) {
+	k.d.ops++
+	return NewKey(k.d.keys[k.handle]).GetChecksum(cksumType, data, usage)
+}
+
+func (k testDeviceKey) VerifyChecksum(cksumType int32, data, chksum []byte, usage uint32) bool {
+	k.d.ops++
+	return NewKey(k.d.keys[k.handle]).VerifyChecksum(cksumType, data, chksum, usage)
+}
+
+func testKey(t *testing.T) types.EncryptionKey {
+	b, err := hex.DecodeString("fe697b52bc0d3ce14432ba036a92e65bbb52280990a2fa27883998d72af30161")
+	if err != nil {
+		t.Fatalf("error decoding key: %v", err)
+	}
+	return types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: b}
+}
+
+func TestKey_DelegatedOperations(t *testing.T) {
+	t.Parallel()
+	raw := testKey(t)
+	d := &testDevice{keys: map[string]types.EncryptionKey{"svc": raw}}
+	var k Key = testDeviceKey{d: d, handle: "svc"}
+	msg := []byte("message protected by a key held in a device")
+
+	ed, err := GetEncryptedDataWithKey(msg, k, keyusage.KDC_REP_TICKET, 3)
+	if err != nil {
+		t.Fatalf("error encrypting: %v", err)
+	}
+	assert.Equal(t, raw.KeyType, ed.EType)
+	assert.Equal(t, 3, ed.KVNO)
+	b, err := DecryptEncPart(ed, raw, keyusage.KDC_REP_TICKET)
+	if err != nil {
+		t.Fatalf("error decrypting with raw key: %v", err)
+	}
+	assert.Equal(t, msg, b)
+
+	ed, err = GetEncryptedData(msg, raw, keyusage.KDC_REP_TICKET, 3)
+	if err != nil {
+		t.Fatalf("error encrypting with raw key: %v", err)
+	}
+	b, err = DecryptEncPartWithKey(ed, k, keyusage.KDC_REP_TICKET)
+	if err != nil {
+		t.Fatalf("error decrypting: %v", err)
+	}
+	assert.Equal(t, msg, b)
+	_, err = DecryptEncPartWithKey(ed, k, keyusage.AP_REQ_AUTHENTICATOR)
+	assert.Error(t, err, "decryption with the wrong usage should fail")
+
+	c, err := GetChecksumWithKey(msg, k, keyusage.KERB_NON_KERB_CKSUM_SALT, chksumtype.HMAC_SHA1_96_AES256)
+	if err != nil {
+		t.Fatalf("error getting checksum: %v", err)
+	}
+	rc, err := GetChecksum(msg, raw, keyusage.KERB_NON_KERB_CKSUM_SALT, chksumtype.HMAC_SHA1_96_AES256)
+	if err != nil {
+		t.Fatalf("error getting checksum with raw key: %v", err)
+	}
+	assert.Equal(t, rc, c)
+	ok, err := VerifyChecksumWithKey(c, msg, k, keyusage.KERB_NON_KERB_CKSUM_SALT, true)
+	if err != nil {
+		t.Fatalf("error verifying checksum: %v", err)
+	}
+	assert.True(t, ok)
+	_, err = VerifyChecksumWithKey(types.Checksum{CksumType: chksumtype.CRC32}, msg, k, 0, true)
+	assert.Error(t, err, "unkeyed checksum should be rejected")
+
+	assert.Equal(t, 5, d.ops, "operations should have been delegated to the device")
+}
+
+func TestKey_DeriveKey(t *testing.T) {
+	t.Parallel()
+	raw := testKey(t)
+	et, _ := GetEtype(raw.KeyType)
+	usage := []byte{0, 0, 0, 2, 0x99}
+	dk, err := NewKey(raw).DeriveKey(usage)
+	if err != nil {
+		t.Fatalf("error deriving key: %v", err)
+	}
+	b, err := et.DeriveKey(raw.KeyValue, usage)
+	if err != nil {
+		t.Fatalf("error deriving key: %v", err)
+	}
+	assert.Equal(t, raw.KeyType, dk.KeyType())
+	ed, err := GetEncryptedDataWithKey([]byte("data"), dk, keyusage.KRB_PRIV_ENCPART, 0)
+	if err != nil {
+		t.Fatalf("error encrypting with derived key: %v", err)
+	}
+	pt, err := et.DecryptMessage(b, ed.Cipher, keyusage.KRB_PRIV_ENCPART)
+	if err != nil {
+		t.Fatalf("error decrypting with derived key: %v", err)
+	}
+	assert.Equal(t, []byte("data"), pt)
+}
@@ -0,0 +1,237 @@
+package crypto
+
+import (
+	"crypto/des"
+	"crypto/md5"
+	"crypto/rand"
+	"fmt"
+
+	"github.com/oiweiwei/gokrb5.fork/v9/crypto/rfc3961"
+	"github.com/oiweiwei/gokrb5.fork/v9/crypto/rfc4757"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/chksumtype"
+	"golang.org/x/crypto/md4"
+)
+
+// RFC 3961 Section 6.1 and RFC 4757 Section 4
+
+// Crc32 implements the unkeyed Kerberos checksum type crc32.
+type Crc32 struct{}
+
+// GetChksumTypeID returns the checksum type ID number.
+func (c Crc32) GetChksumTypeID() int32 {
+	return chksumtype.CRC32
+}
+
+// GetChecksumByteSize returns the byte size of the checksum.
+func (c Crc32) GetChecksumByteSize() int {
+	return 4
+}
+
+// IsKeyed returns false as the checksum is unkeyed.
+func (c Crc32) IsKeyed() bool {
+	return false
+}
+
+// GetChecksum returns the checksum of the data provided. The key and usage are ignored.
+func (c Crc32) GetChecksum(key, data []byte, usage uint32) ([]byte, error) {
+	h := rfc3961.NewCRC32()
+	h.Write(data)
+	return h.Sum(nil), nil
+}
+
+// VerifyChecksum compares the checksum of the data is the same as the checksum provided.
+func (c Crc32) VerifyChecksum(key, data, chksum []byte, usage uint32) bool {
+	return verifyUnkeyed(c, data, chksum)
+}
+
+// RsaMd4 implements the unkeyed Kerberos checksum type rsa-md4.
+type RsaMd4 struct{}
+
+// GetChksumTypeID returns the checksum type ID number.
+func (c RsaMd4) GetChksumTypeID() int32 {
+	return chksumtype.RSA_MD4
+}
+
+// GetChecksumByteSize returns the byte size of the checksum.
+func (c RsaMd4) GetChecksumByteSize() int {
+	return md4.Size
+}
+
+// IsKeyed returns false as the checksum is unkeyed.
+func (c RsaMd4) IsKeyed() bool {
+	return false
+}
+
+// GetChecksum returns the checksum of the data provided. The key and usage are ignored.
+func (c RsaMd4) GetChecksum(key, data []byte, usage uint32) ([]byte, error) {
+	h := md4.New()
+	h.Write(data)
+	return h.Sum(nil), nil
+}
+
+// VerifyChecksum compares the checksum of the data is the same as the checksum provided.
+func (c RsaMd4) VerifyChecksum(key, data, chksum []byte, usage uint32) bool {
+	return verifyUnkeyed(c, data, chksum)
+}
+
+// RsaMd5 implements the unkeyed Kerberos checksum type rsa-md5.
+type RsaMd5 struct{}
+
+// GetChksumTypeID returns the checksum type ID number.
+func (c RsaMd5) GetChksumTypeID() int32 {
+	return chksumtype.RSA_MD5
+}
+
+// GetChecksumByteSize returns the byte size of the checksum.
+func (c RsaMd5) GetChecksumByteSize() int {
+	return md5.Size
+}
+
+// IsKeyed returns false as the checksum is unkeyed.
+func (c RsaMd5) IsKeyed() bool {
+	return false
+}
+
+// GetChecksum returns the checksum of the data provided. The key and usage are ignored.
+func (c RsaMd5) GetChecksum(key, data []byte, usage uint32) ([]byte, error) {
+	h := md5.Sum(data)
+	return h[:], nil
+}
+
+// VerifyChecksum compares the checksum of the data is the same as the checksum provided.
+func (c RsaMd5) VerifyChecksum(key, data, chksum []byte, usage uint32) bool {
+	return verifyUnkeyed(c, data, chksum)
+}
+
+// RsaMd4Des implements the keyed Kerberos checksum type rsa-md4-des, which requires a DES key.
+type RsaMd4Des struct{}
+
+// GetChksumTypeID returns the checksum type ID number.
+func (c RsaMd4Des) GetChksumTypeID() int32 {
+	return chksumtype.RSA_MD4_DES
+}
+
+// GetChecksumByteSize returns the byte size of the checksum.
+func (c RsaMd4Des) GetChecksumByteSize() int {
+	return des.BlockSize + md4.Size
+}
+
+// IsKeyed returns true as the checksum is keyed.
+func (c RsaMd4Des) IsKeyed() bool {
+	return true
+}
+
+// GetChecksum returns a keyed checksum of the data provided. The usage is ignored.
+func (c RsaMd4Des) GetChecksum(key, data []byte, usage uint32) ([]byte, error) {
+	conf, err := desConfounder()
+	if err != nil {
+		return nil, err
+	}
+	return rfc3961.DESConfounderChecksum(key, conf, data, md4.New)
+}
+
+// VerifyChecksum compares the checksum of the data is the same as the checksum provided.
+func (c RsaMd4Des) VerifyChecksum(key, data, chksum []byte, usage uint32) bool {
+	return rfc3961.VerifyDESConfounderChecksum(key, data, chksum, md4.New)
+}
+
+// RsaMd5Des implements the keyed Kerberos checksum type rsa-md5-des, which requires a DES key.
+type RsaMd5Des struct{}
+
+// GetChksumTypeID returns the checksum type ID number.
+func (c RsaMd5Des) GetChksumTypeID() int32 {
+	return chksumtype.RSA_MD5_DES
+}
+
+// GetChecksumByteSize returns the byte size of the checksum.
+func (c RsaMd5Des) GetChecksumByteSize() int {
+	return des.BlockSize + md5.Size
+}
+
+// IsKeyed returns true as the checksum is keyed.
+func (c RsaMd5Des) IsKeyed() bool {
+	return true
+}
+
+// GetChecksum returns a keyed checksum of the data provided. The usage is ignored.
+func (c RsaMd5Des) GetChecksum(key, data []byte, usage uint32) ([]byte, error) {
+	conf, err := desConfounder()
+	if err != nil {
+		return nil, err
+	}
+	return rfc3961.DESConfounderChecksum(key, conf, data, md5.New)
+}
+
+// VerifyChecksum compares the checksum of the data is the same as the checksum provided.
+func (c RsaMd5Des) VerifyChecksum(key, data, chksum []byte, usage uint32) bool {
+	return rfc3961.VerifyDESConfounderChecksum(key, data, chksum, md5.New)
+}
+
+// DesMac implements the keyed Kerberos checksum type des-mac, which requires a DES key.
+type DesMac struct{}
+
+// GetChksumTypeID returns the checksum type ID number.
+func (c DesMac) GetChksumTypeID() int32 {
+	return chksumtype.DES_MAC
+}
+
+// GetChecksumByteSize returns the byte size of the checksum.
+func (c DesMac) GetChecksumByteSize() int {
+	return 2 * des.BlockSize
+}
+
+// IsKeyed returns true as the checksum is keyed.
+func (c DesMac) IsKeyed() bool {
+	return true
+}
+
+// GetChecksum returns a keyed checksum of the data provided. The usage is ignored.
+func (c DesMac) GetChecksum(key, data []byte, usage uint32) ([]byte, error) {
+	conf, err := desConfounder()
+	if err != nil {
+		return nil, err
+	}
+	return rfc3961.DESMAC(key, conf, data)
+}
+
+// VerifyChecksum compares the checksum of the data is the same as the checksum provided.
+func (c DesMac) VerifyChecksum(key, data, chksum []byte, usage uint32) bool {
+	return rfc3961.VerifyDESMAC(key, data, chksum)
+}
+
+// HmacMd5 implements the keyed checksum type KERB_CHECKSUM_HMAC_MD5 (-138) used with RC4 keys as defined in RFC 4757.
+type HmacMd5 struct{}
+
+// GetChksumTypeID returns the checksum type ID number.
+func (c HmacMd5) GetChksumTypeID() int32 {
+	return chksumtype.KERB_CHECKSUM_HMAC_MD5
+}
+
+// GetChecksumByteSize returns the byte size of the checksum.
+func (c HmacMd5) GetChecksumByteSize() int {
+	return md5.Size
+}
+
+// IsKeyed returns true as the checksum is keyed.
+func (c HmacMd5) IsKeyed() bool {
+	return true
+}
+
+// GetChecksum returns a keyed checksum of the data provided.
+func (c HmacMd5) GetChecksum(key, data []byte, usage uint32) ([]byte, error) {
+	return rfc4757.Checksum(key, usage, data)
+}
+
+// VerifyChecksum compares the checksum of the data is the same as the checksum provided.
+func (c HmacMd5) VerifyChecksum(key, data, chksum []byte, usage uint32) bool {
+	return RC4HMAC{}.VerifyChecksum(key, data, chksum, usage)
+}
+
+func desConfounder() ([]byte, error) {
+	conf := make([]byte, des.BlockSize)
+	_, err := rand.Read(conf)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate random confounder: %v", err)
+	}
+	return conf, nil
+}
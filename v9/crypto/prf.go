@@ -0,0 +1,99 @@
+package crypto
+
+import (
+	"crypto/subtle"
+	"errors"
+
+	"github.com/oiweiwei/gokrb5.fork/v9/crypto/etype"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/etypeID"
+	"github.com/oiweiwei/gokrb5.fork/v9/types"
+)
+
+// PseudoRandom returns the output of the etype's pseudo-random function (RFC 3961 section 3) for the key and input
+// using the etypes of the default registry.
+func PseudoRandom(key types.EncryptionKey, b []byte) ([]byte, error) {
+	return defaultRegistry.PseudoRandom(key, b)
+}
+
+// PseudoRandom returns the output of the etype's pseudo-random function (RFC 3961 section 3) for the key and input.
+func (r *Registry) PseudoRandom(key types.EncryptionKey, b []byte) ([]byte, error) {
+	et, err := r.GetEtype(key.KeyType)
+	if err != nil {
+		return nil, err
+	}
+	return et.PRF(key.KeyValue, b)
+}
+
+// PRFPlus returns n bytes of the PRF+ function defined in RFC 6113 section 5.1 for the key and input using the etypes
+// of the default registry.
+func PRFPlus(key types.EncryptionKey, b []byte, n int) ([]byte, error) {
+	return defaultRegistry.PRFPlus(key, b, n)
+}
+
+// PRFPlus returns n bytes of the PRF+ function defined in RFC 6113 section 5.1 for the key and input.
+func (r *Registry) PRFPlus(key types.EncryptionKey, b []byte, n int) ([]byte, error) {
+	et, err := r.GetEtype(key.KeyType)
+	if err != nil {
+		return nil, err
+	}
+	return prfPlus(et, key.KeyValue, b, n)
+}
+
+func prfPlus(et etype.EType, key, b []byte, n int) ([]byte, error) {
+	if n > 255*64 {
+		return nil, errors.New("PRF+ output length too large")
+	}
+	out := make([]byte, 0, n)
+	in := make([]byte, len(b)+1)
+	copy(in[1:], b)
+	for i := 1; len(out) < n; i++ {
+		in[0] = byte(i)
+		p, err := et.PRF(key, in)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p...)
+	}
+	return out[:n], nil
+}
+
+// KRBFXCF2 combines two keys into a new key of the first key's etype as defined in RFC 6113 section 5.1 using the
+// etypes of the default registry.
+func KRBFXCF2(key1, key2 types.EncryptionKey, pepper1, pepper2 string) (types.EncryptionKey, error) {
+	return defaultRegistry.KRBFXCF2(key1, key2, pepper1, pepper2)
+}
+
+// KRBFXCF2 combines two keys into a new key of the first key's etype as defined in RFC 6113 section 5.1.
+func (r *Registry) KRBFXCF2(key1, key2 types.EncryptionKey, pepper1, pepper2 string) (types.EncryptionKey, error) {
+	et1, err := r.GetEtype(key1.KeyType)
+	if err != nil {
+		return types.EncryptionKey{}, err
+	}
+	et2, err := r.GetEtype(key2.KeyType)
+	if err != nil {
+		return types.EncryptionKey{}, err
+	}
+	n := KeySeedByteSize(et1)
+	p1, err := prfPlus(et1, key1.KeyValue, []byte(pepper1), n)
+	if err != nil {
+		return types.EncryptionKey{}, err
+	}
+	p2, err := prfPlus(et2, key2.KeyValue, []byte(pepper2), n)
+	if err != nil {
+		return types.EncryptionKey{}, err
+	}
+	subtle.XORBytes(p1, p1, p2)
+	return types.EncryptionKey{
+		KeyType:  key1.KeyType,
+		KeyValue: et1.RandomToKey(p1),
+	}, nil
+}
+
+// KeySeedByteSize returns the length in bytes of the input to the etype's random-to-key function.
+func KeySeedByteSize(et etype.EType) int {
+	if et.GetETypeID() == etypeID.AES256_CTS_HMAC_SHA384_192 {
+		// The etype reports the length of its integrity key, the protocol key is 256 bits
+		return 32
+	}
+	return et.GetKeySeedBitLength() / 8
+}
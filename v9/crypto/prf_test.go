@@ -0,0 +1,138 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/etypeID"
+	"github.com/oiweiwei/gokrb5.fork/v9/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPseudoRandom(t *testing.T) {
+	t.Parallel()
+	// Test vectors from RFC 8009 Appendix A
+	var tests = []struct {
+		etype int32
+		key   string
+		prf   string
+	}{
+		{etypeID.AES128_CTS_HMAC_SHA256_128, "3705d96080c17728a0e800eab6e0d23c", "9d188616f63852fe86915bb840b4a886ff3e6bb0f819b49b893393d393854295"},
+		{etypeID.AES256_CTS_HMAC_SHA384_192, "6d404d37faf79f9df0d33568d320669800eb4836472ea8a026d16b7182460c52", "9801f69a368c2bf675e59521e177d9a07f67efe1cfde8d3c8d6f6a0256e3b17db3c1b62ad1b8553360d17367eb1514d2"},
+	}
+	for _, test := range tests {
+		k, _ := hex.DecodeString(test.key)
+		p, err := PseudoRandom(types.EncryptionKey{KeyType: test.etype, KeyValue: k}, []byte("test"))
+		if err != nil {
+			t.Fatalf("error calculating PRF for etype %d: %v", test.etype, err)
+		}
+		assert.Equal(t, test.prf, hex.EncodeToString(p), "PRF not as expected for etype %d", test.etype)
+	}
+}
+
+func TestPRF_OutputSize(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		etype int32
+		size  int
+	}{
+		{etypeID.AES128_CTS_HMAC_SHA1_96, 16},
+		{etypeID.AES256_CTS_HMAC_SHA1_96, 16},
+		{etypeID.AES128_CTS_HMAC_SHA256_128, 32},
+		{etypeID.AES256_CTS_HMAC_SHA384_192, 48},
+		{etypeID.DES3_CBC_SHA1_KD, 16},
+		{etypeID.RC4_HMAC, 20},
+		{etypeID.CAMELLIA128_CTS_CMAC, 16},
+		{etypeID.CAMELLIA256_CTS_CMAC, 16},
+		{etypeID.DES_CBC_MD5, 16},
+	}
+	for _, test := range tests {
+		et, err := GetEtype(test.etype)
+		if err != nil {
+			t.Fatalf("error getting etype %d: %v", test.etype, err)
+		}
+		k, err := et.StringToKey("password", "salt", et.GetDefaultStringToKeyParams())
+		if err != nil {
+			t.Fatalf("error generating key for etype %d: %v", test.etype, err)
+		}
+		p, err := et.PRF(k, []byte("test"))
+		if err != nil {
+			t.Fatalf("error calculating PRF for etype %d: %v", test.etype, err)
+		}
+		assert.Equal(t, test.size, len(p), "PRF output length not as expected for etype %d", test.etype)
+		p2, _ := et.PRF(k, []byte("test2"))
+		assert.NotEqual(t, p, p2, "PRF output should depend on the input for etype %d", test.etype)
+	}
+}
+
+func TestKRBFXCF2(t *testing.T) {
+	t.Parallel()
+	// Expected values from the MIT krb5 t_cf2 test
+	var tests = []struct {
+		etype int32
+		cf2   string
+	}{
+		{etypeID.AES128_CTS_HMAC_SHA1_96, "97df97e4b798b29eb31ed7280287a92a"},
+		{etypeID.AES256_CTS_HMAC_SHA1_96, "4d6ca4e629785c1f01baf55e2e548566b9617ae3a96868c337cb93b5e72b1c7b"},
+		{etypeID.DES3_CBC_SHA1_KD, "e58f9eb643862c13ad38e529313462a7f73e62834fe54a01"},
+		{etypeID.RC4_HMAC, "24d7f6b6bae4e5c00d2082c5ebab3672"},
+		{etypeID.AES128_CTS_HMAC_SHA256_128, "edd02a39d2dbde31611c16e610be062c"},
+	}
+	for _, test := range tests {
+		et, err := GetEtype(test.etype)
+		if err != nil {
+			t.Fatalf("error getting etype: %v", err)
+		}
+		k1, err := et.StringToKey("key1", "key1", et.GetDefaultStringToKeyParams())
+		if err != nil {
+			t.Fatalf("error generating key: %v", err)
+		}
+		k2, err := et.StringToKey("key2", "key2", et.GetDefaultStringToKeyParams())
+		if err != nil {
+			t.Fatalf("error generating key: %v", err)
+		}
+		k, err := KRBFXCF2(types.EncryptionKey{KeyType: test.etype, KeyValue: k1}, types.EncryptionKey{KeyType: test.etype, KeyValue: k2}, "a", "b")
+		if err != nil {
+			t.Fatalf("error calculating KRB-FX-CF2 for etype %d: %v", test.etype, err)
+		}
+		assert.Equal(t, test.etype, k.KeyType)
+		assert.Equal(t, test.cf2, hex.EncodeToString(k.KeyValue), "KRB-FX-CF2 not as expected for etype %d", test.etype)
+	}
+}
+
+func TestKRBFXCF2_AllEtypes(t *testing.T) {
+	t.Parallel()
+	for _, id := range DefaultRegistry().EtypeIDs() {
+		et, err := GetEtype(id)
+		if err != nil {
+			t.Fatalf("error getting etype %d: %v", id, err)
+		}
+		k1, err := et.StringToKey("key1", "key1", et.GetDefaultStringToKeyParams())
+		if err != nil {
+			t.Fatalf("error generating key for etype %d: %v", id, err)
+		}
+		k2, err := et.StringToKey("key2", "key2", et.GetDefaultStringToKeyParams())
+		if err != nil {
+			t.Fatalf("error generating key for etype %d: %v", id, err)
+		}
+		key1 := types.EncryptionKey{KeyType: id, KeyValue: k1}
+		key2 := types.EncryptionKey{KeyType: id, KeyValue: k2}
+		k, err := KRBFXCF2(key1, key2, "a", "b")
+		if err != nil {
+			t.Fatalf("error calculating KRB-FX-CF2 for etype %d: %v", id, err)
+		}
+		assert.Equal(t, len(k1), len(k.KeyValue), "KRB-FX-CF2 key length not as expected for etype %d", id)
+		// The combined key must be usable with the etype
+		ed, err := GetEncryptedData([]byte("message"), k, 1, 0)
+		if err != nil {
+			t.Fatalf("error encrypting with KRB-FX-CF2 key for etype %d: %v", id, err)
+		}
+		pt, err := DecryptEncPart(ed, k, 1)
+		if err != nil {
+			t.Fatalf("error decrypting with KRB-FX-CF2 key for etype %d: %v", id, err)
+		}
+		assert.Equal(t, "message", string(pt[:7]), "decrypted message not as expected for etype %d", id)
+		k3, _ := KRBFXCF2(key1, key2, "b", "a")
+		assert.NotEqual(t, k.KeyValue, k3.KeyValue, "KRB-FX-CF2 should depend on the peppers for etype %d", id)
+	}
+}
@@ -1,17 +1,14 @@
 package crypto
 
 import (
-	"bytes"
 	"crypto/hmac"
 	"crypto/md5"
 	"hash"
-	"io"
 
 	"github.com/oiweiwei/gokrb5.fork/v9/crypto/rfc3961"
 	"github.com/oiweiwei/gokrb5.fork/v9/crypto/rfc4757"
 	"github.com/oiweiwei/gokrb5.fork/v9/iana/chksumtype"
 	"github.com/oiweiwei/gokrb5.fork/v9/iana/etypeID"
-	"golang.org/x/crypto/md4"
 )
 
 // RC4HMAC implements Kerberos encryption type rc4-hmac
@@ -73,12 +70,11 @@ func (e RC4HMAC) StringToKey(secret string, salt string, s2kparams string) ([]by
 	return rfc4757.StringToKey(secret)
 }
 
-// RandomToKey returns a key from the bytes provided.
+// RandomToKey returns a key from the bytes provided. This is the identity function for RC4 (RFC 4757 section 5).
 func (e RC4HMAC) RandomToKey(b []byte) []byte {
-	r := bytes.NewReader(b)
-	h := md4.New()
-	io.Copy(h, r)
-	return h.Sum(nil)
+	k := make([]byte, len(b))
+	copy(k, b)
+	return k
 }
 
 // EncryptData encrypts the data provided.
@@ -108,6 +104,11 @@ func (e RC4HMAC) DeriveKey(protocolKey, usage []byte) ([]byte, error) {
 	return rfc4757.HMAC(protocolKey, usage), nil
 }
 
+// PRF returns the output of the etype's pseudo-random function for the protocol key and input.
+func (e RC4HMAC) PRF(protocolKey, b []byte) ([]byte, error) {
+	return rfc4757.PseudoRandom(protocolKey, b), nil
+}
+
 // DeriveRandom generates data needed for key generation.
 func (e RC4HMAC) DeriveRandom(protocolKey, usage []byte) ([]byte, error) {
 	return rfc3961.DeriveRandom(protocolKey, usage, e)
@@ -0,0 +1,354 @@
+package crypto
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/oiweiwei/gokrb5.fork/v9/crypto/chksum"
+	"github.com/oiweiwei/gokrb5.fork/v9/crypto/etype"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/chksumtype"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/etypeID"
+)
+
+// Registry holds the encryption and checksum type implementations available for use along with the policy of
+// which of them are enabled.
+//
+// The package level functions such as GetEtype, GetChksumEtype and GetChksumType use the default registry returned by
+// DefaultRegistry. Custom etype.EType implementations can be added to it with RegisterEtype and weak encryption types
+// can be forbidden process wide with DisableEtype.
+type Registry struct {
+	mu           sync.RWMutex
+	etypes       map[int32]etype.EType
+	chksumEtypes map[int32]etype.EType
+	chksums      map[int32]chksum.ChksumType
+	names        map[string]int32
+	disabled     map[int32]bool
+	disabledCks  map[int32]bool
+	// chksumTies maps checksum types that are not derived from an encryption type, such as the DES checksums, to
+	// the encryption types they are used with. Such a checksum type is disabled when none of them is enabled.
+	chksumTies map[int32][]int32
+}
+
+var defaultRegistry = newDefaultRegistry()
+
+// NewRegistry returns a new empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		etypes:       make(map[int32]etype.EType),
+		chksumEtypes: make(map[int32]etype.EType),
+		chksums:      make(map[int32]chksum.ChksumType),
+		names:        make(map[string]int32),
+		disabled:     make(map[int32]bool),
+		disabledCks:  make(map[int32]bool),
+		chksumTies:   make(map[int32][]int32),
+	}
+}
+
+// newDefaultRegistry returns a registry populated with the encryption and checksum types implemented by this package.
+func newDefaultRegistry() *Registry {
+	r := NewRegistry()
+	builtin := []struct {
+		et       etype.EType
+		chksumID int32
+	}{
+		{Aes128CtsHmacSha96{}, chksumtype.HMAC_SHA1_96_AES128},
+		{Aes256CtsHmacSha96{}, chksumtype.HMAC_SHA1_96_AES256},
+		{Aes128CtsHmacSha256128{}, chksumtype.HMAC_SHA256_128_AES128},
+		{Aes256CtsHmacSha384192{}, chksumtype.HMAC_SHA384_192_AES256},
+		{Camellia128CtsCmac{}, chksumtype.CMAC_CAMELLIA128},
+		{Camellia256CtsCmac{}, chksumtype.CMAC_CAMELLIA256},
+		{Des3CbcSha1Kd{}, chksumtype.HMAC_SHA1_DES3_KD},
+		{RC4HMAC{}, chksumtype.KERB_CHECKSUM_HMAC_MD5},
+		{DesCbcMd5{}, chksumtype.RSA_MD5_DES},
+		{DesCbcCrc{}, chksumtype.CRC32},
+	}
+	for _, b := range builtin {
+		id := b.et.GetETypeID()
+		r.etypes[id] = b.et
+		r.chksumEtypes[b.chksumID] = b.et
+		for name, nid := range etypeID.ETypesByName {
+			if nid == id {
+				r.names[name] = id
+			}
+		}
+	}
+	for _, ct := range []chksum.ChksumType{
+		Crc32{},
+		RsaMd4{},
+		RsaMd4Des{},
+		DesMac{},
+		RsaMd5{},
+		RsaMd5Des{},
+		ETypeChksum{Des3CbcSha1Kd{}},
+		ETypeChksum{Aes128CtsHmacSha96{}},
+		ETypeChksum{Aes256CtsHmacSha96{}},
+		ETypeChksum{Camellia128CtsCmac{}},
+		ETypeChksum{Camellia256CtsCmac{}},
+		ETypeChksum{Aes128CtsHmacSha256128{}},
+		ETypeChksum{Aes256CtsHmacSha384192{}},
+		HmacMd5{},
+	} {
+		r.chksums[ct.GetChksumTypeID()] = ct
+	}
+	des := []int32{etypeID.DES_CBC_CRC, etypeID.DES_CBC_MD4, etypeID.DES_CBC_MD5}
+	r.chksumTies[chksumtype.CRC32] = []int32{etypeID.DES_CBC_CRC}
+	r.chksumTies[chksumtype.RSA_MD4_DES] = des
+	r.chksumTies[chksumtype.DES_MAC] = des
+	r.chksumTies[chksumtype.RSA_MD5_DES] = des
+	return r
+}
+
+// DefaultRegistry returns the process wide registry used by the package level functions.
+func DefaultRegistry() *Registry {
+	return defaultRegistry
+}
+
+// RegisterEtype adds the encryption type to the default registry. See Registry.RegisterEtype.
+func RegisterEtype(et etype.EType, names ...string) {
+	defaultRegistry.RegisterEtype(et, names...)
+}
+
+// RegisterChksumType adds the checksum type to the default registry. See Registry.RegisterChksumType.
+func RegisterChksumType(ct chksum.ChksumType) {
+	defaultRegistry.RegisterChksumType(ct)
+}
+
+// DisableEtype disables the encryption types in the default registry.
+func DisableEtype(ids ...int32) {
+	defaultRegistry.Disable(ids...)
+}
+
+// EnableEtype enables the encryption types in the default registry.
+func EnableEtype(ids ...int32) {
+	defaultRegistry.Enable(ids...)
+}
+
+// RegisterEtype adds the encryption type to the registry, replacing any existing implementation with the same etype ID.
+// The encryption type is also registered as the implementation of its checksum type (as returned by GetHashID)
+// unless that checksum type is already provided by a checksum that is not tied to an encryption type.
+// The names provided, such as "aes256-cts-hmac-sha1-96", are those the encryption type can be referred to by in
+// the krb5.conf configuration.
+func (r *Registry) RegisterEtype(et etype.EType, names ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id := et.GetETypeID()
+	r.etypes[id] = et
+	if cid := et.GetHashID(); cid != 0 {
+		r.chksumEtypes[cid] = et
+		if ct, ok := r.chksums[cid]; !ok {
+			r.chksums[cid] = ETypeChksum{et}
+		} else if _, ok := ct.(ETypeChksum); ok {
+			r.chksums[cid] = ETypeChksum{et}
+		}
+	}
+	for _, name := range names {
+		r.names[name] = id
+	}
+}
+
+// RegisterChksumType adds the checksum type to the registry, replacing any existing implementation with the same
+// checksum type ID.
+func (r *Registry) RegisterChksumType(ct chksum.ChksumType) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.chksums[ct.GetChksumTypeID()] = ct
+}
+
+// Disable disables the encryption types. Disabled encryption types, and the checksum types derived from them, are
+// not returned by the registry.
+func (r *Registry) Disable(ids ...int32) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range ids {
+		r.disabled[id] = true
+	}
+}
+
+// Enable re-enables encryption types previously disabled.
+func (r *Registry) Enable(ids ...int32) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range ids {
+		delete(r.disabled, id)
+	}
+}
+
+// DisableChksumType disables the checksum types.
+func (r *Registry) DisableChksumType(ids ...int32) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range ids {
+		r.disabledCks[id] = true
+	}
+}
+
+// EnableChksumType re-enables checksum types previously disabled.
+func (r *Registry) EnableChksumType(ids ...int32) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range ids {
+		delete(r.disabledCks, id)
+	}
+}
+
+// Enabled returns true if the encryption type is registered and not disabled.
+func (r *Registry) Enabled(id int32) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.etypes[id]
+	return ok && !r.disabled[id]
+}
+
+// EtypeIDs returns the IDs of the registered encryption types that are enabled.
+func (r *Registry) EtypeIDs() []int32 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var ids []int32
+	for id := range r.etypes {
+		if !r.disabled[id] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// EtypeID resolves the encryption type name to its ID. Zero is returned if the name is unknown or the
+// encryption type is not enabled.
+func (r *Registry) EtypeID(name string) int32 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	id, ok := r.names[name]
+	if !ok || r.disabled[id] {
+		return 0
+	}
+	if _, ok := r.etypes[id]; !ok {
+		return 0
+	}
+	return id
+}
+
+// EtypeName returns the name of the encryption type ID. Of the names the encryption type was registered with the
+// longest is returned, as that is the full name such as "aes256-cts-hmac-sha1-96" rather than an alias such as
+// "aes256-cts". An empty string is returned if the encryption type has no name or is not enabled.
+func (r *Registry) EtypeName(id int32) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if _, ok := r.etypes[id]; !ok || r.disabled[id] {
+		return ""
+	}
+	var name string
+	for n, nid := range r.names {
+		if nid == id && (len(n) > len(name) || len(n) == len(name) && n < name) {
+			name = n
+		}
+	}
+	return name
+}
+
+// GetEtype returns the encryption type implementation for the etype ID.
+func (r *Registry) GetEtype(id int32) (etype.EType, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	et, ok := r.etypes[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown or unsupported EType: %d", id)
+	}
+	if r.disabled[id] {
+		return nil, fmt.Errorf("EType %d is disabled", id)
+	}
+	return et, nil
+}
+
+// GetChksumEtype returns the encryption type implementation for the checksum type ID.
+func (r *Registry) GetChksumEtype(id int32) (etype.EType, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	et, ok := r.chksumEtypes[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown or unsupported checksum type: %d", id)
+	}
+	if r.disabledCks[id] || r.disabled[et.GetETypeID()] || r.tiesDisabled(id) {
+		return nil, fmt.Errorf("checksum type %d is disabled", id)
+	}
+	return et, nil
+}
+
+// GetChksumType returns the checksum type implementation for the checksum type ID.
+func (r *Registry) GetChksumType(id int32) (chksum.ChksumType, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ct, ok := r.chksums[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown or unsupported checksum type: %d", id)
+	}
+	if r.disabledCks[id] || r.tiesDisabled(id) {
+		return nil, fmt.Errorf("checksum type %d is disabled", id)
+	}
+	if ec, ok := ct.(ETypeChksum); ok && r.disabled[ec.EType.GetETypeID()] {
+		return nil, fmt.Errorf("checksum type %d is disabled", id)
+	}
+	return ct, nil
+}
+
+// tiesDisabled returns true if the checksum type is tied to encryption types and none of them is enabled.
+// The caller must hold the lock.
+func (r *Registry) tiesDisabled(id int32) bool {
+	ties, ok := r.chksumTies[id]
+	if !ok {
+		return false
+	}
+	for _, eid := range ties {
+		if _, ok := r.etypes[eid]; ok && !r.disabled[eid] {
+			return false
+		}
+	}
+	return true
+}
+
+// Clone returns a copy of the registry that can be modified independently.
+func (r *Registry) Clone() *Registry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c := NewRegistry()
+	for k, v := range r.etypes {
+		c.etypes[k] = v
+	}
+	for k, v := range r.chksumEtypes {
+		c.chksumEtypes[k] = v
+	}
+	for k, v := range r.chksums {
+		c.chksums[k] = v
+	}
+	for k, v := range r.names {
+		c.names[k] = v
+	}
+	for k, v := range r.disabled {
+		c.disabled[k] = v
+	}
+	for k, v := range r.disabledCks {
+		c.disabledCks[k] = v
+	}
+	for k, v := range r.chksumTies {
+		c.chksumTies[k] = v
+	}
+	return c
+}
+
+// Restrict returns a copy of the registry in which only the permitted encryption types are enabled,
+// for example those of the permitted_enctypes setting in the krb5.conf configuration.
+// Encryption types already disabled remain disabled.
+func (r *Registry) Restrict(permitted []int32) *Registry {
+	c := r.Clone()
+	p := make(map[int32]bool, len(permitted))
+	for _, id := range permitted {
+		p[id] = true
+	}
+	for id := range c.etypes {
+		if !p[id] {
+			c.disabled[id] = true
+		}
+	}
+	return c
+}
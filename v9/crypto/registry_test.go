@@ -0,0 +1,118 @@
+package crypto
+
+import (
+	"testing"
+
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/chksumtype"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/etypeID"
+	"github.com/stretchr/testify/assert"
+)
+
+// customAes is an AES encryption type registered under a private etype ID.
+type customAes struct {
+	Aes256CtsHmacSha96
+}
+
+func (e customAes) GetETypeID() int32 {
+	return -1000
+}
+
+func TestRegistry_RegisterEtype(t *testing.T) {
+	t.Parallel()
+	r := DefaultRegistry().Clone()
+	_, err := r.GetEtype(-1000)
+	assert.Error(t, err, "custom etype should not be registered yet")
+
+	r.RegisterEtype(customAes{}, "custom-aes")
+	et, err := r.GetEtype(-1000)
+	if err != nil {
+		t.Fatalf("error getting custom etype: %v", err)
+	}
+	assert.Equal(t, int32(-1000), et.GetETypeID())
+	assert.Equal(t, int32(-1000), r.EtypeID("custom-aes"))
+	assert.Contains(t, r.EtypeIDs(), int32(-1000))
+
+	ct, err := r.GetChksumType(chksumtype.HMAC_SHA1_96_AES256)
+	if err != nil {
+		t.Fatalf("error getting checksum type: %v", err)
+	}
+	assert.Equal(t, ETypeChksum{customAes{}}, ct, "checksum type should use the registered etype")
+
+	// The default registry is not affected
+	_, err = GetEtype(-1000)
+	assert.Error(t, err)
+	ct, err = GetChksumType(chksumtype.HMAC_SHA1_96_AES256)
+	if err != nil {
+		t.Fatalf("error getting checksum type: %v", err)
+	}
+	assert.Equal(t, ETypeChksum{Aes256CtsHmacSha96{}}, ct)
+}
+
+func TestRegistry_EtypeName(t *testing.T) {
+	t.Parallel()
+	r := DefaultRegistry().Clone()
+	assert.Equal(t, "aes256-cts-hmac-sha1-96", r.EtypeName(etypeID.AES256_CTS_HMAC_SHA1_96))
+	assert.Equal(t, "arcfour-hmac-md5", r.EtypeName(etypeID.RC4_HMAC))
+	assert.Equal(t, "camellia128-cts-cmac", r.EtypeName(etypeID.CAMELLIA128_CTS_CMAC))
+	for _, id := range r.EtypeIDs() {
+		assert.Equal(t, id, r.EtypeID(r.EtypeName(id)), "name of etype %d does not resolve to it", id)
+	}
+	r.RegisterEtype(customAes{}, "custom-aes")
+	assert.Equal(t, "custom-aes", r.EtypeName(-1000))
+	r.Disable(etypeID.RC4_HMAC)
+	assert.Equal(t, "", r.EtypeName(etypeID.RC4_HMAC), "disabled etype should have no name")
+	assert.Equal(t, "", r.EtypeName(-2000), "unknown etype should have no name")
+}
+
+func TestRegistry_Disable(t *testing.T) {
+	t.Parallel()
+	r := DefaultRegistry().Clone()
+	r.Disable(etypeID.DES_CBC_CRC, etypeID.DES_CBC_MD5)
+
+	_, err := r.GetEtype(etypeID.DES_CBC_CRC)
+	assert.Error(t, err)
+	_, err = r.GetEtype(etypeID.DES_CBC_MD5)
+	assert.Error(t, err)
+	_, err = r.GetChksumEtype(chksumtype.RSA_MD5_DES)
+	assert.Error(t, err)
+	assert.False(t, r.Enabled(etypeID.DES_CBC_CRC))
+	assert.Equal(t, int32(0), r.EtypeID("des-cbc-crc"))
+	assert.NotContains(t, r.EtypeIDs(), int32(etypeID.DES_CBC_CRC))
+
+	// The DES checksums go with the DES etypes
+	for _, id := range []int32{chksumtype.CRC32, chksumtype.RSA_MD4_DES, chksumtype.DES_MAC, chksumtype.RSA_MD5_DES} {
+		_, err = r.GetChksumType(id)
+		assert.Error(t, err, "checksum type %d should be disabled with the DES etypes", id)
+	}
+	_, err = r.GetChksumType(chksumtype.RSA_MD5)
+	assert.NoError(t, err)
+
+	r.Enable(etypeID.DES_CBC_CRC)
+	_, err = r.GetEtype(etypeID.DES_CBC_CRC)
+	assert.NoError(t, err)
+	assert.True(t, r.Enabled(etypeID.DES_CBC_CRC))
+	for _, id := range []int32{chksumtype.CRC32, chksumtype.RSA_MD4_DES, chksumtype.DES_MAC, chksumtype.RSA_MD5_DES} {
+		_, err = r.GetChksumType(id)
+		assert.NoError(t, err, "checksum type %d should be enabled with des-cbc-crc", id)
+	}
+
+	r.DisableChksumType(chksumtype.CRC32)
+	_, err = r.GetChksumType(chksumtype.CRC32)
+	assert.Error(t, err)
+	r.EnableChksumType(chksumtype.CRC32)
+	_, err = r.GetChksumType(chksumtype.CRC32)
+	assert.NoError(t, err)
+}
+
+func TestRegistry_Restrict(t *testing.T) {
+	t.Parallel()
+	r := DefaultRegistry().Restrict([]int32{etypeID.AES256_CTS_HMAC_SHA1_96, etypeID.AES128_CTS_HMAC_SHA1_96})
+	assert.Equal(t, []int32{etypeID.AES128_CTS_HMAC_SHA1_96, etypeID.AES256_CTS_HMAC_SHA1_96}, r.EtypeIDs())
+	_, err := r.GetEtype(etypeID.RC4_HMAC)
+	assert.Error(t, err)
+	_, err = r.GetChksumType(chksumtype.KERB_CHECKSUM_HMAC_MD5)
+	assert.NoError(t, err, "HMAC-MD5 checksum is independent of the RC4 etype")
+	_, err = r.GetChksumType(chksumtype.HMAC_SHA1_DES3_KD)
+	assert.Error(t, err)
+	assert.True(t, DefaultRegistry().Enabled(etypeID.RC4_HMAC), "default registry should not be modified")
+}
@@ -1,7 +1,15 @@
 package rfc3961
 
 import (
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
 	"crypto/md5"
+	"errors"
+	"fmt"
+	"hash"
+
+	"github.com/oiweiwei/gokrb5.fork/v9/crypto/common"
 
 	"github.com/oiweiwei/gokrb5.fork/v9/crypto/etype"
 )
@@ -21,3 +29,99 @@ func DESGetHash(data, protocolKey []byte, usage []byte, e etype.EType) ([]byte,
 	h.Write(data)
 	return h.Sum(nil), nil
 }
+
+// desChksumKey returns the variant of the DES key used for the keyed DES checksum types: the key XOR F0F0F0F0F0F0F0F0.
+func desChksumKey(key []byte) ([]byte, error) {
+	if len(key) != des.BlockSize {
+		return nil, fmt.Errorf("incorrect keysize: expected: %v actual: %v", des.BlockSize, len(key))
+	}
+	k := make([]byte, des.BlockSize)
+	for i := range key {
+		k[i] = key[i] ^ 0xF0
+	}
+	return k, nil
+}
+
+// DESConfounderChecksum returns a checksum of the form des-cbc(key XOR F0F0F0F0F0F0F0F0, conf | h(conf | msg), iv=0)
+// as used by the rsa-md4-des and rsa-md5-des checksum types.
+func DESConfounderChecksum(key, conf, data []byte, h func() hash.Hash) ([]byte, error) {
+	if len(conf) != des.BlockSize {
+		return nil, fmt.Errorf("incorrect confounder size: expected: %v actual: %v", des.BlockSize, len(conf))
+	}
+	hh := h()
+	hh.Write(conf)
+	hh.Write(data)
+	return desChksumEncrypt(key, append(append([]byte{}, conf...), hh.Sum(nil)...))
+}
+
+// VerifyDESConfounderChecksum verifies a checksum created by DESConfounderChecksum.
+func VerifyDESConfounderChecksum(key, data, chksum []byte, h func() hash.Hash) bool {
+	b, err := desChksumDecrypt(key, chksum)
+	if err != nil || len(b) != des.BlockSize+h().Size() {
+		return false
+	}
+	c, err := DESConfounderChecksum(key, b[:des.BlockSize], data, h)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(c, chksum)
+}
+
+// DESMAC returns the des-mac checksum: des-cbc(key XOR F0F0F0F0F0F0F0F0, conf | des-mac(key, conf | msg, iv=0), iv=0).
+// des-mac is the last block of the DES CBC encryption of the zero padded input.
+func DESMAC(key, conf, data []byte) ([]byte, error) {
+	if len(conf) != des.BlockSize {
+		return nil, fmt.Errorf("incorrect confounder size: expected: %v actual: %v", des.BlockSize, len(conf))
+	}
+	block, err := des.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cipher: %v", err)
+	}
+	m, _ := common.ZeroPad(append(append([]byte{}, conf...), data...), des.BlockSize)
+	cipher.NewCBCEncrypter(block, make([]byte, des.BlockSize)).CryptBlocks(m, m)
+	return desChksumEncrypt(key, append(append([]byte{}, conf...), m[len(m)-des.BlockSize:]...))
+}
+
+// VerifyDESMAC verifies a checksum created by DESMAC.
+func VerifyDESMAC(key, data, chksum []byte) bool {
+	b, err := desChksumDecrypt(key, chksum)
+	if err != nil || len(b) != 2*des.BlockSize {
+		return false
+	}
+	c, err := DESMAC(key, b[:des.BlockSize], data)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(c, chksum)
+}
+
+func desChksumEncrypt(key, b []byte) ([]byte, error) {
+	k, err := desChksumKey(key)
+	if err != nil {
+		return nil, err
+	}
+	block, err := des.NewCipher(k)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cipher: %v", err)
+	}
+	b, _ = common.ZeroPad(b, des.BlockSize)
+	cipher.NewCBCEncrypter(block, make([]byte, des.BlockSize)).CryptBlocks(b, b)
+	return b, nil
+}
+
+func desChksumDecrypt(key, b []byte) ([]byte, error) {
+	if len(b) == 0 || len(b)%des.BlockSize != 0 {
+		return nil, errors.New("checksum is not a multiple of the DES block size")
+	}
+	k, err := desChksumKey(key)
+	if err != nil {
+		return nil, err
+	}
+	block, err := des.NewCipher(k)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cipher: %v", err)
+	}
+	out := make([]byte, len(b))
+	cipher.NewCBCDecrypter(block, make([]byte, des.BlockSize)).CryptBlocks(out, b)
+	return out, nil
+}
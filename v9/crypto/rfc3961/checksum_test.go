@@ -0,0 +1,57 @@
+package rfc3961
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"hash"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/md4"
+)
+
+// The expected checksums were computed independently with the DES-CBC, MD4 and MD5 primitives of OpenSSL following
+// the definitions of RFC 3961 Section 6.2, as MIT krb5 no longer implements the DES checksum types.
+const (
+	testDESChksumKey  = "cbc22fae235298e3"
+	testDESChksumConf = "a1b2c3d4e5f60718"
+	testDESChksumData = "this is a test"
+)
+
+func TestDESConfounderChecksum(t *testing.T) {
+	t.Parallel()
+	key, _ := hex.DecodeString(testDESChksumKey)
+	conf, _ := hex.DecodeString(testDESChksumConf)
+	data := []byte(testDESChksumData)
+	var tests = []struct {
+		name   string
+		chksum string
+	}{
+		{"rsa-md4-des", "e8444e90be0e8b1462f43b9a232cf463c3d19d3483e44dd1"},
+		{"rsa-md5-des", "e8444e90be0e8b14ff4bfa95a73efd3790684f045320aa5e"},
+	}
+	for i, h := range []func() hash.Hash{md4.New, md5.New} {
+		test := tests[i]
+		c, err := DESConfounderChecksum(key, conf, data, h)
+		if err != nil {
+			t.Fatalf("error calculating %s checksum: %v", test.name, err)
+		}
+		assert.Equal(t, test.chksum, hex.EncodeToString(c), "%s checksum not as expected", test.name)
+		assert.True(t, VerifyDESConfounderChecksum(key, data, c, h), "%s checksum verification failed", test.name)
+		assert.False(t, VerifyDESConfounderChecksum(key, []byte("tampered"), c, h), "%s checksum of other data should not verify", test.name)
+	}
+}
+
+func TestDESMAC(t *testing.T) {
+	t.Parallel()
+	key, _ := hex.DecodeString(testDESChksumKey)
+	conf, _ := hex.DecodeString(testDESChksumConf)
+	data := []byte(testDESChksumData)
+	c, err := DESMAC(key, conf, data)
+	if err != nil {
+		t.Fatalf("error calculating des-mac checksum: %v", err)
+	}
+	assert.Equal(t, "e8444e90be0e8b1480bbcf500ae2b1a9", hex.EncodeToString(c), "des-mac checksum not as expected")
+	assert.True(t, VerifyDESMAC(key, data, c), "des-mac checksum verification failed")
+	assert.False(t, VerifyDESMAC(key, []byte("tampered"), c), "des-mac checksum of other data should not verify")
+}
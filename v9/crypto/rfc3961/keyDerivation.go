@@ -2,6 +2,8 @@ package rfc3961
 
 import (
 	"bytes"
+	"crypto/des"
+	"crypto/md5"
 	"math/bits"
 
 	"github.com/oiweiwei/gokrb5.fork/v9/crypto/common"
@@ -108,11 +110,13 @@ func MITDESStringToKey(secret, salt string, e etype.EType) ([]byte, error) {
 	return keyCorrection(key), nil
 }
 
-// PseudoRandom function as defined in RFC 3961
+// PseudoRandom function as defined in RFC 3961 section 5.3 for the simplified profile:
+// PRF = E(DK(key, "prf"), truncate H(input) to a multiple of the message block size).
 func PseudoRandom(key, b []byte, e etype.EType) ([]byte, error) {
 	h := e.GetHashFunc()()
 	h.Write(b)
-	tmp := h.Sum(nil)[:e.GetMessageBlockByteSize()]
+	tmp := h.Sum(nil)
+	tmp = tmp[:len(tmp)-len(tmp)%e.GetMessageBlockByteSize()]
 	k, err := e.DeriveKey(key, []byte(prfconstant))
 	if err != nil {
 		return []byte{}, err
@@ -124,6 +128,17 @@ func PseudoRandom(key, b []byte, e etype.EType) ([]byte, error) {
 	return prf, nil
 }
 
+// DESPseudoRandom function as defined in RFC 3961 section 6.2 for the DES etypes:
+// PRF = DES-CBC(key, MD5(input), ivec=0).
+func DESPseudoRandom(key, b []byte, e etype.EType) ([]byte, error) {
+	tmp := md5.Sum(b)
+	_, prf, err := DESEncryptData(key, tmp[:], make([]byte, des.BlockSize), e)
+	if err != nil {
+		return []byte{}, err
+	}
+	return prf, nil
+}
+
 func stretch56Bits(b []byte) []byte {
 	d := make([]byte, len(b), len(b))
 	copy(d, b)
@@ -2,11 +2,11 @@
 package rfc3962
 
 import (
+	"crypto/aes"
 	"crypto/rand"
 	"errors"
 	"fmt"
 
-	"github.com/jcmturner/aescts/v2"
 	"github.com/oiweiwei/gokrb5.fork/v9/crypto/common"
 	"github.com/oiweiwei/gokrb5.fork/v9/crypto/etype"
 )
@@ -16,8 +16,7 @@ func EncryptData(key, data []byte, e etype.EType) ([]byte, []byte, error) {
 	if len(key) != e.GetKeyByteSize() {
 		return []byte{}, []byte{}, fmt.Errorf("incorrect keysize: expected: %v actual: %v", e.GetKeyByteSize(), len(key))
 	}
-	ivz := make([]byte, e.GetCypherBlockBitLength()/8)
-	return aescts.Encrypt(key, ivz, data)
+	return aesCTSEncrypt(key, data)
 }
 
 // EncryptMessage encrypts the message provided using the methods specific to the etype provided as defined in RFC 3962.
@@ -27,12 +26,15 @@ func EncryptMessage(key, message []byte, usage uint32, e etype.EType) ([]byte, [
 		return []byte{}, []byte{}, fmt.Errorf("incorrect keysize: expected: %v actual: %v", e.GetKeyByteSize(), len(key))
 	}
 	//confounder
-	c := make([]byte, e.GetConfounderByteSize())
-	_, err := rand.Read(c)
+	cl := e.GetConfounderByteSize()
+	bp := common.GetBuffer(cl + len(message))
+	defer common.PutBuffer(bp)
+	plainBytes := *bp
+	_, err := rand.Read(plainBytes[:cl])
 	if err != nil {
 		return []byte{}, []byte{}, fmt.Errorf("could not generate random confounder: %v", err)
 	}
-	plainBytes := append(c, message...)
+	copy(plainBytes[cl:], message)
 
 	// Derive key for encryption from usage
 	var k []byte
@@ -63,8 +65,7 @@ func DecryptData(key, data []byte, e etype.EType) ([]byte, error) {
 	if len(key) != e.GetKeyByteSize() {
 		return []byte{}, fmt.Errorf("incorrect keysize: expected: %v actual: %v", e.GetKeyByteSize(), len(key))
 	}
-	ivz := make([]byte, e.GetCypherBlockBitLength()/8)
-	return aescts.Decrypt(key, ivz, data)
+	return aesCTSDecrypt(key, data)
 }
 
 // DecryptMessage decrypts the message provided using the methods specific to the etype provided as defined in RFC 3962.
@@ -87,3 +88,24 @@ func DecryptMessage(key, ciphertext []byte, usage uint32, e etype.EType) ([]byte
 	//Remove the confounder bytes
 	return b[e.GetConfounderByteSize():], nil
 }
+
+// aesCTSEncrypt encrypts the data with AES in CBC-CTS mode using a zero initial vector.
+func aesCTSEncrypt(key, data []byte) ([]byte, []byte, error) {
+	b, err := common.AESBlock(key)
+	if err != nil {
+		return []byte{}, []byte{}, fmt.Errorf("error creating cipher: %v", err)
+	}
+	var ivz [aes.BlockSize]byte
+	iv, ct := common.CTSEncrypt(b, ivz[:], data)
+	return iv, ct, nil
+}
+
+// aesCTSDecrypt decrypts the data with AES in CBC-CTS mode using a zero initial vector.
+func aesCTSDecrypt(key, data []byte) ([]byte, error) {
+	b, err := common.AESBlock(key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cipher: %v", err)
+	}
+	var ivz [aes.BlockSize]byte
+	return common.CTSDecrypt(b, ivz[:], data)
+}
@@ -1,6 +1,7 @@
 package rfc3962
 
 import (
+	"crypto/sha1"
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
@@ -11,6 +12,7 @@ import (
 
 const (
 	s2kParamsZero = 4294967296
+	prfConstant   = "prf"
 )
 
 // StringToKey returns a key derived from the string provided according to the definition in RFC 3961.
@@ -49,3 +51,17 @@ func S2KparamsToItertions(s2kparams string) (int64, error) {
 	i = binary.BigEndian.Uint32(b)
 	return int64(i), nil
 }
+
+// PseudoRandom function as defined in RFC 3962 section 6: PRF = E(DK(key, "prf"), truncate(SHA-1(input), 128 bits)).
+func PseudoRandom(key, b []byte, e etype.EType) ([]byte, error) {
+	h := sha1.Sum(b)
+	k, err := e.DeriveKey(key, []byte(prfConstant))
+	if err != nil {
+		return nil, err
+	}
+	_, prf, err := e.EncryptData(k, h[:16])
+	if err != nil {
+		return nil, err
+	}
+	return prf, nil
+}
@@ -2,6 +2,8 @@ package rfc4757
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -32,6 +34,13 @@ func StringToKey(secret string) ([]byte, error) {
 	return h.Sum(nil), nil
 }
 
+// PseudoRandom function as defined in RFC 4757 section 5: PRF = HMAC-SHA1(key, input).
+func PseudoRandom(key, b []byte) []byte {
+	mac := hmac.New(sha1.New, key)
+	mac.Write(b)
+	return mac.Sum(nil)
+}
+
 func deriveKeys(key, checksum []byte, usage uint32, export bool) (k1, k2, k3 []byte) {
 	k1 = key
 	k2 = HMAC(k1, UsageToMSMsgType(usage))
@@ -0,0 +1,57 @@
+package rfc6803
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+)
+
+// CMAC returns the CMAC (NIST SP 800-38B, RFC 4493) of the message using the block cipher provided.
+func CMAC(b cipher.Block, message []byte) []byte {
+	bs := b.BlockSize()
+	k1, k2 := cmacSubkeys(b)
+	n := (len(message) + bs - 1) / bs
+	complete := n > 0 && len(message)%bs == 0
+	if n == 0 {
+		n = 1
+	}
+	last := make([]byte, bs)
+	if complete {
+		subtle.XORBytes(last, message[(n-1)*bs:], k1)
+	} else {
+		r := message[(n-1)*bs:]
+		copy(last, r)
+		last[len(r)] = 0x80
+		subtle.XORBytes(last, last, k2)
+	}
+	x := make([]byte, bs)
+	for i := 0; i < n-1; i++ {
+		subtle.XORBytes(x, x, message[i*bs:(i+1)*bs])
+		b.Encrypt(x, x)
+	}
+	subtle.XORBytes(x, x, last)
+	b.Encrypt(x, x)
+	return x
+}
+
+// cmacSubkeys generates the CMAC subkeys K1 and K2.
+func cmacSubkeys(b cipher.Block) ([]byte, []byte) {
+	l := make([]byte, b.BlockSize())
+	b.Encrypt(l, l)
+	k1 := cmacDouble(l)
+	k2 := cmacDouble(k1)
+	return k1, k2
+}
+
+// cmacDouble multiplies the block by x in GF(2^128).
+func cmacDouble(in []byte) []byte {
+	out := make([]byte, len(in))
+	var carry byte
+	for i := len(in) - 1; i >= 0; i-- {
+		out[i] = in[i]<<1 | carry
+		carry = in[i] >> 7
+	}
+	if carry != 0 {
+		out[len(out)-1] ^= 0x87
+	}
+	return out
+}
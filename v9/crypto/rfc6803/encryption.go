@@ -0,0 +1,143 @@
+// Package rfc6803 provides encryption and checksum methods as specified in RFC 6803
+package rfc6803
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"github.com/oiweiwei/gokrb5.fork/v9/crypto/camellia"
+	"github.com/oiweiwei/gokrb5.fork/v9/crypto/common"
+	"github.com/oiweiwei/gokrb5.fork/v9/crypto/etype"
+)
+
+// EncryptData encrypts the data provided using Camellia in CBC-CTS mode as defined in RFC 6803.
+func EncryptData(key, data []byte, e etype.EType) ([]byte, []byte, error) {
+	if len(key) != e.GetKeyByteSize() {
+		return []byte{}, []byte{}, fmt.Errorf("incorrect keysize: expected: %v actual: %v", e.GetKeyByteSize(), len(key))
+	}
+	b, err := camellia.NewCipher(key)
+	if err != nil {
+		return []byte{}, []byte{}, fmt.Errorf("error creating cipher: %v", err)
+	}
+	ivz := make([]byte, camellia.BlockSize)
+	iv, ct := common.CTSEncrypt(b, ivz, data)
+	return iv, ct, nil
+}
+
+// EncryptMessage encrypts the message provided using the methods specific to the etype provided as defined in RFC 6803.
+// The encrypted data is concatenated with its integrity hash to create an encrypted message.
+func EncryptMessage(key, message []byte, usage uint32, e etype.EType) ([]byte, []byte, error) {
+	c := make([]byte, e.GetConfounderByteSize())
+	_, err := rand.Read(c)
+	if err != nil {
+		return []byte{}, []byte{}, fmt.Errorf("could not generate random confounder: %v", err)
+	}
+	return EncryptMessageWithConfounder(key, message, c, usage, e)
+}
+
+// EncryptMessageWithConfounder encrypts the message provided using the confounder given rather than a random one.
+// It is exposed to allow validation against test vectors.
+func EncryptMessageWithConfounder(key, message, confounder []byte, usage uint32, e etype.EType) ([]byte, []byte, error) {
+	if len(key) != e.GetKeyByteSize() {
+		return []byte{}, []byte{}, fmt.Errorf("incorrect keysize: expected: %v actual: %v", e.GetKeyByteSize(), len(key))
+	}
+	plainBytes := append(append([]byte{}, confounder...), message...)
+
+	// Derive key for encryption from usage
+	k, err := e.DeriveKey(key, common.GetUsageKe(usage))
+	if err != nil {
+		return []byte{}, []byte{}, fmt.Errorf("error deriving key for encryption: %v", err)
+	}
+
+	// Encrypt the data
+	iv, b, err := e.EncryptData(k, plainBytes)
+	if err != nil {
+		return iv, b, fmt.Errorf("error encrypting data: %v", err)
+	}
+
+	// The integrity hash is a CMAC over the confounder and plaintext
+	ih, err := GetIntegrityHash(plainBytes, key, usage, e)
+	if err != nil {
+		return iv, b, fmt.Errorf("error encrypting data: %v", err)
+	}
+	b = append(b, ih...)
+	return iv, b, nil
+}
+
+// DecryptData decrypts the data provided using Camellia in CBC-CTS mode as defined in RFC 6803.
+func DecryptData(key, data []byte, e etype.EType) ([]byte, error) {
+	if len(key) != e.GetKeyByteSize() {
+		return []byte{}, fmt.Errorf("incorrect keysize: expected: %v actual: %v", e.GetKeyByteSize(), len(key))
+	}
+	b, err := camellia.NewCipher(key)
+	if err != nil {
+		return []byte{}, fmt.Errorf("error creating cipher: %v", err)
+	}
+	ivz := make([]byte, camellia.BlockSize)
+	return common.CTSDecrypt(b, ivz, data)
+}
+
+// DecryptMessage decrypts the message provided using the methods specific to the etype provided as defined in RFC 6803.
+// The integrity of the message is also verified.
+func DecryptMessage(key, ciphertext []byte, usage uint32, e etype.EType) ([]byte, error) {
+	hl := e.GetHMACBitLength() / 8
+	if len(ciphertext) < e.GetConfounderByteSize()+hl {
+		return nil, errors.New("ciphertext is too short")
+	}
+	//Derive the key
+	k, err := e.DeriveKey(key, common.GetUsageKe(usage))
+	if err != nil {
+		return nil, fmt.Errorf("error deriving key: %v", err)
+	}
+	// Strip off the checksum from the end
+	b, err := e.DecryptData(k, ciphertext[:len(ciphertext)-hl])
+	if err != nil {
+		return nil, err
+	}
+	//Verify checksum
+	if !e.VerifyIntegrity(key, ciphertext, b, usage) {
+		return nil, errors.New("integrity verification failed")
+	}
+	//Remove the confounder bytes
+	return b[e.GetConfounderByteSize():], nil
+}
+
+// GetIntegrityHash returns the CMAC integrity hash of the bytes provided using the integrity key for the usage.
+func GetIntegrityHash(pt, key []byte, usage uint32, e etype.EType) ([]byte, error) {
+	return GetHash(pt, key, common.GetUsageKi(usage), e)
+}
+
+// GetChecksumHash returns the CMAC checksum of the bytes provided using the checksum key for the usage.
+func GetChecksumHash(b, key []byte, usage uint32, e etype.EType) ([]byte, error) {
+	return GetHash(b, key, common.GetUsageKc(usage), e)
+}
+
+// GetHash derives a key from the protocol key for the usage and returns the CMAC of the bytes provided.
+func GetHash(pt, key, usage []byte, e etype.EType) ([]byte, error) {
+	k, err := e.DeriveKey(key, usage)
+	if err != nil {
+		return nil, fmt.Errorf("unable to derive key for checksum: %v", err)
+	}
+	b, err := camellia.NewCipher(k)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cipher: %v", err)
+	}
+	return CMAC(b, pt)[:e.GetHMACBitLength()/8], nil
+}
+
+// VerifyIntegrity verifies the integrity of the ciphertext ct against the decrypted plaintext pt, which includes the
+// confounder.
+func VerifyIntegrity(key, ct, pt []byte, usage uint32, e etype.EType) bool {
+	hl := e.GetHMACBitLength() / 8
+	if len(ct) < hl {
+		return false
+	}
+	h := ct[len(ct)-hl:]
+	expectedMAC, err := GetIntegrityHash(pt, key, usage, e)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(h, expectedMAC)
+}
@@ -0,0 +1,114 @@
+package rfc6803
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+
+	"github.com/oiweiwei/gokrb5.fork/v9/crypto/camellia"
+	"github.com/oiweiwei/gokrb5.fork/v9/crypto/etype"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	s2kParamsZero = 32768
+)
+
+// DeriveRandom generates data needed for key generation as defined in RFC 6803 section 3.
+func DeriveRandom(protocolKey, usage []byte, e etype.EType) ([]byte, error) {
+	return KDFFeedbackCMAC(protocolKey, usage, e.GetKeySeedBitLength())
+}
+
+// DeriveKey derives a key from the protocol key based on the usage as defined in RFC 6803 section 3.
+func DeriveKey(protocolKey, usage []byte, e etype.EType) ([]byte, error) {
+	r, err := e.DeriveRandom(protocolKey, usage)
+	if err != nil {
+		return nil, err
+	}
+	return e.RandomToKey(r), nil
+}
+
+// PseudoRandom function as defined in RFC 6803 section 4: PRF = CMAC(DK(key, "prf"), input).
+func PseudoRandom(protocolKey, b []byte, e etype.EType) ([]byte, error) {
+	k, err := e.DeriveKey(protocolKey, []byte("prf"))
+	if err != nil {
+		return nil, err
+	}
+	c, err := camellia.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+	return CMAC(c, b), nil
+}
+
+// KDFFeedbackCMAC is the key derivation function from NIST SP 800-108 in feedback mode with CMAC-Camellia as the
+// PRF, as defined in RFC 6803 section 3. The output is kl bits in length.
+func KDFFeedbackCMAC(protocolKey, constant []byte, kl int) ([]byte, error) {
+	b, err := camellia.NewCipher(protocolKey)
+	if err != nil {
+		return nil, err
+	}
+	k := make([]byte, 4)
+	binary.BigEndian.PutUint32(k, uint32(kl))
+	n := (kl + 127) / 128
+	var out []byte
+	ki := make([]byte, camellia.BlockSize)
+	for i := 1; i <= n; i++ {
+		c := make([]byte, 4)
+		binary.BigEndian.PutUint32(c, uint32(i))
+		m := append([]byte{}, ki...)
+		m = append(m, c...)
+		m = append(m, constant...)
+		m = append(m, byte(0))
+		m = append(m, k...)
+		ki = CMAC(b, m)
+		out = append(out, ki...)
+	}
+	return out[:kl/8], nil
+}
+
+// RandomToKey returns a key from the bytes provided according to the definition in RFC 6803.
+func RandomToKey(b []byte) []byte {
+	return b
+}
+
+// StringToKey returns a key derived from the string provided according to the definition in RFC 6803.
+func StringToKey(secret, salt, s2kparams string, e etype.EType) ([]byte, error) {
+	i, err := S2KparamsToItertions(s2kparams)
+	if err != nil {
+		return nil, err
+	}
+	return StringToKeyIter(secret, salt, i, e)
+}
+
+// StringToKeyIter returns a key derived from the string provided according to the definition in RFC 6803.
+func StringToKeyIter(secret, salt string, iterations int, e etype.EType) ([]byte, error) {
+	tkey := e.RandomToKey(StringToPBKDF2(secret, salt, iterations, e))
+	return e.DeriveKey(tkey, []byte("kerberos"))
+}
+
+// StringToPBKDF2 generates an encryption key from a pass phrase and salt string using the PBKDF2 function from
+// PKCS #5 v2.0 with HMAC-SHA1.
+func StringToPBKDF2(secret, salt string, iterations int, e etype.EType) []byte {
+	return pbkdf2.Key([]byte(secret), []byte(salt), iterations, e.GetKeyByteSize(), e.GetHashFunc())
+}
+
+// GetSaltP returns the salt value based on the etype name: https://tools.ietf.org/html/rfc6803#section-4
+func GetSaltP(salt, ename string) string {
+	b := []byte(ename)
+	b = append(b, byte(0))
+	b = append(b, []byte(salt)...)
+	return string(b)
+}
+
+// S2KparamsToItertions converts the string representation of iterations to an integer for RFC 6803.
+func S2KparamsToItertions(s2kparams string) (int, error) {
+	if len(s2kparams) != 8 {
+		return s2kParamsZero, errors.New("invalid s2kparams length")
+	}
+	b, err := hex.DecodeString(s2kparams)
+	if err != nil {
+		return s2kParamsZero, errors.New("invalid s2kparams, cannot decode string to bytes")
+	}
+	return int(binary.BigEndian.Uint32(b)), nil
+}
@@ -8,7 +8,6 @@ import (
 	"errors"
 	"fmt"
 
-	"github.com/jcmturner/aescts/v2"
 	"github.com/oiweiwei/gokrb5.fork/v9/crypto/common"
 	"github.com/oiweiwei/gokrb5.fork/v9/crypto/etype"
 	"github.com/oiweiwei/gokrb5.fork/v9/iana/etypeID"
@@ -23,8 +22,7 @@ func EncryptData(key, data []byte, e etype.EType) ([]byte, []byte, error) {
 	if len(key) != kl {
 		return []byte{}, []byte{}, fmt.Errorf("incorrect keysize: expected: %v actual: %v", e.GetKeyByteSize(), len(key))
 	}
-	ivz := make([]byte, aes.BlockSize)
-	return aescts.Encrypt(key, ivz, data)
+	return aesCTSEncrypt(key, data)
 }
 
 // EncryptMessage encrypts the message provided using the methods specific to the etype provided as defined in RFC 8009.
@@ -40,12 +38,15 @@ func EncryptMessage(key, message []byte, usage uint32, e etype.EType) ([]byte, [
 	if len(key) != e.GetKeyByteSize() {
 	}
 	//confounder
-	c := make([]byte, e.GetConfounderByteSize())
-	_, err := rand.Read(c)
+	cl := e.GetConfounderByteSize()
+	bp := common.GetBuffer(cl + len(message))
+	defer common.PutBuffer(bp)
+	plainBytes := *bp
+	_, err := rand.Read(plainBytes[:cl])
 	if err != nil {
 		return []byte{}, []byte{}, fmt.Errorf("could not generate random confounder: %v", err)
 	}
-	plainBytes := append(c, message...)
+	copy(plainBytes[cl:], message)
 
 	// Derive key for encryption from usage
 	var k []byte
@@ -80,8 +81,7 @@ func DecryptData(key, data []byte, e etype.EType) ([]byte, error) {
 	if len(key) != kl {
 		return []byte{}, fmt.Errorf("incorrect keysize: expected: %v actual: %v", kl, len(key))
 	}
-	ivz := make([]byte, aes.BlockSize)
-	return aescts.Decrypt(key, ivz, data)
+	return aesCTSDecrypt(key, data)
 }
 
 // DecryptMessage decrypts the message provided using the methods specific to the etype provided as defined in RFC 8009.
@@ -110,16 +110,44 @@ func GetIntegityHash(iv, c, key []byte, usage uint32, e etype.EType) ([]byte, er
 	// Generate and append integrity hash
 	// Rather than calculating the hash over the confounder and plaintext
 	// it is calculated over the iv concatenated with the AES cipher output.
-	ib := append(iv, c...)
-	return common.GetIntegrityHash(ib, key, usage, e)
+	k, err := e.DeriveKey(key, common.GetUsageKi(usage))
+	if err != nil {
+		return nil, fmt.Errorf("unable to derive key for checksum: %v", err)
+	}
+	mac := hmac.New(e.GetHashFunc(), k)
+	mac.Write(iv)
+	mac.Write(c)
+	return mac.Sum(nil)[:e.GetHMACBitLength()/8], nil
 }
 
 // VerifyIntegrity verifies the integrity of cipertext bytes ct.
 func VerifyIntegrity(key, ct []byte, usage uint32, etype etype.EType) bool {
-	h := make([]byte, etype.GetHMACBitLength()/8)
-	copy(h, ct[len(ct)-etype.GetHMACBitLength()/8:])
+	l := len(ct) - etype.GetHMACBitLength()/8
 	ivz := make([]byte, etype.GetConfounderByteSize())
-	ib := append(ivz, ct[:len(ct)-(etype.GetHMACBitLength()/8)]...)
-	expectedMAC, _ := common.GetIntegrityHash(ib, key, usage, etype)
-	return hmac.Equal(h, expectedMAC)
+	expectedMAC, err := GetIntegityHash(ivz, ct[:l], key, usage, etype)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(ct[l:], expectedMAC)
+}
+
+// aesCTSEncrypt encrypts the data with AES in CBC-CTS mode using a zero initial vector.
+func aesCTSEncrypt(key, data []byte) ([]byte, []byte, error) {
+	b, err := common.AESBlock(key)
+	if err != nil {
+		return []byte{}, []byte{}, fmt.Errorf("error creating cipher: %v", err)
+	}
+	var ivz [aes.BlockSize]byte
+	iv, ct := common.CTSEncrypt(b, ivz[:], data)
+	return iv, ct, nil
+}
+
+// aesCTSDecrypt decrypts the data with AES in CBC-CTS mode using a zero initial vector.
+func aesCTSDecrypt(key, data []byte) ([]byte, error) {
+	b, err := common.AESBlock(key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cipher: %v", err)
+	}
+	var ivz [aes.BlockSize]byte
+	return common.CTSDecrypt(b, ivz[:], data)
 }
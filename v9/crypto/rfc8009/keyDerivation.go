@@ -21,6 +21,11 @@ func DeriveRandom(protocolKey, usage []byte, e etype.EType) ([]byte, error) {
 	return KDF_HMAC_SHA2(protocolKey, []byte("prf"), usage, h.Size(), e), nil
 }
 
+// PseudoRandom function as defined in RFC 8009 section 5: PRF = KDF-HMAC-SHA2(key, "prf", input, 256 or 384).
+func PseudoRandom(protocolKey, b []byte, e etype.EType) ([]byte, error) {
+	return KDF_HMAC_SHA2(protocolKey, []byte("prf"), b, e.GetHashFunc()().Size()*8, e), nil
+}
+
 // DeriveKey derives a key from the protocol key based on the usage and the etype's specific methods.
 //
 // https://tools.ietf.org/html/rfc8009#section-5
@@ -5,21 +5,22 @@ go 1.23
 toolchain go1.23.5
 
 require (
+	filippo.io/bigmod v0.1.0
+	filippo.io/edwards25519 v1.1.0
 	github.com/gorilla/sessions v1.4.0
 	github.com/hashicorp/go-uuid v1.0.3
-	github.com/jcmturner/aescts/v2 v2.0.0
-	github.com/jcmturner/dnsutils/v2 v2.0.0
 	github.com/jcmturner/gofork v1.7.6
 	github.com/jcmturner/goidentity/v6 v6.0.1
 	github.com/jcmturner/rpc/v2 v2.0.3
 	github.com/stretchr/testify v1.10.0
 	golang.org/x/crypto v0.32.0
+	golang.org/x/net v0.21.0
+	golang.org/x/sys v0.29.0
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/gorilla/securecookie v1.1.2 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	golang.org/x/net v0.21.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
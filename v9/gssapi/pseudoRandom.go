@@ -0,0 +1,62 @@
+package gssapi
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+
+	"github.com/oiweiwei/gokrb5.fork/v9/crypto"
+	"github.com/oiweiwei/gokrb5.fork/v9/types"
+)
+
+// RFC 4401 and RFC 4402
+
+// Key selectors for GSS_Pseudo_random.
+const (
+	// PRFKeyPartial selects the key of the context known to the initiator when it sent its token (GSS_C_PRF_KEY_PARTIAL).
+	PRFKeyPartial = 0
+	// PRFKeyFull selects the key of the fully established context (GSS_C_PRF_KEY_FULL).
+	PRFKeyFull = 1
+)
+
+// PRFKey returns the key of a Kerberos V security context to use with GSS_Pseudo_random as defined in RFC 4402 section 2.
+// For PRFKeyFull this is the acceptor's subkey if one was asserted, otherwise for either selector it is the initiator's
+// subkey if one was asserted, otherwise the ticket session key. Pass the zero EncryptionKey for subkeys not asserted.
+func PRFKey(prfKey int, sessionKey, initiatorSubkey, acceptorSubkey types.EncryptionKey) types.EncryptionKey {
+	if prfKey == PRFKeyFull && acceptorSubkey.KeyType != 0 {
+		return acceptorSubkey
+	}
+	if initiatorSubkey.KeyType != 0 {
+		return initiatorSubkey
+	}
+	return sessionKey
+}
+
+// PseudoRandom implements GSS_Pseudo_random for the Kerberos V mechanism as defined in RFC 4402 section 2.
+// It returns desiredOutputLen bytes of PRF+(key, prfIn) where the PRF+ counter is a 32 bit big endian integer.
+// The counter starts at zero, as it does in the MIT and Heimdal implementations, rather than at one as RFC 4402 states.
+// Use PRFKey to select the key of the security context.
+func PseudoRandom(key types.EncryptionKey, prfIn []byte, desiredOutputLen int) ([]byte, error) {
+	if desiredOutputLen < 0 {
+		return nil, errors.New("desired output length of pseudo-random function must not be negative")
+	}
+	et, err := crypto.GetEtype(key.KeyType)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, desiredOutputLen)
+	in := make([]byte, 4+len(prfIn))
+	copy(in[4:], prfIn)
+	for i := uint64(0); len(out) < desiredOutputLen; i++ {
+		if i > math.MaxUint32 {
+			return nil, errors.New("desired output length of pseudo-random function too large")
+		}
+		binary.BigEndian.PutUint32(in, uint32(i))
+		p, err := et.PRF(key.KeyValue, in)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p...)
+	}
+	return out[:desiredOutputLen], nil
+}
@@ -0,0 +1,58 @@
+package gssapi
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/etypeID"
+	"github.com/oiweiwei/gokrb5.fork/v9/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPseudoRandom(t *testing.T) {
+	t.Parallel()
+	// Output of the MIT implementation, in which the PRF+ counter starts at zero
+	var tests = []struct {
+		etype  int32
+		key    string
+		output string
+	}{
+		{etypeID.AES128_CTS_HMAC_SHA1_96, "9062430c8cda3388922e6d6a509f5b7a",
+			"7d5c906dddb9f08a53d77704e330aa0edcad4ad8e3788fd8548c2860c304b0d381a26f41e48ca28fd7b1690c"},
+		{etypeID.AES256_CTS_HMAC_SHA384_192, "6d404d37faf79f9df0d33568d320669800eb4836472ea8a026d16b7182460c52",
+			"808091c255cec846ee2970a4de48f90d05cefd34c4350ecd4ecd29df930c30683940002abb8d59b4b2e70bd6c52d354d88fba9c506e335f446b5bff76d9939f4"},
+	}
+	in := []byte("prf input")
+	for _, test := range tests {
+		k, _ := hex.DecodeString(test.key)
+		key := types.EncryptionKey{KeyType: test.etype, KeyValue: k}
+		out, err := PseudoRandom(key, in, len(test.output)/2)
+		if err != nil {
+			t.Fatalf("error calculating GSS pseudo-random output: %v", err)
+		}
+		assert.Equal(t, test.output, hex.EncodeToString(out), "pseudo-random output for etype %d not as expected", test.etype)
+	}
+
+	key := types.EncryptionKey{KeyType: etypeID.AES128_CTS_HMAC_SHA1_96, KeyValue: make([]byte, 16)}
+	out, err := PseudoRandom(key, in, 0)
+	if err != nil {
+		t.Fatalf("error calculating GSS pseudo-random output: %v", err)
+	}
+	assert.Empty(t, out)
+	_, err = PseudoRandom(key, in, -1)
+	assert.Error(t, err, "negative output length should be rejected")
+}
+
+func TestPRFKey(t *testing.T) {
+	t.Parallel()
+	session := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte("session")}
+	initiator := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte("initiator")}
+	acceptor := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte("acceptor")}
+	var none types.EncryptionKey
+
+	assert.Equal(t, acceptor, PRFKey(PRFKeyFull, session, initiator, acceptor))
+	assert.Equal(t, initiator, PRFKey(PRFKeyFull, session, initiator, none))
+	assert.Equal(t, session, PRFKey(PRFKeyFull, session, none, none))
+	assert.Equal(t, initiator, PRFKey(PRFKeyPartial, session, initiator, acceptor))
+	assert.Equal(t, session, PRFKey(PRFKeyPartial, session, none, acceptor))
+}
@@ -85,6 +85,8 @@ func EtypeSupported(etype string) int32 {
 		AES256_CTS_HMAC_SHA1_96,
 		AES128_CTS_HMAC_SHA256_128,
 		AES256_CTS_HMAC_SHA384_192,
+		CAMELLIA128_CTS_CMAC,
+		CAMELLIA256_CTS_CMAC,
 		DES3_CBC_SHA1_KD,
 		RC4_HMAC,
 		DES_CBC_MD5,
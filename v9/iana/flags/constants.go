@@ -20,8 +20,10 @@ const (
 	RequestAnonymous       = 12
 	TransitedPolicyChecked = 12
 	OKAsDelegate           = 13
+	Anonymous              = 14
 	EncPARep               = 15
 	Canonicalize           = 15
+	KDCOptionAnonymous     = 16
 	DisableTransitedCheck  = 26
 	RenewableOK            = 27
 	EncTktInSkey           = 28
@@ -33,4 +35,14 @@ const (
 	APOptionUseSessionKey  = 1
 	APOptionMutualRequired = 2
 	// 3-31 Reserved for future use.
+
+	// OTP Flags (RFC 6560)
+	// 0 Reserved.
+	OTPNextOTP             = 1
+	OTPCombine             = 2
+	OTPCollectPIN          = 3
+	OTPDoNotCollectPIN     = 4
+	OTPMustEncryptNonce    = 5
+	OTPSeparatePINRequired = 6
+	OTPCheckDigit          = 7
 )
@@ -0,0 +1,180 @@
+// Package adkeytab generates keytabs for Active Directory service accounts.
+//
+// A random password is set on the account using the set password protocol (RFC 3244) and the resulting key version
+// number is read back from the directory so that a keytab with the keys and salts Active Directory will use can be
+// created. This provides the functionality of the Windows ktpass tool.
+//
+// The package does not include a directory client: the account's attributes are read through a Directory
+// implementation provided by the caller, such as one using an LDAP library of their choice.
+package adkeytab
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/etypeID"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/nametype"
+	"github.com/oiweiwei/gokrb5.fork/v9/keytab"
+	"github.com/oiweiwei/gokrb5.fork/v9/types"
+)
+
+// Bit flags of the msDS-SupportedEncryptionTypes attribute (MS-KILE section 2.2.7).
+const (
+	SupportedEncTypeDesCbcCrc = 0x01
+	SupportedEncTypeDesCbcMd5 = 0x02
+	SupportedEncTypeRC4       = 0x04
+	SupportedEncTypeAES128    = 0x08
+	SupportedEncTypeAES256    = 0x10
+)
+
+// DefaultPasswordLength is the length of the random password set on the account if not otherwise specified.
+const DefaultPasswordLength = 64
+
+const passwordChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789!#%+-.:=?@_~"
+
+// Account holds the attributes of an Active Directory account needed to generate a keytab.
+type Account struct {
+	// SAMAccountName is the sAMAccountName attribute. Computer and managed service account names end with "$".
+	SAMAccountName string
+	// ServicePrincipalNames holds the servicePrincipalName attribute values.
+	ServicePrincipalNames []string
+	// KeyVersionNumber is the msDS-KeyVersionNumber attribute.
+	KeyVersionNumber uint32
+	// SupportedEncryptionTypes is the msDS-SupportedEncryptionTypes attribute.
+	SupportedEncryptionTypes uint32
+	// Computer indicates the account is a computer or group managed service account and so uses the computer account
+	// salt for its keys.
+	Computer bool
+}
+
+// Directory looks up accounts in Active Directory. No implementation is provided by this package; callers implement it
+// with the directory client they use, for example by reading the account's attributes over LDAP.
+type Directory interface {
+	// LookupAccount returns the attributes of the account with the sAMAccountName provided.
+	LookupAccount(samAccountName string) (Account, error)
+}
+
+// PasswordSetter sets the password of a principal. It is implemented by client.Client.
+type PasswordSetter interface {
+	SetPasswd(targName types.PrincipalName, targRealm, newPasswd string) (bool, error)
+}
+
+// Settings holds the optional settings for generating a keytab.
+type Settings struct {
+	// ETypes are the encryption types to generate keys for. If empty the types are taken from the account's
+	// msDS-SupportedEncryptionTypes attribute, or if that is not set AES256, AES128 and RC4 are used.
+	ETypes []int32
+	// PasswordLength is the length of the random password. DefaultPasswordLength is used if zero.
+	PasswordLength int
+	// Timestamp of the keytab entries. The current time is used if zero.
+	Timestamp time.Time
+}
+
+// Generate sets a new random password on the Active Directory account and returns a keytab holding its keys.
+// The keytab contains entries for the sAMAccountName and each of the account's service principal names.
+func Generate(ps PasswordSetter, dir Directory, realm, samAccountName string, s Settings) (*keytab.Keytab, error) {
+	if ps == nil || dir == nil {
+		return nil, errors.New("password setter and directory must be provided")
+	}
+	l := s.PasswordLength
+	if l == 0 {
+		l = DefaultPasswordLength
+	}
+	passwd, err := RandomPassword(l)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := ps.SetPasswd(types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, samAccountName), realm, passwd)
+	if !ok {
+		return nil, fmt.Errorf("error setting password of %s@%s: %v", samAccountName, realm, err)
+	}
+	// The kvno is read after the password is set as it is incremented by the domain controller.
+	acc, err := dir.LookupAccount(samAccountName)
+	if err != nil {
+		return nil, fmt.Errorf("error looking up account %s: %v", samAccountName, err)
+	}
+	return NewKeytab(acc, realm, passwd, s)
+}
+
+// NewKeytab returns a keytab holding the keys of the account derived from the password provided using the
+// salts Active Directory uses for the account type.
+func NewKeytab(acc Account, realm, passwd string, s Settings) (*keytab.Keytab, error) {
+	ets := s.ETypes
+	if len(ets) == 0 {
+		ets = ETypesFromSupported(acc.SupportedEncryptionTypes)
+	}
+	ts := s.Timestamp
+	if ts.IsZero() {
+		ts = time.Now().UTC()
+	}
+	realm = strings.ToUpper(realm)
+	salt := keytab.ADUserSalt(realm, acc.SAMAccountName)
+	if acc.Computer || strings.HasSuffix(acc.SAMAccountName, "$") {
+		salt = keytab.ADComputerSalt(realm, acc.SAMAccountName)
+	}
+	principals := append([]string{acc.SAMAccountName}, acc.ServicePrincipalNames...)
+	kt := keytab.New()
+	for _, p := range principals {
+		for _, et := range ets {
+			err := kt.AddEntryWithSalt(p, realm, passwd, salt, "", ts, acc.KeyVersionNumber, et)
+			if err != nil {
+				return nil, fmt.Errorf("error adding keytab entry for %s etype %d: %v", p, et, err)
+			}
+		}
+	}
+	return kt, nil
+}
+
+// ETypesFromSupported returns the encryption type IDs for the msDS-SupportedEncryptionTypes value provided,
+// strongest first. If no supported types are set AES256, AES128 and RC4 are returned.
+func ETypesFromSupported(supported uint32) []int32 {
+	var ets []int32
+	for _, t := range []struct {
+		flag uint32
+		id   int32
+	}{
+		{SupportedEncTypeAES256, etypeID.AES256_CTS_HMAC_SHA1_96},
+		{SupportedEncTypeAES128, etypeID.AES128_CTS_HMAC_SHA1_96},
+		{SupportedEncTypeRC4, etypeID.RC4_HMAC},
+		{SupportedEncTypeDesCbcMd5, etypeID.DES_CBC_MD5},
+		{SupportedEncTypeDesCbcCrc, etypeID.DES_CBC_CRC},
+	} {
+		if supported&t.flag != 0 {
+			ets = append(ets, t.id)
+		}
+	}
+	if len(ets) == 0 {
+		ets = []int32{etypeID.AES256_CTS_HMAC_SHA1_96, etypeID.AES128_CTS_HMAC_SHA1_96, etypeID.RC4_HMAC}
+	}
+	return ets
+}
+
+// RandomPassword returns a random password of the length provided that meets the Active Directory complexity
+// requirements of containing upper case, lower case, digit and symbol characters.
+func RandomPassword(length int) (string, error) {
+	if length < 4 {
+		return "", errors.New("password length must be at least 4")
+	}
+	b := make([]byte, length)
+	max := big.NewInt(int64(len(passwordChars)))
+	for {
+		for i := range b {
+			n, err := rand.Int(rand.Reader, max)
+			if err != nil {
+				return "", fmt.Errorf("error generating random password: %v", err)
+			}
+			b[i] = passwordChars[n.Int64()]
+		}
+		p := string(b)
+		if strings.ContainsAny(p, "abcdefghijklmnopqrstuvwxyz") &&
+			strings.ContainsAny(p, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") &&
+			strings.ContainsAny(p, "0123456789") &&
+			strings.ContainsAny(p, "!#%+-.:=?@_~") {
+			return p, nil
+		}
+	}
+}
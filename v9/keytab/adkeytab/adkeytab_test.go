@@ -0,0 +1,113 @@
+package adkeytab
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/oiweiwei/gokrb5.fork/v9/client"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/etypeID"
+	"github.com/oiweiwei/gokrb5.fork/v9/keytab"
+	"github.com/oiweiwei/gokrb5.fork/v9/types"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ PasswordSetter = (*client.Client)(nil)
+
+type fakeDirectory struct {
+	accounts map[string]Account
+}
+
+func (d *fakeDirectory) LookupAccount(samAccountName string) (Account, error) {
+	acc, ok := d.accounts[samAccountName]
+	if !ok {
+		return acc, errors.New("account not found")
+	}
+	return acc, nil
+}
+
+type fakeSetter struct {
+	dir    *fakeDirectory
+	passwd string
+	err    error
+}
+
+func (s *fakeSetter) SetPasswd(targName types.PrincipalName, targRealm, newPasswd string) (bool, error) {
+	if s.err != nil {
+		return false, s.err
+	}
+	s.passwd = newPasswd
+	acc := s.dir.accounts[targName.PrincipalNameString()]
+	acc.KeyVersionNumber++
+	s.dir.accounts[targName.PrincipalNameString()] = acc
+	return true, nil
+}
+
+func TestGenerate(t *testing.T) {
+	t.Parallel()
+	dir := &fakeDirectory{accounts: map[string]Account{
+		"WEB01$": {
+			SAMAccountName:           "WEB01$",
+			ServicePrincipalNames:    []string{"HTTP/web01.example.com"},
+			KeyVersionNumber:         299,
+			SupportedEncryptionTypes: SupportedEncTypeAES256 | SupportedEncTypeAES128,
+			Computer:                 true,
+		},
+	}}
+	ps := &fakeSetter{dir: dir}
+	ts := time.Unix(1583234434, 0)
+	kt, err := Generate(ps, dir, "example.com", "WEB01$", Settings{Timestamp: ts})
+	if err != nil {
+		t.Fatalf("error generating keytab: %v", err)
+	}
+	assert.Equal(t, DefaultPasswordLength, len(ps.passwd), "password length not as expected")
+	assert.Equal(t, 4, len(kt.Entries), "number of keytab entries not as expected")
+
+	expected := keytab.New()
+	for _, p := range []string{"WEB01$", "HTTP/web01.example.com"} {
+		for _, et := range []int32{etypeID.AES256_CTS_HMAC_SHA1_96, etypeID.AES128_CTS_HMAC_SHA1_96} {
+			expected.AddEntryWithSalt(p, "EXAMPLE.COM", ps.passwd, "EXAMPLE.COMhostweb01.example.com", "", ts, 300, et)
+		}
+	}
+	assert.Equal(t, expected.Entries, kt.Entries, "keytab entries not as expected")
+
+	ps.err = errors.New("access denied")
+	if _, err := Generate(ps, dir, "EXAMPLE.COM", "WEB01$", Settings{}); err == nil {
+		t.Error("should have errored when the password could not be set")
+	}
+}
+
+func TestNewKeytab_UserAccount(t *testing.T) {
+	t.Parallel()
+	ts := time.Unix(1583234434, 0)
+	kt, err := NewKeytab(Account{SAMAccountName: "svc-http", KeyVersionNumber: 3}, "EXAMPLE.COM", "Passw0rd!", Settings{Timestamp: ts})
+	if err != nil {
+		t.Fatalf("error generating keytab: %v", err)
+	}
+	expected := keytab.New()
+	for _, et := range []int32{etypeID.AES256_CTS_HMAC_SHA1_96, etypeID.AES128_CTS_HMAC_SHA1_96, etypeID.RC4_HMAC} {
+		expected.AddEntryWithSalt("svc-http", "EXAMPLE.COM", "Passw0rd!", "EXAMPLE.COMsvc-http", "", ts, 3, et)
+	}
+	assert.Equal(t, expected.Entries, kt.Entries, "keytab entries not as expected")
+}
+
+func TestETypesFromSupported(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, []int32{etypeID.AES256_CTS_HMAC_SHA1_96, etypeID.AES128_CTS_HMAC_SHA1_96, etypeID.RC4_HMAC}, ETypesFromSupported(0))
+	assert.Equal(t, []int32{etypeID.AES256_CTS_HMAC_SHA1_96}, ETypesFromSupported(SupportedEncTypeAES256))
+	assert.Equal(t, []int32{etypeID.RC4_HMAC, etypeID.DES_CBC_MD5}, ETypesFromSupported(SupportedEncTypeRC4|SupportedEncTypeDesCbcMd5))
+}
+
+func TestRandomPassword(t *testing.T) {
+	t.Parallel()
+	p1, err := RandomPassword(20)
+	if err != nil {
+		t.Fatalf("error generating password: %v", err)
+	}
+	p2, _ := RandomPassword(20)
+	assert.Equal(t, 20, len(p1), "password length not as expected")
+	assert.NotEqual(t, p1, p2, "passwords should be random")
+	if _, err := RandomPassword(3); err == nil {
+		t.Error("should have errored for a short password")
+	}
+}
@@ -28,6 +28,7 @@ type Keytab struct {
 }
 
 // Keytab entry struct.
+// KVNO holds the full 32-bit key version number and takes precedence over KVNO8 when the entry is marshaled.
 type Entry struct {
 	Principal Principal
 	Timestamp time.Time
@@ -98,6 +99,22 @@ func (kt *Keytab) GetEncryptionKey(princName types.PrincipalName, realm string,
 	return key, kv, nil
 }
 
+// KeyProvider provides the long-term keys of principals as opaque keys. The Keytab is the only implementation
+// provided.
+type KeyProvider interface {
+	GetKey(princName types.PrincipalName, realm string, kvno int, etype int32) (crypto.Key, error)
+}
+
+// GetKey returns the key from the Keytab for the newest entry with the required kvno, etype and matching principal
+// as an opaque key so the Keytab can be used as a KeyProvider.
+func (kt *Keytab) GetKey(princName types.PrincipalName, realm string, kvno int, etype int32) (crypto.Key, error) {
+	key, _, err := kt.GetEncryptionKey(princName, realm, kvno, etype)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.NewKey(key), nil
+}
+
 // Create a new Keytab entry.
 func NewEntry() Entry {
 	var b []byte
@@ -113,6 +130,13 @@ func NewEntry() Entry {
 	}
 }
 
+// SetKVNO sets the key version number of the entry.
+// As with MIT Kerberos the 8-bit kvno field holds the low order byte of the 32-bit kvno.
+func (e *Entry) SetKVNO(kvno uint32) {
+	e.KVNO = kvno
+	e.KVNO8 = uint8(kvno)
+}
+
 func (kt Keytab) String() string {
 	var s string
 	s = `KVNO Timestamp         Principal                                                ET Key
@@ -126,19 +150,36 @@ func (kt Keytab) String() string {
 
 // AddEntry adds an entry to the keytab. The password should be provided in plain text and it will be converted using the defined enctype to be stored.
 func (kt *Keytab) AddEntry(principalName, realm, password string, ts time.Time, KVNO uint8, encType int32) error {
+	princ, _ := types.ParseSPNString(principalName)
+	return kt.AddEntryWithSalt(principalName, realm, password, princ.GetSalt(realm), "", ts, uint32(KVNO), encType)
+}
+
+// AddEntryWithSalt adds an entry to the keytab deriving the key from the plain text password using the salt and
+// string-to-key parameters provided rather than the defaults for the principal.
+// If s2kparams is empty the default string-to-key parameters of the enctype are used.
+// The full 32-bit kvno is taken so that key version numbers above 255, as are common in Active Directory, are preserved.
+func (kt *Keytab) AddEntryWithSalt(principalName, realm, password, salt, s2kparams string, ts time.Time, KVNO uint32, encType int32) error {
 	// Generate a key from the password
 	princ, _ := types.ParseSPNString(principalName)
-	key, _, err := crypto.GetKeyFromPassword(password, princ, realm, encType, types.PADataSequence{})
+	et, err := crypto.GetEtype(encType)
 	if err != nil {
-		return err
+		return fmt.Errorf("error getting encryption type: %v", err)
+	}
+	if s2kparams == "" {
+		s2kparams = et.GetDefaultStringToKeyParams()
+	}
+	k, err := et.StringToKey(password, salt, s2kparams)
+	if err != nil {
+		return fmt.Errorf("error deriving key from string: %v", err)
+	}
+	key := types.EncryptionKey{
+		KeyType:  encType,
+		KeyValue: k,
 	}
 
 	// Populate the keytab entry principal
 	ktep := NewPrincipal()
 	ktep.NumComponents = int16(len(princ.NameString))
-	if kt.Version == 1 {
-		ktep.NumComponents += 1
-	}
 
 	ktep.Realm = realm
 	ktep.Components = princ.NameString
@@ -148,8 +189,7 @@ func (kt *Keytab) AddEntry(principalName, realm, password string, ts time.Time,
 	e := NewEntry()
 	e.Principal = ktep
 	e.Timestamp = ts
-	e.KVNO8 = KVNO
-	e.KVNO = uint32(KVNO)
+	e.SetKVNO(KVNO)
 	e.Key = key
 
 	kt.Entries = append(kt.Entries, e)
@@ -179,7 +219,11 @@ func Load(ktPath string) (*Keytab, error) {
 }
 
 // Marshal keytab into byte slice
+// Version 1 keytabs are written in the native byte order of the host, version 2 keytabs in big-endian byte order.
 func (kt *Keytab) Marshal() ([]byte, error) {
+	if kt.Version != 1 && kt.Version != 2 {
+		return nil, fmt.Errorf("invalid keytab version %d. Keytab version must be 1 or 2", kt.Version)
+	}
 	b := []byte{keytabFirstByte, kt.Version}
 	for _, e := range kt.Entries {
 		eb, err := e.Marshal(int(kt.Version))
@@ -247,7 +291,10 @@ func (kt *Keytab) Unmarshal(b []byte) error {
 			// p keeps track as to where we are in the byte stream
 			var p int
 			var err error
-			parsePrincipal(eb, &p, kt, &ke, &endian)
+			err = parsePrincipal(eb, &p, kt, &ke, &endian)
+			if err != nil {
+				return err
+			}
 			ke.Timestamp, err = readTimestamp(eb, &p, &endian)
 			if err != nil {
 				return err
@@ -303,6 +350,9 @@ func (kt *Keytab) Unmarshal(b []byte) error {
 	return nil
 }
 
+// Marshal the keytab entry into a byte slice for the keytab format version provided.
+// The 32-bit kvno is always appended to the entry. If KVNO is zero KVNO8 is used for both kvno fields,
+// otherwise the 8-bit field is set to the low order byte of KVNO as MIT Kerberos does.
 func (e Entry) Marshal(v int) ([]byte, error) {
 	var b []byte
 	pb, err := e.Principal.Marshal(v)
@@ -317,9 +367,14 @@ func (e Entry) Marshal(v int) ([]byte, error) {
 		endian = binary.LittleEndian
 	}
 
+	kvno := e.KVNO
+	if kvno == 0 {
+		kvno = uint32(e.KVNO8)
+	}
+
 	t := make([]byte, 9)
 	endian.PutUint32(t[0:4], uint32(e.Timestamp.Unix()))
-	t[4] = e.KVNO8
+	t[4] = uint8(kvno)
 	endian.PutUint16(t[5:7], uint16(e.Key.KeyType))
 	endian.PutUint16(t[7:9], uint16(len(e.Key.KeyValue)))
 	b = append(b, t...)
@@ -332,7 +387,7 @@ func (e Entry) Marshal(v int) ([]byte, error) {
 	b = append(b, buf.Bytes()...)
 
 	t = make([]byte, 4)
-	endian.PutUint32(t, e.KVNO)
+	endian.PutUint32(t, kvno)
 	b = append(b, t...)
 
 	// Add the length header
@@ -391,7 +446,12 @@ func (p Principal) Marshal(v int) ([]byte, error) {
 	if v == 1 && isNativeEndianLittle() {
 		endian = binary.LittleEndian
 	}
-	endian.PutUint16(b[0:], uint16(p.NumComponents))
+	// The number of components is taken from the components themselves. In version 1 the count includes the realm.
+	n := len(p.Components)
+	if v == 1 {
+		n++
+	}
+	endian.PutUint16(b[0:], uint16(n))
 	realm, err := marshalString(p.Realm, v)
 	if err != nil {
 		return b, err
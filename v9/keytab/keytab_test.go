@@ -249,3 +249,129 @@ func TestKeytab_GetEncryptionKey(t *testing.T) {
 	}
 	assert.Equal(t, 3, kvno)
 }
+
+func TestKeytab_AddEntryWithSalt(t *testing.T) {
+	t.Parallel()
+	// Test vectors from RFC 3962 Appendix B
+	var tests = []struct {
+		iterations string
+		salt       string
+		key        string
+	}{
+		{"00000001", "ATHENA.MIT.EDUraeburn", "42263c6e89f4fc28b8df68ee09799f15"},
+		{"00000002", "ATHENA.MIT.EDUraeburn", "c651bf29e2300ac27fa469d693bdda13"},
+		{"000004b0", "ATHENA.MIT.EDUraeburn", "4c01cd46d632d01e6dbe230a01ed642a"},
+	}
+	kt := New()
+	for i, test := range tests {
+		err := kt.AddEntryWithSalt("raeburn", "ATHENA.MIT.EDU", "password", test.salt, test.iterations, time.Unix(100, 0), 1, etypeID.AES128_CTS_HMAC_SHA1_96)
+		if err != nil {
+			t.Fatalf("error adding entry %d: %v", i, err)
+		}
+		assert.Equal(t, test.key, hex.EncodeToString(kt.Entries[i].Key.KeyValue), "key not as expected for test %d", i)
+	}
+
+	// The default salt and s2kparams should give the same key as AddEntry
+	princ := "HTTP/www.example.org"
+	pn, _ := types.ParseSPNString(princ)
+	kt = New()
+	kt.AddEntry(princ, "EXAMPLE.ORG", "hello456", time.Unix(100, 0), 1, etypeID.AES256_CTS_HMAC_SHA1_96)
+	err := kt.AddEntryWithSalt(princ, "EXAMPLE.ORG", "hello456", pn.GetSalt("EXAMPLE.ORG"), "", time.Unix(100, 0), 1, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("error adding entry: %v", err)
+	}
+	assert.Equal(t, kt.Entries[0], kt.Entries[1], "entries with default salt not as expected")
+
+	if err := kt.AddEntryWithSalt(princ, "EXAMPLE.ORG", "hello456", "", "", time.Unix(100, 0), 1, 0); err == nil {
+		t.Error("should have errored for an unknown enctype")
+	}
+}
+
+func TestADSalts(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "EXAMPLE.COMjsmith", ADUserSalt("example.com", "jsmith"), "user salt not as expected")
+	assert.Equal(t, "EXAMPLE.COMJSmith", ADUserSalt("EXAMPLE.COM", "JSmith"), "user salt should preserve case")
+	assert.Equal(t, "EXAMPLE.COMhostweb01.example.com", ADComputerSalt("EXAMPLE.COM", "WEB01$"), "computer salt not as expected")
+	assert.Equal(t, "EXAMPLE.COMhostweb01.example.com", ADComputerSalt("example.com", "web01"), "computer salt not as expected")
+	assert.Equal(t, "EXAMPLE.COMhostgmsa-svc.example.com", ADManagedServiceAccountSalt("EXAMPLE.COM", "gMSA-svc$"), "gMSA salt not as expected")
+}
+
+func TestMarshalVersion1(t *testing.T) {
+	t.Parallel()
+	kt := New()
+	kt.Version = 1
+	err := kt.AddEntry("HTTP/www.example.org", "EXAMPLE.ORG", "hello456", time.Unix(1583234434, 0), 10, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("error adding entry: %v", err)
+	}
+	b, err := kt.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling: %v", err)
+	}
+	assert.Equal(t, []byte{5, 1}, b[:2], "keytab header not as expected")
+
+	var endian binary.ByteOrder = binary.BigEndian
+	if isNativeEndianLittle() {
+		endian = binary.LittleEndian
+	}
+	// In version 1 the component count includes the realm and is in native byte order.
+	assert.Equal(t, uint16(3), endian.Uint16(b[6:8]), "component count not as expected")
+
+	kt2 := new(Keytab)
+	err = kt2.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("error unmarshaling: %v", err)
+	}
+	assert.Equal(t, uint8(1), kt2.Version, "keytab version not as expected")
+	assert.Equal(t, int16(2), kt2.Entries[0].Principal.NumComponents, "number of components not as expected")
+	assert.Equal(t, []string{"HTTP", "www.example.org"}, kt2.Entries[0].Principal.Components, "components not as expected")
+	assert.Equal(t, kt.Entries[0].Key, kt2.Entries[0].Key, "key not as expected")
+	assert.Equal(t, uint32(10), kt2.Entries[0].KVNO, "kvno not as expected")
+
+	mb, err := kt2.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling: %v", err)
+	}
+	assert.Equal(t, b, mb, "marshaled bytes not the same as input bytes")
+}
+
+func TestMarshalExtendedKVNO(t *testing.T) {
+	t.Parallel()
+	for _, v := range []uint8{1, 2} {
+		kt := New()
+		kt.Version = v
+		err := kt.AddEntryWithSalt("svc", "EXAMPLE.COM", "password", ADUserSalt("EXAMPLE.COM", "svc"), "", time.Unix(1583234434, 0), 300, etypeID.AES256_CTS_HMAC_SHA1_96)
+		if err != nil {
+			t.Fatalf("error adding entry: %v", err)
+		}
+		assert.Equal(t, uint8(44), kt.Entries[0].KVNO8, "8-bit kvno should be the low order byte of the kvno")
+		b, err := kt.Marshal()
+		if err != nil {
+			t.Fatalf("error marshaling: %v", err)
+		}
+		kt2 := new(Keytab)
+		err = kt2.Unmarshal(b)
+		if err != nil {
+			t.Fatalf("error unmarshaling: %v", err)
+		}
+		assert.Equal(t, uint32(300), kt2.Entries[0].KVNO, "kvno not as expected for version %d", v)
+		assert.Equal(t, uint8(44), kt2.Entries[0].KVNO8, "8-bit kvno not as expected for version %d", v)
+		assert.Equal(t, kt.Entries[0].Key, kt2.Entries[0].Key, "key not as expected for version %d", v)
+	}
+
+	// Entries with only the 8-bit kvno set write it to both kvno fields.
+	e := NewEntry()
+	e.Principal.Realm = "EXAMPLE.COM"
+	e.Principal.Components = []string{"svc"}
+	e.KVNO8 = 7
+	b, err := e.Marshal(2)
+	if err != nil {
+		t.Fatalf("error marshaling entry: %v", err)
+	}
+	assert.Equal(t, uint32(7), binary.BigEndian.Uint32(b[len(b)-4:]), "32-bit kvno not as expected")
+
+	kt := &Keytab{Version: 3}
+	if _, err := kt.Marshal(); err == nil {
+		t.Error("should have errored for invalid keytab version")
+	}
+}
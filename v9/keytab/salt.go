@@ -0,0 +1,29 @@
+package keytab
+
+import (
+	"strings"
+)
+
+// Active Directory does not use the RFC 4120 default salt (realm followed by the principal name components) for all
+// account types. The salt is instead derived from the account's sAMAccountName as described in MS-KILE section 3.1.1.2:
+// https://learn.microsoft.com/en-us/openspecs/windows_protocols/ms-kile/
+
+// ADUserSalt returns the salt used by Active Directory for the keys of a user account.
+// The salt is the upper-case realm followed by the sAMAccountName with its case preserved.
+func ADUserSalt(realm, samAccountName string) string {
+	return strings.ToUpper(realm) + samAccountName
+}
+
+// ADComputerSalt returns the salt used by Active Directory for the keys of a computer account.
+// The salt is the upper-case realm followed by "host" and the lower-case "<name>.<domain>" where name is the
+// sAMAccountName without the trailing "$".
+func ADComputerSalt(realm, samAccountName string) string {
+	name := strings.ToLower(strings.TrimSuffix(samAccountName, "$"))
+	return strings.ToUpper(realm) + "host" + name + "." + strings.ToLower(realm)
+}
+
+// ADManagedServiceAccountSalt returns the salt used by Active Directory for the keys of a group managed service
+// account (gMSA). These accounts are salted in the same way as computer accounts.
+func ADManagedServiceAccountSalt(realm, samAccountName string) string {
+	return ADComputerSalt(realm, samAccountName)
+}
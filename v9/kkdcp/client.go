@@ -0,0 +1,48 @@
+package kkdcp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Post sends the Kerberos message for the KDCs of the realm to the KDC proxy at the URL provided and returns the
+// Kerberos message replied by the KDC. If the HTTP client is nil http.DefaultClient is used.
+func Post(ctx context.Context, hc *http.Client, proxyURL, realm string, b []byte) ([]byte, error) {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	m := NewMessage(realm, b)
+	mb, err := m.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling KDC proxy message: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, proxyURL, bytes.NewReader(mb))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request to KDC proxy %s: %v", proxyURL, err)
+	}
+	req.Header.Set("Content-Type", ContentType)
+	req.Header.Set("Cache-Control", "no-cache")
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending to KDC proxy %s: %v", proxyURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("KDC proxy %s responded with status %s", proxyURL, resp.Status)
+	}
+	rb, err := io.ReadAll(io.LimitReader(resp.Body, maxMessageSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("error reading response from KDC proxy %s: %v", proxyURL, err)
+	}
+	if len(rb) > maxMessageSize {
+		return nil, fmt.Errorf("response from KDC proxy %s is too large", proxyURL)
+	}
+	var r Message
+	if err := r.Unmarshal(rb); err != nil {
+		return nil, fmt.Errorf("error unmarshaling response from KDC proxy %s: %v", proxyURL, err)
+	}
+	return r.KerberosMessage()
+}
@@ -0,0 +1,208 @@
+package kkdcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/oiweiwei/gokrb5.fork/v9/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessage_MarshalUnmarshal(t *testing.T) {
+	t.Parallel()
+	m := NewMessage("TEST.GOKRB5", []byte("AS_REQ"))
+	assert.Equal(t, []byte{0, 0, 0, 6}, m.KerbMessage[:4], "length prefix not as expected")
+	b, err := m.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling KDC proxy message: %v", err)
+	}
+	var u Message
+	if err := u.Unmarshal(b); err != nil {
+		t.Fatalf("error unmarshaling KDC proxy message: %v", err)
+	}
+	assert.Equal(t, "TEST.GOKRB5", u.TargetDomain)
+	km, err := u.KerberosMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("AS_REQ"), km)
+
+	u.KerbMessage = u.KerbMessage[:5]
+	_, err = u.KerberosMessage()
+	assert.Error(t, err, "length prefix mismatch should be an error")
+}
+
+// testKDCDialer connects to a fake KDC that replies to a request over TCP with the request reversed.
+type testKDCDialer struct {
+	dialed []string
+}
+
+func (d *testKDCDialer) Dial(network, address string) (net.Conn, error) {
+	d.dialed = append(d.dialed, network+"/"+address)
+	c, s := net.Pipe()
+	go func() {
+		defer s.Close()
+		h := make([]byte, 4)
+		if _, err := io.ReadFull(s, h); err != nil {
+			return
+		}
+		b := make([]byte, binary.BigEndian.Uint32(h))
+		if _, err := io.ReadFull(s, b); err != nil {
+			return
+		}
+		for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+			b[i], b[j] = b[j], b[i]
+		}
+		s.Write(append(h, b...))
+	}()
+	return c, nil
+}
+
+// asReq is a minimal message with the application tag of an AS_REQ.
+var asReq = []byte{0x6a, 0x02, 0x30, 0x00}
+
+func reversed(b []byte) []byte {
+	r := make([]byte, len(b))
+	for i := range b {
+		r[len(b)-1-i] = b[i]
+	}
+	return r
+}
+
+func TestProxy(t *testing.T) {
+	t.Parallel()
+	c := config.New()
+	c.Realms = []config.Realm{
+		{Realm: "TEST.GOKRB5", KDC: []string{"kdc.test.gokrb5:88"}},
+		{Realm: "OTHER.GOKRB5", KDC: []string{"kdc.other.gokrb5:88"}},
+	}
+	d := new(testKDCDialer)
+	s := httptest.NewTLSServer(NewProxy(c, Dialer(d), Realms("TEST.GOKRB5")))
+	defer s.Close()
+
+	rb, err := Post(context.Background(), s.Client(), s.URL, "TEST.GOKRB5", asReq)
+	if assert.NoError(t, err) {
+		assert.Equal(t, reversed(asReq), rb, "reply from the KDC not returned")
+	}
+	assert.Equal(t, []string{"tcp/kdc.test.gokrb5:88"}, d.dialed)
+
+	_, err = Post(context.Background(), s.Client(), s.URL, "OTHER.GOKRB5", asReq)
+	assert.Error(t, err, "realm not permitted should be an error")
+	_, err = Post(context.Background(), s.Client(), s.URL, "", asReq)
+	assert.Error(t, err, "message without a realm should be an error")
+	_, err = Post(context.Background(), s.Client(), s.URL, "TEST.GOKRB5", []byte("GET / HTTP/1.0\r\n\r\n"))
+	assert.Error(t, err, "message that is not a Kerberos request should be an error")
+	_, err = Post(context.Background(), s.Client(), s.URL, "TEST.GOKRB5", []byte{0x6b, 0x02, 0x30, 0x00})
+	assert.Error(t, err, "AS_REP should not be forwarded")
+	assert.Equal(t, []string{"tcp/kdc.test.gokrb5:88"}, d.dialed, "messages rejected should not be forwarded")
+
+	resp, err := s.Client().Post(s.URL, ContentType, bytes.NewReader([]byte("not a KDC proxy message")))
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	}
+	resp, err = s.Client().Get(s.URL)
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	}
+}
+
+func TestProxy_Realms(t *testing.T) {
+	t.Parallel()
+	c := config.New()
+	c.Realms = []config.Realm{{Realm: "TEST.GOKRB5", KDC: []string{"kdc.test.gokrb5:88"}}}
+	d := new(testKDCDialer)
+	s := httptest.NewTLSServer(NewProxy(c, Dialer(d)))
+	defer s.Close()
+
+	_, err := Post(context.Background(), s.Client(), s.URL, "TEST.GOKRB5", asReq)
+	assert.NoError(t, err, "configured realm should be permitted by default")
+	resp, err := s.Client().Post(s.URL, ContentType, bytes.NewReader(mustMarshal(t, NewMessage("EVIL.EXAMPLE", asReq))))
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode, "realm not in the configuration should not be permitted by default")
+	}
+
+	// Realms located with DNS are permitted when enabled, here failing as there are no KDCs to be found
+	p := NewProxy(c, Dialer(d), DNSRealms())
+	assert.True(t, p.permitted("EVIL.EXAMPLE"), "realm not in the configuration should be permitted with DNSRealms")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(mustMarshal(t, NewMessage("EVIL.EXAMPLE", asReq)))))
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Equal(t, []string{"tcp/kdc.test.gokrb5:88"}, d.dialed)
+}
+
+func TestProxy_Kpasswd(t *testing.T) {
+	t.Parallel()
+	c := config.New()
+	c.Realms = []config.Realm{{Realm: "TEST.GOKRB5", KDC: []string{"kdc.test.gokrb5:88"}, KPasswdServer: []string{"kpasswd.test.gokrb5:464"}}}
+	d := new(testKDCDialer)
+	s := httptest.NewTLSServer(NewProxy(c, Dialer(d)))
+	defer s.Close()
+
+	apReq := []byte{0x6e, 0x02, 0x30, 0x00}
+	priv := []byte{0x75, 0x02, 0x30, 0x00}
+	b := []byte{0, byte(6 + len(apReq) + len(priv)), 0xff, 0x80, 0, byte(len(apReq))}
+	b = append(append(b, apReq...), priv...)
+	_, err := Post(context.Background(), s.Client(), s.URL, "TEST.GOKRB5", b)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tcp/kpasswd.test.gokrb5:464"}, d.dialed, "kpasswd request should be sent to the kpasswd server")
+
+	b[6] = 0x6a
+	_, err = Post(context.Background(), s.Client(), s.URL, "TEST.GOKRB5", b)
+	assert.Error(t, err, "kpasswd request without an AP_REQ should be an error")
+}
+
+// hangingDialer connects to a KDC that never replies.
+type hangingDialer struct {
+	closed chan struct{}
+}
+
+func (d *hangingDialer) Dial(network, address string) (net.Conn, error) {
+	c, s := net.Pipe()
+	go func() {
+		io.Copy(io.Discard, s)
+		close(d.closed)
+	}()
+	return c, nil
+}
+
+func TestProxy_ClientDisconnect(t *testing.T) {
+	t.Parallel()
+	c := config.New()
+	c.Realms = []config.Realm{{Realm: "TEST.GOKRB5", KDC: []string{"kdc.test.gokrb5:88"}}}
+	d := &hangingDialer{closed: make(chan struct{})}
+	p := NewProxy(c, Dialer(d))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(mustMarshal(t, NewMessage("TEST.GOKRB5", asReq)))).WithContext(ctx)
+	w := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		p.ServeHTTP(w, r)
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("exchange with the KDC not abandoned when the client disconnected")
+	}
+	<-d.closed
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+}
+
+func mustMarshal(t *testing.T, m Message) []byte {
+	b, err := m.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling KDC proxy message: %v", err)
+	}
+	return b
+}
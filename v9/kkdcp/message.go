@@ -0,0 +1,63 @@
+// Package kkdcp implements the Kerberos KDC proxy protocol (MS-KKDCP), which carries Kerberos messages to a KDC over
+// HTTPS. It provides the client side used to send messages through a KDC proxy and a KDC proxy http.Handler.
+package kkdcp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+)
+
+// ContentType is the HTTP content type of KDC proxy messages.
+const ContentType = "application/kerberos"
+
+// maxMessageSize is the largest KDC proxy message accepted.
+const maxMessageSize = 1 << 20
+
+// Message is the KDC-PROXY-MESSAGE of MS-KKDCP section 2.2.2.
+//
+//	KDC-PROXY-MESSAGE ::= SEQUENCE {
+//		kerb-message   [0] OCTET STRING,
+//		target-domain  [1] KERB-REALM OPTIONAL,
+//		dclocator-hint [2] INTEGER OPTIONAL
+//	}
+type Message struct {
+	// KerbMessage is the Kerberos message with the 4 octet length prefix used when it is sent over TCP.
+	KerbMessage   []byte `asn1:"explicit,tag:0"`
+	TargetDomain  string `asn1:"optional,generalstring,explicit,tag:1"`
+	DCLocatorHint int    `asn1:"optional,explicit,tag:2"`
+}
+
+// NewMessage creates a new KDC proxy message carrying the Kerberos message for the KDCs of the realm.
+func NewMessage(realm string, b []byte) Message {
+	km := make([]byte, 4, len(b)+4)
+	binary.BigEndian.PutUint32(km, uint32(len(b)))
+	return Message{
+		KerbMessage:  append(km, b...),
+		TargetDomain: realm,
+	}
+}
+
+// Marshal the KDC proxy message.
+func (m *Message) Marshal() ([]byte, error) {
+	return asn1.Marshal(*m)
+}
+
+// Unmarshal bytes into the KDC proxy message.
+func (m *Message) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, m)
+	return err
+}
+
+// KerberosMessage returns the Kerberos message carried, without its length prefix.
+func (m *Message) KerberosMessage() ([]byte, error) {
+	if len(m.KerbMessage) < 4 {
+		return nil, errors.New("KDC proxy message does not contain a Kerberos message")
+	}
+	if l := binary.BigEndian.Uint32(m.KerbMessage[:4]); int(l) != len(m.KerbMessage)-4 {
+		return nil, fmt.Errorf("length of the Kerberos message (%d) does not match the length prefix (%d)", len(m.KerbMessage)-4, l)
+	}
+	return m.KerbMessage[4:], nil
+}
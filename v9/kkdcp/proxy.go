@@ -0,0 +1,279 @@
+package kkdcp
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/oiweiwei/gokrb5.fork/v9/config"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/asnAppTag"
+)
+
+// KDCDialer establishes the connections to the KDCs the proxy forwards messages to.
+type KDCDialer interface {
+	Dial(network, address string) (net.Conn, error)
+}
+
+// Proxy is a KDC proxy (MS-KKDCP) http.Handler. The Kerberos messages POSTed to it are forwarded over TCP to the KDCs
+// of the realm in the message's target-domain, as located by the configuration, and the KDC's reply is returned.
+// Only AS and TGS requests, which are forwarded to the KDCs, and kpasswd requests, which are forwarded to the kpasswd
+// servers of the realm, are accepted. The proxy is expected to be served over HTTPS.
+type Proxy struct {
+	config *config.Config
+	dialer KDCDialer
+	logger *log.Logger
+	realms map[string]bool
+	dns    bool
+}
+
+// NewProxy creates a new KDC proxy forwarding messages to the KDCs located by the configuration provided.
+//
+// p := kkdcp.NewProxy(cfg, kkdcp.Realms("EXAMPLE.COM"))
+// http.Handle("/KdcProxy", p)
+func NewProxy(c *config.Config, settings ...func(*Proxy)) *Proxy {
+	p := &Proxy{config: c}
+	for _, set := range settings {
+		set(p)
+	}
+	return p
+}
+
+// Realms used to configure the proxy to only forward messages for the realms provided. By default messages are
+// forwarded for the realms that have a subsection in the [realms] section of the configuration.
+//
+// p := NewProxy(cfg, Realms("EXAMPLE.COM"))
+func Realms(realms ...string) func(*Proxy) {
+	return func(p *Proxy) {
+		p.realms = make(map[string]bool)
+		for _, r := range realms {
+			p.realms[r] = true
+		}
+	}
+}
+
+// DNSRealms used to configure the proxy to also forward messages for realms that are not in the configuration, whose
+// KDCs are located with DNS if dns_lookup_kdc is enabled. As the target realm is chosen by the client this permits
+// clients to have messages forwarded to any host published in the DNS of a domain, so it should only be enabled if
+// that is intended.
+//
+// p := NewProxy(cfg, DNSRealms())
+func DNSRealms() func(*Proxy) {
+	return func(p *Proxy) {
+		p.dns = true
+	}
+}
+
+// Dialer used to configure the proxy with a custom dialer for connections to the KDCs.
+//
+// p := NewProxy(cfg, Dialer(&net.Dialer{Timeout: 10 * time.Second}))
+func Dialer(d KDCDialer) func(*Proxy) {
+	return func(p *Proxy) {
+		p.dialer = d
+	}
+}
+
+// Logger used to configure the proxy with a logger.
+//
+// p := NewProxy(cfg, Logger(l))
+func Logger(l *log.Logger) func(*Proxy) {
+	return func(p *Proxy) {
+		p.logger = l
+	}
+}
+
+// ServeHTTP implements the http.Handler interface for the KDC proxy.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	b, err := io.ReadAll(io.LimitReader(r.Body, maxMessageSize+1))
+	if err != nil {
+		p.log("error reading request from %s: %v", r.RemoteAddr, err)
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if len(b) > maxMessageSize {
+		http.Error(w, "request too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	var m Message
+	if err := m.Unmarshal(b); err != nil {
+		p.log("invalid KDC proxy message from %s: %v", r.RemoteAddr, err)
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	km, err := m.KerberosMessage()
+	if err != nil {
+		p.log("invalid KDC proxy message from %s: %v", r.RemoteAddr, err)
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	kpasswd, err := requestType(km)
+	if err != nil {
+		p.log("invalid KDC proxy message from %s: %v", r.RemoteAddr, err)
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	realm := strings.TrimSpace(m.TargetDomain)
+	if realm == "" {
+		p.log("KDC proxy message from %s does not specify the target realm", r.RemoteAddr)
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if !p.permitted(realm) {
+		p.log("KDC proxy message from %s for realm %s not permitted", r.RemoteAddr, realm)
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	rb, err := p.forward(r.Context(), realm, kpasswd, m.KerbMessage)
+	if err != nil {
+		p.log("error forwarding KDC proxy message from %s to realm %s: %v", r.RemoteAddr, realm, err)
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+		return
+	}
+	resp := Message{KerbMessage: rb}
+	mb, err := resp.Marshal()
+	if err != nil {
+		p.log("error marshaling KDC proxy response: %v", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(mb)
+}
+
+// permitted indicates if messages are forwarded for the realm.
+func (p *Proxy) permitted(realm string) bool {
+	if p.realms != nil && !p.realms[realm] {
+		return false
+	}
+	if p.dns {
+		return true
+	}
+	for _, r := range p.config.Realms {
+		if r.Realm == realm {
+			return true
+		}
+	}
+	return false
+}
+
+// requestType checks that the Kerberos message is an AS or TGS request, or a kpasswd request (RFC 3244), and
+// indicates if it is a kpasswd request.
+func requestType(b []byte) (bool, error) {
+	if isApplication(b, asnAppTag.ASREQ, asnAppTag.TGSREQ) {
+		return false, nil
+	}
+	// A kpasswd request is the message length, the protocol version, the length of the AP_REQ and the AP_REQ followed
+	// by a KRB_PRIV.
+	if len(b) > 6 && int(binary.BigEndian.Uint16(b[0:2])) == len(b) {
+		v := binary.BigEndian.Uint16(b[2:4])
+		l := int(binary.BigEndian.Uint16(b[4:6]))
+		if (v == 1 || v == 0xff80) && 6+l < len(b) && isApplication(b[6:6+l], asnAppTag.APREQ) {
+			return true, nil
+		}
+	}
+	return false, errors.New("message is not an AS, TGS or kpasswd request")
+}
+
+// isApplication indicates if the bytes are an ASN.1 value with one of the application tags provided.
+func isApplication(b []byte, tags ...int) bool {
+	var v asn1.RawValue
+	if _, err := asn1.Unmarshal(b, &v); err != nil || v.Class != asn1.ClassApplication {
+		return false
+	}
+	for _, t := range tags {
+		if v.Tag == t {
+			return true
+		}
+	}
+	return false
+}
+
+// forward the Kerberos message, with its length prefix, to a KDC, or kpasswd server, of the realm over TCP and return
+// the reply with its length prefix. The exchange is abandoned if the context is cancelled.
+func (p *Proxy) forward(ctx context.Context, realm string, kpasswd bool, b []byte) ([]byte, error) {
+	get := p.config.GetKDCs
+	if kpasswd {
+		get = p.config.GetKpasswdServers
+	}
+	_, kdcs, err := get(realm, true)
+	if err != nil {
+		return nil, err
+	}
+	var errs []string
+	for i := 1; i <= len(kdcs); i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		rb, err := p.exchange(ctx, kdcs[i], b)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("error sending to %s: %v", kdcs[i], err))
+			continue
+		}
+		return rb, nil
+	}
+	return nil, fmt.Errorf("error sending to a KDC: %s", strings.Join(errs, "; "))
+}
+
+// exchange sends the Kerberos message to the KDC and returns its reply.
+func (p *Proxy) exchange(ctx context.Context, kdc string, b []byte) ([]byte, error) {
+	var d KDCDialer = &net.Dialer{Timeout: 5 * time.Second}
+	if p.dialer != nil {
+		d = p.dialer
+	}
+	var conn net.Conn
+	var err error
+	if cd, ok := d.(interface {
+		DialContext(ctx context.Context, network, address string) (net.Conn, error)
+	}); ok {
+		conn, err = cd.DialContext(ctx, "tcp", kdc)
+	} else {
+		conn, err = d.Dial("tcp", kdc)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	// Abandon the exchange if the client disconnects
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	if err := conn.SetDeadline(time.Now().Add(10 * time.Second)); err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(b); err != nil {
+		return nil, err
+	}
+	h := make([]byte, 4)
+	if _, err := io.ReadFull(conn, h); err != nil {
+		return nil, fmt.Errorf("error reading response size header: %v", err)
+	}
+	l := binary.BigEndian.Uint32(h)
+	if l < 1 || l > maxMessageSize {
+		return nil, fmt.Errorf("invalid response size %d", l)
+	}
+	rb := make([]byte, 4+l)
+	copy(rb, h)
+	if _, err := io.ReadFull(conn, rb[4:]); err != nil {
+		return nil, fmt.Errorf("error reading response: %v", err)
+	}
+	return rb, nil
+}
+
+// log writes to the proxy's logger if it is configured.
+func (p *Proxy) log(format string, v ...interface{}) {
+	if p.logger != nil {
+		p.logger.Output(2, fmt.Sprintf(format, v...))
+	}
+}
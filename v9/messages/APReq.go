@@ -36,10 +36,16 @@ type APReq struct {
 	Authenticator          types.Authenticator `asn1:"optional"`
 }
 
-// NewAPReq generates a new KRB_AP_REQ struct.
+// NewAPReq generates a new KRB_AP_REQ struct encrypting the authenticator with the etype from the default registry.
+// Use NewAPReqWithRegistry to use the registry of a configuration, as returned by config.Config EtypeRegistry.
 func NewAPReq(tkt Ticket, sessionKey types.EncryptionKey, auth types.Authenticator) (APReq, error) {
+	return NewAPReqWithRegistry(crypto.DefaultRegistry(), tkt, sessionKey, auth)
+}
+
+// NewAPReqWithRegistry generates a new KRB_AP_REQ struct encrypting the authenticator with the etype from the registry.
+func NewAPReqWithRegistry(r *crypto.Registry, tkt Ticket, sessionKey types.EncryptionKey, auth types.Authenticator) (APReq, error) {
 	var a APReq
-	ed, err := encryptAuthenticator(auth, sessionKey, tkt)
+	ed, err := encryptAuthenticator(r, auth, sessionKey, tkt)
 	if err != nil {
 		return a, krberror.Errorf(err, krberror.KRBMsgError, "error creating Authenticator for AP_REQ")
 	}
@@ -54,14 +60,14 @@ func NewAPReq(tkt Ticket, sessionKey types.EncryptionKey, auth types.Authenticat
 }
 
 // Encrypt Authenticator
-func encryptAuthenticator(a types.Authenticator, sessionKey types.EncryptionKey, tkt Ticket) (types.EncryptedData, error) {
+func encryptAuthenticator(r *crypto.Registry, a types.Authenticator, sessionKey types.EncryptionKey, tkt Ticket) (types.EncryptedData, error) {
 	var ed types.EncryptedData
 	m, err := a.Marshal()
 	if err != nil {
 		return ed, krberror.Errorf(err, krberror.EncodingError, "marshaling error of EncryptedData form of Authenticator")
 	}
 	usage := authenticatorKeyUsage(tkt.SName)
-	ed, err = crypto.GetEncryptedData(m, sessionKey, uint32(usage), tkt.EncPart.KVNO)
+	ed, err = r.GetEncryptedData(m, sessionKey, uint32(usage), tkt.EncPart.KVNO)
 	if err != nil {
 		return ed, krberror.Errorf(err, krberror.EncryptingError, "error encrypting Authenticator")
 	}
@@ -140,7 +146,8 @@ func (a *APReq) Marshal() ([]byte, error) {
 
 // Verify an AP_REQ using service's keytab, spn and max acceptable clock skew duration.
 // The service ticket encrypted part and authenticator will be decrypted as part of this operation.
-func (a *APReq) Verify(kt *keytab.Keytab, d time.Duration, cAddr types.HostAddress, snameOverride *types.PrincipalName) (bool, error) {
+// Any keytab.KeyProvider can be used in place of the service's keytab.
+func (a *APReq) Verify(kt keytab.KeyProvider, d time.Duration, cAddr types.HostAddress, snameOverride *types.PrincipalName) (bool, error) {
 	// Decrypt ticket's encrypted part with service key
 	//TODO decrypt with service's session key from its TGT is use-to-user. Need to figure out how to get TGT.
 	//if types.IsFlagSet(&a.APOptions, flags.APOptionUseSessionKey) {
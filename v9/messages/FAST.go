@@ -0,0 +1,475 @@
+package messages
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/oiweiwei/gokrb5.fork/v9/config"
+	"github.com/oiweiwei/gokrb5.fork/v9/crypto"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/errorcode"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/keyusage"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/msgtype"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/patype"
+	"github.com/oiweiwei/gokrb5.fork/v9/krberror"
+	"github.com/oiweiwei/gokrb5.fork/v9/types"
+)
+
+// Reference: https://www.ietf.org/rfc/rfc6113.txt
+// Section: 5.4
+
+// FXFastArmorAPRequest is the armor type for FAST armor that is an AP_REQ using a ticket granting ticket.
+const FXFastArmorAPRequest int32 = 1
+
+// KrbFastArmor implements RFC 6113 KrbFastArmor.
+type KrbFastArmor struct {
+	ArmorType  int32  `asn1:"explicit,tag:0"`
+	ArmorValue []byte `asn1:"explicit,tag:1"`
+}
+
+// KrbFastArmoredReq implements RFC 6113 KrbFastArmoredReq.
+type KrbFastArmoredReq struct {
+	Armor       KrbFastArmor        `asn1:"explicit,optional,tag:0"`
+	ReqChecksum types.Checksum      `asn1:"explicit,tag:1"`
+	EncFastReq  types.EncryptedData `asn1:"explicit,tag:2"`
+}
+
+type marshalKrbFastReq struct {
+	FastOptions asn1.BitString       `asn1:"explicit,tag:0"`
+	PAData      types.PADataSequence `asn1:"explicit,tag:1"`
+	ReqBody     asn1.RawValue        `asn1:"explicit,tag:2"`
+}
+
+// KrbFastReq implements RFC 6113 KrbFastReq.
+type KrbFastReq struct {
+	FastOptions asn1.BitString
+	PAData      types.PADataSequence
+	ReqBody     KDCReqBody
+}
+
+// KrbFastArmoredRep implements RFC 6113 KrbFastArmoredRep.
+type KrbFastArmoredRep struct {
+	EncFastRep types.EncryptedData `asn1:"explicit,tag:0"`
+}
+
+// KrbFastResponse implements RFC 6113 KrbFastResponse.
+type KrbFastResponse struct {
+	PAData        types.PADataSequence `asn1:"explicit,tag:0"`
+	StrengthenKey types.EncryptionKey  `asn1:"explicit,optional,tag:1"`
+	Finished      KrbFastFinished      `asn1:"explicit,optional,tag:2"`
+	Nonce         int                  `asn1:"explicit,tag:3"`
+}
+
+// KrbFastFinished implements RFC 6113 KrbFastFinished.
+type KrbFastFinished struct {
+	Timestamp      time.Time           `asn1:"generalized,explicit,tag:0"`
+	Usec           int                 `asn1:"explicit,tag:1"`
+	CRealm         string              `asn1:"generalstring,explicit,tag:2"`
+	CName          types.PrincipalName `asn1:"explicit,tag:3"`
+	TicketChecksum types.Checksum      `asn1:"explicit,tag:4"`
+}
+
+// Unmarshal bytes b into the KrbFastReq struct.
+func (k *KrbFastReq) Unmarshal(b []byte) error {
+	var m marshalKrbFastReq
+	_, err := asn1.Unmarshal(b, &m)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling KrbFastReq")
+	}
+	var reqb KDCReqBody
+	err = reqb.Unmarshal(m.ReqBody.Bytes)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error processing KrbFastReq body")
+	}
+	k.FastOptions = m.FastOptions
+	k.PAData = m.PAData
+	k.ReqBody = reqb
+	return nil
+}
+
+// Marshal the KrbFastReq struct.
+func (k *KrbFastReq) Marshal() ([]byte, error) {
+	m := marshalKrbFastReq{
+		FastOptions: k.FastOptions,
+		PAData:      k.PAData,
+	}
+	if m.PAData == nil {
+		m.PAData = types.PADataSequence{}
+	}
+	b, err := k.ReqBody.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	m.ReqBody = asn1.RawValue{
+		Class:      asn1.ClassContextSpecific,
+		IsCompound: true,
+		Tag:        2,
+		Bytes:      b,
+	}
+	mk, err := asn1.Marshal(m)
+	if err != nil {
+		return mk, krberror.Errorf(err, krberror.EncodingError, "error marshaling KrbFastReq")
+	}
+	return mk, nil
+}
+
+// Unmarshal bytes b, the PA-FX-FAST-REQUEST, into the KrbFastArmoredReq struct.
+func (k *KrbFastArmoredReq) Unmarshal(b []byte) error {
+	c, err := unmarshalFASTChoice(b)
+	if err != nil {
+		return err
+	}
+	_, err = asn1.Unmarshal(c, k)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling KrbFastArmoredReq")
+	}
+	return nil
+}
+
+// Marshal the KrbFastArmoredReq struct as a PA-FX-FAST-REQUEST.
+func (k *KrbFastArmoredReq) Marshal() ([]byte, error) {
+	b, err := asn1.Marshal(*k)
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.EncodingError, "error marshaling KrbFastArmoredReq")
+	}
+	return marshalFASTChoice(b)
+}
+
+// Unmarshal bytes b, the PA-FX-FAST-REPLY, into the KrbFastArmoredRep struct.
+func (k *KrbFastArmoredRep) Unmarshal(b []byte) error {
+	c, err := unmarshalFASTChoice(b)
+	if err != nil {
+		return err
+	}
+	_, err = asn1.Unmarshal(c, k)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling KrbFastArmoredRep")
+	}
+	return nil
+}
+
+// Marshal the KrbFastArmoredRep struct as a PA-FX-FAST-REPLY.
+func (k *KrbFastArmoredRep) Marshal() ([]byte, error) {
+	b, err := asn1.Marshal(*k)
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.EncodingError, "error marshaling KrbFastArmoredRep")
+	}
+	return marshalFASTChoice(b)
+}
+
+// Unmarshal bytes b into the KrbFastResponse struct.
+func (k *KrbFastResponse) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, k)
+	return err
+}
+
+// Marshal the KrbFastResponse struct.
+func (k *KrbFastResponse) Marshal() ([]byte, error) {
+	m := *k
+	if m.PAData == nil {
+		m.PAData = types.PADataSequence{}
+	}
+	return asn1.Marshal(m)
+}
+
+// PA-FX-FAST-REQUEST and PA-FX-FAST-REPLY are both a choice with the single alternative tagged [0].
+func marshalFASTChoice(b []byte) ([]byte, error) {
+	return asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: b})
+}
+
+func unmarshalFASTChoice(b []byte) ([]byte, error) {
+	var c asn1.RawValue
+	_, err := asn1.Unmarshal(b, &c)
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA-FX-FAST")
+	}
+	if c.Class != asn1.ClassContextSpecific || c.Tag != 0 {
+		return nil, krberror.NewErrorf(krberror.EncodingError, "PA-FX-FAST choice has unexpected tag %d", c.Tag)
+	}
+	return c.Bytes, nil
+}
+
+// FASTArmor holds the armor and armor key with which KDC exchanges are protected using FAST (RFC 6113).
+type FASTArmor struct {
+	Armor    KrbFastArmor
+	Key      types.EncryptionKey
+	registry *crypto.Registry
+}
+
+// NewFASTArmor creates FAST armor of type FX_FAST_ARMOR_AP_REQUEST from a ticket granting ticket, such as one obtained
+// by anonymous PKINIT or with a host keytab, and its session key.
+// The client name and realm are those of the principal to which the armor ticket was issued.
+// The etypes of the registry, such as that returned by config.Config EtypeRegistry, are used for the armor and the
+// exchanges it protects.
+func NewFASTArmor(r *crypto.Registry, tgt Ticket, sessionKey types.EncryptionKey, cname types.PrincipalName, crealm string) (FASTArmor, error) {
+	a := FASTArmor{registry: r}
+	auth, err := types.NewAuthenticator(crealm, cname)
+	if err != nil {
+		return a, krberror.Errorf(err, krberror.KRBMsgError, "error generating new authenticator for FAST armor")
+	}
+	err = auth.GenerateSeqNumberAndSubKey(sessionKey.KeyType, len(sessionKey.KeyValue))
+	if err != nil {
+		return a, krberror.Errorf(err, krberror.KRBMsgError, "error generating subkey for FAST armor")
+	}
+	b, err := auth.Marshal()
+	if err != nil {
+		return a, krberror.Errorf(err, krberror.EncodingError, "error marshaling FAST armor authenticator")
+	}
+	// The armor AP_REQ is not a TGS request so the authenticator uses the AP_REQ key usage.
+	ed, err := r.GetEncryptedData(b, sessionKey, keyusage.AP_REQ_AUTHENTICATOR, tgt.EncPart.KVNO)
+	if err != nil {
+		return a, krberror.Errorf(err, krberror.EncryptingError, "error encrypting FAST armor authenticator")
+	}
+	APReq := APReq{
+		PVNO:                   iana.PVNO,
+		MsgType:                msgtype.KRB_AP_REQ,
+		APOptions:              types.NewKrbFlags(),
+		Ticket:                 tgt,
+		EncryptedAuthenticator: ed,
+	}
+	ab, err := APReq.Marshal()
+	if err != nil {
+		return a, krberror.Errorf(err, krberror.EncodingError, "error marshaling FAST armor AP_REQ")
+	}
+	// RFC 6113 section 5.4.1.1
+	key, err := r.KRBFXCF2(auth.SubKey, sessionKey, "subkeyarmor", "ticketarmor")
+	if err != nil {
+		return a, krberror.Errorf(err, krberror.EncryptingError, "error deriving FAST armor key")
+	}
+	a.Armor = KrbFastArmor{
+		ArmorType:  FXFastArmorAPRequest,
+		ArmorValue: ab,
+	}
+	a.Key = key
+	return a, nil
+}
+
+// etypes returns the registry of the etypes used with the armor, the default registry if none was provided.
+func (a *FASTArmor) etypes() *crypto.Registry {
+	if a.registry == nil {
+		return crypto.DefaultRegistry()
+	}
+	return a.registry
+}
+
+// ArmorASReq moves the AS_REQ into an armored FAST request. The pre-authentication data provided is sent encrypted in
+// the armored request and the AS_REQ's pre-authentication data is replaced by the PA-FX-FAST.
+func (a *FASTArmor) ArmorASReq(asReq *ASReq, pas types.PADataSequence) error {
+	fr := KrbFastReq{
+		FastOptions: types.NewKrbFlags(),
+		PAData:      pas,
+		ReqBody:     asReq.ReqBody,
+	}
+	fb, err := fr.Marshal()
+	if err != nil {
+		return err
+	}
+	ed, err := a.etypes().GetEncryptedData(fb, a.Key, keyusage.KEY_USAGE_FAST_ENC, 0)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncryptingError, "error encrypting KrbFastReq")
+	}
+	bb, err := asReq.ReqBody.Marshal()
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error marshaling AS_REQ body")
+	}
+	et, err := a.etypes().GetEtype(a.Key.KeyType)
+	if err != nil {
+		return krberror.Errorf(err, krberror.ChksumError, "error getting etype for FAST request checksum")
+	}
+	cb, err := et.GetChecksumHash(a.Key.KeyValue, bb, keyusage.KEY_USAGE_FAST_REQ_CHKSUM)
+	if err != nil {
+		return krberror.Errorf(err, krberror.ChksumError, "error generating FAST request checksum")
+	}
+	ar := KrbFastArmoredReq{
+		Armor: a.Armor,
+		ReqChecksum: types.Checksum{
+			CksumType: et.GetHashID(),
+			Checksum:  cb,
+		},
+		EncFastReq: ed,
+	}
+	b, err := ar.Marshal()
+	if err != nil {
+		return err
+	}
+	asReq.PAData = types.PADataSequence{
+		{
+			PADataType:  patype.PA_FX_FAST,
+			PADataValue: b,
+		},
+	}
+	return nil
+}
+
+// Response decrypts the FAST response from the PA-FX-FAST in the pre-authentication data of a KDC reply or error.
+func (a *FASTArmor) Response(pas types.PADataSequence) (KrbFastResponse, error) {
+	var resp KrbFastResponse
+	for _, pa := range pas {
+		if pa.PADataType != patype.PA_FX_FAST {
+			continue
+		}
+		var ar KrbFastArmoredRep
+		if err := ar.Unmarshal(pa.PADataValue); err != nil {
+			return resp, err
+		}
+		b, err := a.etypes().DecryptEncPart(ar.EncFastRep, a.Key, keyusage.KEY_USAGE_FAST_REP)
+		if err != nil {
+			return resp, krberror.Errorf(err, krberror.DecryptingError, "error decrypting FAST response")
+		}
+		if err := resp.Unmarshal(b); err != nil {
+			return resp, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling FAST response")
+		}
+		return resp, nil
+	}
+	return resp, krberror.New(krberror.KRBMsgError, "KDC reply does not contain a FAST response")
+}
+
+// Error returns the KRBError carried in the FAST response of an armored KRBError received from the KDC.
+// The error data of the KRBError returned is the pre-authentication data of the FAST response so that it can be used
+// in the same way as the method data of an unarmored KRBError.
+func (a *FASTArmor) Error(krberr KRBError) (KRBError, error) {
+	var e KRBError
+	var pas types.PADataSequence
+	if err := pas.Unmarshal(krberr.EData); err != nil {
+		return e, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling KRBError data")
+	}
+	resp, err := a.Response(pas)
+	if err != nil {
+		return e, err
+	}
+	for _, pa := range resp.PAData {
+		if pa.PADataType != patype.PA_FX_ERROR {
+			continue
+		}
+		if err := e.Unmarshal(pa.PADataValue); err != nil {
+			return e, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA_FX_ERROR")
+		}
+		e.EData, err = asn1.Marshal(resp.PAData)
+		if err != nil {
+			return e, krberror.Errorf(err, krberror.EncodingError, "error marshaling FAST response pre-authentication data")
+		}
+		return e, nil
+	}
+	return e, krberror.New(krberror.KRBMsgError, "FAST response to error does not contain PA_FX_ERROR")
+}
+
+// EncryptedChallenge returns the PA-ENCRYPTED-CHALLENGE pre-authentication data (RFC 6113 section 5.4.6) proving
+// knowledge of the reply key.
+func (a *FASTArmor) EncryptedChallenge(replyKey types.EncryptionKey) (types.PAData, error) {
+	key, err := a.etypes().KRBFXCF2(a.Key, replyKey, "clientchallengearmor", "challengelongterm")
+	if err != nil {
+		return types.PAData{}, krberror.Errorf(err, krberror.EncryptingError, "error deriving client challenge key")
+	}
+	b, err := types.GetPAEncTSEncAsnMarshalled()
+	if err != nil {
+		return types.PAData{}, krberror.Errorf(err, krberror.KRBMsgError, "error creating PAEncTSEnc for encrypted challenge")
+	}
+	ed, err := a.etypes().GetEncryptedData(b, key, keyusage.KEY_USAGE_ENC_CHALLENGE_CLIENT, 0)
+	if err != nil {
+		return types.PAData{}, krberror.Errorf(err, krberror.EncryptingError, "error encrypting client challenge")
+	}
+	pb, err := ed.Marshal()
+	if err != nil {
+		return types.PAData{}, krberror.Errorf(err, krberror.EncodingError, "error marshaling client challenge")
+	}
+	return types.PAData{
+		PADataType:  patype.PA_ENCRYPTED_CHALLENGE,
+		PADataValue: pb,
+	}, nil
+}
+
+// VerifyKDCChallenge checks the KDC's PA-ENCRYPTED-CHALLENGE in the FAST response of the KDC reply which proves the
+// KDC knows the reply key. The KDC's timestamp must be within the clock skew.
+func (a *FASTArmor) VerifyKDCChallenge(pas types.PADataSequence, replyKey types.EncryptionKey, clockSkew time.Duration) error {
+	resp, err := a.Response(pas)
+	if err != nil {
+		return err
+	}
+	for _, pa := range resp.PAData {
+		if pa.PADataType != patype.PA_ENCRYPTED_CHALLENGE {
+			continue
+		}
+		var ed types.EncryptedData
+		if err := ed.Unmarshal(pa.PADataValue); err != nil {
+			return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling KDC challenge")
+		}
+		key, err := a.etypes().KRBFXCF2(a.Key, replyKey, "kdcchallengearmor", "challengelongterm")
+		if err != nil {
+			return krberror.Errorf(err, krberror.EncryptingError, "error deriving KDC challenge key")
+		}
+		b, err := a.etypes().DecryptEncPart(ed, key, keyusage.KEY_USAGE_ENC_CHALLENGE_KDC)
+		if err != nil {
+			return krberror.Errorf(err, krberror.DecryptingError, "error decrypting KDC challenge")
+		}
+		var ts types.PAEncTSEnc
+		if _, err := asn1.Unmarshal(b, &ts); err != nil {
+			return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling KDC challenge timestamp")
+		}
+		t := time.Now().UTC()
+		if t.Sub(ts.PATimestamp) > clockSkew || ts.PATimestamp.Sub(t) > clockSkew {
+			return krberror.NewErrorf(krberror.KRBMsgError, "clock skew with KDC too large. Greater than %v seconds", clockSkew.Seconds())
+		}
+		return nil
+	}
+	return krberror.New(krberror.KRBMsgError, "KDC reply does not contain the KDC's encrypted challenge")
+}
+
+// VerifyArmored checks the validity of an AS_REP in response to an AS_REQ armored with FAST.
+// The reply key is the client's long-term key. The encrypted part is decrypted with the reply key strengthened as
+// directed by the FAST response, and the FAST response's finished message must match the AS_REP.
+func (k *ASRep) VerifyArmored(cfg *config.Config, armor FASTArmor, replyKey types.EncryptionKey, asReq ASReq) (bool, error) {
+	// The client name in the reply is authenticated by the FAST finished message so it may be canonicalized
+	if err := k.verifyClient(asReq); err != nil {
+		return false, err
+	}
+	if !cfg.EtypePermitted(k.EncPart.EType) {
+		return false, NewKRBError(asReq.ReqBody.SName, asReq.ReqBody.Realm, errorcode.KDC_ERR_ETYPE_NOSUPP, fmt.Sprintf("AS_REP encrypted part etype %d is not permitted", k.EncPart.EType))
+	}
+	resp, err := armor.Response(k.PAData)
+	if err != nil {
+		return false, err
+	}
+	if resp.Nonce != asReq.ReqBody.Nonce {
+		return false, krberror.NewErrorf(krberror.KRBMsgError, "possible replay attack, nonce in FAST response does not match that in request")
+	}
+	if err := resp.verifyFinished(cfg.EtypeRegistry(), armor.Key, k); err != nil {
+		return false, err
+	}
+	k.clientAuthenticated = true
+	key := replyKey
+	if resp.StrengthenKey.KeyType != 0 {
+		key, err = cfg.EtypeRegistry().KRBFXCF2(resp.StrengthenKey, replyKey, "strengthenkey", "replykey")
+		if err != nil {
+			return false, krberror.Errorf(err, krberror.EncryptingError, "error strengthening reply key")
+		}
+	}
+	if err := k.decryptWithKey(cfg.EtypeRegistry().NewKey(key)); err != nil {
+		return false, krberror.Errorf(err, krberror.DecryptingError, "error decrypting EncPart of AS_REP")
+	}
+	return k.verifyEncPart(cfg, key, asReq)
+}
+
+// verifyFinished checks the KrbFastFinished of the FAST response binds the response to the ticket and client in the AS_REP.
+func (k *KrbFastResponse) verifyFinished(r *crypto.Registry, armorKey types.EncryptionKey, asRep *ASRep) error {
+	f := k.Finished
+	if f.TicketChecksum.CksumType == 0 {
+		return errors.New("FAST response does not contain the finished message")
+	}
+	if !f.CName.Equal(asRep.CName) || f.CRealm != asRep.CRealm {
+		return krberror.NewErrorf(krberror.KRBMsgError, "client in FAST finished message does not match the AS_REP. Finished: %s@%s; Reply: %s@%s", f.CName.PrincipalNameString(), f.CRealm, asRep.CName.PrincipalNameString(), asRep.CRealm)
+	}
+	tb, err := asRep.Ticket.Marshal()
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error marshaling AS_REP ticket")
+	}
+	ct, err := r.GetChksumType(f.TicketChecksum.CksumType)
+	if err != nil {
+		return krberror.Errorf(err, krberror.ChksumError, "FAST finished ticket checksum type not supported")
+	}
+	if !ct.IsKeyed() || !ct.VerifyChecksum(armorKey.KeyValue, tb, f.TicketChecksum.Checksum, keyusage.KEY_USAGE_FAST_FINISHED) {
+		return krberror.New(krberror.ChksumError, "FAST finished ticket checksum invalid")
+	}
+	return nil
+}
@@ -0,0 +1,348 @@
+package messages
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/oiweiwei/gokrb5.fork/v9/config"
+	"github.com/oiweiwei/gokrb5.fork/v9/crypto"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/errorcode"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/etypeID"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/keyusage"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/nametype"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/patype"
+	"github.com/oiweiwei/gokrb5.fork/v9/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// testFASTKDC plays the KDC side of a FAST armored AS exchange.
+type testFASTKDC struct {
+	t          *testing.T
+	sessionKey types.EncryptionKey
+	armorKey   types.EncryptionKey
+}
+
+func newTestFASTArmor(t *testing.T) (FASTArmor, *testFASTKDC) {
+	et, _ := crypto.GetEtype(etypeID.AES256_CTS_HMAC_SHA1_96)
+	sessionKey, _ := types.GenerateEncryptionKey(et)
+	tgt := Ticket{
+		TktVNO: 5,
+		Realm:  testRealm,
+		SName:  types.PrincipalName{NameType: nametype.KRB_NT_SRV_INST, NameString: []string{"krbtgt", testRealm}},
+		EncPart: types.EncryptedData{
+			EType:  etypeID.AES256_CTS_HMAC_SHA1_96,
+			KVNO:   1,
+			Cipher: []byte("armor ticket"),
+		},
+	}
+	armor, err := NewFASTArmor(crypto.DefaultRegistry(), tgt, sessionKey, types.NewAnonymousPrincipalName(), types.AnonymousRealm)
+	if err != nil {
+		t.Fatalf("error creating FAST armor: %v", err)
+	}
+	return armor, &testFASTKDC{t: t, sessionKey: sessionKey}
+}
+
+// unarmor processes the armored AS_REQ as the KDC would, returning the inner FAST request.
+func (k *testFASTKDC) unarmor(asReq ASReq) KrbFastReq {
+	k.t.Helper()
+	if len(asReq.PAData) != 1 || asReq.PAData[0].PADataType != patype.PA_FX_FAST {
+		k.t.Fatalf("armored AS_REQ should only contain PA_FX_FAST: %+v", asReq.PAData)
+	}
+	var ar KrbFastArmoredReq
+	if err := ar.Unmarshal(asReq.PAData[0].PADataValue); err != nil {
+		k.t.Fatalf("error unmarshaling armored request: %v", err)
+	}
+	if ar.Armor.ArmorType != FXFastArmorAPRequest {
+		k.t.Fatalf("unexpected armor type %d", ar.Armor.ArmorType)
+	}
+	var apReq APReq
+	if err := apReq.Unmarshal(ar.Armor.ArmorValue); err != nil {
+		k.t.Fatalf("error unmarshaling armor AP_REQ: %v", err)
+	}
+	b, err := crypto.DecryptEncPart(apReq.EncryptedAuthenticator, k.sessionKey, keyusage.AP_REQ_AUTHENTICATOR)
+	if err != nil {
+		k.t.Fatalf("error decrypting armor authenticator: %v", err)
+	}
+	var auth types.Authenticator
+	if err := auth.Unmarshal(b); err != nil {
+		k.t.Fatalf("error unmarshaling armor authenticator: %v", err)
+	}
+	k.armorKey, err = crypto.KRBFXCF2(auth.SubKey, k.sessionKey, "subkeyarmor", "ticketarmor")
+	if err != nil {
+		k.t.Fatalf("error deriving armor key: %v", err)
+	}
+	bb, _ := asReq.ReqBody.Marshal()
+	et, _ := crypto.GetEtype(k.armorKey.KeyType)
+	if !et.VerifyChecksum(k.armorKey.KeyValue, bb, ar.ReqChecksum.Checksum, keyusage.KEY_USAGE_FAST_REQ_CHKSUM) {
+		k.t.Fatal("FAST request checksum not valid")
+	}
+	b, err = crypto.DecryptEncPart(ar.EncFastReq, k.armorKey, keyusage.KEY_USAGE_FAST_ENC)
+	if err != nil {
+		k.t.Fatalf("error decrypting FAST request: %v", err)
+	}
+	var fr KrbFastReq
+	if err := fr.Unmarshal(b); err != nil {
+		k.t.Fatalf("error unmarshaling FAST request: %v", err)
+	}
+	return fr
+}
+
+// verifyChallenge checks the client's encrypted challenge as the KDC would.
+func (k *testFASTKDC) verifyChallenge(pas types.PADataSequence, replyKey types.EncryptionKey) bool {
+	for _, pa := range pas {
+		if pa.PADataType != patype.PA_ENCRYPTED_CHALLENGE {
+			continue
+		}
+		var ed types.EncryptedData
+		if err := ed.Unmarshal(pa.PADataValue); err != nil {
+			return false
+		}
+		key, _ := crypto.KRBFXCF2(k.armorKey, replyKey, "clientchallengearmor", "challengelongterm")
+		b, err := crypto.DecryptEncPart(ed, key, keyusage.KEY_USAGE_ENC_CHALLENGE_CLIENT)
+		if err != nil {
+			return false
+		}
+		var ts types.PAEncTSEnc
+		_, err = asn1.Unmarshal(b, &ts)
+		return err == nil && time.Since(ts.PATimestamp) < time.Minute
+	}
+	return false
+}
+
+// response wraps the FAST response in a PA-FX-FAST for the reply.
+func (k *testFASTKDC) response(resp KrbFastResponse) types.PAData {
+	k.t.Helper()
+	b, err := resp.Marshal()
+	if err != nil {
+		k.t.Fatalf("error marshaling FAST response: %v", err)
+	}
+	ed, err := crypto.GetEncryptedData(b, k.armorKey, keyusage.KEY_USAGE_FAST_REP, 0)
+	if err != nil {
+		k.t.Fatalf("error encrypting FAST response: %v", err)
+	}
+	ar := KrbFastArmoredRep{EncFastRep: ed}
+	ab, err := ar.Marshal()
+	if err != nil {
+		k.t.Fatalf("error marshaling armored reply: %v", err)
+	}
+	return types.PAData{PADataType: patype.PA_FX_FAST, PADataValue: ab}
+}
+
+// reply generates the armored AS_REP for the request.
+func (k *testFASTKDC) reply(asReq ASReq, replyKey types.EncryptionKey, kdcChallenge bool) ASRep {
+	k.t.Helper()
+	et, _ := crypto.GetEtype(replyKey.KeyType)
+	strengthenKey, _ := types.GenerateEncryptionKey(et)
+	sessionKey, _ := types.GenerateEncryptionKey(et)
+	key, _ := crypto.KRBFXCF2(strengthenKey, replyKey, "strengthenkey", "replykey")
+	encPart := EncKDCRepPart{
+		Key:      sessionKey,
+		Nonce:    asReq.ReqBody.Nonce,
+		Flags:    types.NewKrbFlags(),
+		AuthTime: time.Now().UTC(),
+		EndTime:  time.Now().UTC().Add(time.Hour),
+		SRealm:   asReq.ReqBody.Realm,
+		SName:    asReq.ReqBody.SName,
+	}
+	b, _ := encPart.Marshal()
+	ed, err := crypto.GetEncryptedData(b, key, keyusage.AS_REP_ENCPART, 0)
+	if err != nil {
+		k.t.Fatalf("error encrypting AS_REP part: %v", err)
+	}
+	rep := ASRep{
+		KDCRepFields: KDCRepFields{
+			CName:  asReq.ReqBody.CName,
+			CRealm: asReq.ReqBody.Realm,
+			Ticket: Ticket{
+				TktVNO:  5,
+				Realm:   asReq.ReqBody.Realm,
+				SName:   asReq.ReqBody.SName,
+				EncPart: types.EncryptedData{EType: etypeID.AES256_CTS_HMAC_SHA1_96, KVNO: 1, Cipher: []byte("ticket")},
+			},
+			EncPart: ed,
+		},
+	}
+	tb, _ := rep.Ticket.Marshal()
+	aet, _ := crypto.GetEtype(k.armorKey.KeyType)
+	cb, _ := aet.GetChecksumHash(k.armorKey.KeyValue, tb, keyusage.KEY_USAGE_FAST_FINISHED)
+	resp := KrbFastResponse{
+		StrengthenKey: strengthenKey,
+		Finished: KrbFastFinished{
+			Timestamp:      time.Now().UTC(),
+			CRealm:         rep.CRealm,
+			CName:          rep.CName,
+			TicketChecksum: types.Checksum{CksumType: aet.GetHashID(), Checksum: cb},
+		},
+		Nonce: asReq.ReqBody.Nonce,
+	}
+	if kdcChallenge {
+		ck, _ := crypto.KRBFXCF2(k.armorKey, replyKey, "kdcchallengearmor", "challengelongterm")
+		tsb, _ := types.GetPAEncTSEncAsnMarshalled()
+		ced, _ := crypto.GetEncryptedData(tsb, ck, keyusage.KEY_USAGE_ENC_CHALLENGE_KDC, 0)
+		cedb, _ := ced.Marshal()
+		resp.PAData = types.PADataSequence{{PADataType: patype.PA_ENCRYPTED_CHALLENGE, PADataValue: cedb}}
+	}
+	rep.PAData = types.PADataSequence{k.response(resp)}
+	return rep
+}
+
+func testFASTASReq(t *testing.T) ASReq {
+	c := config.New()
+	c.LibDefaults.DefaultRealm = testRealm
+	asReq, err := NewASReqForTGT(testRealm, c, types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, testUser))
+	if err != nil {
+		t.Fatalf("error creating AS_REQ: %v", err)
+	}
+	return asReq
+}
+
+func TestKrbFastReq_MarshalUnmarshal(t *testing.T) {
+	t.Parallel()
+	asReq := testFASTASReq(t)
+	fr := KrbFastReq{
+		FastOptions: types.NewKrbFlags(),
+		PAData:      types.PADataSequence{{PADataType: patype.PA_FX_COOKIE, PADataValue: []byte("cookie")}},
+		ReqBody:     asReq.ReqBody,
+	}
+	b, err := fr.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling KrbFastReq: %v", err)
+	}
+	var u KrbFastReq
+	if err := u.Unmarshal(b); err != nil {
+		t.Fatalf("error unmarshaling KrbFastReq: %v", err)
+	}
+	assert.Equal(t, fr.PAData, u.PAData)
+	assert.Equal(t, fr.ReqBody.Nonce, u.ReqBody.Nonce)
+	assert.Equal(t, fr.ReqBody.CName, u.ReqBody.CName)
+	assert.Equal(t, fr.ReqBody.Realm, u.ReqBody.Realm)
+}
+
+func TestFASTArmor_EncryptedChallenge(t *testing.T) {
+	t.Parallel()
+	armor, kdc := newTestFASTArmor(t)
+	et, _ := crypto.GetEtype(etypeID.AES256_CTS_HMAC_SHA1_96)
+	replyKey, _ := types.GenerateEncryptionKey(et)
+	wrongKey, _ := types.GenerateEncryptionKey(et)
+
+	asReq := testFASTASReq(t)
+	pa, err := armor.EncryptedChallenge(replyKey)
+	if err != nil {
+		t.Fatalf("error generating encrypted challenge: %v", err)
+	}
+	if err := armor.ArmorASReq(&asReq, types.PADataSequence{pa}); err != nil {
+		t.Fatalf("error armoring AS_REQ: %v", err)
+	}
+	// The request must survive the trip over the wire
+	b, err := asReq.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling armored AS_REQ: %v", err)
+	}
+	var sent ASReq
+	if err := sent.Unmarshal(b); err != nil {
+		t.Fatalf("error unmarshaling armored AS_REQ: %v", err)
+	}
+	fr := kdc.unarmor(sent)
+	assert.Equal(t, armor.Key, kdc.armorKey, "armor key not as derived by the KDC")
+	assert.Equal(t, asReq.ReqBody.Nonce, fr.ReqBody.Nonce)
+	assert.True(t, kdc.verifyChallenge(fr.PAData, replyKey), "client challenge should verify with the reply key")
+	assert.False(t, kdc.verifyChallenge(fr.PAData, wrongKey), "client challenge should not verify with another key")
+
+	c := config.New()
+	asRep := kdc.reply(asReq, replyKey, true)
+	ok, err := asRep.VerifyArmored(c, armor, replyKey, asReq)
+	if !ok {
+		t.Fatalf("armored AS_REP should verify: %v", err)
+	}
+	assert.NoError(t, armor.VerifyKDCChallenge(asRep.PAData, replyKey, c.LibDefaults.Clockskew))
+	assert.Error(t, armor.VerifyKDCChallenge(asRep.PAData, wrongKey, c.LibDefaults.Clockskew), "KDC challenge should not verify with another key")
+
+	asRep = kdc.reply(asReq, replyKey, false)
+	assert.Error(t, armor.VerifyKDCChallenge(asRep.PAData, replyKey, c.LibDefaults.Clockskew), "missing KDC challenge should not verify")
+}
+
+func TestASRep_VerifyArmored_Rejected(t *testing.T) {
+	t.Parallel()
+	armor, kdc := newTestFASTArmor(t)
+	et, _ := crypto.GetEtype(etypeID.AES256_CTS_HMAC_SHA1_96)
+	replyKey, _ := types.GenerateEncryptionKey(et)
+	asReq := testFASTASReq(t)
+	if err := armor.ArmorASReq(&asReq, nil); err != nil {
+		t.Fatalf("error armoring AS_REQ: %v", err)
+	}
+	kdc.unarmor(asReq)
+	c := config.New()
+
+	// Ticket swapped after the KDC computed the finished checksum
+	asRep := kdc.reply(asReq, replyKey, false)
+	asRep.Ticket.EncPart.Cipher = []byte("other ticket")
+	ok, _ := asRep.VerifyArmored(c, armor, replyKey, asReq)
+	assert.False(t, ok, "AS_REP with a ticket not matching the finished checksum should not verify")
+
+	// Reply to a different request
+	other := asReq
+	other.ReqBody.Nonce++
+	asRep = kdc.reply(other, replyKey, false)
+	ok, _ = asRep.VerifyArmored(c, armor, replyKey, asReq)
+	assert.False(t, ok, "AS_REP with a FAST response nonce not matching the request should not verify")
+
+	// Reply protected with different armor
+	otherArmor, _ := newTestFASTArmor(t)
+	asRep = kdc.reply(asReq, replyKey, false)
+	ok, _ = asRep.VerifyArmored(c, otherArmor, replyKey, asReq)
+	assert.False(t, ok, "AS_REP armored with another key should not verify")
+}
+
+func TestFASTArmor_Error(t *testing.T) {
+	t.Parallel()
+	armor, kdc := newTestFASTArmor(t)
+	asReq := testFASTASReq(t)
+	if err := armor.ArmorASReq(&asReq, nil); err != nil {
+		t.Fatalf("error armoring AS_REQ: %v", err)
+	}
+	kdc.unarmor(asReq)
+
+	inner := NewKRBError(asReq.ReqBody.SName, testRealm, errorcode.KDC_ERR_PREAUTH_REQUIRED, "pre-authentication required")
+	ib, _ := inner.Marshal()
+	info, _ := asn1.Marshal(types.ETypeInfo2{{EType: etypeID.AES256_CTS_HMAC_SHA1_96, Salt: "salt"}})
+	resp := KrbFastResponse{
+		PAData: types.PADataSequence{
+			{PADataType: patype.PA_FX_ERROR, PADataValue: ib},
+			{PADataType: patype.PA_ETYPE_INFO2, PADataValue: info},
+			{PADataType: patype.PA_ENCRYPTED_CHALLENGE},
+		},
+	}
+	edata, _ := asn1.Marshal(types.PADataSequence{kdc.response(resp)})
+	outer := NewKRBError(asReq.ReqBody.SName, testRealm, errorcode.KDC_ERR_PREAUTH_REQUIRED, "")
+	outer.EData = edata
+
+	e, err := armor.Error(outer)
+	if err != nil {
+		t.Fatalf("error processing armored KRBError: %v", err)
+	}
+	assert.Equal(t, errorcode.KDC_ERR_PREAUTH_REQUIRED, e.ErrorCode)
+	assert.Equal(t, "pre-authentication required", e.EText)
+	var pas types.PADataSequence
+	if err := pas.Unmarshal(e.EData); err != nil {
+		t.Fatalf("error unmarshaling error data: %v", err)
+	}
+	assert.True(t, pas.Contains(patype.PA_ENCRYPTED_CHALLENGE))
+	assert.True(t, pas.Contains(patype.PA_ETYPE_INFO2))
+}
+
+func TestNewFASTArmor_Registry(t *testing.T) {
+	t.Parallel()
+	et, _ := crypto.GetEtype(etypeID.AES256_CTS_HMAC_SHA1_96)
+	sessionKey, _ := types.GenerateEncryptionKey(et)
+	tgt := Ticket{
+		TktVNO:  5,
+		Realm:   testRealm,
+		SName:   types.PrincipalName{NameType: nametype.KRB_NT_SRV_INST, NameString: []string{"krbtgt", testRealm}},
+		EncPart: types.EncryptedData{EType: etypeID.AES256_CTS_HMAC_SHA1_96, KVNO: 1, Cipher: []byte("armor ticket")},
+	}
+	r := crypto.DefaultRegistry().Clone()
+	r.Disable(etypeID.AES256_CTS_HMAC_SHA1_96)
+	_, err := NewFASTArmor(r, tgt, sessionKey, types.NewAnonymousPrincipalName(), types.AnonymousRealm)
+	assert.Error(t, err, "the session key etype is disabled in the registry")
+}
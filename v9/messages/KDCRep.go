@@ -13,6 +13,7 @@ import (
 	"github.com/oiweiwei/gokrb5.fork/v9/credentials"
 	"github.com/oiweiwei/gokrb5.fork/v9/crypto"
 	"github.com/oiweiwei/gokrb5.fork/v9/iana/asnAppTag"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/errorcode"
 	"github.com/oiweiwei/gokrb5.fork/v9/iana/flags"
 	"github.com/oiweiwei/gokrb5.fork/v9/iana/keyusage"
 	"github.com/oiweiwei/gokrb5.fork/v9/iana/msgtype"
@@ -47,6 +48,8 @@ type KDCRepFields struct {
 // ASRep implements RFC 4120 KRB_AS_REP: https://tools.ietf.org/html/rfc4120#section-5.4.2.
 type ASRep struct {
 	KDCRepFields
+	// clientAuthenticated is set when verification of the AS_REP authenticates its client name and realm.
+	clientAuthenticated bool
 }
 
 // TGSRep implements RFC 4120 KRB_TGS_REP: https://tools.ietf.org/html/rfc4120#section-5.4.2.
@@ -212,8 +215,14 @@ func (e *EncKDCRepPart) Marshal() ([]byte, error) {
 	return b, nil
 }
 
-// DecryptEncPart decrypts the encrypted part of an AS_REP.
+// DecryptEncPart decrypts the encrypted part of an AS_REP with the etypes of the default registry.
+// Use DecryptEncPartWithRegistry to use the registry of a configuration, as returned by config.Config EtypeRegistry.
 func (k *ASRep) DecryptEncPart(c *credentials.Credentials) (types.EncryptionKey, error) {
+	return k.DecryptEncPartWithRegistry(crypto.DefaultRegistry(), c)
+}
+
+// DecryptEncPartWithRegistry decrypts the encrypted part of an AS_REP with the etypes of the registry.
+func (k *ASRep) DecryptEncPartWithRegistry(r *crypto.Registry, c *credentials.Credentials) (types.EncryptionKey, error) {
 	var key types.EncryptionKey
 	var err error
 	if c.HasKeyProvider() {
@@ -223,7 +232,7 @@ func (k *ASRep) DecryptEncPart(c *credentials.Credentials) (types.EncryptionKey,
 		}
 	}
 	if c.HasPassword() {
-		key, _, err = crypto.GetKeyFromPassword(c.Password(), k.CName, k.CRealm, k.EncPart.EType, k.PAData)
+		key, _, err = r.GetKeyFromPassword(c.Password(), k.CName, k.CRealm, k.EncPart.EType, k.PAData)
 		if err != nil {
 			return key, krberror.Errorf(err, krberror.DecryptingError, "error decrypting AS_REP encrypted part")
 		}
@@ -231,32 +240,106 @@ func (k *ASRep) DecryptEncPart(c *credentials.Credentials) (types.EncryptionKey,
 	if !c.HasKeyProvider() && !c.HasPassword() {
 		return key, krberror.NewErrorf(krberror.DecryptingError, "no secret available in credentials to perform decryption of AS_REP encrypted part")
 	}
-	b, err := crypto.DecryptEncPart(k.EncPart, key, keyusage.AS_REP_ENCPART)
+	return key, k.decryptWithKey(r.NewKey(key))
+}
+
+// DecryptEncPartWithKey decrypts the encrypted part of an AS_REP with the reply key provided.
+func (k *ASRep) DecryptEncPartWithKey(key types.EncryptionKey) error {
+	return k.decryptWithKey(crypto.NewKey(key))
+}
+
+// decryptWithKey decrypts the encrypted part of an AS_REP with the opaque reply key provided.
+func (k *ASRep) decryptWithKey(key crypto.Key) error {
+	b, err := crypto.DecryptEncPartWithKey(k.EncPart, key, keyusage.AS_REP_ENCPART)
 	if err != nil {
-		return key, krberror.Errorf(err, krberror.DecryptingError, "error decrypting AS_REP encrypted part")
+		return krberror.Errorf(err, krberror.DecryptingError, "error decrypting AS_REP encrypted part")
 	}
 	var denc EncKDCRepPart
 	err = denc.Unmarshal(b)
 	if err != nil {
-		return key, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling decrypted encpart of AS_REP")
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling decrypted encpart of AS_REP")
 	}
 	k.DecryptedEncPart = denc
-	return key, nil
+	return nil
 }
 
 // Verify checks the validity of AS_REP message.
 func (k *ASRep) Verify(cfg *config.Config, creds *credentials.Credentials, asReq ASReq) (bool, error) {
 	//Ref RFC 4120 Section 3.1.5
+	if err := k.verifyClient(asReq); err != nil {
+		return false, err
+	}
+	if !cfg.EtypePermitted(k.EncPart.EType) {
+		return false, NewKRBError(asReq.ReqBody.SName, asReq.ReqBody.Realm, errorcode.KDC_ERR_ETYPE_NOSUPP, fmt.Sprintf("AS_REP encrypted part etype %d is not permitted", k.EncPart.EType))
+	}
+	key, err := k.DecryptEncPartWithRegistry(cfg.EtypeRegistry(), creds)
+	if err != nil {
+		return false, krberror.Errorf(err, krberror.DecryptingError, "error decrypting EncPart of AS_REP")
+	}
+	if ok, err := k.verifyEncPart(cfg, key, asReq); !ok {
+		return ok, err
+	}
+	// RFC 6806 section 11: a canonicalized client name is only accepted in a TGT or in a reply protected by the
+	// PA-REQ-ENC-PA-REP checksum over the request. Even in a TGT it is only adopted by the client if it is protected,
+	// see ClientAuthenticated.
+	if k.Canonicalized(asReq) && asReq.ReqBody.SName.NameString[0] != "krbtgt" && !k.clientAuthenticated {
+		return false, krberror.NewErrorf(krberror.KRBMsgError, "client name canonicalized by the KDC to %s@%s in an unprotected reply", k.CName.PrincipalNameString(), k.CRealm)
+	}
+	return true, nil
+}
+
+// Canonicalized indicates if the KDC returned a client name or realm different to that in the AS_REQ, such as when
+// mapping an enterprise principal name to the principal's canonical name.
+func (k *ASRep) Canonicalized(asReq ASReq) bool {
+	return !k.CName.Equal(asReq.ReqBody.CName) || k.CRealm != asReq.ReqBody.Realm
+}
+
+// ClientAuthenticated indicates if the client name and realm of the AS_REP, which are outside its encrypted part, were
+// authenticated when it was verified: by the PA-REQ-ENC-PA-REP checksum over the AS_REQ (RFC 6806 section 11) or by
+// the finished message of a FAST armored reply. A canonicalized client name should only be adopted if it was.
+func (k *ASRep) ClientAuthenticated() bool {
+	return k.clientAuthenticated
+}
+
+// verifyClient checks the client name and realm in the AS_REP are those requested, unless the request asked the KDC
+// to canonicalize the client name (RFC 6806).
+func (k *ASRep) verifyClient(asReq ASReq) error {
+	if len(asReq.ReqBody.KDCOptions.Bytes) > 0 && types.IsFlagSet(&asReq.ReqBody.KDCOptions, flags.Canonicalize) {
+		return nil
+	}
 	if !k.CName.Equal(asReq.ReqBody.CName) {
-		return false, krberror.NewErrorf(krberror.KRBMsgError, "CName in response does not match what was requested. Requested: %+v; Reply: %+v", asReq.ReqBody.CName, k.CName)
+		return krberror.NewErrorf(krberror.KRBMsgError, "CName in response does not match what was requested. Requested: %+v; Reply: %+v", asReq.ReqBody.CName, k.CName)
 	}
 	if k.CRealm != asReq.ReqBody.Realm {
-		return false, krberror.NewErrorf(krberror.KRBMsgError, "CRealm in response does not match what was requested. Requested: %s; Reply: %s", asReq.ReqBody.Realm, k.CRealm)
+		return krberror.NewErrorf(krberror.KRBMsgError, "CRealm in response does not match what was requested. Requested: %s; Reply: %s", asReq.ReqBody.Realm, k.CRealm)
 	}
-	key, err := k.DecryptEncPart(creds)
-	if err != nil {
+	return nil
+}
+
+// VerifyAnonymous checks the validity of an AS_REP message in response to an anonymous AS_REQ (RFC 8062).
+// The reply key is that established by the anonymous pre-authentication.
+// The client name in the reply must be the anonymous principal in either the requested realm or the anonymous realm.
+func (k *ASRep) VerifyAnonymous(cfg *config.Config, replyKey types.EncryptionKey, asReq ASReq) (bool, error) {
+	if !k.CName.IsAnonymous() {
+		return false, krberror.NewErrorf(krberror.KRBMsgError, "CName in response is not the anonymous principal: %+v", k.CName)
+	}
+	if k.CRealm != asReq.ReqBody.Realm && k.CRealm != types.AnonymousRealm {
+		return false, krberror.NewErrorf(krberror.KRBMsgError, "CRealm in response is not valid for an anonymous request. Requested: %s; Reply: %s", asReq.ReqBody.Realm, k.CRealm)
+	}
+	if !cfg.EtypePermitted(k.EncPart.EType) {
+		return false, NewKRBError(asReq.ReqBody.SName, asReq.ReqBody.Realm, errorcode.KDC_ERR_ETYPE_NOSUPP, fmt.Sprintf("AS_REP encrypted part etype %d is not permitted", k.EncPart.EType))
+	}
+	if err := k.decryptWithKey(cfg.EtypeRegistry().NewKey(replyKey)); err != nil {
 		return false, krberror.Errorf(err, krberror.DecryptingError, "error decrypting EncPart of AS_REP")
 	}
+	return k.verifyEncPart(cfg, replyKey, asReq)
+}
+
+// verifyEncPart checks the validity of the decrypted encrypted part of the AS_REP message.
+func (k *ASRep) verifyEncPart(cfg *config.Config, key types.EncryptionKey, asReq ASReq) (bool, error) {
+	if !cfg.EtypePermitted(k.DecryptedEncPart.Key.KeyType) {
+		return false, NewKRBError(asReq.ReqBody.SName, asReq.ReqBody.Realm, errorcode.KDC_ERR_ETYPE_NOSUPP, fmt.Sprintf("AS_REP session key etype %d is not permitted", k.DecryptedEncPart.Key.KeyType))
+	}
 	if k.DecryptedEncPart.Nonce != asReq.ReqBody.Nonce {
 		return false, krberror.NewErrorf(krberror.KRBMsgError, "possible replay attack, nonce in response does not match that in request")
 	}
@@ -287,14 +370,15 @@ func (k *ASRep) Verify(cfg *config.Config, creds *credentials.Credentials, asReq
 				if err != nil {
 					return false, krberror.Errorf(err, krberror.EncodingError, "KDC FAST negotiation response error, could not unmarshal PA_REQ_ENC_PA_REP")
 				}
-				etype, err := crypto.GetChksumEtype(pafast.ChksumType)
+				ct, err := cfg.EtypeRegistry().GetChksumType(pafast.ChksumType)
 				if err != nil {
 					return false, krberror.Errorf(err, krberror.ChksumError, "KDC FAST negotiation response error")
 				}
 				ab, _ := asReq.Marshal()
-				if !etype.VerifyChecksum(key.KeyValue, ab, pafast.Chksum, keyusage.KEY_USAGE_AS_REQ) {
+				if !ct.IsKeyed() || !ct.VerifyChecksum(key.KeyValue, ab, pafast.Chksum, keyusage.KEY_USAGE_AS_REQ) {
 					return false, krberror.Errorf(err, krberror.ChksumError, "KDC FAST negotiation response checksum invalid")
 				}
+				k.clientAuthenticated = true
 			}
 		}
 	}
@@ -303,7 +387,12 @@ func (k *ASRep) Verify(cfg *config.Config, creds *credentials.Credentials, asReq
 
 // DecryptEncPart decrypts the encrypted part of an TGS_REP.
 func (k *TGSRep) DecryptEncPart(key types.EncryptionKey) error {
-	b, err := crypto.DecryptEncPart(k.EncPart, key, keyusage.TGS_REP_ENCPART_SESSION_KEY)
+	return k.DecryptWithKey(crypto.NewKey(key))
+}
+
+// DecryptWithKey decrypts the encrypted part of an TGS_REP using the opaque key provided.
+func (k *TGSRep) DecryptWithKey(key crypto.Key) error {
+	b, err := crypto.DecryptEncPartWithKey(k.EncPart, key, keyusage.TGS_REP_ENCPART_SESSION_KEY)
 	if err != nil {
 		return krberror.Errorf(err, krberror.DecryptingError, "error decrypting TGS_REP EncPart")
 	}
@@ -327,6 +416,9 @@ func (k *TGSRep) Verify(cfg *config.Config, tgsReq TGSReq) (bool, error) {
 	if k.DecryptedEncPart.Nonce != tgsReq.ReqBody.Nonce {
 		return false, krberror.NewErrorf(krberror.KRBMsgError, "possible replay attack, nonce in response does not match that in request")
 	}
+	if !cfg.EtypePermitted(k.DecryptedEncPart.Key.KeyType) {
+		return false, NewKRBError(tgsReq.ReqBody.SName, tgsReq.ReqBody.Realm, errorcode.KDC_ERR_ETYPE_NOSUPP, fmt.Sprintf("TGS_REP session key etype %d is not permitted", k.DecryptedEncPart.Key.KeyType))
+	}
 	//if k.Ticket.SName.NameType != tgsReq.ReqBody.SName.NameType || k.Ticket.SName.NameString == nil {
 	//	return false, krberror.NewErrorf(krberror.KRBMsgError, "SName in response ticket does not match what was requested. Requested: %v; Reply: %v", tgsReq.ReqBody.SName, k.Ticket.SName)
 	//}
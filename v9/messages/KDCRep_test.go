@@ -6,14 +6,21 @@ import (
 	"testing"
 	"time"
 
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/oiweiwei/gokrb5.fork/v9/config"
 	"github.com/oiweiwei/gokrb5.fork/v9/credentials"
+	"github.com/oiweiwei/gokrb5.fork/v9/crypto"
 	"github.com/oiweiwei/gokrb5.fork/v9/iana"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/errorcode"
 	"github.com/oiweiwei/gokrb5.fork/v9/iana/etypeID"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/flags"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/keyusage"
 	"github.com/oiweiwei/gokrb5.fork/v9/iana/msgtype"
 	"github.com/oiweiwei/gokrb5.fork/v9/iana/nametype"
 	"github.com/oiweiwei/gokrb5.fork/v9/iana/patype"
 	"github.com/oiweiwei/gokrb5.fork/v9/keytab"
 	"github.com/oiweiwei/gokrb5.fork/v9/test/testdata"
+	"github.com/oiweiwei/gokrb5.fork/v9/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -349,3 +356,181 @@ func TestUnmarshalASRepDecodeAndDecrypt_withPassword(t *testing.T) {
 	assert.Equal(t, nametype.KRB_NT_SRV_INST, asRep.DecryptedEncPart.SName.NameType, "Name type for AS_REP not as expected")
 	assert.Equal(t, []string{"krbtgt", testRealm}, asRep.DecryptedEncPart.SName.NameString, "Service name string not as expected")
 }
+
+func TestASRep_Verify_EtypeNotPermitted(t *testing.T) {
+	t.Parallel()
+	var asRep ASRep
+	b, _ := hex.DecodeString(testuser1EType18ASREP)
+	err := asRep.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("AS REP Unmarshal error: %v\n", err)
+	}
+	asReq := ASReq{
+		KDCReqFields{
+			ReqBody: KDCReqBody{
+				CName: asRep.CName,
+				Realm: asRep.CRealm,
+				SName: asRep.Ticket.SName,
+			},
+		},
+	}
+	c, err := config.NewFromString(`[libdefaults]
+ permitted_enctypes = aes128-cts-hmac-sha1-96
+`)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	cred := credentials.New(testUser, testRealm)
+	ok, err := asRep.Verify(c, cred.WithPassword(testUserPassword), asReq)
+	assert.False(t, ok, "AS_REP should not verify")
+	if e, ok := err.(KRBError); ok {
+		assert.Equal(t, errorcode.KDC_ERR_ETYPE_NOSUPP, e.ErrorCode, "Error code not as expected")
+	} else {
+		t.Fatalf("Error is not a KRBError: %v", err)
+	}
+}
+
+func TestASRep_VerifyAnonymous(t *testing.T) {
+	t.Parallel()
+	et, _ := crypto.GetEtype(etypeID.AES256_CTS_HMAC_SHA1_96)
+	replyKey, _ := types.GenerateEncryptionKey(et)
+	sessionKey, _ := types.GenerateEncryptionKey(et)
+	sname := types.PrincipalName{NameType: nametype.KRB_NT_SRV_INST, NameString: []string{"krbtgt", testRealm}}
+	asReq := ASReq{
+		KDCReqFields{
+			ReqBody: KDCReqBody{
+				CName: types.NewAnonymousPrincipalName(),
+				Realm: testRealm,
+				SName: sname,
+				Nonce: 12345,
+			},
+		},
+	}
+	encPart := EncKDCRepPart{
+		Key:      sessionKey,
+		Nonce:    asReq.ReqBody.Nonce,
+		Flags:    types.NewKrbFlags(),
+		AuthTime: time.Now().UTC(),
+		EndTime:  time.Now().UTC().Add(time.Hour),
+		SRealm:   testRealm,
+		SName:    sname,
+	}
+	b, err := encPart.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling encrypted part: %v", err)
+	}
+	ed, err := crypto.GetEncryptedData(b, replyKey, keyusage.AS_REP_ENCPART, 0)
+	if err != nil {
+		t.Fatalf("error encrypting encrypted part: %v", err)
+	}
+	c := config.New()
+	rep := func(cname types.PrincipalName) ASRep {
+		return ASRep{KDCRepFields: KDCRepFields{CName: cname, CRealm: types.AnonymousRealm, EncPart: ed}}
+	}
+
+	asRep := rep(types.NewAnonymousPrincipalName())
+	ok, err := asRep.VerifyAnonymous(c, replyKey, asReq)
+	if !ok {
+		t.Fatalf("AS_REP should verify: %v", err)
+	}
+	assert.Equal(t, sessionKey, asRep.DecryptedEncPart.Key)
+
+	asRep = rep(types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, testUser))
+	ok, _ = asRep.VerifyAnonymous(c, replyKey, asReq)
+	assert.False(t, ok, "AS_REP for a non-anonymous client should not verify")
+
+	asRep = rep(types.NewAnonymousPrincipalName())
+	ok, _ = asRep.VerifyAnonymous(c, sessionKey, asReq)
+	assert.False(t, ok, "AS_REP should not verify with the wrong reply key")
+}
+
+func TestASRep_Canonicalized(t *testing.T) {
+	t.Parallel()
+	c := config.New()
+	cname := types.NewEnterprisePrincipalName("testuser1@upn.test.gokrb5")
+	asReq, err := NewASReqForTGT(testRealm, c, cname)
+	if err != nil {
+		t.Fatalf("error creating AS_REQ: %v", err)
+	}
+	assert.True(t, types.IsFlagSet(&asReq.ReqBody.KDCOptions, flags.Canonicalize), "canonicalize should be requested for an enterprise name")
+
+	asRep := ASRep{KDCRepFields: KDCRepFields{CName: cname, CRealm: testRealm}}
+	assert.False(t, asRep.Canonicalized(asReq), "reply with the requested name is not canonicalized")
+	asRep.CName = types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, testUser)
+	asRep.CRealm = "OTHER.GOKRB5"
+	assert.True(t, asRep.Canonicalized(asReq), "reply with a different name should be canonicalized")
+	assert.NoError(t, asRep.verifyClient(asReq), "canonicalized name should be accepted when requested")
+
+	types.UnsetFlag(&asReq.ReqBody.KDCOptions, flags.Canonicalize)
+	assert.Error(t, asRep.verifyClient(asReq), "canonicalized name should not be accepted unless requested")
+}
+
+func TestASRep_ClientAuthenticated(t *testing.T) {
+	t.Parallel()
+	c := config.New()
+	asReq, err := NewASReqForTGT(testRealm, c, types.NewEnterprisePrincipalName("testuser1@upn.test.gokrb5"))
+	if err != nil {
+		t.Fatalf("error creating AS_REQ: %v", err)
+	}
+	asReq.PAData = append(asReq.PAData, types.PAData{PADataType: patype.PA_REQ_ENC_PA_REP})
+	cname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, testUser)
+	key, _, err := crypto.GetKeyFromPassword(testUserPassword, cname, testRealm, etypeID.AES256_CTS_HMAC_SHA1_96, types.PADataSequence{})
+	if err != nil {
+		t.Fatalf("error getting key from password: %v", err)
+	}
+	rep := func(protected bool) ASRep {
+		encPart := EncKDCRepPart{
+			Key:      types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: make([]byte, 32)},
+			Nonce:    asReq.ReqBody.Nonce,
+			Flags:    types.NewKrbFlags(),
+			AuthTime: time.Now().UTC(),
+			EndTime:  time.Now().UTC().Add(time.Hour),
+			SRealm:   testRealm,
+			SName:    asReq.ReqBody.SName,
+		}
+		if protected {
+			et, _ := crypto.GetEtype(key.KeyType)
+			ab, _ := asReq.Marshal()
+			cb, _ := et.GetChecksumHash(key.KeyValue, ab, keyusage.KEY_USAGE_AS_REQ)
+			pb, _ := asn1.Marshal(types.PAReqEncPARep{ChksumType: et.GetHashID(), Chksum: cb})
+			types.SetFlag(&encPart.Flags, flags.EncPARep)
+			encPart.EncPAData = types.PADataSequence{
+				{PADataType: patype.PA_REQ_ENC_PA_REP, PADataValue: pb},
+				{PADataType: patype.PA_FX_FAST},
+			}
+		}
+		b, err := encPart.Marshal()
+		if err != nil {
+			t.Fatalf("error marshaling encrypted part: %v", err)
+		}
+		ed, err := crypto.GetEncryptedData(b, key, keyusage.AS_REP_ENCPART, 0)
+		if err != nil {
+			t.Fatalf("error encrypting encrypted part: %v", err)
+		}
+		return ASRep{KDCRepFields: KDCRepFields{CName: cname, CRealm: testRealm, EncPart: ed}}
+	}
+	cred := credentials.New(testUser, testRealm).WithPassword(testUserPassword)
+
+	// A canonicalized name in an unprotected TGT reply is accepted but not authenticated so it is not to be adopted
+	asRep := rep(false)
+	ok, err := asRep.Verify(c, cred, asReq)
+	if !ok {
+		t.Fatalf("AS_REP should verify: %v", err)
+	}
+	assert.True(t, asRep.Canonicalized(asReq), "reply should be canonicalized")
+	assert.False(t, asRep.ClientAuthenticated(), "client name of an unprotected reply should not be authenticated")
+
+	asRep = rep(true)
+	ok, err = asRep.Verify(c, cred, asReq)
+	if !ok {
+		t.Fatalf("AS_REP should verify: %v", err)
+	}
+	assert.True(t, asRep.ClientAuthenticated(), "client name of a reply with a valid PA-REQ-ENC-PA-REP should be authenticated")
+
+	// The checksum is over the AS_REQ as sent so a reply to a different request is rejected
+	asRep = rep(true)
+	other := asReq
+	other.ReqBody.Till = other.ReqBody.Till.Add(time.Hour)
+	ok, _ = asRep.Verify(c, cred, other)
+	assert.False(t, ok, "AS_REP with a PA-REQ-ENC-PA-REP checksum over a different request should not verify")
+}
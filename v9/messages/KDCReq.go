@@ -131,7 +131,8 @@ func NewASReq(realm string, c *config.Config, cname, sname types.PrincipalName)
 	if c.LibDefaults.Forwardable {
 		types.SetFlag(&a.ReqBody.KDCOptions, flags.Forwardable)
 	}
-	if c.LibDefaults.Canonicalize {
+	// Enterprise names must be canonicalized by the KDC (RFC 6806 section 5)
+	if c.LibDefaults.Canonicalize || cname.IsEnterprise() {
 		types.SetFlag(&a.ReqBody.KDCOptions, flags.Canonicalize)
 	}
 	if c.LibDefaults.Proxiable {
@@ -159,7 +160,7 @@ func NewTGSReq(cname types.PrincipalName, kdcRealm string, c *config.Config, tgt
 	if err != nil {
 		return a, err
 	}
-	err = a.setPAData(tgt, sessionKey)
+	err = a.setPAData(c.EtypeRegistry(), tgt, sessionKey)
 	return a, err
 }
 
@@ -171,7 +172,7 @@ func NewUser2UserTGSReq(cname types.PrincipalName, kdcRealm string, c *config.Co
 	}
 	a.ReqBody.AdditionalTickets = []Ticket{verifyingTGT}
 	types.SetFlag(&a.ReqBody.KDCOptions, flags.EncTktInSkey)
-	err = a.setPAData(clientTGT, sessionKey)
+	err = a.setPAData(c.EtypeRegistry(), clientTGT, sessionKey)
 	return a, err
 }
 
@@ -226,13 +227,13 @@ func tgsReq(cname, sname types.PrincipalName, kdcRealm string, renewal bool, c *
 	}, nil
 }
 
-func (k *TGSReq) setPAData(tgt Ticket, sessionKey types.EncryptionKey) error {
+func (k *TGSReq) setPAData(r *crypto.Registry, tgt Ticket, sessionKey types.EncryptionKey) error {
 	// Marshal the request and calculate checksum
 	b, err := k.ReqBody.Marshal()
 	if err != nil {
 		return krberror.Errorf(err, krberror.EncodingError, "error marshaling TGS_REQ body")
 	}
-	etype, err := crypto.GetEtype(sessionKey.KeyType)
+	etype, err := r.GetEtype(sessionKey.KeyType)
 	if err != nil {
 		return krberror.Errorf(err, krberror.EncryptingError, "error getting etype to encrypt authenticator")
 	}
@@ -252,7 +253,7 @@ func (k *TGSReq) setPAData(tgt Ticket, sessionKey types.EncryptionKey) error {
 		Checksum:  cb,
 	}
 	// Create AP_REQ
-	apReq, err := NewAPReq(tgt, sessionKey, auth)
+	apReq, err := NewAPReqWithRegistry(r, tgt, sessionKey, auth)
 	if err != nil {
 		return krberror.Errorf(err, krberror.KRBMsgError, "error generating new AP_REQ")
 	}
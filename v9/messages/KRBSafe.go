@@ -5,7 +5,12 @@ import (
 	"time"
 
 	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/oiweiwei/gokrb5.fork/v9/asn1tools"
+	"github.com/oiweiwei/gokrb5.fork/v9/crypto"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana"
 	"github.com/oiweiwei/gokrb5.fork/v9/iana/asnAppTag"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/chksumtype"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/keyusage"
 	"github.com/oiweiwei/gokrb5.fork/v9/iana/msgtype"
 	"github.com/oiweiwei/gokrb5.fork/v9/krberror"
 	"github.com/oiweiwei/gokrb5.fork/v9/types"
@@ -41,3 +46,70 @@ func (s *KRBSafe) Unmarshal(b []byte) error {
 	}
 	return nil
 }
+
+// NewKRBSafe returns a new KRBSafe type with the checksum of the body calculated using the key and checksum type
+// provided. The checksum type must be a keyed checksum, such as the config.LibDefaults SafeChecksumType.
+func NewKRBSafe(body KRBSafeBody, key types.EncryptionKey, cksumType int32) (KRBSafe, error) {
+	s := KRBSafe{
+		PVNO:     iana.PVNO,
+		MsgType:  msgtype.KRB_SAFE,
+		SafeBody: body,
+	}
+	ct, err := crypto.GetChksumType(cksumType)
+	if err != nil {
+		return s, krberror.Errorf(err, krberror.ChksumError, "error getting KRB_SAFE checksum type")
+	}
+	if !ct.IsKeyed() {
+		return s, krberror.NewErrorf(krberror.ChksumError, "checksum type %d is not a keyed checksum", cksumType)
+	}
+	b, err := asn1.Marshal(body)
+	if err != nil {
+		return s, krberror.Errorf(err, krberror.EncodingError, "error marshaling KRB_SAFE body")
+	}
+	s.Cksum, err = crypto.GetChecksum(b, key, keyusage.KRB_SAFE_CHKSUM, cksumType)
+	if err != nil {
+		return s, krberror.Errorf(err, krberror.ChksumError, "error calculating KRB_SAFE checksum")
+	}
+	return s, nil
+}
+
+// Marshal the KRBSafe.
+func (s *KRBSafe) Marshal() ([]byte, error) {
+	b, err := asn1.Marshal(*s)
+	if err != nil {
+		return []byte{}, err
+	}
+	b = asn1tools.AddASNAppTag(b, asnAppTag.KRBSafe)
+	return b, nil
+}
+
+// Verify the checksum of the KRBSafe body using the key provided.
+// Unkeyed checksum types are rejected as RFC 4120 requires KRB_SAFE checksums to be keyed and collision-proof.
+// Use VerifyAllowRSAMD5 to accept the unkeyed RSA-MD5 checksums sent by legacy peers.
+func (s *KRBSafe) Verify(key types.EncryptionKey) (bool, error) {
+	return s.verify(key, true)
+}
+
+// VerifyAllowRSAMD5 verifies the checksum of the KRBSafe body using the key provided as Verify does, but also accepts
+// an unkeyed RSA-MD5 checksum as sent by legacy peers, such as those using the former MIT safe_checksum_type default.
+// An RSA-MD5 checksum only detects accidental corruption: anyone can recompute it over altered user data, so the
+// integrity of the message is not protected. Other unkeyed checksum types are still rejected.
+func (s *KRBSafe) VerifyAllowRSAMD5(key types.EncryptionKey) (bool, error) {
+	return s.verify(key, s.Cksum.CksumType != chksumtype.RSA_MD5)
+}
+
+// verify the checksum of the KRBSafe body using the key provided, rejecting unkeyed checksum types if keyed is true.
+func (s *KRBSafe) verify(key types.EncryptionKey, keyed bool) (bool, error) {
+	b, err := asn1.Marshal(s.SafeBody)
+	if err != nil {
+		return false, krberror.Errorf(err, krberror.EncodingError, "error marshaling KRB_SAFE body")
+	}
+	ok, err := crypto.VerifyChecksum(s.Cksum, b, key, keyusage.KRB_SAFE_CHKSUM, keyed)
+	if err != nil {
+		return false, krberror.Errorf(err, krberror.ChksumError, "error verifying KRB_SAFE checksum")
+	}
+	if !ok {
+		return false, krberror.NewErrorf(krberror.ChksumError, "KRB_SAFE checksum verification failed")
+	}
+	return true, nil
+}
@@ -5,10 +5,16 @@ import (
 	"testing"
 	"time"
 
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/oiweiwei/gokrb5.fork/v9/crypto"
 	"github.com/oiweiwei/gokrb5.fork/v9/iana"
 	"github.com/oiweiwei/gokrb5.fork/v9/iana/addrtype"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/chksumtype"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/etypeID"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/keyusage"
 	"github.com/oiweiwei/gokrb5.fork/v9/iana/msgtype"
 	"github.com/oiweiwei/gokrb5.fork/v9/test/testdata"
+	"github.com/oiweiwei/gokrb5.fork/v9/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -60,3 +66,92 @@ func TestUnmarshalKRBSafe_optionalsNULL(t *testing.T) {
 	assert.Equal(t, int32(1), a.Cksum.CksumType, "Checksum type not as expected")
 	assert.Equal(t, []byte("1234"), a.Cksum.Checksum, "Checksum not as expected")
 }
+
+func TestKRBSafe_Verify(t *testing.T) {
+	t.Parallel()
+	key := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96}
+	key.KeyValue, _ = hex.DecodeString("fe697b52bc0d3ce14432ba036a92e65bbb52280990a2fa27883998d72af30161")
+	desKey := types.EncryptionKey{KeyType: etypeID.DES_CBC_MD5}
+	desKey.KeyValue, _ = hex.DecodeString("cbc22fae235298e3")
+	body := KRBSafeBody{
+		UserData:       []byte("krb5data"),
+		Timestamp:      time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		SequenceNumber: 17,
+		SAddress:       types.HostAddress{AddrType: addrtype.IPv4, Address: []byte{18, 208, 0, 35}},
+	}
+	for _, test := range []struct {
+		key       types.EncryptionKey
+		cksumType int32
+	}{
+		{key, chksumtype.HMAC_SHA1_96_AES256},
+		{desKey, chksumtype.RSA_MD5_DES},
+	} {
+		s, err := NewKRBSafe(body, test.key, test.cksumType)
+		if err != nil {
+			t.Fatalf("error creating KRB_SAFE: %v", err)
+		}
+		b, err := s.Marshal()
+		if err != nil {
+			t.Fatalf("error marshaling KRB_SAFE: %v", err)
+		}
+		var u KRBSafe
+		err = u.Unmarshal(b)
+		if err != nil {
+			t.Fatalf("error unmarshaling KRB_SAFE: %v", err)
+		}
+		assert.Equal(t, test.cksumType, u.Cksum.CksumType, "checksum type not as expected")
+		ok, err := u.Verify(test.key)
+		if err != nil || !ok {
+			t.Errorf("KRB_SAFE verification failed: %v", err)
+		}
+		u.SafeBody.UserData = []byte("tampered")
+		if ok, _ := u.Verify(test.key); ok {
+			t.Error("KRB_SAFE verification should fail for tampered user data")
+		}
+	}
+
+	if _, err := NewKRBSafe(body, key, chksumtype.RSA_MD5); err == nil {
+		t.Error("should have errored creating a KRB_SAFE with an unkeyed checksum")
+	}
+	var u KRBSafe
+	b, _ := hex.DecodeString(testdata.MarshaledKRB5safe)
+	u.Unmarshal(b)
+	if ok, _ := u.Verify(key); ok {
+		t.Error("KRB_SAFE with an unkeyed CRC32 checksum should not verify")
+	}
+	if ok, _ := u.VerifyAllowRSAMD5(key); ok {
+		t.Error("KRB_SAFE with an unkeyed CRC32 checksum should not verify when RSA-MD5 is allowed")
+	}
+}
+
+func TestKRBSafe_VerifyAllowRSAMD5(t *testing.T) {
+	t.Parallel()
+	key := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96}
+	key.KeyValue, _ = hex.DecodeString("fe697b52bc0d3ce14432ba036a92e65bbb52280990a2fa27883998d72af30161")
+	s := KRBSafe{
+		PVNO:    iana.PVNO,
+		MsgType: msgtype.KRB_SAFE,
+		SafeBody: KRBSafeBody{
+			UserData:  []byte("krb5data"),
+			Timestamp: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+			SAddress:  types.HostAddress{AddrType: addrtype.IPv4, Address: []byte{18, 208, 0, 35}},
+		},
+	}
+	b, err := asn1.Marshal(s.SafeBody)
+	if err != nil {
+		t.Fatalf("error marshaling KRB_SAFE body: %v", err)
+	}
+	s.Cksum, err = crypto.GetChecksum(b, key, keyusage.KRB_SAFE_CHKSUM, chksumtype.RSA_MD5)
+	if err != nil {
+		t.Fatalf("error calculating checksum: %v", err)
+	}
+	ok, err := s.Verify(key)
+	assert.False(t, ok, "KRB_SAFE with an RSA-MD5 checksum should not verify by default")
+	assert.Error(t, err)
+	ok, err = s.VerifyAllowRSAMD5(key)
+	assert.NoError(t, err)
+	assert.True(t, ok, "KRB_SAFE with an RSA-MD5 checksum should verify when allowed")
+	s.SafeBody.UserData = []byte("tampered")
+	ok, _ = s.VerifyAllowRSAMD5(key)
+	assert.False(t, ok, "KRB_SAFE with an RSA-MD5 checksum should not verify for altered user data")
+}
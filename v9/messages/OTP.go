@@ -0,0 +1,146 @@
+package messages
+
+import (
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/oiweiwei/gokrb5.fork/v9/crypto"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/keyusage"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/patype"
+	"github.com/oiweiwei/gokrb5.fork/v9/krberror"
+	"github.com/oiweiwei/gokrb5.fork/v9/pkinit"
+	"github.com/oiweiwei/gokrb5.fork/v9/types"
+)
+
+// Reference: https://www.ietf.org/rfc/rfc6560.txt
+// Section: 4
+
+// OTP formats.
+const (
+	OTPFormatDecimal      int32 = 0
+	OTPFormatHexadecimal  int32 = 1
+	OTPFormatAlphanumeric int32 = 2
+	OTPFormatBinary       int32 = 3
+	OTPFormatBase64       int32 = 4
+)
+
+// PAOTPChallenge implements RFC 6560 PA-OTP-CHALLENGE.
+type PAOTPChallenge struct {
+	Nonce     []byte         `asn1:"explicit,tag:0"`
+	Service   string         `asn1:"utf8,explicit,optional,tag:1"`
+	TokenInfo []OTPTokenInfo `asn1:"explicit,tag:2"`
+	Salt      string         `asn1:"generalstring,explicit,optional,tag:3"`
+	S2KParams []byte         `asn1:"explicit,optional,tag:4"`
+}
+
+// OTPTokenInfo implements RFC 6560 OTP-TOKENINFO.
+type OTPTokenInfo struct {
+	Flags            asn1.BitString               `asn1:"explicit,tag:0"`
+	Vendor           string                       `asn1:"utf8,explicit,optional,tag:1"`
+	Challenge        []byte                       `asn1:"explicit,optional,tag:2"`
+	Length           int32                        `asn1:"explicit,optional,tag:3"`
+	Format           int32                        `asn1:"explicit,optional,tag:4"`
+	TokenID          []byte                       `asn1:"explicit,optional,tag:5"`
+	AlgID            string                       `asn1:"utf8,explicit,optional,tag:6"`
+	SupportedHashAlg []pkinit.AlgorithmIdentifier `asn1:"explicit,optional,tag:7"`
+	IterationCount   int32                        `asn1:"explicit,optional,tag:8"`
+}
+
+// PAOTPRequest implements RFC 6560 PA-OTP-REQUEST.
+type PAOTPRequest struct {
+	Flags          asn1.BitString             `asn1:"explicit,tag:0"`
+	Nonce          []byte                     `asn1:"explicit,optional,tag:1"`
+	EncData        types.EncryptedData        `asn1:"explicit,tag:2"`
+	HashAlg        pkinit.AlgorithmIdentifier `asn1:"explicit,optional,tag:3"`
+	IterationCount int32                      `asn1:"explicit,optional,tag:4"`
+	Value          []byte                     `asn1:"explicit,optional,tag:5"`
+	PIN            string                     `asn1:"utf8,explicit,optional,tag:6"`
+	Challenge      []byte                     `asn1:"explicit,optional,tag:7"`
+	Time           time.Time                  `asn1:"generalized,explicit,optional,tag:8"`
+	Counter        []byte                     `asn1:"explicit,optional,tag:9"`
+	Format         int32                      `asn1:"explicit,optional,tag:10"`
+	TokenID        []byte                     `asn1:"explicit,optional,tag:11"`
+	AlgID          string                     `asn1:"utf8,explicit,optional,tag:12"`
+	Vendor         string                     `asn1:"utf8,explicit,optional,tag:13"`
+}
+
+// PAOTPEncRequest implements RFC 6560 PA-OTP-ENC-REQUEST.
+type PAOTPEncRequest struct {
+	Nonce []byte `asn1:"explicit,tag:0"`
+}
+
+// Unmarshal bytes b into the PAOTPChallenge struct.
+func (p *PAOTPChallenge) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, p)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA-OTP-CHALLENGE")
+	}
+	return nil
+}
+
+// Marshal the PAOTPChallenge struct.
+func (p *PAOTPChallenge) Marshal() ([]byte, error) {
+	return asn1.Marshal(*p)
+}
+
+// Unmarshal bytes b into the PAOTPRequest struct.
+func (p *PAOTPRequest) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, p)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA-OTP-REQUEST")
+	}
+	return nil
+}
+
+// Marshal the PAOTPRequest struct.
+func (p *PAOTPRequest) Marshal() ([]byte, error) {
+	return asn1.Marshal(*p)
+}
+
+// DecryptEncData decrypts the PA-OTP-ENC-REQUEST in the request with the FAST armor key using the etypes of the
+// registry.
+func (p *PAOTPRequest) DecryptEncData(r *crypto.Registry, armorKey types.EncryptionKey) (PAOTPEncRequest, error) {
+	var e PAOTPEncRequest
+	b, err := r.DecryptEncPart(p.EncData, armorKey, keyusage.KEY_USAGE_PA_OTP_REQUEST)
+	if err != nil {
+		return e, krberror.Errorf(err, krberror.DecryptingError, "error decrypting PA-OTP-ENC-REQUEST")
+	}
+	_, err = asn1.Unmarshal(b, &e)
+	if err != nil {
+		return e, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA-OTP-ENC-REQUEST")
+	}
+	return e, nil
+}
+
+// OTPRequest returns the PA-OTP-REQUEST answering the KDC's PA-OTP-CHALLENGE with the one-time password value and
+// PIN for the token provided, which should be one of those in the challenge.
+// The KDC's nonce is returned encrypted in the armor key. The reply key of the exchange is the armor key.
+func (a *FASTArmor) OTPRequest(challenge PAOTPChallenge, token OTPTokenInfo, value []byte, pin string) (types.PAData, error) {
+	eb, err := asn1.Marshal(PAOTPEncRequest{Nonce: challenge.Nonce})
+	if err != nil {
+		return types.PAData{}, krberror.Errorf(err, krberror.EncodingError, "error marshaling PA-OTP-ENC-REQUEST")
+	}
+	ed, err := a.etypes().GetEncryptedData(eb, a.Key, keyusage.KEY_USAGE_PA_OTP_REQUEST, 0)
+	if err != nil {
+		return types.PAData{}, krberror.Errorf(err, krberror.EncryptingError, "error encrypting PA-OTP-ENC-REQUEST")
+	}
+	req := PAOTPRequest{
+		Flags:     types.NewKrbFlags(),
+		EncData:   ed,
+		Value:     value,
+		PIN:       pin,
+		Challenge: token.Challenge,
+		Format:    token.Format,
+		TokenID:   token.TokenID,
+		AlgID:     token.AlgID,
+		Vendor:    token.Vendor,
+	}
+	b, err := req.Marshal()
+	if err != nil {
+		return types.PAData{}, krberror.Errorf(err, krberror.EncodingError, "error marshaling PA-OTP-REQUEST")
+	}
+	return types.PAData{
+		PADataType:  patype.PA_OTP_REQUEST,
+		PADataValue: b,
+	}, nil
+}
@@ -0,0 +1,96 @@
+package messages
+
+import (
+	"testing"
+
+	"github.com/oiweiwei/gokrb5.fork/v9/config"
+	"github.com/oiweiwei/gokrb5.fork/v9/crypto"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/flags"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/patype"
+	"github.com/oiweiwei/gokrb5.fork/v9/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPAOTPChallenge_MarshalUnmarshal(t *testing.T) {
+	t.Parallel()
+	tf := types.NewKrbFlags()
+	types.SetFlag(&tf, flags.OTPCollectPIN)
+	ch := PAOTPChallenge{
+		Nonce:   []byte("kdc nonce"),
+		Service: "Example OTP Service",
+		TokenInfo: []OTPTokenInfo{
+			{
+				Flags:   tf,
+				Vendor:  "Example Vendor",
+				Length:  6,
+				Format:  OTPFormatDecimal,
+				TokenID: []byte("token-1"),
+			},
+			{
+				Flags:          types.NewKrbFlags(),
+				Challenge:      []byte("challenge"),
+				Format:         OTPFormatAlphanumeric,
+				IterationCount: 1000,
+			},
+		},
+	}
+	b, err := ch.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling PA-OTP-CHALLENGE: %v", err)
+	}
+	var u PAOTPChallenge
+	if err := u.Unmarshal(b); err != nil {
+		t.Fatalf("error unmarshaling PA-OTP-CHALLENGE: %v", err)
+	}
+	assert.Equal(t, ch.Nonce, u.Nonce)
+	assert.Equal(t, ch.Service, u.Service)
+	if assert.Len(t, u.TokenInfo, 2) {
+		assert.True(t, types.IsFlagSet(&u.TokenInfo[0].Flags, flags.OTPCollectPIN), "collect-pin flag not set")
+		assert.Equal(t, "Example Vendor", u.TokenInfo[0].Vendor)
+		assert.Equal(t, int32(6), u.TokenInfo[0].Length)
+		assert.Equal(t, []byte("token-1"), u.TokenInfo[0].TokenID)
+		assert.Equal(t, []byte("challenge"), u.TokenInfo[1].Challenge)
+		assert.Equal(t, OTPFormatAlphanumeric, u.TokenInfo[1].Format)
+		assert.Equal(t, int32(1000), u.TokenInfo[1].IterationCount)
+	}
+}
+
+func TestFASTArmor_OTPRequest(t *testing.T) {
+	t.Parallel()
+	armor, kdc := newTestFASTArmor(t)
+	ch := PAOTPChallenge{
+		Nonce:     []byte("kdc nonce"),
+		TokenInfo: []OTPTokenInfo{{Flags: types.NewKrbFlags(), Vendor: "Example Vendor", TokenID: []byte("token-1")}},
+	}
+	pa, err := armor.OTPRequest(ch, ch.TokenInfo[0], []byte("123456"), "1234")
+	if err != nil {
+		t.Fatalf("error creating PA-OTP-REQUEST: %v", err)
+	}
+	assert.Equal(t, patype.PA_OTP_REQUEST, pa.PADataType)
+	asReq := testFASTASReq(t)
+	if err := armor.ArmorASReq(&asReq, types.PADataSequence{pa}); err != nil {
+		t.Fatalf("error armoring AS_REQ: %v", err)
+	}
+	fr := kdc.unarmor(asReq)
+	if !assert.Len(t, fr.PAData, 1) {
+		t.FailNow()
+	}
+	var req PAOTPRequest
+	if err := req.Unmarshal(fr.PAData[0].PADataValue); err != nil {
+		t.Fatalf("error unmarshaling PA-OTP-REQUEST: %v", err)
+	}
+	assert.Equal(t, []byte("123456"), req.Value)
+	assert.Equal(t, "1234", req.PIN)
+	assert.Equal(t, "Example Vendor", req.Vendor)
+	assert.Equal(t, []byte("token-1"), req.TokenID)
+	enc, err := req.DecryptEncData(crypto.DefaultRegistry(), kdc.armorKey)
+	if err != nil {
+		t.Fatalf("error decrypting PA-OTP-ENC-REQUEST: %v", err)
+	}
+	assert.Equal(t, ch.Nonce, enc.Nonce, "nonce not returned to the KDC")
+
+	// The armor key is the reply key
+	asRep := kdc.reply(asReq, armor.Key, false)
+	ok, err := asRep.VerifyArmored(config.New(), armor, armor.Key, asReq)
+	assert.True(t, ok, "AS_REP with the armor key as the reply key should verify: %v", err)
+}
@@ -3,10 +3,12 @@ package messages
 import (
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/jcmturner/gofork/encoding/asn1"
 	"github.com/oiweiwei/gokrb5.fork/v9/asn1tools"
+	"github.com/oiweiwei/gokrb5.fork/v9/config"
 	"github.com/oiweiwei/gokrb5.fork/v9/crypto"
 	"github.com/oiweiwei/gokrb5.fork/v9/iana"
 	"github.com/oiweiwei/gokrb5.fork/v9/iana/adtype"
@@ -14,6 +16,7 @@ import (
 	"github.com/oiweiwei/gokrb5.fork/v9/iana/errorcode"
 	"github.com/oiweiwei/gokrb5.fork/v9/iana/flags"
 	"github.com/oiweiwei/gokrb5.fork/v9/iana/keyusage"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/trtype"
 	"github.com/oiweiwei/gokrb5.fork/v9/keytab"
 	"github.com/oiweiwei/gokrb5.fork/v9/krberror"
 	"github.com/oiweiwei/gokrb5.fork/v9/pac"
@@ -184,22 +187,28 @@ func MarshalTicketSequence(tkts []Ticket) (asn1.RawValue, error) {
 }
 
 // DecryptEncPart decrypts the encrypted part of the ticket.
+// The key is obtained from the key provider, which is typically the service's keytab.
 // The sname argument can be used to specify which service principal's key should be used to decrypt the ticket.
 // If nil is passed as the sname then the service principal specified within the ticket it used.
-func (t *Ticket) DecryptEncPart(keytab *keytab.Keytab, sname *types.PrincipalName) error {
+func (t *Ticket) DecryptEncPart(kp keytab.KeyProvider, sname *types.PrincipalName) error {
 	if sname == nil {
 		sname = &t.SName
 	}
-	key, _, err := keytab.GetEncryptionKey(*sname, t.Realm, t.EncPart.KVNO, t.EncPart.EType)
+	key, err := kp.GetKey(*sname, t.Realm, t.EncPart.KVNO, t.EncPart.EType)
 	if err != nil {
 		return NewKRBError(t.SName, t.Realm, errorcode.KRB_AP_ERR_NOKEY, fmt.Sprintf("Could not get key from keytab: %v", err))
 	}
-	return t.Decrypt(key)
+	return t.DecryptWithKey(key)
 }
 
 // Decrypt decrypts the encrypted part of the ticket using the key provided.
 func (t *Ticket) Decrypt(key types.EncryptionKey) error {
-	b, err := crypto.DecryptEncPart(t.EncPart, key, keyusage.KDC_REP_TICKET)
+	return t.DecryptWithKey(crypto.NewKey(key))
+}
+
+// DecryptWithKey decrypts the encrypted part of the ticket using the opaque key provided.
+func (t *Ticket) DecryptWithKey(key crypto.Key) error {
+	b, err := crypto.DecryptEncPartWithKey(t.EncPart, key, keyusage.KDC_REP_TICKET)
 	if err != nil {
 		return fmt.Errorf("error decrypting Ticket EncPart: %v", err)
 	}
@@ -213,7 +222,8 @@ func (t *Ticket) Decrypt(key types.EncryptionKey) error {
 }
 
 // GetPACType returns a Microsoft PAC that has been extracted from the ticket and processed.
-func (t *Ticket) GetPACType(keytab *keytab.Keytab, sname *types.PrincipalName, l *log.Logger) (bool, pac.PACType, error) {
+// The key to verify the PAC's server checksum is obtained from the key provider, which is typically the service's keytab.
+func (t *Ticket) GetPACType(kp keytab.KeyProvider, sname *types.PrincipalName, l *log.Logger) (bool, pac.PACType, error) {
 	var isPAC bool
 	for _, ad := range t.DecryptedEncPart.AuthorizationData {
 		if ad.ADType == adtype.ADIfRelevant {
@@ -233,11 +243,11 @@ func (t *Ticket) GetPACType(keytab *keytab.Keytab, sname *types.PrincipalName, l
 				if sname == nil {
 					sname = &t.SName
 				}
-				key, _, err := keytab.GetEncryptionKey(*sname, t.Realm, t.EncPart.KVNO, t.EncPart.EType)
+				key, err := kp.GetKey(*sname, t.Realm, t.EncPart.KVNO, t.EncPart.EType)
 				if err != nil {
 					return isPAC, p, NewKRBError(t.SName, t.Realm, errorcode.KRB_AP_ERR_NOKEY, fmt.Sprintf("Could not get key from keytab: %v", err))
 				}
-				err = p.ProcessPACInfoBuffers(key, l)
+				err = p.ProcessPACInfoBuffersWithKey(key, l)
 				return isPAC, p, err
 			}
 		}
@@ -260,3 +270,85 @@ func (t *Ticket) Valid(d time.Duration) (bool, error) {
 
 	return true, nil
 }
+
+// Realms returns the realms transited in obtaining the ticket, decoded from the DOMAIN-X500-COMPRESS encoding
+// (RFC 4120 section 3.3.3.2). Realm names are completed from the preceding realm and null subfields are expanded to
+// the hierarchical path between the neighbouring realms, with the client realm preceding the encoded realms and the
+// server realm following them.
+func (t TransitedEncoding) Realms(crealm, srealm string) ([]string, error) {
+	if len(t.Contents) == 0 {
+		return nil, nil
+	}
+	if t.TRType != trtype.DOMAIN_X500_COMPRESS {
+		return nil, krberror.NewErrorf(krberror.KRBMsgError, "transited encoding type %d not supported", t.TRType)
+	}
+	// Split the contents on unescaped commas, completing each realm name from the preceding one
+	var fields []string
+	var sb strings.Builder
+	var escaped bool
+	for _, c := range string(t.Contents) {
+		switch {
+		case escaped:
+			sb.WriteRune(c)
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == ',':
+			fields = append(fields, sb.String())
+			sb.Reset()
+		default:
+			sb.WriteRune(c)
+		}
+	}
+	fields = append(fields, sb.String())
+	prev := crealm
+	for i, f := range fields {
+		switch {
+		case f == "":
+			continue
+		case strings.HasPrefix(f, " "):
+			// A leading space indicates the realm name is not to be completed
+			f = f[1:]
+		case strings.HasSuffix(f, "."):
+			f += prev
+		case strings.HasPrefix(f, "/") && strings.HasPrefix(prev, "/"):
+			f = prev + f
+		}
+		fields[i] = f
+		prev = f
+	}
+	var realms []string
+	for i, f := range fields {
+		if f != "" {
+			realms = append(realms, f)
+			continue
+		}
+		// A null subfield indicates all realms between its neighbours have been transited
+		before, after := crealm, srealm
+		if i > 0 && fields[i-1] != "" {
+			before = fields[i-1]
+		}
+		if i+1 < len(fields) && fields[i+1] != "" {
+			after = fields[i+1]
+		}
+		realms = append(realms, config.HierarchicalRealmPath(before, after)...)
+	}
+	return realms, nil
+}
+
+// VerifyTransited checks the realms transited in obtaining the ticket are on the path between the client and server
+// realms configured, unless the KDC has set the TRANSITED-POLICY-CHECKED flag to indicate it has checked them.
+// The ticket must have been decrypted.
+func (t *Ticket) VerifyTransited(c *config.Config) error {
+	if types.IsFlagSet(&t.DecryptedEncPart.Flags, flags.TransitedPolicyChecked) {
+		return nil
+	}
+	realms, err := t.DecryptedEncPart.Transited.Realms(t.DecryptedEncPart.CRealm, t.Realm)
+	if err != nil {
+		return NewKRBError(t.SName, t.Realm, errorcode.KDC_ERR_TRTYPE_NOSUPP, err.Error())
+	}
+	if !c.TransitedPermitted(t.DecryptedEncPart.CRealm, t.Realm, realms) {
+		return NewKRBError(t.SName, t.Realm, errorcode.KRB_AP_PATH_NOT_ACCEPTED, fmt.Sprintf("transited realms %v not on the path from %s to %s", realms, t.DecryptedEncPart.CRealm, t.Realm))
+	}
+	return nil
+}
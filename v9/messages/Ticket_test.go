@@ -8,9 +8,12 @@ import (
 	"testing"
 	"time"
 
+	"github.com/oiweiwei/gokrb5.fork/v9/config"
 	"github.com/oiweiwei/gokrb5.fork/v9/iana"
 	"github.com/oiweiwei/gokrb5.fork/v9/iana/addrtype"
 	"github.com/oiweiwei/gokrb5.fork/v9/iana/adtype"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/errorcode"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/flags"
 	"github.com/oiweiwei/gokrb5.fork/v9/iana/nametype"
 	"github.com/oiweiwei/gokrb5.fork/v9/iana/trtype"
 	"github.com/oiweiwei/gokrb5.fork/v9/keytab"
@@ -164,3 +167,60 @@ func TestAuthorizationData_GetPACType_GOKRB5TestData(t *testing.T) {
 	assert.NotNil(t, pac.KDCChecksum, "PAC KDC Checksum info is nil")
 	assert.NotNil(t, pac.ServerChecksum, "PAC Server checksum info is nil")
 }
+
+func TestTransitedEncoding_Realms(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		contents string
+		realms   []string
+	}{
+		{"", nil},
+		{"EDU,MIT.,ATHENA.,WASHINGTON.EDU,CS.", []string{"EDU", "MIT.EDU", "ATHENA.MIT.EDU", "WASHINGTON.EDU", "CS.WASHINGTON.EDU"}},
+		{"/COM,/HP,/APOLLO, /COM/DEC", []string{"/COM", "/COM/HP", "/COM/HP/APOLLO", "/COM/DEC"}},
+		{"ES.NET,", []string{"ES.NET", "NET", "GOV"}},
+		{`A\,B.NET`, []string{"A,B.NET"}},
+	}
+	for _, test := range tests {
+		te := TransitedEncoding{TRType: trtype.DOMAIN_X500_COMPRESS, Contents: []byte(test.contents)}
+		realms, err := te.Realms("ANL.GOV", "NIST.GOV")
+		if err != nil {
+			t.Fatalf("error decoding transited realms %q: %v", test.contents, err)
+		}
+		assert.Equal(t, test.realms, realms, "transited realms of %q not as expected", test.contents)
+	}
+	_, err := TransitedEncoding{TRType: 2, Contents: []byte("EDU")}.Realms("ANL.GOV", "NIST.GOV")
+	assert.Error(t, err, "unsupported transited encoding type should not decode")
+}
+
+func TestTicket_VerifyTransited(t *testing.T) {
+	t.Parallel()
+	c, err := config.NewFromString(`[capaths]
+ ANL.GOV = {
+  NIST.GOV = ES.NET
+ }
+`)
+	if err != nil {
+		t.Fatalf("error loading config: %v", err)
+	}
+	tkt := Ticket{
+		Realm: "NIST.GOV",
+		SName: types.NewPrincipalName(nametype.KRB_NT_SRV_HST, "HTTP/www.nist.gov"),
+		DecryptedEncPart: EncTicketPart{
+			Flags:     types.NewKrbFlags(),
+			CRealm:    "ANL.GOV",
+			Transited: TransitedEncoding{TRType: trtype.DOMAIN_X500_COMPRESS, Contents: []byte("ES.NET")},
+		},
+	}
+	assert.NoError(t, tkt.VerifyTransited(c), "ticket transiting the configured path should verify")
+
+	tkt.DecryptedEncPart.Transited.Contents = []byte("ES.NET,EVIL.ORG")
+	err = tkt.VerifyTransited(c)
+	if e, ok := err.(KRBError); ok {
+		assert.Equal(t, errorcode.KRB_AP_PATH_NOT_ACCEPTED, e.ErrorCode, "error code not as expected")
+	} else {
+		t.Fatalf("error is not a KRBError: %v", err)
+	}
+
+	types.SetFlag(&tkt.DecryptedEncPart.Flags, flags.TransitedPolicyChecked)
+	assert.NoError(t, tkt.VerifyTransited(c), "ticket with the transited policy checked by the KDC should verify")
+}
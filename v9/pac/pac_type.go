@@ -88,6 +88,11 @@ func (pac *PACType) Unmarshal(b []byte) (err error) {
 // ProcessPACInfoBuffers processes the PAC Info Buffers.
 // https://msdn.microsoft.com/en-us/library/cc237954.aspx
 func (pac *PACType) ProcessPACInfoBuffers(key types.EncryptionKey, l *log.Logger) error {
+	return pac.ProcessPACInfoBuffersWithKey(crypto.NewKey(key), l)
+}
+
+// ProcessPACInfoBuffersWithKey processes the PAC Info Buffers verifying the server checksum with the opaque key provided.
+func (pac *PACType) ProcessPACInfoBuffersWithKey(key crypto.Key, l *log.Logger) error {
 	for _, buf := range pac.Buffers {
 		p := make([]byte, buf.CBBufferSize, buf.CBBufferSize)
 		copy(p, pac.Data[int(buf.Offset):int(buf.Offset)+int(buf.CBBufferSize)])
@@ -223,7 +228,7 @@ func (pac *PACType) ProcessPACInfoBuffers(key types.EncryptionKey, l *log.Logger
 	return nil
 }
 
-func (pac *PACType) verify(key types.EncryptionKey) (bool, error) {
+func (pac *PACType) verify(key crypto.Key) (bool, error) {
 	if pac.KerbValidationInfo == nil {
 		return false, errors.New("PAC Info Buffers does not contain a KerbValidationInfo")
 	}
@@ -236,11 +241,14 @@ func (pac *PACType) verify(key types.EncryptionKey) (bool, error) {
 	if pac.ClientInfo == nil {
 		return false, errors.New("PAC Info Buffers does not contain a ClientInfo")
 	}
-	etype, err := crypto.GetChksumEtype(int32(pac.ServerChecksum.SignatureType))
+	ct, err := crypto.KeyRegistry(key).GetChksumType(int32(pac.ServerChecksum.SignatureType))
 	if err != nil {
 		return false, err
 	}
-	if ok := etype.VerifyChecksum(key.KeyValue,
+	if !ct.IsKeyed() {
+		return false, fmt.Errorf("PAC service checksum type %d is not a keyed checksum", pac.ServerChecksum.SignatureType)
+	}
+	if ok := key.VerifyChecksum(int32(pac.ServerChecksum.SignatureType),
 		pac.ZeroSigData,
 		pac.ServerChecksum.Signature,
 		keyusage.KERB_NON_KERB_CKSUM_SALT); !ok {
@@ -7,6 +7,7 @@ import (
 	"log"
 	"testing"
 
+	"github.com/oiweiwei/gokrb5.fork/v9/crypto"
 	"github.com/oiweiwei/gokrb5.fork/v9/keytab"
 	"github.com/oiweiwei/gokrb5.fork/v9/test/testdata"
 	"github.com/oiweiwei/gokrb5.fork/v9/types"
@@ -62,7 +63,7 @@ func TestPACTypeVerify(t *testing.T) {
 		{pacInvalidClientInfo},
 	}
 	for i, s := range pacs {
-		v, _ := s.pac.verify(key)
+		v, _ := s.pac.verify(crypto.NewKey(key))
 		assert.False(t, v, fmt.Sprintf("Validation should have failed for test %v", i))
 	}
 
@@ -0,0 +1,171 @@
+package pkinit
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"time"
+
+	"github.com/oiweiwei/gokrb5.fork/v9/crypto"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/keyusage"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/patype"
+	"github.com/oiweiwei/gokrb5.fork/v9/krberror"
+	"github.com/oiweiwei/gokrb5.fork/v9/types"
+)
+
+// Client holds the client side state of an anonymous PKINIT exchange using ephemeral Diffie-Hellman key agreement.
+type Client struct {
+	realm   string
+	anchors *x509.CertPool
+	dh      *dhKey
+	nonce   int64
+}
+
+// NewAnonymousClient creates the client side of an anonymous PKINIT exchange with the KDC of the realm.
+// The KDC's certificate must chain to one of the trust anchors provided.
+func NewAnonymousClient(realm string, anchors *x509.CertPool) (*Client, error) {
+	if anchors == nil {
+		return nil, errors.New("trust anchors are required to verify the KDC certificate")
+	}
+	dh, err := newDHKey(modp2048())
+	if err != nil {
+		return nil, fmt.Errorf("error generating Diffie-Hellman key: %v", err)
+	}
+	nonce, err := rand.Int(rand.Reader, big.NewInt(math.MaxUint32))
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		realm:   realm,
+		anchors: anchors,
+		dh:      dh,
+		nonce:   nonce.Int64(),
+	}, nil
+}
+
+// PAData returns the PA-PK-AS-REQ pre-authentication data for the AS_REQ with the marshaled request body provided.
+// As required for anonymous PKINIT the AuthPack is sent as an unsigned SignedData.
+func (c *Client) PAData(reqBody []byte) (types.PAData, error) {
+	spki, err := c.dh.publicKeyInfo()
+	if err != nil {
+		return types.PAData{}, krberror.Errorf(err, krberror.EncodingError, "error marshaling Diffie-Hellman public key")
+	}
+	t := time.Now().UTC()
+	cksum := sha1.Sum(reqBody)
+	ap := AuthPack{
+		PKAuthenticator: PKAuthenticator{
+			CUSec:      int((t.UnixNano() / int64(time.Microsecond)) - (t.Unix() * 1e6)),
+			CTime:      t.Truncate(time.Second),
+			Nonce:      c.nonce,
+			PAChecksum: cksum[:],
+		},
+		ClientPublicValue: spki,
+	}
+	apb, err := ap.Marshal()
+	if err != nil {
+		return types.PAData{}, krberror.Errorf(err, krberror.EncodingError, "error marshaling AuthPack")
+	}
+	sd, err := marshalUnsignedData(OIDPKINITAuthData, apb)
+	if err != nil {
+		return types.PAData{}, krberror.Errorf(err, krberror.EncodingError, "error marshaling AuthPack SignedData")
+	}
+	req := PAPKASReq{SignedAuthPack: sd}
+	b, err := req.Marshal()
+	if err != nil {
+		return types.PAData{}, krberror.Errorf(err, krberror.EncodingError, "error marshaling PA-PK-AS-REQ")
+	}
+	return types.PAData{
+		PADataType:  patype.PA_PK_AS_REQ,
+		PADataValue: b,
+	}, nil
+}
+
+// ReplyKey verifies the KDC's PA-PK-AS-REP in the AS_REP pre-authentication data and returns the key, of the
+// etype provided, with which the AS_REP encrypted part is decrypted.
+// The KDC's signature and certificate are verified: the certificate must chain to one of the trust anchors, have the
+// id-pkinit-KPKdc extended key usage and be for the TGS of the realm.
+func (c *Client) ReplyKey(pas types.PADataSequence, etypeID int32) (types.EncryptionKey, error) {
+	var key types.EncryptionKey
+	var rep PAPKASRep
+	var found bool
+	for _, pa := range pas {
+		if pa.PADataType == patype.PA_PK_AS_REP {
+			if err := rep.Unmarshal(pa.PADataValue); err != nil {
+				return key, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA-PK-AS-REP")
+			}
+			found = true
+			break
+		}
+	}
+	if !found {
+		return key, krberror.New(krberror.KRBMsgError, "AS_REP does not contain a PA-PK-AS-REP")
+	}
+	if len(rep.DHInfo.DHSignedData) == 0 {
+		return key, krberror.New(krberror.KRBMsgError, "only Diffie-Hellman key delivery is supported for PKINIT")
+	}
+	sd, err := parseSignedData(rep.DHInfo.DHSignedData)
+	if err != nil {
+		return key, krberror.Errorf(err, krberror.EncodingError, "error parsing KDC DH key data")
+	}
+	content, cert, err := sd.verify(OIDPKINITDHKeyData, c.anchors, time.Now())
+	if err != nil {
+		return key, krberror.Errorf(err, krberror.KRBMsgError, "KDC DH key data not verified")
+	}
+	if err := verifyKDCCertificate(cert, c.realm); err != nil {
+		return key, krberror.Errorf(err, krberror.KRBMsgError, "KDC certificate not accepted")
+	}
+	var ki KDCDHKeyInfo
+	if err := ki.Unmarshal(content); err != nil {
+		return key, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling KDCDHKeyInfo")
+	}
+	if ki.Nonce != c.nonce {
+		return key, krberror.New(krberror.KRBMsgError, "possible replay attack, nonce in KDCDHKeyInfo does not match that in request")
+	}
+	z, err := c.dh.sharedSecret(ki.SubjectPublicKey)
+	if err != nil {
+		return key, krberror.Errorf(err, krberror.KRBMsgError, "error calculating Diffie-Hellman shared secret")
+	}
+	key, err = OctetString2Key(z, etypeID)
+	if err != nil {
+		return key, krberror.Errorf(err, krberror.EncryptingError, "error deriving reply key")
+	}
+	return key, nil
+}
+
+// VerifyKeyExchange checks the ticket session key is bound to the reply key as required for anonymous PKINIT by
+// RFC 8062 section 4.1 and RFC 6112 section 5.4: the session key must be
+// KRB-FX-CF2(kdc-contribution-key, reply-key, "PKINIT", "KEYEXCHANGE") where the KDC contribution key is
+// delivered encrypted with the reply key in the PA_PKINIT_KX pre-authentication data.
+func VerifyKeyExchange(pas types.PADataSequence, replyKey, sessionKey types.EncryptionKey) error {
+	for _, pa := range pas {
+		if pa.PADataType != patype.PA_PKINIT_KX {
+			continue
+		}
+		var ed types.EncryptedData
+		if err := ed.Unmarshal(pa.PADataValue); err != nil {
+			return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA_PKINIT_KX")
+		}
+		b, err := crypto.DecryptEncPart(ed, replyKey, keyusage.KEY_USAGE_PA_PKINIT_KX)
+		if err != nil {
+			return krberror.Errorf(err, krberror.DecryptingError, "error decrypting PA_PKINIT_KX")
+		}
+		var kdcKey types.EncryptionKey
+		if err := kdcKey.Unmarshal(b); err != nil {
+			return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA_PKINIT_KX key")
+		}
+		k, err := crypto.KRBFXCF2(kdcKey, replyKey, "PKINIT", "KEYEXCHANGE")
+		if err != nil {
+			return krberror.Errorf(err, krberror.EncryptingError, "error combining PA_PKINIT_KX key with reply key")
+		}
+		if k.KeyType != sessionKey.KeyType || subtle.ConstantTimeCompare(k.KeyValue, sessionKey.KeyValue) != 1 {
+			return krberror.New(krberror.KRBMsgError, "session key is not bound to the PKINIT reply key")
+		}
+		return nil
+	}
+	return krberror.New(krberror.KRBMsgError, "AS_REP does not contain PA_PKINIT_KX")
+}
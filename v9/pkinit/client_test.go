@@ -0,0 +1,297 @@
+package pkinit
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	stdasn1 "encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/oiweiwei/gokrb5.fork/v9/crypto"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/etypeID"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/keyusage"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/nametype"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/patype"
+	"github.com/oiweiwei/gokrb5.fork/v9/types"
+	"github.com/stretchr/testify/assert"
+)
+
+const testRealm = "TEST.GOKRB5"
+
+// testKDC signs PKINIT replies as a KDC would.
+type testKDC struct {
+	ca      *x509.Certificate
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	anchors *x509.CertPool
+}
+
+func newTestKDC(t *testing.T, realm string, eku bool) *testKDC {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating CA key: %v", err)
+	}
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("error creating CA certificate: %v", err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating KDC key: %v", err)
+	}
+	san, err := asn1.Marshal(KRB5PrincipalName{
+		Realm:         realm,
+		PrincipalName: types.PrincipalName{NameType: nametype.KRB_NT_SRV_INST, NameString: []string{"krbtgt", realm}},
+	})
+	if err != nil {
+		t.Fatalf("error marshaling SAN: %v", err)
+	}
+	on, err := asn1.Marshal(otherName{TypeID: OIDPKINITSAN, Value: asn1.RawValue{FullBytes: san}})
+	if err != nil {
+		t.Fatalf("error marshaling other name: %v", err)
+	}
+	// Change the SEQUENCE tag to the IMPLICIT [0] tag of the otherName GeneralName
+	on[0] = 0xa0
+	sanExt, _ := asn1.Marshal([]asn1.RawValue{{FullBytes: on}})
+	tmpl := &x509.Certificate{
+		SerialNumber:    big.NewInt(2),
+		Subject:         pkix.Name{CommonName: "kdc"},
+		NotBefore:       time.Now().Add(-time.Hour),
+		NotAfter:        time.Now().Add(time.Hour),
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtraExtensions: []pkix.Extension{{Id: stdasn1.ObjectIdentifier(oidSubjectAltName), Value: sanExt}},
+	}
+	if eku {
+		tmpl.UnknownExtKeyUsage = []stdasn1.ObjectIdentifier{stdasn1.ObjectIdentifier(OIDPKINITKPKdc)}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("error creating KDC certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	anchors := x509.NewCertPool()
+	anchors.AddCert(ca)
+	return &testKDC{ca: ca, cert: cert, key: key, anchors: anchors}
+}
+
+// reply processes the client's PA-PK-AS-REQ and returns the PA-PK-AS-REP and the Diffie-Hellman shared secret.
+func (k *testKDC) reply(t *testing.T, pa types.PAData, nonceDelta int64) (types.PAData, []byte) {
+	var req PAPKASReq
+	if err := req.Unmarshal(pa.PADataValue); err != nil {
+		t.Fatalf("error unmarshaling PA-PK-AS-REQ: %v", err)
+	}
+	sd, err := parseSignedData(req.SignedAuthPack)
+	if err != nil {
+		t.Fatalf("error parsing signed AuthPack: %v", err)
+	}
+	assert.Equal(t, 0, len(sd.SignerInfos), "anonymous AuthPack should not be signed")
+	assert.True(t, sd.EncapContentInfo.EContentType.Equal(OIDPKINITAuthData))
+	var ap AuthPack
+	if err := ap.Unmarshal(sd.EncapContentInfo.EContent); err != nil {
+		t.Fatalf("error unmarshaling AuthPack: %v", err)
+	}
+	assert.True(t, ap.ClientPublicValue.Algorithm.Algorithm.Equal(OIDDHPublicNumber))
+	dh, err := newDHKey(modp2048())
+	if err != nil {
+		t.Fatalf("error generating DH key: %v", err)
+	}
+	z, err := dh.sharedSecret(ap.ClientPublicValue.SubjectPublicKey)
+	if err != nil {
+		t.Fatalf("error calculating shared secret: %v", err)
+	}
+	y, _ := asn1.Marshal(dh.y)
+	ki := KDCDHKeyInfo{
+		SubjectPublicKey: asn1.BitString{Bytes: y, BitLength: len(y) * 8},
+		Nonce:            ap.PKAuthenticator.Nonce + nonceDelta,
+	}
+	content, _ := ki.Marshal()
+	rep := PAPKASRep{DHInfo: DHRepInfo{DHSignedData: k.sign(t, OIDPKINITDHKeyData, content)}}
+	b, err := rep.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling PA-PK-AS-REP: %v", err)
+	}
+	return types.PAData{PADataType: patype.PA_PK_AS_REP, PADataValue: b}, z
+}
+
+// sign returns a CMS SignedData of the content signed with signed attributes by the KDC's key.
+func (k *testKDC) sign(t *testing.T, contentType asn1.ObjectIdentifier, content []byte) []byte {
+	d := sha256.Sum256(content)
+	ctv, _ := asn1.Marshal(contentType)
+	mdv, _ := asn1.Marshal(d[:])
+	ct, _ := asn1.Marshal(attribute{Type: oidContentType, Values: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: ctv}})
+	md, _ := asn1.Marshal(attribute{Type: oidMessageDigest, Values: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: mdv}})
+	attrs := append(ct, md...)
+	signed, _ := asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: attrs})
+	h := sha256.Sum256(signed)
+	sig, err := ecdsa.SignASN1(rand.Reader, k.key, h[:])
+	if err != nil {
+		t.Fatalf("error signing: %v", err)
+	}
+	certs, _ := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: append(k.cert.Raw, k.ca.Raw...)})
+	signedAttrs, _ := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attrs})
+	ias, _ := asn1.Marshal(issuerAndSerialNumber{Issuer: asn1.RawValue{FullBytes: k.cert.RawIssuer}, SerialNumber: k.cert.SerialNumber})
+	si, _ := asn1.Marshal(signerInfo{
+		Version:            1,
+		SID:                asn1.RawValue{FullBytes: ias},
+		DigestAlgorithm:    AlgorithmIdentifier{Algorithm: oidSHA256},
+		SignedAttrs:        rawContent{Raw: signedAttrs},
+		SignatureAlgorithm: AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256},
+		Signature:          sig,
+	})
+	da, _ := asn1.Marshal(AlgorithmIdentifier{Algorithm: oidSHA256})
+	// The SET OF fields are built as raw values as the asn1 package marshals the elements of a slice tagged as a set
+	// as sets themselves.
+	sd := struct {
+		Version          int
+		DigestAlgorithms asn1.RawValue
+		EncapContentInfo encapsulatedContentInfo
+		Certificates     rawContent `asn1:"optional,tag:0"`
+		SignerInfos      asn1.RawValue
+	}{
+		Version:          3,
+		DigestAlgorithms: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: da},
+		EncapContentInfo: encapsulatedContentInfo{EContentType: contentType, EContent: content},
+		Certificates:     rawContent{Raw: certs},
+		SignerInfos:      asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: si},
+	}
+	b, err := asn1.Marshal(sd)
+	if err != nil {
+		t.Fatalf("error marshaling SignedData: %v", err)
+	}
+	ci, err := asn1.Marshal(contentInfo{ContentType: oidSignedData, Content: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: b}})
+	if err != nil {
+		t.Fatalf("error marshaling ContentInfo: %v", err)
+	}
+	return ci
+}
+
+func TestClient_ReplyKey(t *testing.T) {
+	t.Parallel()
+	kdc := newTestKDC(t, testRealm, true)
+	cl, err := NewAnonymousClient(testRealm, kdc.anchors)
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+	pa, err := cl.PAData([]byte("request body"))
+	if err != nil {
+		t.Fatalf("error generating PA-PK-AS-REQ: %v", err)
+	}
+	assert.Equal(t, patype.PA_PK_AS_REQ, pa.PADataType)
+	rep, z := kdc.reply(t, pa, 0)
+	key, err := cl.ReplyKey(types.PADataSequence{rep}, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("error getting reply key: %v", err)
+	}
+	expected, err := OctetString2Key(z, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("error deriving key: %v", err)
+	}
+	assert.Equal(t, expected, key)
+	assert.Equal(t, 32, len(key.KeyValue))
+}
+
+func TestClient_ReplyKey_Rejected(t *testing.T) {
+	t.Parallel()
+	kdc := newTestKDC(t, testRealm, true)
+	var tests = []struct {
+		name       string
+		realm      string
+		anchors    *x509.CertPool
+		kdc        *testKDC
+		nonceDelta int64
+	}{
+		{"untrusted", testRealm, x509.NewCertPool(), kdc, 0},
+		{"wrong realm", "OTHER.GOKRB5", kdc.anchors, kdc, 0},
+		{"nonce mismatch", testRealm, kdc.anchors, kdc, 1},
+		{"no KDC EKU", testRealm, nil, newTestKDC(t, testRealm, false), 0},
+	}
+	for _, test := range tests {
+		anchors := test.anchors
+		if anchors == nil {
+			anchors = test.kdc.anchors
+		}
+		cl, err := NewAnonymousClient(test.realm, anchors)
+		if err != nil {
+			t.Fatalf("error creating client: %v", err)
+		}
+		pa, err := cl.PAData([]byte("request body"))
+		if err != nil {
+			t.Fatalf("error generating PA-PK-AS-REQ: %v", err)
+		}
+		rep, _ := test.kdc.reply(t, pa, test.nonceDelta)
+		_, err = cl.ReplyKey(types.PADataSequence{rep}, etypeID.AES256_CTS_HMAC_SHA1_96)
+		assert.Error(t, err, "reply should be rejected: %s", test.name)
+	}
+}
+
+func TestSignedData_Tampered(t *testing.T) {
+	t.Parallel()
+	kdc := newTestKDC(t, testRealm, true)
+	b := kdc.sign(t, OIDPKINITDHKeyData, []byte("content"))
+	sd, err := parseSignedData(b)
+	if err != nil {
+		t.Fatalf("error parsing SignedData: %v", err)
+	}
+	content, cert, err := sd.verify(OIDPKINITDHKeyData, kdc.anchors, time.Now())
+	if err != nil {
+		t.Fatalf("error verifying SignedData: %v", err)
+	}
+	assert.Equal(t, []byte("content"), content)
+	assert.Equal(t, kdc.cert.Raw, cert.Raw)
+	_, _, err = sd.verify(OIDPKINITAuthData, kdc.anchors, time.Now())
+	assert.Error(t, err, "unexpected content type should be rejected")
+	sd.EncapContentInfo.EContent = []byte("tampered")
+	_, _, err = sd.verify(OIDPKINITDHKeyData, kdc.anchors, time.Now())
+	assert.Error(t, err, "tampered content should be rejected")
+}
+
+func TestVerifyKeyExchange(t *testing.T) {
+	t.Parallel()
+	et, _ := crypto.GetEtype(etypeID.AES256_CTS_HMAC_SHA1_96)
+	replyKey, _ := types.GenerateEncryptionKey(et)
+	kdcKey, _ := types.GenerateEncryptionKey(et)
+	sessionKey, err := crypto.KRBFXCF2(kdcKey, replyKey, "PKINIT", "KEYEXCHANGE")
+	if err != nil {
+		t.Fatalf("error combining keys: %v", err)
+	}
+	kb, _ := kdcKey.Marshal()
+	ed, err := crypto.GetEncryptedData(kb, replyKey, keyusage.KEY_USAGE_PA_PKINIT_KX, 0)
+	if err != nil {
+		t.Fatalf("error encrypting KDC key: %v", err)
+	}
+	edb, _ := ed.Marshal()
+	pas := types.PADataSequence{{PADataType: patype.PA_PKINIT_KX, PADataValue: edb}}
+	assert.NoError(t, VerifyKeyExchange(pas, replyKey, sessionKey))
+	assert.Error(t, VerifyKeyExchange(pas, replyKey, kdcKey), "unbound session key should be rejected")
+	assert.Error(t, VerifyKeyExchange(types.PADataSequence{}, replyKey, sessionKey), "missing PA_PKINIT_KX should be rejected")
+}
+
+func TestOctetString2Key(t *testing.T) {
+	t.Parallel()
+	for _, id := range []int32{etypeID.AES128_CTS_HMAC_SHA1_96, etypeID.AES256_CTS_HMAC_SHA1_96, etypeID.AES256_CTS_HMAC_SHA384_192} {
+		k, err := OctetString2Key([]byte("shared secret"), id)
+		if err != nil {
+			t.Fatalf("error deriving key: %v", err)
+		}
+		et, _ := crypto.GetEtype(id)
+		assert.Equal(t, crypto.KeySeedByteSize(et), len(k.KeyValue))
+		assert.Equal(t, id, k.KeyType)
+	}
+}
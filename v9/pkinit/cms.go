@@ -0,0 +1,397 @@
+package pkinit
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/oiweiwei/gokrb5.fork/v9/types"
+)
+
+// Reference: https://www.ietf.org/rfc/rfc5652.txt
+// Only the parts of CMS SignedData used by PKINIT are implemented.
+
+var (
+	oidSignedData     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidContentType    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+
+	oidSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+
+	oidRSAEncryption   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidSHA1WithRSA     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 5}
+	oidSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSHA384WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}
+	oidSHA512WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}
+	oidECPublicKey     = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidECDSAWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 1}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidECDSAWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidECDSAWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+)
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"explicit,optional,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     rawContent   `asn1:"optional,tag:0"`
+	CRLs             rawContent   `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo `asn1:"set"`
+}
+
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    AlgorithmIdentifier
+	SignedAttrs        rawContent `asn1:"optional,tag:0"`
+	SignatureAlgorithm AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      rawContent `asn1:"optional,tag:1"`
+}
+
+// rawContent captures the encoding of an optional, implicitly tagged, element.
+// A RawValue cannot be used as it would match whatever element follows if the optional element is absent.
+type rawContent struct {
+	Raw asn1.RawContent
+}
+
+// contents returns the contents of the element without the tag and length.
+func (r rawContent) contents() ([]byte, error) {
+	if len(r.Raw) == 0 {
+		return nil, nil
+	}
+	var v asn1.RawValue
+	if _, err := asn1.Unmarshal(r.Raw, &v); err != nil {
+		return nil, err
+	}
+	return v.Bytes, nil
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+type otherName struct {
+	TypeID asn1.ObjectIdentifier
+	Value  asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+// marshalUnsignedData returns a DER encoded CMS ContentInfo holding a SignedData, with no signers, of the content.
+// Unsigned SignedData is used by clients requesting anonymous PKINIT (RFC 8062 section 4.1).
+func marshalUnsignedData(contentType asn1.ObjectIdentifier, content []byte) ([]byte, error) {
+	sd := signedData{
+		Version:          3,
+		DigestAlgorithms: []AlgorithmIdentifier{},
+		EncapContentInfo: encapsulatedContentInfo{
+			EContentType: contentType,
+			EContent:     content,
+		},
+		SignerInfos: []signerInfo{},
+	}
+	b, err := asn1.Marshal(sd)
+	if err != nil {
+		return nil, err
+	}
+	// A RawValue is marshaled as is so the explicit tag is added here
+	return asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: b},
+	})
+}
+
+// parseSignedData parses the DER encoded CMS ContentInfo holding a SignedData.
+func parseSignedData(b []byte) (signedData, error) {
+	var sd signedData
+	var ci contentInfo
+	rest, err := asn1.Unmarshal(b, &ci)
+	if err != nil {
+		return sd, fmt.Errorf("error unmarshaling CMS ContentInfo: %v", err)
+	}
+	if len(rest) > 0 {
+		return sd, errors.New("trailing data after CMS ContentInfo")
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return sd, fmt.Errorf("CMS content type %v is not SignedData", ci.ContentType)
+	}
+	_, err = asn1.Unmarshal(ci.Content.Bytes, &sd)
+	if err != nil {
+		return sd, fmt.Errorf("error unmarshaling CMS SignedData: %v", err)
+	}
+	return sd, nil
+}
+
+// certificates returns the certificates carried in the SignedData.
+func (sd *signedData) certificates() ([]*x509.Certificate, error) {
+	b, err := sd.Certificates.contents()
+	if err != nil || len(b) == 0 {
+		return nil, err
+	}
+	return x509.ParseCertificates(b)
+}
+
+// verify checks that the SignedData content, of the expected content type, is signed by a certificate that chains to
+// one of the roots. The content and the signer's certificate are returned.
+func (sd *signedData) verify(contentType asn1.ObjectIdentifier, roots *x509.CertPool, now time.Time) ([]byte, *x509.Certificate, error) {
+	if !sd.EncapContentInfo.EContentType.Equal(contentType) {
+		return nil, nil, fmt.Errorf("SignedData content type %v is not as expected: %v", sd.EncapContentInfo.EContentType, contentType)
+	}
+	if len(sd.SignerInfos) != 1 {
+		return nil, nil, fmt.Errorf("SignedData should have one signer but has %d", len(sd.SignerInfos))
+	}
+	si := sd.SignerInfos[0]
+	certs, err := sd.certificates()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing SignedData certificates: %v", err)
+	}
+	signer, err := si.signer(certs)
+	if err != nil {
+		return nil, nil, err
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range certs {
+		if c != signer {
+			intermediates.AddCert(c)
+		}
+	}
+	_, err = signer.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("SignedData signer certificate not trusted: %v", err)
+	}
+	h, err := digestAlgorithm(si.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return nil, nil, err
+	}
+	alg, err := signatureAlgorithm(si.SignatureAlgorithm.Algorithm, h)
+	if err != nil {
+		return nil, nil, err
+	}
+	content := sd.EncapContentInfo.EContent
+	signed := content
+	if len(si.SignedAttrs.Raw) > 0 {
+		if err := si.checkSignedAttrs(contentType, h, content); err != nil {
+			return nil, nil, err
+		}
+		// The signature is over the DER encoding of the attributes as a SET OF rather than the IMPLICIT [0] tag
+		signed = make([]byte, len(si.SignedAttrs.Raw))
+		copy(signed, si.SignedAttrs.Raw)
+		signed[0] = 0x31
+	}
+	if err := signer.CheckSignature(alg, signed, si.Signature); err != nil {
+		return nil, nil, fmt.Errorf("SignedData signature is not valid: %v", err)
+	}
+	return content, signer, nil
+}
+
+// signer finds the certificate of the signer amongst the certificates provided.
+func (si *signerInfo) signer(certs []*x509.Certificate) (*x509.Certificate, error) {
+	for _, c := range certs {
+		switch {
+		case si.SID.Class == asn1.ClassContextSpecific && si.SID.Tag == 0:
+			if len(c.SubjectKeyId) > 0 && bytes.Equal(c.SubjectKeyId, si.SID.Bytes) {
+				return c, nil
+			}
+		default:
+			var ias issuerAndSerialNumber
+			if _, err := asn1.Unmarshal(si.SID.FullBytes, &ias); err != nil {
+				return nil, fmt.Errorf("error unmarshaling SignedData signer identifier: %v", err)
+			}
+			if bytes.Equal(c.RawIssuer, ias.Issuer.FullBytes) && c.SerialNumber.Cmp(ias.SerialNumber) == 0 {
+				return c, nil
+			}
+		}
+	}
+	return nil, errors.New("certificate of the SignedData signer not found")
+}
+
+// checkSignedAttrs checks the content type and message digest signed attributes match the content.
+func (si *signerInfo) checkSignedAttrs(contentType asn1.ObjectIdentifier, h crypto.Hash, content []byte) error {
+	var ct, md bool
+	rest, err := si.SignedAttrs.contents()
+	if err != nil {
+		return fmt.Errorf("error unmarshaling SignedData signed attributes: %v", err)
+	}
+	for len(rest) > 0 {
+		var a attribute
+		var err error
+		rest, err = asn1.Unmarshal(rest, &a)
+		if err != nil {
+			return fmt.Errorf("error unmarshaling SignedData signed attribute: %v", err)
+		}
+		switch {
+		case a.Type.Equal(oidContentType):
+			var v asn1.ObjectIdentifier
+			if _, err := asn1.Unmarshal(a.Values.Bytes, &v); err != nil || !v.Equal(contentType) {
+				return errors.New("SignedData content type attribute does not match the content type")
+			}
+			ct = true
+		case a.Type.Equal(oidMessageDigest):
+			var v []byte
+			if _, err := asn1.Unmarshal(a.Values.Bytes, &v); err != nil {
+				return fmt.Errorf("error unmarshaling SignedData message digest attribute: %v", err)
+			}
+			d := h.New()
+			d.Write(content)
+			if !bytes.Equal(d.Sum(nil), v) {
+				return errors.New("SignedData message digest does not match the content")
+			}
+			md = true
+		}
+	}
+	if !ct || !md {
+		return errors.New("SignedData signed attributes do not include the content type and message digest")
+	}
+	return nil
+}
+
+func digestAlgorithm(oid asn1.ObjectIdentifier) (crypto.Hash, error) {
+	switch {
+	case oid.Equal(oidSHA1):
+		return crypto.SHA1, nil
+	case oid.Equal(oidSHA256):
+		return crypto.SHA256, nil
+	case oid.Equal(oidSHA384):
+		return crypto.SHA384, nil
+	case oid.Equal(oidSHA512):
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("SignedData digest algorithm %v not supported", oid)
+}
+
+func signatureAlgorithm(oid asn1.ObjectIdentifier, h crypto.Hash) (x509.SignatureAlgorithm, error) {
+	switch {
+	case oid.Equal(oidRSAEncryption):
+		switch h {
+		case crypto.SHA1:
+			return x509.SHA1WithRSA, nil
+		case crypto.SHA256:
+			return x509.SHA256WithRSA, nil
+		case crypto.SHA384:
+			return x509.SHA384WithRSA, nil
+		case crypto.SHA512:
+			return x509.SHA512WithRSA, nil
+		}
+	case oid.Equal(oidECPublicKey):
+		switch h {
+		case crypto.SHA1:
+			return x509.ECDSAWithSHA1, nil
+		case crypto.SHA256:
+			return x509.ECDSAWithSHA256, nil
+		case crypto.SHA384:
+			return x509.ECDSAWithSHA384, nil
+		case crypto.SHA512:
+			return x509.ECDSAWithSHA512, nil
+		}
+	case oid.Equal(oidSHA1WithRSA):
+		return x509.SHA1WithRSA, nil
+	case oid.Equal(oidSHA256WithRSA):
+		return x509.SHA256WithRSA, nil
+	case oid.Equal(oidSHA384WithRSA):
+		return x509.SHA384WithRSA, nil
+	case oid.Equal(oidSHA512WithRSA):
+		return x509.SHA512WithRSA, nil
+	case oid.Equal(oidECDSAWithSHA1):
+		return x509.ECDSAWithSHA1, nil
+	case oid.Equal(oidECDSAWithSHA256):
+		return x509.ECDSAWithSHA256, nil
+	case oid.Equal(oidECDSAWithSHA384):
+		return x509.ECDSAWithSHA384, nil
+	case oid.Equal(oidECDSAWithSHA512):
+		return x509.ECDSAWithSHA512, nil
+	}
+	return x509.UnknownSignatureAlgorithm, fmt.Errorf("SignedData signature algorithm %v not supported", oid)
+}
+
+// pkinitSANs returns the Kerberos principal names in the id-pkinit-san subject alternative names of the certificate.
+func pkinitSANs(c *x509.Certificate) ([]KRB5PrincipalName, error) {
+	var names []KRB5PrincipalName
+	for _, ext := range c.Extensions {
+		if !asn1.ObjectIdentifier(ext.Id).Equal(oidSubjectAltName) {
+			continue
+		}
+		var seq asn1.RawValue
+		if _, err := asn1.Unmarshal(ext.Value, &seq); err != nil {
+			return nil, fmt.Errorf("error unmarshaling subject alternative names: %v", err)
+		}
+		rest := seq.Bytes
+		for len(rest) > 0 {
+			var gn asn1.RawValue
+			var err error
+			rest, err = asn1.Unmarshal(rest, &gn)
+			if err != nil {
+				return nil, fmt.Errorf("error unmarshaling subject alternative name: %v", err)
+			}
+			if gn.Class != asn1.ClassContextSpecific || gn.Tag != 0 {
+				continue
+			}
+			var on otherName
+			if _, err := asn1.UnmarshalWithParams(gn.FullBytes, &on, "tag:0"); err != nil {
+				return nil, fmt.Errorf("error unmarshaling subject alternative other name: %v", err)
+			}
+			if !on.TypeID.Equal(OIDPKINITSAN) {
+				continue
+			}
+			var n KRB5PrincipalName
+			if _, err := asn1.Unmarshal(on.Value.FullBytes, &n); err != nil {
+				return nil, fmt.Errorf("error unmarshaling id-pkinit-san: %v", err)
+			}
+			names = append(names, n)
+		}
+	}
+	return names, nil
+}
+
+// verifyKDCCertificate checks the certificate is that of a KDC of the realm as required by RFC 4556 section 3.2.4:
+// it has the id-pkinit-KPKdc extended key usage and krbtgt/REALM@REALM as an id-pkinit-san.
+func verifyKDCCertificate(c *x509.Certificate, realm string) error {
+	var eku bool
+	for _, u := range c.UnknownExtKeyUsage {
+		if asn1.ObjectIdentifier(u).Equal(OIDPKINITKPKdc) {
+			eku = true
+			break
+		}
+	}
+	if !eku {
+		return errors.New("KDC certificate does not have the id-pkinit-KPKdc extended key usage")
+	}
+	names, err := pkinitSANs(c)
+	if err != nil {
+		return err
+	}
+	tgs := types.PrincipalName{NameString: []string{"krbtgt", realm}}
+	for _, n := range names {
+		if n.Realm == realm && n.PrincipalName.Equal(tgs) {
+			return nil
+		}
+	}
+	return fmt.Errorf("KDC certificate is not for the TGS of realm %s", realm)
+}
@@ -0,0 +1,114 @@
+package pkinit
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/oiweiwei/gokrb5.fork/v9/crypto"
+	"github.com/oiweiwei/gokrb5.fork/v9/types"
+)
+
+// modp2048P is the prime of the 2048-bit MODP group 14 of RFC 3526.
+const modp2048P = "FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74" +
+	"020BBEA63B139B22514A08798E3404DDEF9519B3CD3A431B302B0A6DF25F1437" +
+	"4FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED" +
+	"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3DC2007CB8A163BF05" +
+	"98DA48361C55D39A69163FA8FD24CF5F83655D23DCA3AD961C62F356208552BB" +
+	"9ED529077096966D670C354E4ABC9804F1746C08CA18217C32905E462E36CE3B" +
+	"E39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9DE2BCBF695581718" +
+	"3995497CEA956AE515D2261898FA051015728E5A8AACAA68FFFFFFFFFFFFFFFF"
+
+// dhGroup holds Diffie-Hellman domain parameters.
+type dhGroup struct {
+	p, g, q *big.Int
+}
+
+func modp2048() dhGroup {
+	p, _ := new(big.Int).SetString(modp2048P, 16)
+	// The group is a safe prime group so q = (p-1)/2
+	q := new(big.Int).Rsh(p, 1)
+	return dhGroup{p: p, g: big.NewInt(2), q: q}
+}
+
+// dhKey is an ephemeral Diffie-Hellman key pair.
+type dhKey struct {
+	group dhGroup
+	x, y  *big.Int
+}
+
+func newDHKey(g dhGroup) (*dhKey, error) {
+	// The private exponent is chosen from [2, q-1]
+	x, err := rand.Int(rand.Reader, new(big.Int).Sub(g.q, big.NewInt(2)))
+	if err != nil {
+		return nil, err
+	}
+	x.Add(x, big.NewInt(2))
+	return &dhKey{
+		group: g,
+		x:     x,
+		y:     new(big.Int).Exp(g.g, x, g.p),
+	}, nil
+}
+
+// publicKeyInfo returns the public key as the SubjectPublicKeyInfo of RFC 3279 section 2.3.3.
+func (k *dhKey) publicKeyInfo() (SubjectPublicKeyInfo, error) {
+	params, err := asn1.Marshal(DomainParameters{P: k.group.p, G: k.group.g, Q: k.group.q})
+	if err != nil {
+		return SubjectPublicKeyInfo{}, err
+	}
+	y, err := asn1.Marshal(k.y)
+	if err != nil {
+		return SubjectPublicKeyInfo{}, err
+	}
+	return SubjectPublicKeyInfo{
+		Algorithm: AlgorithmIdentifier{
+			Algorithm:  OIDDHPublicNumber,
+			Parameters: asn1.RawValue{FullBytes: params},
+		},
+		SubjectPublicKey: asn1.BitString{Bytes: y, BitLength: len(y) * 8},
+	}, nil
+}
+
+// sharedSecret returns the shared secret with the peer's public value, which is encoded as a DER INTEGER in the
+// BIT STRING pk. The secret is padded with leading zeros to the length of the modulus (RFC 4556 section 3.2.3.1).
+func (k *dhKey) sharedSecret(pk asn1.BitString) ([]byte, error) {
+	var y *big.Int
+	if _, err := asn1.Unmarshal(pk.Bytes, &y); err != nil {
+		return nil, fmt.Errorf("error unmarshaling Diffie-Hellman public value: %v", err)
+	}
+	one := big.NewInt(1)
+	// The public value must be in the range [2, p-2] and in the subgroup of order q
+	if y.Cmp(one) <= 0 || y.Cmp(new(big.Int).Sub(k.group.p, one)) >= 0 {
+		return nil, errors.New("Diffie-Hellman public value out of range")
+	}
+	if new(big.Int).Exp(y, k.group.q, k.group.p).Cmp(one) != 0 {
+		return nil, errors.New("Diffie-Hellman public value not in the group")
+	}
+	z := new(big.Int).Exp(y, k.x, k.group.p)
+	return z.FillBytes(make([]byte, (k.group.p.BitLen()+7)/8)), nil
+}
+
+// OctetString2Key derives a key of the etype from the octet string as defined in RFC 4556 section 3.2.3.1:
+// random-to-key(K-truncate(SHA1(0x00 | x) | SHA1(0x01 | x) | ...)).
+func OctetString2Key(x []byte, etypeID int32) (types.EncryptionKey, error) {
+	et, err := crypto.GetEtype(etypeID)
+	if err != nil {
+		return types.EncryptionKey{}, err
+	}
+	n := crypto.KeySeedByteSize(et)
+	b := make([]byte, 0, n+sha1.Size)
+	for i := 0; len(b) < n; i++ {
+		h := sha1.New()
+		h.Write([]byte{byte(i)})
+		h.Write(x)
+		b = h.Sum(b)
+	}
+	return types.EncryptionKey{
+		KeyType:  etypeID,
+		KeyValue: et.RandomToKey(b[:n]),
+	}, nil
+}
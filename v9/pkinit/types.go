@@ -0,0 +1,160 @@
+// Package pkinit provides the public key cryptography for initial authentication (PKINIT) of RFC 4556 as used for
+// anonymous authentication (RFC 8062).
+package pkinit
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/oiweiwei/gokrb5.fork/v9/krberror"
+	"github.com/oiweiwei/gokrb5.fork/v9/types"
+)
+
+// Reference: https://www.ietf.org/rfc/rfc4556.txt
+// Section: 3.2
+
+// Object identifiers used by PKINIT.
+var (
+	OIDPKINITAuthData  = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 2, 3, 1}
+	OIDPKINITDHKeyData = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 2, 3, 2}
+	OIDPKINITKPKdc     = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 2, 3, 5}
+	OIDPKINITSAN       = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 2, 2}
+	OIDDHPublicNumber  = asn1.ObjectIdentifier{1, 2, 840, 10046, 2, 1}
+)
+
+// AlgorithmIdentifier implements the X.509 AlgorithmIdentifier type.
+type AlgorithmIdentifier struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.RawValue `asn1:"optional"`
+}
+
+// SubjectPublicKeyInfo implements the X.509 SubjectPublicKeyInfo type.
+type SubjectPublicKeyInfo struct {
+	Algorithm        AlgorithmIdentifier
+	SubjectPublicKey asn1.BitString
+}
+
+// DomainParameters implements the Diffie-Hellman domain parameters of RFC 3279 section 2.3.3.
+type DomainParameters struct {
+	P *big.Int
+	G *big.Int
+	Q *big.Int
+}
+
+// PKAuthenticator implements RFC 4556 PKAuthenticator.
+type PKAuthenticator struct {
+	CUSec      int       `asn1:"explicit,tag:0"`
+	CTime      time.Time `asn1:"generalized,explicit,tag:1"`
+	Nonce      int64     `asn1:"explicit,tag:2"`
+	PAChecksum []byte    `asn1:"explicit,optional,tag:3"`
+}
+
+// AuthPack implements RFC 4556 AuthPack.
+type AuthPack struct {
+	PKAuthenticator   PKAuthenticator       `asn1:"explicit,tag:0"`
+	ClientPublicValue SubjectPublicKeyInfo  `asn1:"explicit,optional,tag:1"`
+	SupportedCMSTypes []AlgorithmIdentifier `asn1:"explicit,optional,tag:2"`
+	ClientDHNonce     []byte                `asn1:"explicit,optional,tag:3"`
+}
+
+// PAPKASReq implements RFC 4556 PA-PK-AS-REQ.
+type PAPKASReq struct {
+	SignedAuthPack    []byte          `asn1:"tag:0"`
+	TrustedCertifiers []asn1.RawValue `asn1:"explicit,optional,tag:1"`
+	KDCPkID           []byte          `asn1:"optional,tag:2"`
+}
+
+// DHRepInfo implements RFC 4556 DHRepInfo.
+type DHRepInfo struct {
+	DHSignedData  []byte        `asn1:"tag:0"`
+	ServerDHNonce []byte        `asn1:"explicit,optional,tag:1"`
+	KDF           asn1.RawValue `asn1:"explicit,optional,tag:2"`
+}
+
+// PAPKASRep implements RFC 4556 PA-PK-AS-REP.
+// The PA-PK-AS-REP is a choice between DHRepInfo and an encKeyPack. Only DHRepInfo is supported.
+type PAPKASRep struct {
+	DHInfo     DHRepInfo
+	EncKeyPack []byte
+}
+
+// KDCDHKeyInfo implements RFC 4556 KDCDHKeyInfo.
+type KDCDHKeyInfo struct {
+	SubjectPublicKey asn1.BitString `asn1:"explicit,tag:0"`
+	Nonce            int64          `asn1:"explicit,tag:1"`
+	DHKeyExpiration  time.Time      `asn1:"generalized,explicit,optional,tag:2"`
+}
+
+// KRB5PrincipalName implements the RFC 4556 KRB5PrincipalName used in the id-pkinit-san subject alternative name.
+type KRB5PrincipalName struct {
+	Realm         string              `asn1:"generalstring,explicit,tag:0"`
+	PrincipalName types.PrincipalName `asn1:"explicit,tag:1"`
+}
+
+// Unmarshal bytes b into the AuthPack struct.
+func (a *AuthPack) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, a)
+	return err
+}
+
+// Marshal the AuthPack struct.
+func (a *AuthPack) Marshal() ([]byte, error) {
+	return asn1.Marshal(*a)
+}
+
+// Unmarshal bytes b into the PAPKASReq struct.
+func (p *PAPKASReq) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, p)
+	return err
+}
+
+// Marshal the PAPKASReq struct.
+func (p *PAPKASReq) Marshal() ([]byte, error) {
+	return asn1.Marshal(*p)
+}
+
+// Unmarshal bytes b into the PAPKASRep struct.
+func (p *PAPKASRep) Unmarshal(b []byte) error {
+	var c asn1.RawValue
+	_, err := asn1.Unmarshal(b, &c)
+	if err != nil {
+		return err
+	}
+	if c.Class != asn1.ClassContextSpecific {
+		return krberror.NewErrorf(krberror.EncodingError, "PA-PK-AS-REP choice has unexpected class %d", c.Class)
+	}
+	switch c.Tag {
+	case 0:
+		_, err = asn1.Unmarshal(c.Bytes, &p.DHInfo)
+		return err
+	case 1:
+		p.EncKeyPack = c.Bytes
+		return nil
+	default:
+		return krberror.NewErrorf(krberror.EncodingError, "PA-PK-AS-REP choice has unexpected tag %d", c.Tag)
+	}
+}
+
+// Marshal the PAPKASRep struct.
+func (p *PAPKASRep) Marshal() ([]byte, error) {
+	if len(p.EncKeyPack) > 0 {
+		return asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 1, Bytes: p.EncKeyPack})
+	}
+	b, err := asn1.Marshal(p.DHInfo)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: b})
+}
+
+// Unmarshal bytes b into the KDCDHKeyInfo struct.
+func (k *KDCDHKeyInfo) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, k)
+	return err
+}
+
+// Marshal the KDCDHKeyInfo struct.
+func (k *KDCDHKeyInfo) Marshal() ([]byte, error) {
+	return asn1.Marshal(*k)
+}
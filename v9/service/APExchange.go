@@ -1,6 +1,7 @@
 package service
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/oiweiwei/gokrb5.fork/v9/credentials"
@@ -11,10 +12,28 @@ import (
 // VerifyAPREQ verifies an AP_REQ sent to the service. Returns a boolean for if the AP_REQ is valid and the client's principal name and realm.
 func VerifyAPREQ(APReq *messages.APReq, s *Settings) (bool, *credentials.Credentials, error) {
 	var creds *credentials.Credentials
-	ok, err := APReq.Verify(s.Keytab, s.MaxClockSkew(), s.ClientAddress(), s.KeytabPrincipal())
+	if !s.EtypePermitted(APReq.Ticket.EncPart.EType) {
+		return false, creds,
+			messages.NewKRBError(APReq.Ticket.SName, APReq.Ticket.Realm, errorcode.KDC_ERR_ETYPE_NOSUPP, fmt.Sprintf("ticket etype %d is not permitted", APReq.Ticket.EncPart.EType))
+	}
+	ok, err := APReq.Verify(s.KeyProvider(), s.MaxClockSkew(), s.ClientAddress(), s.KeytabPrincipal())
 	if err != nil || !ok {
 		return false, creds, err
 	}
+	if !s.EtypePermitted(APReq.Ticket.DecryptedEncPart.Key.KeyType) {
+		return false, creds,
+			messages.NewKRBError(APReq.Ticket.SName, APReq.Ticket.Realm, errorcode.KDC_ERR_ETYPE_NOSUPP, fmt.Sprintf("session key etype %d is not permitted", APReq.Ticket.DecryptedEncPart.Key.KeyType))
+	}
+	if APReq.Authenticator.SubKey.KeyType != 0 && !s.EtypePermitted(APReq.Authenticator.SubKey.KeyType) {
+		return false, creds,
+			messages.NewKRBError(APReq.Ticket.SName, APReq.Ticket.Realm, errorcode.KDC_ERR_ETYPE_NOSUPP, fmt.Sprintf("authenticator subkey etype %d is not permitted", APReq.Authenticator.SubKey.KeyType))
+	}
+
+	if s.TransitedPolicy() != nil {
+		if err := APReq.Ticket.VerifyTransited(s.TransitedPolicy()); err != nil {
+			return false, creds, err
+		}
+	}
 
 	if s.RequireHostAddr() && len(APReq.Ticket.DecryptedEncPart.CAddr) < 1 {
 		return false, creds,
@@ -33,10 +52,16 @@ func VerifyAPREQ(APReq *messages.APReq, s *Settings) (bool, *credentials.Credent
 	creds.SetAuthTime(time.Now().UTC())
 	creds.SetAuthenticated(true)
 	creds.SetValidUntil(APReq.Ticket.DecryptedEncPart.EndTime)
+	if s.AuthToLocal() != nil {
+		// Clients without a local name mapping are authenticated without a local name
+		if l, err := s.AuthToLocal().LocalName(APReq.Authenticator.CName.PrincipalNameString() + "@" + APReq.Authenticator.CRealm); err == nil {
+			creds.SetLocalName(l)
+		}
+	}
 
 	//PAC decoding
 	if !s.disablePACDecoding {
-		isPAC, pac, err := APReq.Ticket.GetPACType(s.Keytab, s.KeytabPrincipal(), s.Logger())
+		isPAC, pac, err := APReq.Ticket.GetPACType(s.KeyProvider(), s.KeytabPrincipal(), s.Logger())
 		if isPAC && err != nil {
 			return false, creds, err
 		}
@@ -6,11 +6,18 @@ import (
 	"testing"
 	"time"
 
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/oiweiwei/gokrb5.fork/v9/asn1tools"
 	"github.com/oiweiwei/gokrb5.fork/v9/client"
 	"github.com/oiweiwei/gokrb5.fork/v9/config"
 	"github.com/oiweiwei/gokrb5.fork/v9/credentials"
+	"github.com/oiweiwei/gokrb5.fork/v9/crypto"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/asnAppTag"
 	"github.com/oiweiwei/gokrb5.fork/v9/iana/errorcode"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/etypeID"
 	"github.com/oiweiwei/gokrb5.fork/v9/iana/flags"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/keyusage"
 	"github.com/oiweiwei/gokrb5.fork/v9/iana/nametype"
 	"github.com/oiweiwei/gokrb5.fork/v9/keytab"
 	"github.com/oiweiwei/gokrb5.fork/v9/messages"
@@ -61,6 +68,115 @@ func TestVerifyAPREQ(t *testing.T) {
 	}
 }
 
+func TestVerifyAPREQ_AuthToLocal(t *testing.T) {
+	t.Parallel()
+	cl := getClient()
+	sname := types.PrincipalName{
+		NameType:   nametype.KRB_NT_PRINCIPAL,
+		NameString: []string{"HTTP", "host.test.gokrb5"},
+	}
+	b, _ := hex.DecodeString(testdata.HTTP_KEYTAB)
+	kt := keytab.New()
+	kt.Unmarshal(b)
+	st := time.Now().UTC()
+	tkt, sessionKey, err := messages.NewTicket(cl.Credentials.CName(), cl.Credentials.Domain(),
+		sname, "TEST.GOKRB5",
+		types.NewKrbFlags(),
+		kt,
+		18,
+		1,
+		st,
+		st,
+		st.Add(time.Duration(24)*time.Hour),
+		st.Add(time.Duration(48)*time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test ticket: %v", err)
+	}
+	APReq, err := messages.NewAPReq(
+		tkt,
+		sessionKey,
+		newTestAuthenticator(*cl.Credentials),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test AP_REQ: %v", err)
+	}
+	c, err := config.NewFromString(`[libdefaults]
+ default_realm = TEST.GOKRB5
+
+[realms]
+ TEST.GOKRB5 = {
+  auth_to_local = RULE:[1:$1@$0](.*@TEST\.GOKRB5)s/@.*//s/^test/local/
+ }
+`)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+
+	h, _ := types.GetHostAddress("127.0.0.1:1234")
+	s := NewSettings(kt, ClientAddress(h), AuthToLocal(c))
+	ok, creds, err := VerifyAPREQ(&APReq, s)
+	if !ok || err != nil {
+		t.Fatalf("Validation of AP_REQ failed when it should not have: %v", err)
+	}
+	assert.Equal(t, "localuser1", creds.LocalName(), "local name not as expected")
+}
+
+// countingKeyProvider is a keytab.KeyProvider that records the keys requested.
+type countingKeyProvider struct {
+	kp    keytab.KeyProvider
+	calls int
+}
+
+func (p *countingKeyProvider) GetKey(princName types.PrincipalName, realm string, kvno int, etype int32) (crypto.Key, error) {
+	p.calls++
+	return p.kp.GetKey(princName, realm, kvno, etype)
+}
+
+func TestVerifyAPREQWithKeyProvider(t *testing.T) {
+	t.Parallel()
+	cl := getClient()
+	sname := types.PrincipalName{
+		NameType:   nametype.KRB_NT_PRINCIPAL,
+		NameString: []string{"HTTP", "host.test.gokrb5"},
+	}
+	b, _ := hex.DecodeString(testdata.HTTP_KEYTAB)
+	kt := keytab.New()
+	kt.Unmarshal(b)
+	st := time.Now().UTC()
+	tkt, sessionKey, err := messages.NewTicket(cl.Credentials.CName(), cl.Credentials.Domain(),
+		sname, "TEST.GOKRB5",
+		types.NewKrbFlags(),
+		kt,
+		18,
+		1,
+		st,
+		st,
+		st.Add(time.Duration(24)*time.Hour),
+		st.Add(time.Duration(48)*time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test ticket: %v", err)
+	}
+	APReq, err := messages.NewAPReq(
+		tkt,
+		sessionKey,
+		newTestAuthenticator(*cl.Credentials),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test AP_REQ: %v", err)
+	}
+
+	h, _ := types.GetHostAddress("127.0.0.1:1234")
+	kp := &countingKeyProvider{kp: kt}
+	s := NewSettings(nil, KeyProvider(kp), ClientAddress(h))
+	ok, _, err := VerifyAPREQ(&APReq, s)
+	if !ok || err != nil {
+		t.Fatalf("Validation of AP_REQ failed when it should not have: %v", err)
+	}
+	assert.Equal(t, 1, kp.calls, "key should have been obtained from the key provider")
+}
+
 func TestVerifyAPREQWithPrincipalOverride(t *testing.T) {
 	t.Parallel()
 	cl := getClient()
@@ -157,6 +273,150 @@ func TestVerifyAPREQ_KRB_AP_ERR_BADMATCH(t *testing.T) {
 	}
 }
 
+func TestVerifyAPREQ_EtypeNotPermitted(t *testing.T) {
+	t.Parallel()
+	cl := getClient()
+	sname := types.PrincipalName{
+		NameType:   nametype.KRB_NT_PRINCIPAL,
+		NameString: []string{"HTTP", "host.test.gokrb5"},
+	}
+	kt := keytab.New()
+	err := kt.AddEntry("HTTP/host.test.gokrb5", "TEST.GOKRB5", "passwordvalue", time.Now(), 1, etypeID.DES_CBC_MD5)
+	if err != nil {
+		t.Fatalf("Error creating test keytab: %v", err)
+	}
+	st := time.Now().UTC()
+	tkt, sessionKey, err := messages.NewTicket(cl.Credentials.CName(), cl.Credentials.Domain(),
+		sname, "TEST.GOKRB5",
+		types.NewKrbFlags(),
+		kt,
+		etypeID.DES_CBC_MD5,
+		1,
+		st,
+		st,
+		st.Add(time.Duration(24)*time.Hour),
+		st.Add(time.Duration(48)*time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test ticket: %v", err)
+	}
+	APReq, err := messages.NewAPReq(
+		tkt,
+		sessionKey,
+		newTestAuthenticator(*cl.Credentials),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test AP_REQ: %v", err)
+	}
+	h, _ := types.GetHostAddress("127.0.0.1:1234")
+	s := NewSettings(kt, ClientAddress(h))
+	ok, _, err := VerifyAPREQ(&APReq, s)
+	if ok || err == nil {
+		t.Fatal("Validation of AP_REQ with DES ticket passed when it should not have")
+	}
+	if _, ok := err.(messages.KRBError); ok {
+		assert.Equal(t, errorcode.KDC_ERR_ETYPE_NOSUPP, err.(messages.KRBError).ErrorCode, "Error code not as expected")
+	} else {
+		t.Fatalf("Error is not a KRBError: %v", err)
+	}
+
+	// Explicitly permitting the weak etype allows the ticket
+	s = NewSettings(kt, ClientAddress(h), PermittedEnctypes([]int32{etypeID.DES_CBC_MD5, etypeID.AES256_CTS_HMAC_SHA1_96}))
+	ok, _, err = VerifyAPREQ(&APReq, s)
+	if !ok || err != nil {
+		t.Fatalf("Validation of AP_REQ failed when it should not have: %v", err)
+	}
+
+	// The authenticator subkey etype must also be permitted
+	s = NewSettings(kt, ClientAddress(h), PermittedEnctypes([]int32{etypeID.DES_CBC_MD5}))
+	ok, _, err = VerifyAPREQ(&APReq, s)
+	assert.False(t, ok)
+	if assert.IsType(t, messages.KRBError{}, err) {
+		assert.Equal(t, errorcode.KDC_ERR_ETYPE_NOSUPP, err.(messages.KRBError).ErrorCode, "Error code not as expected")
+		assert.Contains(t, err.Error(), "authenticator subkey etype", "Error not for the authenticator subkey")
+	}
+
+	// The etypes must be enabled in the service's etype registry
+	r := crypto.DefaultRegistry().Clone()
+	r.Disable(etypeID.DES_CBC_MD5)
+	s = NewSettings(kt, ClientAddress(h), EtypeRegistry(r), PermittedEnctypes([]int32{etypeID.DES_CBC_MD5, etypeID.AES256_CTS_HMAC_SHA1_96}))
+	ok, _, err = VerifyAPREQ(&APReq, s)
+	assert.False(t, ok)
+	if assert.IsType(t, messages.KRBError{}, err) {
+		assert.Equal(t, errorcode.KDC_ERR_ETYPE_NOSUPP, err.(messages.KRBError).ErrorCode, "Error code not as expected")
+	}
+
+	// Only the permitted etypes are accepted
+	s = NewSettings(kt, ClientAddress(h), PermittedEnctypes([]int32{etypeID.AES256_CTS_HMAC_SHA1_96}))
+	ok, _, err = VerifyAPREQ(&APReq, s)
+	assert.False(t, ok)
+	if assert.IsType(t, messages.KRBError{}, err) {
+		assert.Equal(t, errorcode.KDC_ERR_ETYPE_NOSUPP, err.(messages.KRBError).ErrorCode, "Error code not as expected")
+	}
+
+	// The session key etype must also be permitted
+	err = kt.AddEntry("HTTP/host.test.gokrb5", "TEST.GOKRB5", "passwordvalue", time.Now(), 1, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("Error adding to test keytab: %v", err)
+	}
+	tkt = newTestTicketWithSessionKeyEtype(t, cl.Credentials, sname, kt, etypeID.AES256_CTS_HMAC_SHA1_96, etypeID.DES_CBC_MD5, st)
+	APReq, err = messages.NewAPReq(tkt, tkt.DecryptedEncPart.Key, newTestAuthenticator(*cl.Credentials))
+	if err != nil {
+		t.Fatalf("Error getting test AP_REQ: %v", err)
+	}
+	s = NewSettings(kt, ClientAddress(h), PermittedEnctypes([]int32{etypeID.AES256_CTS_HMAC_SHA1_96}))
+	ok, _, err = VerifyAPREQ(&APReq, s)
+	assert.False(t, ok)
+	if assert.IsType(t, messages.KRBError{}, err) {
+		assert.Equal(t, errorcode.KDC_ERR_ETYPE_NOSUPP, err.(messages.KRBError).ErrorCode, "Error code not as expected")
+		assert.Contains(t, err.Error(), "session key etype", "Error not for the session key")
+	}
+}
+
+// newTestTicketWithSessionKeyEtype creates a ticket encrypted with the service key of etype tktEtype carrying a
+// session key of etype keyEtype, which messages.NewTicket cannot do as it uses the same etype for both.
+func newTestTicketWithSessionKeyEtype(t *testing.T, creds *credentials.Credentials, sname types.PrincipalName, kt *keytab.Keytab, tktEtype, keyEtype int32, st time.Time) messages.Ticket {
+	t.Helper()
+	et, err := crypto.GetEtype(keyEtype)
+	if err != nil {
+		t.Fatalf("Error getting etype: %v", err)
+	}
+	sessionKey, err := types.GenerateEncryptionKey(et)
+	if err != nil {
+		t.Fatalf("Error generating session key: %v", err)
+	}
+	etp := messages.EncTicketPart{
+		Flags:     types.NewKrbFlags(),
+		Key:       sessionKey,
+		CRealm:    creds.Domain(),
+		CName:     creds.CName(),
+		AuthTime:  st,
+		StartTime: st,
+		EndTime:   st.Add(time.Duration(24) * time.Hour),
+		RenewTill: st.Add(time.Duration(48) * time.Hour),
+	}
+	b, err := asn1.Marshal(etp)
+	if err != nil {
+		t.Fatalf("Error marshalling ticket encpart: %v", err)
+	}
+	b = asn1tools.AddASNAppTag(b, asnAppTag.EncTicketPart)
+	skey, _, err := kt.GetEncryptionKey(sname, "TEST.GOKRB5", 1, tktEtype)
+	if err != nil {
+		t.Fatalf("Error getting service key: %v", err)
+	}
+	ed, err := crypto.GetEncryptedData(b, skey, keyusage.KDC_REP_TICKET, 1)
+	if err != nil {
+		t.Fatalf("Error encrypting ticket encpart: %v", err)
+	}
+	return messages.Ticket{
+		TktVNO:           iana.PVNO,
+		Realm:            "TEST.GOKRB5",
+		SName:            sname,
+		EncPart:          ed,
+		DecryptedEncPart: etp,
+	}
+}
+
 func TestVerifyAPREQ_LargeClockSkew(t *testing.T) {
 	t.Parallel()
 	cl := getClient()
@@ -5,6 +5,8 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/oiweiwei/gokrb5.fork/v9/config"
+	"github.com/oiweiwei/gokrb5.fork/v9/crypto"
 	"github.com/oiweiwei/gokrb5.fork/v9/keytab"
 	"github.com/oiweiwei/gokrb5.fork/v9/types"
 )
@@ -20,6 +22,11 @@ type Settings struct {
 	maxClockSkew       time.Duration
 	logger             *log.Logger
 	sessionMgr         SessionMgr
+	keyProvider        keytab.KeyProvider
+	permittedEtypes    []int32
+	registry           *crypto.Registry
+	transitedPolicy    *config.Config
+	authToLocal        *config.Config
 }
 
 // NewSettings creates a new service Settings.
@@ -104,6 +111,104 @@ func (s *Settings) KeytabPrincipal() *types.PrincipalName {
 	return s.ktprinc
 }
 
+// KeyProvider used to configure the service to obtain its keys from the key provider rather than the keytab.
+// The keys are used through the crypto.Key interface, so the key provider decides how they are held.
+//
+// s := NewSettings(nil, KeyProvider(kp))
+func KeyProvider(kp keytab.KeyProvider) func(*Settings) {
+	return func(s *Settings) {
+		s.keyProvider = kp
+	}
+}
+
+// KeyProvider returns the key provider used to obtain the service's keys.
+// If none is configured the service's keytab is returned.
+func (s *Settings) KeyProvider() keytab.KeyProvider {
+	if s.keyProvider != nil {
+		return s.keyProvider
+	}
+	return s.Keytab
+}
+
+// PermittedEnctypes used to configure the encryption types the service will accept for tickets, session keys and
+// authenticator subkeys, such as the permitted_enctypes of the krb5.conf configuration.
+//
+// s := NewSettings(kt, PermittedEnctypes(cfg.LibDefaults.PermittedEnctypeIDs))
+func PermittedEnctypes(ids []int32) func(*Settings) {
+	return func(s *Settings) {
+		s.permittedEtypes = ids
+	}
+}
+
+// EtypeRegistry used to configure the registry of encryption types the service accepts in place of the crypto
+// package's default registry, such as the registry of the krb5.conf configuration.
+//
+// s := NewSettings(kt, EtypeRegistry(cfg.EtypeRegistry()), PermittedEnctypes(cfg.LibDefaults.PermittedEnctypeIDs))
+func EtypeRegistry(r *crypto.Registry) func(*Settings) {
+	return func(s *Settings) {
+		s.registry = r
+	}
+}
+
+// EtypeRegistry returns the registry of encryption types the service accepts.
+func (s *Settings) EtypeRegistry() *crypto.Registry {
+	if s.registry == nil {
+		return crypto.DefaultRegistry()
+	}
+	return s.registry
+}
+
+// EtypePermitted returns true if the service accepts the encryption type.
+// The encryption type must be enabled in the service's etype registry. If permitted encryption types have not been
+// configured all encryption types enabled in the registry are accepted except those deemed weak.
+func (s *Settings) EtypePermitted(id int32) bool {
+	if !s.EtypeRegistry().Enabled(id) {
+		return false
+	}
+	if s.permittedEtypes == nil {
+		return !config.IsWeakEtype(id)
+	}
+	for _, p := range s.permittedEtypes {
+		if p == id {
+			return true
+		}
+	}
+	return false
+}
+
+// TransitedPolicy used to configure the service to check the realms transited by cross-realm tickets are on the
+// authentication paths of the configuration, such as those of its [capaths] section. Tickets the KDC has marked as
+// transited policy checked are accepted without being checked by the service.
+//
+// s := NewSettings(kt, TransitedPolicy(cfg))
+func TransitedPolicy(c *config.Config) func(*Settings) {
+	return func(s *Settings) {
+		s.transitedPolicy = c
+	}
+}
+
+// TransitedPolicy returns the configuration the realms transited by tickets are checked against, or nil if they are
+// not checked.
+func (s *Settings) TransitedPolicy() *config.Config {
+	return s.transitedPolicy
+}
+
+// AuthToLocal used to configure the service to map the principal names of authenticated clients to local user names
+// using the auth_to_local rules of the configuration. The local name is set on the client's credentials.
+//
+// s := NewSettings(kt, AuthToLocal(cfg))
+func AuthToLocal(c *config.Config) func(*Settings) {
+	return func(s *Settings) {
+		s.authToLocal = c
+	}
+}
+
+// AuthToLocal returns the configuration used to map client principal names to local user names, or nil if they are
+// not mapped.
+func (s *Settings) AuthToLocal() *config.Config {
+	return s.authToLocal
+}
+
 // MaxClockSkew used to configure service side with the maximum acceptable clock skew
 // between the service and the issue time of kerberos tickets
 //
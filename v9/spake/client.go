@@ -0,0 +1,213 @@
+package spake
+
+import (
+	"encoding/binary"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/oiweiwei/gokrb5.fork/v9/crypto"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/keyusage"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/patype"
+	"github.com/oiweiwei/gokrb5.fork/v9/krberror"
+	"github.com/oiweiwei/gokrb5.fork/v9/types"
+)
+
+// SecondFactor returns the response data for the second factor the KDC offers in its challenge.
+type SecondFactor func(factor SPAKESecondFactor) ([]byte, error)
+
+// Client holds the client side state of a SPAKE pre-authentication exchange.
+type Client struct {
+	r       *crypto.Registry
+	key     types.EncryptionKey
+	groups  []int32
+	support []byte
+}
+
+// NewClient creates the client side of a SPAKE exchange using the client's long-term key as the initial reply key.
+// The etypes of the registry, such as that returned by config.Config EtypeRegistry, are used to derive and encrypt
+// with the keys of the exchange. If no groups are provided all supported groups are offered, in order of preference.
+func NewClient(r *crypto.Registry, replyKey types.EncryptionKey, groups ...int32) *Client {
+	if len(groups) == 0 {
+		groups = []int32{GroupEdwards25519, GroupP256, GroupP384, GroupP521}
+	}
+	return &Client{
+		r:      r,
+		key:    replyKey,
+		groups: groups,
+	}
+}
+
+// Support returns the PA-SPAKE support message listing the client's groups.
+// This is sent in response to an empty PA-SPAKE from the KDC and is included in the transcript hash.
+func (c *Client) Support() (types.PAData, error) {
+	msg := PASPAKE{
+		Choice:  MessageSupport,
+		Support: SPAKESupport{Groups: c.groups},
+	}
+	b, err := msg.Marshal()
+	if err != nil {
+		return types.PAData{}, err
+	}
+	c.support = b
+	return types.PAData{
+		PADataType:  patype.PA_SPAKE,
+		PADataValue: b,
+	}, nil
+}
+
+// Response returns the PA-SPAKE response to the KDC's challenge in pa and the reply key with which the KDC will
+// encrypt the AS_REP. reqBody is the marshaled body of the AS_REQ in which the response will be sent.
+//
+// The SF-NONE second factor is used if the KDC offers it, otherwise the first factor offered is answered with the
+// data returned by sf.
+func (c *Client) Response(pa types.PAData, reqBody []byte, sf SecondFactor) (types.PAData, types.EncryptionKey, error) {
+	var msg PASPAKE
+	if err := msg.Unmarshal(pa.PADataValue); err != nil {
+		return types.PAData{}, types.EncryptionKey{}, err
+	}
+	if msg.Choice != MessageChallenge {
+		return types.PAData{}, types.EncryptionKey{}, krberror.NewErrorf(krberror.KRBMsgError, "PA-SPAKE message %d is not a challenge", msg.Choice)
+	}
+	ch := msg.Challenge
+	if !c.offered(ch.Group) {
+		return types.PAData{}, types.EncryptionKey{}, krberror.NewErrorf(krberror.KRBMsgError, "KDC challenge uses SPAKE group %d which was not offered", ch.Group)
+	}
+	g, err := getGroup(ch.Group)
+	if err != nil {
+		return types.PAData{}, types.EncryptionKey{}, krberror.Errorf(err, krberror.KRBMsgError, "SPAKE group not supported")
+	}
+	factor, err := secondFactor(ch.Factors, sf)
+	if err != nil {
+		return types.PAData{}, types.EncryptionKey{}, err
+	}
+
+	wbytes, err := c.r.PRFPlus(c.key, append([]byte("SPAKEsecret"), be32(ch.Group)...), g.multLen())
+	if err != nil {
+		return types.PAData{}, types.EncryptionKey{}, krberror.Errorf(err, krberror.EncryptingError, "error deriving SPAKE multiplier")
+	}
+	w := g.multiplier(wbytes)
+	x, pub, err := g.keygen(w, false)
+	if err != nil {
+		return types.PAData{}, types.EncryptionKey{}, krberror.Errorf(err, krberror.EncryptingError, "error generating SPAKE key")
+	}
+	K, err := g.result(w, x, ch.PubKey, false)
+	if err != nil {
+		return types.PAData{}, types.EncryptionKey{}, krberror.Errorf(err, krberror.EncryptingError, "error computing SPAKE result from KDC public key")
+	}
+	tk := append(append([]byte{}, pub...), K...)
+	thash := transcriptHash(g, c.support, pa.PADataValue, tk)
+
+	fkey, err := deriveKey(c.r, g, c.key, wbytes, K, thash, reqBody, 1)
+	if err != nil {
+		return types.PAData{}, types.EncryptionKey{}, err
+	}
+	fb, err := asn1.Marshal(factor)
+	if err != nil {
+		return types.PAData{}, types.EncryptionKey{}, krberror.Errorf(err, krberror.EncodingError, "error marshaling SPAKE second factor")
+	}
+	ed, err := c.r.GetEncryptedData(fb, fkey, keyusage.KEY_USAGE_SPAKE, 0)
+	if err != nil {
+		return types.PAData{}, types.EncryptionKey{}, krberror.Errorf(err, krberror.EncryptingError, "error encrypting SPAKE second factor")
+	}
+	replyKey, err := deriveKey(c.r, g, c.key, wbytes, K, thash, reqBody, 0)
+	if err != nil {
+		return types.PAData{}, types.EncryptionKey{}, err
+	}
+	resp := PASPAKE{
+		Choice: MessageResponse,
+		Response: SPAKEResponse{
+			PubKey: pub,
+			Factor: ed,
+		},
+	}
+	b, err := resp.Marshal()
+	if err != nil {
+		return types.PAData{}, types.EncryptionKey{}, err
+	}
+	return types.PAData{
+		PADataType:  patype.PA_SPAKE,
+		PADataValue: b,
+	}, replyKey, nil
+}
+
+// offered indicates if the client offers the group.
+func (c *Client) offered(id int32) bool {
+	for _, g := range c.groups {
+		if g == id {
+			return true
+		}
+	}
+	return false
+}
+
+// secondFactor chooses the second factor from those offered by the KDC and returns it with the client's response data.
+func secondFactor(factors []SPAKESecondFactor, sf SecondFactor) (SPAKESecondFactor, error) {
+	if len(factors) == 0 {
+		return SPAKESecondFactor{}, krberror.New(krberror.KRBMsgError, "KDC challenge offers no SPAKE second factors")
+	}
+	for _, f := range factors {
+		if f.Type == SecondFactorNone {
+			return SPAKESecondFactor{Type: SecondFactorNone}, nil
+		}
+	}
+	if sf == nil {
+		return SPAKESecondFactor{}, krberror.NewErrorf(krberror.KRBMsgError, "SPAKE second factor type %d required but no second factor callback provided", factors[0].Type)
+	}
+	d, err := sf(factors[0])
+	if err != nil {
+		return SPAKESecondFactor{}, krberror.Errorf(err, krberror.KRBMsgError, "error getting SPAKE second factor type %d", factors[0].Type)
+	}
+	return SPAKESecondFactor{
+		Type: factors[0].Type,
+		Data: d,
+	}, nil
+}
+
+// transcriptHash returns the transcript hash over the support message, if one was sent, the KDC's challenge and
+// the client's public key followed by the SPAKE result.
+// Each update is THash = H(THash || data) starting from a hash length string of zero bytes.
+func transcriptHash(g group, msgs ...[]byte) []byte {
+	h := g.newHash()
+	thash := make([]byte, h.Size())
+	for _, m := range msgs {
+		if m == nil {
+			continue
+		}
+		h.Reset()
+		h.Write(thash)
+		h.Write(m)
+		thash = h.Sum(nil)
+	}
+	return thash
+}
+
+// deriveKey returns the key K'[n] of the initial reply key's etype from the registry:
+// random-to-key(PRF+(key, "SPAKEkey" || group || etype || w || K || THash || KDC-REQ-BODY || n)).
+func deriveKey(r *crypto.Registry, g group, key types.EncryptionKey, wbytes, K, thash, reqBody []byte, n uint32) (types.EncryptionKey, error) {
+	et, err := r.GetEtype(key.KeyType)
+	if err != nil {
+		return types.EncryptionKey{}, krberror.Errorf(err, krberror.EncryptingError, "error getting etype of SPAKE reply key")
+	}
+	var b []byte
+	b = append(b, "SPAKEkey"...)
+	b = append(b, be32(g.id())...)
+	b = append(b, be32(et.GetETypeID())...)
+	b = append(b, wbytes...)
+	b = append(b, K...)
+	b = append(b, thash...)
+	b = append(b, reqBody...)
+	b = append(b, be32(int32(n))...)
+	seed, err := r.PRFPlus(key, b, crypto.KeySeedByteSize(et))
+	if err != nil {
+		return types.EncryptionKey{}, krberror.Errorf(err, krberror.EncryptingError, "error deriving SPAKE key %d", n)
+	}
+	return types.EncryptionKey{
+		KeyType:  key.KeyType,
+		KeyValue: et.RandomToKey(seed),
+	}, nil
+}
+
+func be32(i int32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(i))
+	return b
+}
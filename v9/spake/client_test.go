@@ -0,0 +1,206 @@
+package spake
+
+import (
+	"testing"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/oiweiwei/gokrb5.fork/v9/crypto"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/etypeID"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/keyusage"
+	"github.com/oiweiwei/gokrb5.fork/v9/iana/patype"
+	"github.com/oiweiwei/gokrb5.fork/v9/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// TODO add the draft-ietf-kitten-krb-spake-preauth appendix B vectors (w, x, y, T, S, K, THash and K'[0..3]) for each
+// group. Until then the exchange is only checked against this KDC, which shares the group implementations.
+
+// testKDC is the KDC side of a SPAKE exchange.
+type testKDC struct {
+	key     types.EncryptionKey
+	g       group
+	wbytes  []byte
+	w       []byte
+	y       []byte
+	support []byte
+	chal    []byte
+}
+
+func newTestKDC(t *testing.T, key types.EncryptionKey, id int32, support []byte) *testKDC {
+	g, err := getGroup(id)
+	if err != nil {
+		t.Fatalf("error getting group: %v", err)
+	}
+	wbytes, err := crypto.PRFPlus(key, append([]byte("SPAKEsecret"), be32(id)...), g.multLen())
+	if err != nil {
+		t.Fatalf("error deriving multiplier: %v", err)
+	}
+	return &testKDC{
+		key:     key,
+		g:       g,
+		wbytes:  wbytes,
+		w:       g.multiplier(wbytes),
+		support: support,
+	}
+}
+
+func (k *testKDC) challenge(t *testing.T, factors ...SPAKESecondFactor) types.PAData {
+	y, pub, err := k.g.keygen(k.w, true)
+	if err != nil {
+		t.Fatalf("error generating KDC key: %v", err)
+	}
+	k.y = y
+	msg := PASPAKE{
+		Choice: MessageChallenge,
+		Challenge: SPAKEChallenge{
+			Group:   k.g.id(),
+			PubKey:  pub,
+			Factors: factors,
+		},
+	}
+	b, err := msg.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling challenge: %v", err)
+	}
+	k.chal = b
+	return types.PAData{PADataType: patype.PA_SPAKE, PADataValue: b}
+}
+
+// verify returns the second factor in the client's response and the reply key.
+func (k *testKDC) verify(t *testing.T, pa types.PAData, reqBody []byte) (SPAKESecondFactor, types.EncryptionKey) {
+	var msg PASPAKE
+	if err := msg.Unmarshal(pa.PADataValue); err != nil {
+		t.Fatalf("error unmarshaling response: %v", err)
+	}
+	if msg.Choice != MessageResponse {
+		t.Fatalf("message is not a response: %d", msg.Choice)
+	}
+	K, err := k.g.result(k.w, k.y, msg.Response.PubKey, true)
+	if err != nil {
+		t.Fatalf("error computing result: %v", err)
+	}
+	tk := append(append([]byte{}, msg.Response.PubKey...), K...)
+	thash := transcriptHash(k.g, k.support, k.chal, tk)
+	fkey, err := deriveKey(crypto.DefaultRegistry(), k.g, k.key, k.wbytes, K, thash, reqBody, 1)
+	if err != nil {
+		t.Fatalf("error deriving factor key: %v", err)
+	}
+	var f SPAKESecondFactor
+	b, err := crypto.DecryptEncPart(msg.Response.Factor, fkey, keyusage.KEY_USAGE_SPAKE)
+	if err == nil {
+		_, err = asn1.Unmarshal(b, &f)
+	}
+	if err != nil {
+		return f, types.EncryptionKey{}
+	}
+	replyKey, err := deriveKey(crypto.DefaultRegistry(), k.g, k.key, k.wbytes, K, thash, reqBody, 0)
+	if err != nil {
+		t.Fatalf("error deriving reply key: %v", err)
+	}
+	return f, replyKey
+}
+
+func testKey(t *testing.T, etype int32) types.EncryptionKey {
+	key, _, err := crypto.GetKeyFromPassword("passwordvalue", types.NewPrincipalName(1, "testuser1"), "TEST.GOKRB5", etype, types.PADataSequence{})
+	if err != nil {
+		t.Fatalf("error getting key from password: %v", err)
+	}
+	return key
+}
+
+func TestClient_Response(t *testing.T) {
+	t.Parallel()
+	reqBody := []byte("kdc-req-body")
+	var tests = []struct {
+		group int32
+		etype int32
+	}{
+		{GroupEdwards25519, etypeID.AES256_CTS_HMAC_SHA1_96},
+		{GroupP256, etypeID.AES128_CTS_HMAC_SHA256_128},
+		{GroupP384, etypeID.AES256_CTS_HMAC_SHA384_192},
+		{GroupP521, etypeID.AES128_CTS_HMAC_SHA1_96},
+	}
+	for _, test := range tests {
+		key := testKey(t, test.etype)
+		cl := NewClient(crypto.DefaultRegistry(), key)
+		support, err := cl.Support()
+		if err != nil {
+			t.Fatalf("error creating support message: %v", err)
+		}
+		var msg PASPAKE
+		if err := msg.Unmarshal(support.PADataValue); err != nil {
+			t.Fatalf("error unmarshaling support message: %v", err)
+		}
+		assert.Equal(t, MessageSupport, msg.Choice, "support message choice not as expected")
+		assert.Equal(t, []int32{GroupEdwards25519, GroupP256, GroupP384, GroupP521}, msg.Support.Groups, "groups not as expected")
+
+		kdc := newTestKDC(t, key, test.group, support.PADataValue)
+		pa, replyKey, err := cl.Response(kdc.challenge(t, SPAKESecondFactor{Type: SecondFactorNone}), reqBody, nil)
+		if !assert.NoError(t, err, "error creating response for group %d", test.group) {
+			continue
+		}
+		f, kdcKey := kdc.verify(t, pa, reqBody)
+		assert.Equal(t, SecondFactorNone, f.Type, "second factor not as expected for group %d", test.group)
+		assert.Equal(t, kdcKey, replyKey, "reply keys do not match for group %d", test.group)
+		assert.Equal(t, test.etype, replyKey.KeyType, "reply key etype not as expected")
+		assert.NotEqual(t, key.KeyValue, replyKey.KeyValue, "reply key should not be the long-term key")
+	}
+}
+
+func TestClient_Response_WrongKey(t *testing.T) {
+	t.Parallel()
+	reqBody := []byte("kdc-req-body")
+	cl := NewClient(crypto.DefaultRegistry(), testKey(t, etypeID.AES256_CTS_HMAC_SHA1_96), GroupP256)
+	other, _, err := crypto.GetKeyFromPassword("wrongpassword", types.NewPrincipalName(1, "testuser1"), "TEST.GOKRB5", etypeID.AES256_CTS_HMAC_SHA1_96, types.PADataSequence{})
+	if err != nil {
+		t.Fatalf("error getting key from password: %v", err)
+	}
+	// The KDC sends an optimistic challenge so there is no support message
+	kdc := newTestKDC(t, other, GroupP256, nil)
+	pa, _, err := cl.Response(kdc.challenge(t, SPAKESecondFactor{Type: SecondFactorNone}), reqBody, nil)
+	if err != nil {
+		t.Fatalf("error creating response: %v", err)
+	}
+	_, kdcKey := kdc.verify(t, pa, reqBody)
+	assert.Equal(t, types.EncryptionKey{}, kdcKey, "KDC should not be able to decrypt the second factor")
+}
+
+func TestClient_Response_SecondFactor(t *testing.T) {
+	t.Parallel()
+	reqBody := []byte("kdc-req-body")
+	key := testKey(t, etypeID.AES256_CTS_HMAC_SHA1_96)
+
+	cl := NewClient(crypto.DefaultRegistry(), key, GroupP256)
+	kdc := newTestKDC(t, key, GroupP256, nil)
+	_, _, err := cl.Response(kdc.challenge(t, SPAKESecondFactor{Type: 2, Data: []byte("challenge")}), reqBody, nil)
+	assert.Error(t, err, "response should require a second factor callback")
+
+	var offered SPAKESecondFactor
+	pa, replyKey, err := cl.Response(kdc.challenge(t, SPAKESecondFactor{Type: 2, Data: []byte("challenge")}), reqBody,
+		func(f SPAKESecondFactor) ([]byte, error) {
+			offered = f
+			return []byte("123456"), nil
+		})
+	if err != nil {
+		t.Fatalf("error creating response: %v", err)
+	}
+	assert.Equal(t, SPAKESecondFactor{Type: 2, Data: []byte("challenge")}, offered, "factor passed to callback not as expected")
+	f, kdcKey := kdc.verify(t, pa, reqBody)
+	assert.Equal(t, SPAKESecondFactor{Type: 2, Data: []byte("123456")}, f, "second factor not as expected")
+	assert.Equal(t, kdcKey, replyKey, "reply keys do not match")
+
+	_, _, err = cl.Response(newTestKDC(t, key, GroupP384, nil).challenge(t, SPAKESecondFactor{Type: SecondFactorNone}), reqBody, nil)
+	assert.Error(t, err, "challenge with a group not offered should be rejected")
+}
+
+func TestClient_Response_Registry(t *testing.T) {
+	t.Parallel()
+	reqBody := []byte("kdc-req-body")
+	key := testKey(t, etypeID.AES256_CTS_HMAC_SHA1_96)
+	r := crypto.DefaultRegistry().Clone()
+	r.Disable(etypeID.AES256_CTS_HMAC_SHA1_96)
+	cl := NewClient(r, key, GroupP256)
+	kdc := newTestKDC(t, key, GroupP256, nil)
+	_, _, err := cl.Response(kdc.challenge(t, SPAKESecondFactor{Type: SecondFactorNone}), reqBody, nil)
+	assert.Error(t, err, "the reply key etype is disabled in the client's registry")
+}
@@ -0,0 +1,115 @@
+package spake
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+
+	"filippo.io/edwards25519"
+)
+
+// edwards25519 SPAKE constants (draft-ietf-kitten-krb-spake-preauth section 6).
+var (
+	ed25519M, _ = hex.DecodeString("d048032c6ea0b6d697ddc2e86bda85a33adac920f1bf18e1b0c6d166a5cecdaf")
+	ed25519N, _ = hex.DecodeString("d3bfb518f44f3430f29d0c92af503865a1ed3281dc69b35dd868ba85f886c4ab")
+)
+
+// edwards25519Group is the SPAKE group over edwards25519. Points are encoded as in RFC 8032 and scalars are 32 byte
+// little-endian. The arithmetic is constant time using filippo.io/edwards25519.
+type edwards25519Group struct{}
+
+func (edwards25519Group) id() int32 {
+	return GroupEdwards25519
+}
+
+func (edwards25519Group) multLen() int {
+	return 32
+}
+
+func (edwards25519Group) newHash() hash.Hash {
+	return sha256.New()
+}
+
+func (edwards25519Group) multiplier(wbytes []byte) []byte {
+	return edScalar(wbytes).Bytes()
+}
+
+func (edwards25519Group) keygen(w []byte, kdc bool) ([]byte, []byte, error) {
+	// The private scalar is a multiple of the cofactor so the small order component of the peer's public key is
+	// removed from the result.
+	x := make([]byte, 32)
+	if _, err := rand.Read(x); err != nil {
+		return nil, nil, err
+	}
+	x[0] &= 0xf8
+	x[31] &= 0x7f
+	mb, _ := edConstants(kdc)
+	m, err := edDecode(mb)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The base point has prime order so x*G is x reduced modulo the group order times G.
+	t := new(edwards25519.Point).ScalarBaseMult(edScalar(x))
+	t.Add(t, new(edwards25519.Point).ScalarMult(edScalar(w), m))
+	return x, t.Bytes(), nil
+}
+
+func (edwards25519Group) result(w, x, pub []byte, kdc bool) ([]byte, error) {
+	s, err := edDecode(pub)
+	if err != nil {
+		return nil, err
+	}
+	_, nb := edConstants(kdc)
+	n, err := edDecode(nb)
+	if err != nil {
+		return nil, err
+	}
+	p := new(edwards25519.Point).ScalarMult(edScalar(w), n)
+	p.Subtract(s, p)
+	// x is a multiple of the cofactor 8 so x*P is (x/8)*(8*P), where 8*P has prime order and so x/8 can be reduced
+	// modulo the group order.
+	k := new(edwards25519.Point).ScalarMult(edScalar(shiftRight3(x)), p.MultByCofactor(p))
+	if k.Equal(edwards25519.NewIdentityPoint()) == 1 {
+		return nil, errors.New("SPAKE result is the identity element")
+	}
+	return k.Bytes(), nil
+}
+
+// edConstants returns the M and N constants, which are swapped for the KDC.
+func edConstants(kdc bool) ([]byte, []byte) {
+	if kdc {
+		return ed25519N, ed25519M
+	}
+	return ed25519M, ed25519N
+}
+
+// edDecode decodes a point as in RFC 8032 section 5.1.3.
+func edDecode(b []byte) (*edwards25519.Point, error) {
+	p, err := new(edwards25519.Point).SetBytes(b)
+	if err != nil {
+		return nil, errors.New("invalid SPAKE group element")
+	}
+	return p, nil
+}
+
+// edScalar returns the 32 byte little-endian value reduced modulo the group order.
+func edScalar(b []byte) *edwards25519.Scalar {
+	wide := make([]byte, 64)
+	copy(wide, b)
+	s, _ := new(edwards25519.Scalar).SetUniformBytes(wide)
+	return s
+}
+
+// shiftRight3 returns the 32 byte little-endian value divided by 8.
+func shiftRight3(b []byte) []byte {
+	r := make([]byte, len(b))
+	for i := range b {
+		r[i] = b[i] >> 3
+		if i+1 < len(b) {
+			r[i] |= b[i+1] << 5
+		}
+	}
+	return r
+}
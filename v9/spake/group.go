@@ -0,0 +1,57 @@
+package spake
+
+import (
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+)
+
+// SPAKE groups.
+const (
+	GroupEdwards25519 int32 = 1
+	GroupP256         int32 = 2
+	GroupP384         int32 = 3
+	GroupP521         int32 = 4
+)
+
+// group is a SPAKE2 group with its M and N constants.
+type group interface {
+	// id returns the group number.
+	id() int32
+	// multLen returns the length in bytes of the multiplier derived from the reply key.
+	multLen() int
+	// newHash returns the hash function used for the transcript hash.
+	newHash() hash.Hash
+	// multiplier reduces the derived multiplier bytes to the encoding of a scalar.
+	multiplier(wbytes []byte) []byte
+	// keygen returns the encoding of a random private scalar x and the client public key T = x*G + w*M.
+	// For the KDC the public key is S = x*G + w*N.
+	keygen(w []byte, kdc bool) ([]byte, []byte, error)
+	// result returns the shared SPAKE result K = x*(S - w*N) for the KDC public key S.
+	// For the KDC the result is K = x*(T - w*M) for the client public key T.
+	result(w, x, pub []byte, kdc bool) ([]byte, error)
+}
+
+// getGroup returns the SPAKE group with the number provided.
+func getGroup(id int32) (group, error) {
+	switch id {
+	case GroupEdwards25519:
+		return edwards25519Group{}, nil
+	case GroupP256:
+		return newNISTGroup(id, elliptic.P256(), sha256.New,
+			"02886e2f97ace46e55ba9dd7242579f2993b64e16ef3dcab95afd497333d8fa12f",
+			"03d8bbd6c639c62937b04d997f38c3770719c629d7014d49a24b4f98baa1292b49"), nil
+	case GroupP384:
+		return newNISTGroup(id, elliptic.P384(), sha512.New384,
+			"030ff0895ae5ebf6187080a82d82b42e2765e3b2f8749c7e05eba366434b363d3dc36f15314739074d2eb8613fceec2853",
+			"02c72cf2e390853a1c1c4ad816a62fd15824f56078918f43f922ca21518f9c543bb252c5490214cf9aa3f0baab4b665c10"), nil
+	case GroupP521:
+		return newNISTGroup(id, elliptic.P521(), sha512.New,
+			"02003f06f38131b2ba2600791e82488e8d20ab889af753a41806c5db18d37d85608cfae06b82e4a72cd744c719193562a653ea1f119eef9356907edc9b56979962d7aa",
+			"0200c7924b9ec017f3094562894336a53c50167ba8c5963876880542bc669e494b2532d76c5b53dfb349fdf69154b9e0048c58a42e8ed04cef052a3bc349d95575cd25"), nil
+	default:
+		return nil, fmt.Errorf("SPAKE group %d not supported", id)
+	}
+}
@@ -0,0 +1,184 @@
+package spake
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"testing"
+
+	"filippo.io/edwards25519"
+	"github.com/stretchr/testify/assert"
+)
+
+// generateConstant derives a SPAKE M or N constant from its seed as described in RFC 9382 appendix A, hashing the
+// seed iteratively until the candidate is the encoding of a point of prime order.
+func generateConstant(seed string, size int, valid func([]byte) bool) []byte {
+	for i := 1; i < 1000; i++ {
+		var b []byte
+		for j := i; len(b) < size; j++ {
+			h := []byte(seed)
+			for k := 0; k < j; k++ {
+				s := sha256.Sum256(h)
+				h = s[:]
+			}
+			b = append(b, h...)
+		}
+		b = b[:size]
+		if valid(b) {
+			return b
+		}
+	}
+	return nil
+}
+
+func TestGroup_Constants(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		id   int32
+		name string
+	}{
+		{GroupEdwards25519, "edwards25519"},
+		{GroupP256, "1.2.840.10045.3.1.7"},
+		{GroupP384, "1.3.132.0.34"},
+		{GroupP521, "1.3.132.0.35"},
+	}
+	for _, test := range tests {
+		g, err := getGroup(test.id)
+		if !assert.NoError(t, err, "error getting group %d", test.id) {
+			continue
+		}
+		var m, n []byte
+		var valid func([]byte) bool
+		var size int
+		switch g := g.(type) {
+		case nistGroup:
+			m, n = g.m, g.n
+			size = 1 + g.multLen()
+			valid = func(b []byte) bool {
+				b[0] = b[0]&1 | 2
+				// The curves have prime order so every point other than the identity, which has no encoding, does
+				_, _, err := g.point(b)
+				return err == nil
+			}
+		case edwards25519Group:
+			m, n = ed25519M, ed25519N
+			size = 32
+			valid = func(b []byte) bool {
+				p, err := edDecode(b)
+				if err != nil {
+					return false
+				}
+				l := edScalar(nil)
+				// The point has prime order if (L-1)*P + P is the identity, with L-1 being -1 modulo L
+				l.Subtract(l, edScalar([]byte{1}))
+				q := new(edwards25519.Point).ScalarMult(l, p)
+				return q.Add(q, p).Equal(edwards25519.NewIdentityPoint()) == 1
+			}
+		}
+		assert.Equal(t, hex.EncodeToString(m), hex.EncodeToString(generateConstant(test.name+" point generation seed (M)", size, valid)),
+			"M of group %d not as derived from its seed", test.id)
+		assert.Equal(t, hex.EncodeToString(n), hex.EncodeToString(generateConstant(test.name+" point generation seed (N)", size, valid)),
+			"N of group %d not as derived from its seed", test.id)
+	}
+	_, err := getGroup(5)
+	assert.Error(t, err, "group 5 should not be supported")
+}
+
+func TestNISTGroup_ScalarMult(t *testing.T) {
+	t.Parallel()
+	// The public key of an ECDH key pair is the private scalar times the base point.
+	var tests = []struct {
+		id    int32
+		curve ecdh.Curve
+	}{
+		{GroupP256, ecdh.P256()},
+		{GroupP384, ecdh.P384()},
+		{GroupP521, ecdh.P521()},
+	}
+	for _, test := range tests {
+		grp, _ := getGroup(test.id)
+		g := grp.(nistGroup)
+		for i := 0; i < 4; i++ {
+			k, err := test.curve.GenerateKey(rand.Reader)
+			if err != nil {
+				t.Fatalf("error generating key: %v", err)
+			}
+			pub := k.PublicKey().Bytes()
+			size := g.multLen()
+			want := append([]byte{2 | pub[2*size]&1}, pub[1:1+size]...)
+			b, err := g.encode(g.curve.ScalarBaseMult(k.Bytes()))
+			if !assert.NoError(t, err, "error encoding point of group %d", test.id) {
+				continue
+			}
+			assert.Equal(t, want, b, "scalar multiplication of the base point of group %d not as expected", test.id)
+
+			// The x coordinate of the scalar times the peer's public key is the ECDH shared secret
+			peer, _ := test.curve.GenerateKey(rand.Reader)
+			pb := peer.PublicKey().Bytes()
+			px, py, err := g.point(append([]byte{2 | pb[2*size]&1}, pb[1:1+size]...))
+			if err != nil {
+				t.Fatalf("error decoding point: %v", err)
+			}
+			secret, _ := k.ECDH(peer.PublicKey())
+			b, _ = g.encode(g.curve.ScalarMult(px, py, k.Bytes()))
+			assert.Equal(t, secret, b[1:], "scalar multiplication of a point of group %d not as expected", test.id)
+		}
+		_, err := g.encode(g.curve.ScalarBaseMult(g.curve.Params().N.Bytes()))
+		assert.Error(t, err, "the identity should not be encoded")
+		_, _, err = g.point(append([]byte{2}, g.curve.Params().P.FillBytes(make([]byte, g.multLen()))...))
+		assert.Error(t, err, "a coordinate not less than the field modulus should not decode")
+	}
+}
+
+func TestEdwards25519_Result(t *testing.T) {
+	t.Parallel()
+	// The public key of an Ed25519 key pair is the encoding of the clamped scalar times the base point.
+	seed, _ := hex.DecodeString("9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60")
+	pub := ed25519.NewKeyFromSeed(seed).Public().(ed25519.PublicKey)
+	h := sha512.Sum512(seed)
+	h[0] &= 0xf8
+	h[31] &= 0x7f
+	h[31] |= 0x40
+	assert.Equal(t, []byte(pub), new(edwards25519.Point).ScalarBaseMult(edScalar(h[:32])).Bytes(),
+		"scalar multiplication of the base point not as expected")
+
+	// A small order component of the peer's public key is removed from the result by the cofactor in the private scalar.
+	g := edwards25519Group{}
+	w := g.multiplier(bytes.Repeat([]byte{0xff}, 32))
+	_, s, err := g.keygen(w, true)
+	if err != nil {
+		t.Fatalf("error generating KDC key: %v", err)
+	}
+	x, _, err := g.keygen(w, false)
+	if err != nil {
+		t.Fatalf("error generating client key: %v", err)
+	}
+	// A point of order 8
+	torsion, _ := hex.DecodeString("26e8958fc2b227b045c3f489f2ef98f0d5dfac05d3c63339b13802886d53fc05")
+	tp, err := edDecode(torsion)
+	if err != nil {
+		t.Fatalf("error decoding small order point: %v", err)
+	}
+	assert.Equal(t, 1, new(edwards25519.Point).MultByCofactor(tp).Equal(edwards25519.NewIdentityPoint()), "point does not have small order")
+	sp, _ := edDecode(s)
+	k, err := g.result(w, x, s, false)
+	if err != nil {
+		t.Fatalf("error computing result: %v", err)
+	}
+	kt, err := g.result(w, x, sp.Add(sp, tp).Bytes(), false)
+	if err != nil {
+		t.Fatalf("error computing result: %v", err)
+	}
+	assert.Equal(t, k, kt, "small order component should not change the result")
+	n, _ := edDecode(ed25519N)
+	wn := new(edwards25519.Point).ScalarMult(edScalar(w), n)
+	_, err = g.result(w, x, wn.Add(wn, tp).Bytes(), false)
+	assert.Error(t, err, "result for a public key of w*N plus a small order point should be the identity")
+
+	_, err = edDecode(make([]byte, 31))
+	assert.Error(t, err, "short encoding should not decode")
+}
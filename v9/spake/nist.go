@@ -0,0 +1,131 @@
+package spake
+
+import (
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"math/big"
+
+	"filippo.io/bigmod"
+)
+
+// nistGroup is a SPAKE group over a NIST prime curve. Points are SEC 1 compressed and scalars are big-endian.
+// The point arithmetic is that of the standard library's crypto/elliptic curves, which is implemented by its audited,
+// constant time nistec package (the package also published as filippo.io/nistec). The scalars are reduced in constant
+// time with filippo.io/bigmod.
+type nistGroup struct {
+	group int32
+	curve elliptic.Curve
+	hash  func() hash.Hash
+	m, n  []byte
+	// fn is the group order.
+	fn *bigmod.Modulus
+}
+
+func newNISTGroup(id int32, curve elliptic.Curve, h func() hash.Hash, m, n string) nistGroup {
+	mb, _ := hex.DecodeString(m)
+	nb, _ := hex.DecodeString(n)
+	g := nistGroup{
+		group: id,
+		curve: curve,
+		hash:  h,
+		m:     mb,
+		n:     nb,
+	}
+	g.fn, _ = bigmod.NewModulus(curve.Params().N.Bytes())
+	return g
+}
+
+func (g nistGroup) id() int32 {
+	return g.group
+}
+
+func (g nistGroup) multLen() int {
+	return (g.curve.Params().BitSize + 7) / 8
+}
+
+func (g nistGroup) newHash() hash.Hash {
+	return g.hash()
+}
+
+func (g nistGroup) multiplier(wbytes []byte) []byte {
+	return g.scalar(wbytes).Bytes(g.fn)
+}
+
+// scalar returns the big-endian value reduced modulo the group order.
+func (g nistGroup) scalar(b []byte) *bigmod.Nat {
+	// The value is first set modulo 2^(8*len(b)), which it is always less than, so that it can be reduced.
+	wide, _ := bigmod.NewModulus(append([]byte{1}, make([]byte, len(b))...))
+	v, _ := bigmod.NewNat().SetBytes(b, wide)
+	return bigmod.NewNat().Mod(v, g.fn)
+}
+
+// constants returns the M and N constants, which are swapped for the KDC.
+func (g nistGroup) constants(kdc bool) ([]byte, []byte) {
+	if kdc {
+		return g.n, g.m
+	}
+	return g.m, g.n
+}
+
+func (g nistGroup) keygen(w []byte, kdc bool) ([]byte, []byte, error) {
+	// 64 bits more than the group order are reduced so the bias of the scalar is negligible.
+	rb := make([]byte, g.fn.Size()+8)
+	if _, err := rand.Read(rb); err != nil {
+		return nil, nil, err
+	}
+	x := g.scalar(rb).Bytes(g.fn)
+	mb, _ := g.constants(kdc)
+	mx, my, err := g.point(mb)
+	if err != nil {
+		return nil, nil, err
+	}
+	tx, ty := g.curve.ScalarBaseMult(x)
+	wx, wy := g.curve.ScalarMult(mx, my, w)
+	pub, err := g.encode(g.curve.Add(tx, ty, wx, wy))
+	if err != nil {
+		return nil, nil, err
+	}
+	return x, pub, nil
+}
+
+func (g nistGroup) result(w, x, pub []byte, kdc bool) ([]byte, error) {
+	sx, sy, err := g.point(pub)
+	if err != nil {
+		return nil, err
+	}
+	_, nb := g.constants(kdc)
+	nx, ny, err := g.point(nb)
+	if err != nil {
+		return nil, err
+	}
+	// S - w*N is S + w*(-N)
+	ny.Sub(g.curve.Params().P, ny)
+	wx, wy := g.curve.ScalarMult(nx, ny, w)
+	kx, ky := g.curve.Add(sx, sy, wx, wy)
+	k, err := g.encode(g.curve.ScalarMult(kx, ky, x))
+	if err != nil {
+		return nil, errors.New("SPAKE result is the identity element")
+	}
+	return k, nil
+}
+
+// point decodes a SEC 1 compressed point, rejecting encodings of values that are not on the curve.
+func (g nistGroup) point(b []byte) (*big.Int, *big.Int, error) {
+	x, y := elliptic.UnmarshalCompressed(g.curve, b)
+	if x == nil {
+		return nil, nil, errors.New("invalid SPAKE group element")
+	}
+	return x, y, nil
+}
+
+// encode returns the SEC 1 compressed encoding of the point, which must not be the identity.
+// The identity is represented by crypto/elliptic as (0, 0).
+func (g nistGroup) encode(x, y *big.Int) ([]byte, error) {
+	if x.Sign() == 0 && y.Sign() == 0 {
+		return nil, errors.New("cannot encode the identity element")
+	}
+	return elliptic.MarshalCompressed(g.curve, x, y), nil
+}
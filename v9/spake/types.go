@@ -0,0 +1,113 @@
+// Package spake implements the client side of SPAKE pre-authentication (PA-SPAKE) as specified in
+// draft-ietf-kitten-krb-spake-preauth and implemented by MIT Kerberos.
+package spake
+
+import (
+	"fmt"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/oiweiwei/gokrb5.fork/v9/krberror"
+	"github.com/oiweiwei/gokrb5.fork/v9/types"
+)
+
+// PA-SPAKE message choices.
+const (
+	MessageSupport   = 0
+	MessageChallenge = 1
+	MessageResponse  = 2
+	MessageEncData   = 3
+)
+
+// SecondFactorNone is the SF-NONE second factor type which provides no second factor.
+const SecondFactorNone int32 = 1
+
+// SPAKESupport implements the SPAKESupport message listing the groups supported by the client.
+type SPAKESupport struct {
+	Groups []int32 `asn1:"explicit,tag:0"`
+}
+
+// SPAKEChallenge implements the SPAKEChallenge message from the KDC.
+type SPAKEChallenge struct {
+	Group   int32               `asn1:"explicit,tag:0"`
+	PubKey  []byte              `asn1:"explicit,tag:1"`
+	Factors []SPAKESecondFactor `asn1:"explicit,tag:2"`
+}
+
+// SPAKESecondFactor implements the SPAKESecondFactor type.
+type SPAKESecondFactor struct {
+	Type int32  `asn1:"explicit,tag:0"`
+	Data []byte `asn1:"explicit,optional,tag:1"`
+}
+
+// SPAKEResponse implements the SPAKEResponse message from the client.
+type SPAKEResponse struct {
+	PubKey []byte              `asn1:"explicit,tag:0"`
+	Factor types.EncryptedData `asn1:"explicit,tag:1"`
+}
+
+// PASPAKE implements the PA-SPAKE CHOICE. Choice indicates which of the messages is present.
+type PASPAKE struct {
+	Choice    int
+	Support   SPAKESupport
+	Challenge SPAKEChallenge
+	Response  SPAKEResponse
+	EncData   types.EncryptedData
+}
+
+// Unmarshal bytes b into the PASPAKE struct.
+func (p *PASPAKE) Unmarshal(b []byte) error {
+	var c asn1.RawValue
+	_, err := asn1.Unmarshal(b, &c)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA-SPAKE")
+	}
+	if c.Class != asn1.ClassContextSpecific || !c.IsCompound {
+		return krberror.NewErrorf(krberror.EncodingError, "PA-SPAKE is not a valid choice")
+	}
+	var v interface{}
+	switch c.Tag {
+	case MessageSupport:
+		v = &p.Support
+	case MessageChallenge:
+		v = &p.Challenge
+	case MessageResponse:
+		v = &p.Response
+	case MessageEncData:
+		v = &p.EncData
+	default:
+		return krberror.NewErrorf(krberror.EncodingError, "PA-SPAKE choice %d not supported", c.Tag)
+	}
+	_, err = asn1.Unmarshal(c.Bytes, v)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA-SPAKE choice %d", c.Tag)
+	}
+	p.Choice = c.Tag
+	return nil
+}
+
+// Marshal the PASPAKE struct.
+func (p *PASPAKE) Marshal() ([]byte, error) {
+	var v interface{}
+	switch p.Choice {
+	case MessageSupport:
+		v = p.Support
+	case MessageChallenge:
+		v = p.Challenge
+	case MessageResponse:
+		v = p.Response
+	case MessageEncData:
+		v = p.EncData
+	default:
+		return nil, fmt.Errorf("PA-SPAKE choice %d not supported", p.Choice)
+	}
+	b, err := asn1.Marshal(v)
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.EncodingError, "error marshaling PA-SPAKE choice %d", p.Choice)
+	}
+	return asn1.Marshal(asn1.RawValue{
+		Class:      asn1.ClassContextSpecific,
+		IsCompound: true,
+		Tag:        p.Choice,
+		Bytes:      b,
+	})
+}
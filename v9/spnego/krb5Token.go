@@ -172,7 +172,8 @@ func NewKRB5TokenAPREQ(cl *client.Client, tkt messages.Ticket, sessionKey types.
 	if err != nil {
 		return m, err
 	}
-	APReq, err := messages.NewAPReq(
+	APReq, err := messages.NewAPReqWithRegistry(
+		cl.Config.EtypeRegistry(),
 		tkt,
 		sessionKey,
 		auth,
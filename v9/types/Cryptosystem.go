@@ -51,6 +51,11 @@ func (a *EncryptionKey) Unmarshal(b []byte) error {
 	return err
 }
 
+// Marshal the EncryptionKey.
+func (a *EncryptionKey) Marshal() ([]byte, error) {
+	return asn1.Marshal(*a)
+}
+
 // Unmarshal bytes into the Checksum.
 func (a *Checksum) Unmarshal(b []byte) error {
 	_, err := asn1.Unmarshal(b, a)
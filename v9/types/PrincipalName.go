@@ -23,6 +23,36 @@ func NewPrincipalName(ntype int32, spn string) PrincipalName {
 	}
 }
 
+// AnonymousRealm is the realm of the anonymous principal as defined in RFC 8062.
+const AnonymousRealm = "WELLKNOWN:ANONYMOUS"
+
+// NewAnonymousPrincipalName returns the well-known anonymous principal name WELLKNOWN/ANONYMOUS of RFC 8062.
+func NewAnonymousPrincipalName() PrincipalName {
+	return PrincipalName{
+		NameType:   nametype.KRB_NT_WELLKNOWN,
+		NameString: []string{"WELLKNOWN", "ANONYMOUS"},
+	}
+}
+
+// IsAnonymous indicates if the PrincipalName is the well-known anonymous principal name.
+func (pn PrincipalName) IsAnonymous() bool {
+	return pn.Equal(NewAnonymousPrincipalName())
+}
+
+// NewEnterprisePrincipalName returns the enterprise principal name (RFC 6806 section 5) for a name of the form
+// user@suffix, such as an Active Directory user principal name. The KDC maps it to the principal's canonical name.
+func NewEnterprisePrincipalName(name string) PrincipalName {
+	return PrincipalName{
+		NameType:   nametype.KRB_NT_ENTERPRISE,
+		NameString: []string{name},
+	}
+}
+
+// IsEnterprise indicates if the PrincipalName is an enterprise principal name.
+func (pn PrincipalName) IsEnterprise() bool {
+	return pn.NameType == nametype.KRB_NT_ENTERPRISE
+}
+
 // GetSalt returns a salt derived from the PrincipalName.
 func (pn PrincipalName) GetSalt(realm string) string {
 	var sb []byte
@@ -35,3 +35,12 @@ func TestParseSPNString(t *testing.T) {
 	assert.Equal(t, "www.example.com", pn.NameString[0], "second element of name string not as expected")
 
 }
+
+func TestNewEnterprisePrincipalName(t *testing.T) {
+	t.Parallel()
+	pn := NewEnterprisePrincipalName("user@upn.example.com")
+	assert.Equal(t, nametype.KRB_NT_ENTERPRISE, pn.NameType, "name type not as expected")
+	assert.Equal(t, []string{"user@upn.example.com"}, pn.NameString, "enterprise name should be a single component")
+	assert.True(t, pn.IsEnterprise(), "enterprise principal name not identified")
+	assert.False(t, NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "user").IsEnterprise(), "principal name identified as enterprise")
+}